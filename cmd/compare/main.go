@@ -0,0 +1,68 @@
+// Command compare prints how a concept is written in Go, Python and Java,
+// side by side, from site/go_syntax_comparison.csv:
+//
+//	go run ./cmd/compare "error handling"
+//	go run ./cmd/compare -lang go,python -width 100 loop
+//
+// Concept names are matched loosely, so "structs" or "fucntion" work.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"go-learning-guide/syntax"
+)
+
+func main() {
+	langs := flag.String("lang", "", "comma separated languages to show (default: all)")
+	width := flag.Int("width", terminalWidth(), "width of the output in columns")
+	list := flag.Bool("list", false, "list the concepts and exit")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: compare [flags] <concept>\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	table, err := syntax.Default()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Reading syntax comparison:", err)
+		os.Exit(1)
+	}
+	if *list {
+		fmt.Println(strings.Join(table.Concepts(), "\n"))
+		return
+	}
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var languages []string
+	if *langs != "" {
+		for _, name := range strings.Split(*langs, ",") {
+			lang, ok := table.Language(name)
+			if !ok {
+				fmt.Fprintf(os.Stderr, "Unknown language %q; the comparison has %s\n", name, strings.Join(table.Languages, ", "))
+				os.Exit(2)
+			}
+			languages = append(languages, lang)
+		}
+	}
+
+	if err := table.Compare(os.Stdout, strings.Join(flag.Args(), " "), languages, *width); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// terminalWidth uses $COLUMNS if the shell exports it
+func terminalWidth() int {
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		return n
+	}
+	return 120
+}
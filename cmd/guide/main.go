@@ -0,0 +1,101 @@
+// Command guide serves the interactive learning guide and the user API
+// from one binary. The site's files are embedded (see package site), so
+// the binary is the whole deployment:
+//
+//	go build -o guide ./cmd/guide
+//	./guide -addr :8080 -data /var/lib/guide/users
+//
+// Checking coding challenges compiles and runs the submitted code on the
+// server, so it is off unless started with -code-runs.
+//
+// People signing in to the guide need their key to sync progress and
+// record quiz answers; print one with
+//
+//	./guide -data /var/lib/guide/users -user-key 3
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"go-learning-guide/examples/apiserver"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "address to listen on")
+	dataDir := flag.String("data", "data/users", "directory for the user log and snapshots (empty: memory only)")
+	keyFor := flag.Int("user-key", 0, "print the sign-in key of the user with this ID and exit")
+	codeRuns := flag.Bool("code-runs", false, "compile and run solutions to coding challenges on this machine")
+	flag.Parse()
+
+	if *keyFor != 0 {
+		if *dataDir == "" {
+			log.Fatal("-user-key needs -data: keys of a memory-only store change with every start")
+		}
+		key, err := apiserver.UserKeyIn(*dataDir, *keyFor)
+		if err != nil {
+			log.Fatal("Reading the store's secret: ", err)
+		}
+		fmt.Println(key)
+		return
+	}
+
+	store := apiserver.NewUserStore()
+	if *dataDir != "" {
+		var err error
+		if store, err = apiserver.OpenUserStore(*dataDir, apiserver.PersistOptions{}); err != nil {
+			log.Fatal("Opening user store: ", err)
+		}
+		log.Printf("Users are stored in %s", *dataDir)
+	}
+
+	// The API server routes everything outside /api/ to the embedded site
+	api := apiserver.NewAPIServerWithStore(store)
+	if *codeRuns {
+		api.EnableCodeRuns()
+		log.Println("Solutions to coding challenges are run on this machine")
+	}
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           api,
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+		// No WriteTimeout: event streams and WebSockets stay open, and
+		// the API sets its own per-route timeouts
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		log.Printf("Learning guide on http://localhost%s/ (API under /api/)", *addr)
+		errc <- server.ListenAndServe()
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	select {
+	case err := <-errc:
+		if !errors.Is(err, http.ErrServerClosed) {
+			store.Close()
+			log.Fatal("Server failed: ", err)
+		}
+	case <-stop:
+		log.Println("Shutting down...")
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Printf("Shutdown: %v", err)
+		}
+	}
+
+	if err := store.Close(); err != nil {
+		log.Printf("Closing user store: %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+// Command roadmap prints the learning path from
+// site/golang_learning_roadmap.csv, with the time estimate of each stage
+// added up from its topics. With -readme it rewrites the learning path
+// section of the README instead (see go generate in package roadmap).
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"go-learning-guide/roadmap"
+)
+
+func main() {
+	readme := flag.String("readme", "", "rewrite the learning path in this README instead of printing it")
+	flag.Parse()
+
+	rm, err := roadmap.Default()
+	if err != nil {
+		log.Fatal("Reading roadmap: ", err)
+	}
+	if *readme == "" {
+		fmt.Print(rm.Markdown())
+		return
+	}
+
+	content, err := os.ReadFile(*readme)
+	if err != nil {
+		log.Fatal(err)
+	}
+	updated, err := roadmap.ReplaceSection(content, rm.Markdown())
+	if err != nil {
+		log.Fatalf("%s: %v", *readme, err)
+	}
+	if bytes.Equal(updated, content) {
+		return
+	}
+	if err := os.WriteFile(*readme, updated, 0o644); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Updated the learning path in %s", *readme)
+}
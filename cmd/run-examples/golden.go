@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// A golden file is an example's expected output, line by line, with
+// three additions for output that isn't the same from run to run:
+//
+//   - {{regexp}} inside a line matches whatever the regexp matches, for
+//     values such as timings: "took {{[0-9.]+}}ms"
+//   - the lines between #unordered and #end may come in any order, for
+//     goroutines racing to print and for map iteration
+//   - the lines between #repeat and #end must come one or more times,
+//     for loops that run for a while rather than a fixed count
+//
+// Trailing spaces are ignored on both sides.
+
+const (
+	directiveUnordered = "#unordered"
+	directiveRepeat    = "#repeat"
+	directiveEnd       = "#end"
+)
+
+type blockKind int
+
+const (
+	inOrder blockKind = iota
+	unordered
+	repeated
+)
+
+// block is a run of golden lines matched the same way
+type block struct {
+	kind  blockKind
+	start int // golden line number of the first line
+	lines []pattern
+}
+
+// pattern is one golden line
+type pattern struct {
+	text string
+	re   *regexp.Regexp // nil for plain text
+}
+
+func (p pattern) match(line string) bool {
+	if p.re == nil {
+		return p.text == line
+	}
+	return p.re.MatchString(line)
+}
+
+// golden is a parsed golden file
+type golden struct {
+	blocks []block
+}
+
+// parseGolden reads a golden file
+func parseGolden(data []byte) (*golden, error) {
+	g := &golden{}
+	var open *block // the #unordered or #repeat block being read
+	for i, line := range splitLines(data) {
+		n := i + 1
+		switch line {
+		case directiveUnordered, directiveRepeat:
+			if open != nil {
+				return nil, fmt.Errorf("line %d: %s inside a block started at line %d", n, line, open.start-1)
+			}
+			kind := unordered
+			if line == directiveRepeat {
+				kind = repeated
+			}
+			open = &block{kind: kind, start: n + 1}
+			continue
+		case directiveEnd:
+			if open == nil {
+				return nil, fmt.Errorf("line %d: %s without a block", n, line)
+			}
+			if len(open.lines) == 0 {
+				return nil, fmt.Errorf("line %d: empty block", n)
+			}
+			g.blocks = append(g.blocks, *open)
+			open = nil
+			continue
+		}
+
+		p, err := compilePattern(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		if open != nil {
+			open.lines = append(open.lines, p)
+			continue
+		}
+		// Consecutive in-order lines share a block
+		if last := len(g.blocks) - 1; last >= 0 && g.blocks[last].kind == inOrder {
+			g.blocks[last].lines = append(g.blocks[last].lines, p)
+		} else {
+			g.blocks = append(g.blocks, block{kind: inOrder, start: n, lines: []pattern{p}})
+		}
+	}
+	if open != nil {
+		return nil, fmt.Errorf("block started at line %d has no %s", open.start-1, directiveEnd)
+	}
+	return g, nil
+}
+
+// compilePattern turns a golden line with {{regexp}} holes into a
+// regexp matching the whole line
+func compilePattern(line string) (pattern, error) {
+	if !strings.Contains(line, "{{") {
+		return pattern{text: line}, nil
+	}
+	var expr strings.Builder
+	expr.WriteString("^")
+	rest := line
+	for {
+		open := strings.Index(rest, "{{")
+		if open < 0 {
+			break
+		}
+		end := strings.Index(rest[open+2:], "}}")
+		if end < 0 {
+			return pattern{}, fmt.Errorf("unclosed {{ in %q", line)
+		}
+		// A regexp may end in a brace, as in {{[0-9]{4}}}
+		for open+2+end+2 < len(rest) && rest[open+2+end+2] == '}' {
+			end++
+		}
+		expr.WriteString(regexp.QuoteMeta(rest[:open]))
+		expr.WriteString("(?:" + rest[open+2:open+2+end] + ")")
+		rest = rest[open+2+end+2:]
+	}
+	expr.WriteString(regexp.QuoteMeta(rest))
+	expr.WriteString("$")
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return pattern{}, fmt.Errorf("bad pattern %q: %v", line, err)
+	}
+	return pattern{text: line, re: re}, nil
+}
+
+// drift is where the output stopped matching the golden file
+type drift struct {
+	goldenLine int    // 0 past the end of the golden file
+	outputLine int    // 0 past the end of the output
+	want       string // the golden line, or a description of the block
+	got        string
+}
+
+func (d *drift) Error() string {
+	switch {
+	case d.outputLine == 0:
+		return fmt.Sprintf("golden line %d: output ended, want %q", d.goldenLine, d.want)
+	case d.goldenLine == 0:
+		return fmt.Sprintf("output line %d: unexpected %q after the end of the golden file", d.outputLine, d.got)
+	}
+	return fmt.Sprintf("output line %d: got %q, want %q (golden line %d)", d.outputLine, d.got, d.want, d.goldenLine)
+}
+
+// match compares output with the golden file, returning a *drift at the
+// first difference
+func (g *golden) match(output []string) error {
+	pos := 0
+	for _, b := range g.blocks {
+		var err error
+		switch b.kind {
+		case inOrder:
+			pos, err = matchInOrder(b, output, pos)
+		case unordered:
+			pos, err = matchUnordered(b, output, pos)
+		case repeated:
+			pos, err = matchRepeated(b, output, pos)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if pos < len(output) {
+		return &drift{outputLine: pos + 1, got: output[pos]}
+	}
+	return nil
+}
+
+func matchInOrder(b block, output []string, pos int) (int, error) {
+	for i, p := range b.lines {
+		if pos >= len(output) {
+			return pos, &drift{goldenLine: b.start + i, want: p.text}
+		}
+		if !p.match(output[pos]) {
+			return pos, &drift{goldenLine: b.start + i, outputLine: pos + 1, want: p.text, got: output[pos]}
+		}
+		pos++
+	}
+	return pos, nil
+}
+
+// matchUnordered pairs the next len(b.lines) output lines with the
+// block's patterns. Patterns may overlap ("Worker {{\d}} done" and
+// "Worker 1 done"), so it looks for a full matching rather than taking
+// the first pattern that fits.
+func matchUnordered(b block, output []string, pos int) (int, error) {
+	n := len(b.lines)
+	if pos+n > len(output) {
+		return pos, &drift{goldenLine: b.start, want: fmt.Sprintf("%d unordered lines", n)}
+	}
+	lines := output[pos : pos+n]
+
+	// owner[p] is the output line assigned to pattern p, or -1
+	owner := make([]int, n)
+	for i := range owner {
+		owner[i] = -1
+	}
+	var assign func(line int, seen []bool) bool
+	assign = func(line int, seen []bool) bool {
+		for p := range b.lines {
+			if seen[p] || !b.lines[p].match(lines[line]) {
+				continue
+			}
+			seen[p] = true
+			if owner[p] < 0 || assign(owner[p], seen) {
+				owner[p] = line
+				return true
+			}
+		}
+		return false
+	}
+	for line := range lines {
+		if !assign(line, make([]bool, n)) {
+			return pos, &drift{
+				goldenLine: b.start,
+				outputLine: pos + line + 1,
+				want:       fmt.Sprintf("one of the %d unordered lines", n),
+				got:        lines[line],
+			}
+		}
+	}
+	return pos + n, nil
+}
+
+func matchRepeated(b block, output []string, pos int) (int, error) {
+	// The first time through is required
+	pos, err := matchInOrder(b, output, pos)
+	if err != nil {
+		return pos, err
+	}
+	for {
+		next, err := matchInOrder(b, output, pos)
+		if err != nil {
+			return pos, nil
+		}
+		pos = next
+	}
+}
+
+// splitLines splits output into lines without their line endings and
+// trailing spaces. A final newline doesn't start another line.
+func splitLines(data []byte) []string {
+	data = bytes.TrimSuffix(data, []byte("\n"))
+	if len(data) == 0 {
+		return nil
+	}
+	lines := strings.Split(string(data), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t\r")
+	}
+	return lines
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestGoldenMatch(t *testing.T) {
+	const golden = `start
+#unordered
+worker {{[0-9]}} done
+worker 1 done
+#end
+took {{[0-9]+}}ms
+#repeat
+tick
+#end
+digits {{[0-9]{3}}}
+end
+`
+	tests := []struct {
+		name   string
+		output string
+		ok     bool
+	}{
+		{"in order", "start\nworker 1 done\nworker 2 done\ntook 12ms\ntick\ndigits 123\nend\n", true},
+		{"swapped", "start\nworker 2 done\nworker 1 done\ntook 7ms\ntick\ntick\ntick\ndigits 123\nend", true},
+		{"trailing spaces", "start  \nworker 1 done\nworker 2 done\ntook 12ms \ntick\ndigits 123\nend\n", true},
+		{"both general", "start\nworker 2 done\nworker 3 done\ntook 12ms\ntick\ndigits 123\nend\n", false},
+		{"masked value", "start\nworker 1 done\nworker 2 done\ntook 1.5s\ntick\ndigits 123\nend\n", false},
+		{"no repeat", "start\nworker 1 done\nworker 2 done\ntook 12ms\ndigits 123\nend\n", false},
+		{"brace in regexp", "start\nworker 1 done\nworker 2 done\ntook 12ms\ntick\ndigits 12\nend\n", false},
+		{"extra line", "start\nworker 1 done\nworker 2 done\ntook 12ms\ntick\ndigits 123\nend\nmore\n", false},
+		{"short", "start\nworker 1 done\n", false},
+		{"empty", "", false},
+	}
+
+	g, err := parseGolden([]byte(golden))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := g.match(splitLines([]byte(tt.output)))
+			if tt.ok && err != nil {
+				t.Errorf("unexpected drift: %v", err)
+			}
+			if !tt.ok {
+				var d *drift
+				if !errors.As(err, &d) {
+					t.Errorf("got %v, want a drift", err)
+				}
+			}
+		})
+	}
+}
+
+func TestGoldenDriftPosition(t *testing.T) {
+	g, err := parseGolden([]byte("a\nb\nc\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = g.match([]string{"a", "x", "c"})
+	var d *drift
+	if !errors.As(err, &d) {
+		t.Fatalf("got %v, want a drift", err)
+	}
+	if d.goldenLine != 2 || d.outputLine != 2 || d.want != "b" || d.got != "x" {
+		t.Errorf("got %+v, want golden line 2 and output line 2, b vs x", *d)
+	}
+}
+
+func TestParseGoldenErrors(t *testing.T) {
+	for _, golden := range []string{
+		"#unordered\na\n",
+		"a\n#end\n",
+		"#repeat\n#end\n",
+		"#unordered\n#repeat\na\n#end\n#end\n",
+		"bad {{[}}\n",
+		"open {{ only\n",
+	} {
+		if _, err := parseGolden([]byte(golden)); err == nil {
+			t.Errorf("parseGolden(%q) succeeded", golden)
+		} else if !strings.Contains(err.Error(), "line") && !strings.Contains(err.Error(), "#end") {
+			t.Errorf("parseGolden(%q): %v does not say where", golden, err)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+// Command run-examples builds every program in examples/ on its own,
+// runs it with a timeout and compares what it prints with its golden
+// file, examples/testdata/<name>.golden, so the sample output in the
+// README and the guide stays honest:
+//
+//	go run ./cmd/run-examples                  # check every example
+//	go run ./cmd/run-examples -run collections # only the matching ones
+//	go run ./cmd/run-examples -update          # rewrite drifted golden files
+//
+// The examples share a directory and each declares package main, so
+// they can't be built as one package; each file is built by itself, as
+// "go run examples/<name>.go" does. Run it from the repository root. It
+// exits with status 1 if any example fails to build, fails to run or
+// has drifted from its golden file.
+//
+// Output that changes from run to run, such as goroutines racing to
+// print, is marked in the golden file (see golden.go). -update writes
+// the output as it is, so those marks have to be put back by hand.
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// example is how to run one program in examples/
+type example struct {
+	File    string
+	Args    []string
+	Stdin   string
+	Timeout time.Duration // 0 means the -timeout flag
+	Skip    string        // why it isn't run, if it isn't
+}
+
+// examples lists every program in examples/. A new example must be added
+// here, with a golden file, or run-examples reports it.
+var examples = []example{
+	{File: "basic_types.go"},
+	{File: "collections.go"},
+	{File: "concurrency_patterns.go"},
+	{File: "todo_cli.go", Stdin: "list\nquit\n"},
+	{
+		// Each example runs in its own temporary directory, so the
+		// default -data directory starts out empty
+		File:  "user_admin.go",
+		Args:  []string{"import", "-format", "csv", "-"},
+		Stdin: "name,email\nAda Lovelace,ada@example.com\nGrace Hopper,grace@example.com\n",
+	},
+	{File: "web_server.go", Skip: "serves until stopped; go test ./examples/apiserver covers it"},
+}
+
+// Outcomes, as reported
+const (
+	statusOK    = "ok"
+	statusDrift = "DRIFT"
+	statusFail  = "FAIL"
+	statusSkip  = "skip"
+	statusNew   = "new"
+)
+
+func main() {
+	dir := flag.String("dir", "examples", "directory holding the examples")
+	run := flag.String("run", "", "only run examples whose file name matches this regexp")
+	update := flag.Bool("update", false, "write the output of drifted examples to their golden files")
+	timeout := flag.Duration("timeout", 30*time.Second, "how long an example may run")
+	flag.Parse()
+
+	filter, err := regexp.Compile(*run)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "run-examples: -run:", err)
+		os.Exit(2)
+	}
+	if err := checkListed(*dir); err != nil {
+		fmt.Fprintln(os.Stderr, "run-examples:", err)
+		os.Exit(1)
+	}
+
+	bin, err := os.MkdirTemp("", "run-examples")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "run-examples:", err)
+		os.Exit(1)
+	}
+	defer os.RemoveAll(bin)
+
+	failed := false
+	for _, ex := range examples {
+		if !filter.MatchString(ex.File) {
+			continue
+		}
+		if ex.Timeout == 0 {
+			ex.Timeout = *timeout
+		}
+		start := time.Now()
+		status, detail := check(ex, *dir, bin, *update)
+		fmt.Println(strings.TrimSpace(fmt.Sprintf("%-5s %-26s %s", status, ex.File, elapsed(status, start))))
+		if detail != "" {
+			fmt.Println(indent(detail))
+		}
+		if status == statusDrift || status == statusFail {
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// checkListed reports programs in dir that examples doesn't mention
+func checkListed(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no examples in %s; run from the repository root", dir)
+	}
+	listed := make(map[string]bool)
+	for _, ex := range examples {
+		listed[ex.File] = true
+	}
+	var missing []string
+	for _, f := range files {
+		name := filepath.Base(f)
+		if !strings.HasSuffix(name, "_test.go") && !listed[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("add %s to the examples list in cmd/run-examples", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// check builds, runs and compares one example
+func check(ex example, dir, bin string, update bool) (status, detail string) {
+	if ex.Skip != "" {
+		return statusSkip, ex.Skip
+	}
+	name := strings.TrimSuffix(ex.File, ".go")
+	exe := filepath.Join(bin, name)
+
+	build := exec.Command("go", "build", "-o", exe, filepath.Join(dir, ex.File))
+	if out, err := build.CombinedOutput(); err != nil {
+		return statusFail, fmt.Sprintf("build: %v\n%s", err, out)
+	}
+
+	stdout, err := runExample(ex, exe)
+	if err != nil {
+		return statusFail, err.Error()
+	}
+
+	goldenPath := filepath.Join(dir, "testdata", name+".golden")
+	want, err := os.ReadFile(goldenPath)
+	if errors.Is(err, os.ErrNotExist) {
+		if !update {
+			return statusFail, fmt.Sprintf("no golden file %s; run with -update to create it", goldenPath)
+		}
+		if err := writeGolden(goldenPath, stdout); err != nil {
+			return statusFail, err.Error()
+		}
+		return statusNew, "wrote " + goldenPath
+	}
+	if err != nil {
+		return statusFail, err.Error()
+	}
+
+	g, err := parseGolden(want)
+	if err != nil {
+		return statusFail, fmt.Sprintf("%s: %v", goldenPath, err)
+	}
+	mismatch := g.match(splitLines(stdout))
+	if mismatch == nil {
+		return statusOK, ""
+	}
+	if update {
+		if err := writeGolden(goldenPath, stdout); err != nil {
+			return statusFail, err.Error()
+		}
+		return statusDrift, fmt.Sprintf("%v\nrewrote %s; mark the lines that vary between runs again", mismatch, goldenPath)
+	}
+	return statusDrift, mismatch.Error()
+}
+
+// runExample runs a built example in a temporary directory of its own
+// and returns what it printed to stdout
+func runExample(ex example, exe string) ([]byte, error) {
+	work, err := os.MkdirTemp("", "example")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(work)
+
+	ctx, cancel := context.WithTimeout(context.Background(), ex.Timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, exe, ex.Args...)
+	cmd.Dir = work
+	cmd.Stdin = strings.NewReader(ex.Stdin)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	cmd.WaitDelay = time.Second
+
+	err = cmd.Run()
+	switch {
+	case ctx.Err() != nil:
+		return nil, fmt.Errorf("still running after %v\n%s", ex.Timeout, tail(stdout.Bytes(), 10))
+	case err != nil:
+		return nil, fmt.Errorf("%v\n%s", err, tail(stderr.Bytes(), 10))
+	}
+	return stdout.Bytes(), nil
+}
+
+func writeGolden(path string, output []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	lines := splitLines(output)
+	return os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o644)
+}
+
+// tail returns the last n lines of output, to show where a run got to
+func tail(output []byte, n int) string {
+	lines := splitLines(output)
+	if len(lines) > n {
+		lines = append([]string{"..."}, lines[len(lines)-n:]...)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func indent(s string) string {
+	s = strings.TrimRight(s, "\n")
+	return "      " + strings.ReplaceAll(s, "\n", "\n      ")
+}
+
+func elapsed(status string, start time.Time) string {
+	if status == statusSkip {
+		return ""
+	}
+	return time.Since(start).Round(10 * time.Millisecond).String()
+}
@@ -0,0 +1,128 @@
+package apiserver
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// User keys. The guide has no passwords, but changes made in someone's
+// name (their progress, their recorded quiz answers, their chat
+// messages) need their key:
+//
+//	Authorization: Bearer <key>
+//
+// Browsers can't add headers to a WebSocket handshake, so those may send
+// it as the access_token query parameter instead.
+//
+// Whoever runs the server hands the keys out (guide -user-key ID). A
+// key is an HMAC of the user ID under a secret the store keeps, so keys
+// need no storage, and those of a persistent store survive restarts.
+// An in-memory store makes up a new secret each time it starts.
+
+const (
+	secretFileName = "secret.key"
+	secretBytes    = 32
+)
+
+// newSecret returns a fresh random secret
+func newSecret() []byte {
+	secret := make([]byte, secretBytes)
+	if _, err := rand.Read(secret); err != nil {
+		panic(fmt.Errorf("apiserver: generating secret: %w", err)) // never happens on supported platforms
+	}
+	return secret
+}
+
+// loadSecret reads the store's secret from dir, creating it the first
+// time. Only the owner may read it: anyone who can mints every key.
+func loadSecret(dir string) ([]byte, error) {
+	path := filepath.Join(dir, secretFileName)
+	secret, err := os.ReadFile(path)
+	if err == nil {
+		if len(secret) != secretBytes {
+			return nil, fmt.Errorf("%s: want %d bytes, got %d", path, secretBytes, len(secret))
+		}
+		return secret, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	secret = newSecret()
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(secret); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	return secret, syncDir(dir)
+}
+
+func userKey(secret []byte, id int) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("user:" + strconv.Itoa(id)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// UserKey returns the key that lets a client act as the user with the
+// given ID
+func (s *UserStore) UserKey(id int) string {
+	return userKey(s.secret, id)
+}
+
+// UserKeyIn returns a user's key for the persistent store in dir,
+// without opening the store, so it works while a server has it open
+func UserKeyIn(dir string, id int) (string, error) {
+	secret, err := loadSecret(dir)
+	if err != nil {
+		return "", err
+	}
+	return userKey(secret, id), nil
+}
+
+// checkUserKey reports whether key is the user's, in constant time
+func (s *UserStore) checkUserKey(id int, key string) bool {
+	return hmac.Equal([]byte(key), []byte(s.UserKey(id)))
+}
+
+// requestKey returns the user key r carries, if any
+func requestKey(r *http.Request) (string, bool) {
+	if key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(key), true
+	}
+	if headerContainsToken(r.Header, "Upgrade", "websocket") && r.URL.Query().Has("access_token") {
+		return r.URL.Query().Get("access_token"), true
+	}
+	return "", false
+}
+
+// authorizeUser reports whether r carries the key of the user with the
+// given ID, and writes a 401 response if not
+func (s *APIServer) authorizeUser(w http.ResponseWriter, r *http.Request, id int) bool {
+	key, ok := requestKey(r)
+	if ok && s.store.checkUserKey(id, key) {
+		return true
+	}
+	w.Header().Set("WWW-Authenticate", `Bearer realm="guide"`)
+	s.writeError(w, r, http.StatusUnauthorized, "Unauthorized",
+		fmt.Sprintf("Send user %d's key as Authorization: Bearer <key>", id))
+	return false
+}
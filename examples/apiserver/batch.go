@@ -0,0 +1,422 @@
+package apiserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+)
+
+// Batch operation kinds
+const (
+	BatchCreate = "create"
+	BatchUpdate = "update"
+	BatchDelete = "delete"
+)
+
+// Batch modes, selected with ?mode=
+const (
+	BatchAtomic     = "atomic"      // all operations succeed or none are applied
+	BatchBestEffort = "best-effort" // apply what succeeds, report the rest
+)
+
+// Batch limits
+const (
+	maxBatchOps       = 100000           // operations per atomic batch
+	maxBatchBodyBytes = 64 << 20         // request body size
+	batchChunkSize    = 1000             // ops per store lock for best-effort NDJSON
+	maxListedResults  = 1000             // successes, and failures, listed for NDJSON
+	batchTimeout      = 60 * time.Second // longer than defaultRouteTimeout for big imports
+)
+
+// BatchOp is one create, update or delete in a batch
+type BatchOp struct {
+	Op    string `json:"op"`
+	ID    int    `json:"id,omitempty"`
+	Name  string `json:"name,omitempty"`
+	Email string `json:"email,omitempty"`
+}
+
+// BatchRequest is the application/json body for POST /users:batch.
+// NDJSON uploads send one BatchOp per line instead.
+type BatchRequest struct {
+	Operations []BatchOp `json:"operations"`
+}
+
+// BatchItemResult reports what happened to one operation
+type BatchItemResult struct {
+	Index  int             `json:"index"`
+	Op     string          `json:"op"`
+	Status int             `json:"status"`
+	User   *User           `json:"user,omitempty"`
+	Error  *ProblemDetails `json:"error,omitempty"`
+}
+
+// BatchResponse summarises a batch
+type BatchResponse struct {
+	Mode      string            `json:"mode"`
+	Committed bool              `json:"committed"`
+	Succeeded int               `json:"succeeded"`
+	Failed    int               `json:"failed"`
+	Results   []BatchItemResult `json:"results"`
+	// Omitted counts results left out of an NDJSON batch's Results,
+	// which lists the first maxListedResults successes and failures
+	Omitted int `json:"omitted,omitempty"`
+
+	capped bool // list at most maxListedResults of each
+	listed [2]int
+}
+
+// add records the result of one operation
+func (b *BatchResponse) add(result BatchItemResult) {
+	failed := 0
+	if result.Error != nil {
+		b.Failed++
+		failed = 1
+	} else {
+		b.Succeeded++
+	}
+	if b.capped && b.listed[failed] == maxListedResults {
+		b.Omitted++
+		return
+	}
+	b.listed[failed]++
+	b.Results = append(b.Results, result)
+}
+
+// Errors reported per operation by ApplyBatch
+var (
+	ErrUserNotFound = errors.New("user not found")
+	ErrUnknownOp    = errors.New("unknown operation")
+	ErrNotApplied   = errors.New("not applied because another operation in the atomic batch failed")
+)
+
+// ValidationError lists the fields of an operation that were rejected
+type ValidationError struct {
+	Params []InvalidParam
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%d invalid field(s)", len(e.Params))
+}
+
+// BatchOutcome is the store-level result of one operation
+type BatchOutcome struct {
+	User *User // the user after the operation (before it, for deletes)
+	Err  error
+}
+
+// ApplyBatch runs the operations in order while holding the store lock
+// once. Later operations see the effects of earlier ones, so a batch can
+// create a user and then update it. In atomic mode nothing is applied
+// unless every operation succeeds; otherwise each successful operation
+// is kept. Events are published only for committed changes.
+func (s *UserStore) ApplyBatch(ops []BatchOp, atomic bool) (outcomes []BatchOutcome, committed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Stage changes in an overlay: a nil entry means deleted
+	staged := make(map[int]*User)
+	lookup := func(id int) (*User, bool) {
+		if u, ok := staged[id]; ok {
+			return u, u != nil
+		}
+		u, ok := s.users[id]
+		return u, ok
+	}
+
+	type change struct {
+		event string
+		user  User
+	}
+	var changes []change
+	nextID := s.nextID
+	failed := false
+
+	outcomes = make([]BatchOutcome, len(ops))
+	for i, op := range ops {
+		switch op.Op {
+		case BatchCreate:
+			if invalid := validateNewUser(op.Name, op.Email); len(invalid) > 0 {
+				outcomes[i].Err = &ValidationError{Params: invalid}
+				break
+			}
+			now := time.Now()
+			user := &User{ID: nextID, Name: op.Name, Email: op.Email, CreatedAt: now, UpdatedAt: now}
+			nextID++
+			staged[user.ID] = user
+			outcomes[i].User = user
+			changes = append(changes, change{UserCreated, *user})
+
+		case BatchUpdate:
+			current, ok := lookup(op.ID)
+			if !ok {
+				outcomes[i].Err = ErrUserNotFound
+				break
+			}
+			updated := *current // copy so a rollback leaves the original alone
+			if op.Name != "" {
+				updated.Name, updated.LastName = op.Name, nil
+			}
+			if op.Email != "" {
+				updated.Email = op.Email
+			}
+			updated.UpdatedAt = time.Now()
+			staged[op.ID] = &updated
+			outcomes[i].User = &updated
+			changes = append(changes, change{UserUpdated, updated})
+
+		case BatchDelete:
+			current, ok := lookup(op.ID)
+			if !ok {
+				outcomes[i].Err = ErrUserNotFound
+				break
+			}
+			staged[op.ID] = nil
+			outcomes[i].User = current
+			changes = append(changes, change{UserDeleted, *current})
+
+		default:
+			outcomes[i].Err = ErrUnknownOp
+		}
+
+		if outcomes[i].Err != nil {
+			failed = true
+		}
+	}
+
+	if atomic && failed {
+		for i := range outcomes {
+			if outcomes[i].Err == nil {
+				outcomes[i] = BatchOutcome{Err: ErrNotApplied}
+			}
+		}
+		return outcomes, false
+	}
+
+	// Log the whole batch as one record so recovery never sees half of it
+	logged := make([]walOp, len(changes))
+	for i, c := range changes {
+		logged[i] = walOp{Op: walPut, User: c.user}
+		if c.event == UserDeleted {
+			logged[i] = walOp{Op: walDelete, User: User{ID: c.user.ID}}
+		}
+	}
+	if len(logged) > 0 {
+		s.logLocked(logged...)
+		s.commitLocked()
+	}
+
+	// Commit. Updates replace the stored struct in place so pointers
+	// handed out earlier by GetUser see the change, as with UpdateUser.
+	for id, user := range staged {
+		switch existing, ok := s.users[id]; {
+		case user == nil:
+			delete(s.users, id)
+			delete(s.progress, id)
+			delete(s.quiz, id)
+		case ok:
+			*existing = *user
+		default:
+			s.users[id] = user
+		}
+	}
+	s.nextID = nextID
+	for _, c := range changes {
+		s.events.publish(c.event, c.user)
+	}
+	return outcomes, true
+}
+
+// handleBatchUsers applies many creates, updates and deletes in one
+// request. Bodies are either a BatchRequest (application/json) or one
+// BatchOp per line (application/x-ndjson) for very large imports.
+func (s *APIServer) handleBatchUsers(w http.ResponseWriter, r *http.Request) {
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = BatchAtomic
+	}
+	if mode != BatchAtomic && mode != BatchBestEffort {
+		s.writeError(w, r, http.StatusBadRequest, "Invalid batch mode",
+			fmt.Sprintf("mode must be %q or %q", BatchAtomic, BatchBestEffort))
+		return
+	}
+	atomic := mode == BatchAtomic
+
+	body := http.MaxBytesReader(w, r.Body, maxBatchBodyBytes)
+	response := BatchResponse{Mode: mode, Committed: true, Results: []BatchItemResult{}}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "", "application/json":
+		var req BatchRequest
+		if err := json.NewDecoder(body).Decode(&req); err != nil {
+			if isTooLarge(err) {
+				s.writeBodyTooLarge(w, r)
+				return
+			}
+			s.writeError(w, r, http.StatusBadRequest, "Invalid JSON", err.Error())
+			return
+		}
+		if len(req.Operations) > maxBatchOps {
+			s.writeError(w, r, http.StatusRequestEntityTooLarge, "Batch too large",
+				fmt.Sprintf("A batch may contain at most %d operations", maxBatchOps))
+			return
+		}
+		s.applyBatchChunk(&response, req.Operations, 0, atomic)
+
+	case "application/x-ndjson":
+		response.capped = true
+		if !s.applyNDJSONBatch(w, r, body, &response, atomic) {
+			return
+		}
+
+	default:
+		s.writeError(w, r, http.StatusUnsupportedMediaType, "Unsupported media type",
+			"Send application/json or application/x-ndjson")
+		return
+	}
+
+	status := http.StatusOK
+	if !response.Committed {
+		status = http.StatusUnprocessableEntity
+	}
+	s.writeJSON(w, status, response)
+}
+
+// applyNDJSONBatch reads one operation per line. Best-effort batches
+// are applied every batchChunkSize operations, so only one chunk of
+// operations is held at a time, and the response lists a bounded number
+// of results; atomic batches must be read completely first. It reports
+// false if an error response has already been written.
+func (s *APIServer) applyNDJSONBatch(w http.ResponseWriter, r *http.Request, body io.Reader, response *BatchResponse, atomic bool) bool {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var chunk []BatchOp
+	var chunkStart, index int
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		var op BatchOp
+		if err := json.Unmarshal(text, &op); err != nil {
+			if atomic {
+				s.writeError(w, r, http.StatusBadRequest, "Invalid JSON", fmt.Sprintf("line %d: %v", line, err))
+				return false
+			}
+			// Keep going; the line is reported as a failed item
+			s.applyBatchChunk(response, chunk, chunkStart, atomic)
+			response.add(BatchItemResult{
+				Index:  index,
+				Status: http.StatusBadRequest,
+				Error: &ProblemDetails{
+					Type:   problemType("Invalid JSON"),
+					Title:  "Invalid JSON",
+					Status: http.StatusBadRequest,
+					Detail: fmt.Sprintf("line %d: %v", line, err),
+				},
+			})
+			index++
+			chunk, chunkStart = nil, index
+			continue
+		}
+
+		chunk = append(chunk, op)
+		index++
+		if atomic && len(chunk) > maxBatchOps {
+			s.writeError(w, r, http.StatusRequestEntityTooLarge, "Batch too large",
+				fmt.Sprintf("An atomic batch may contain at most %d operations; use mode=%s", maxBatchOps, BatchBestEffort))
+			return false
+		}
+		if !atomic && len(chunk) == batchChunkSize {
+			s.applyBatchChunk(response, chunk, chunkStart, atomic)
+			chunk, chunkStart = nil, index
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		if isTooLarge(err) {
+			s.writeBodyTooLarge(w, r)
+			return false
+		}
+		// In best-effort mode earlier chunks are already applied; say so
+		detail := err.Error()
+		if !atomic && index > 0 {
+			detail = fmt.Sprintf("%s (the first %d operations were processed)", detail, chunkStart)
+		}
+		s.writeError(w, r, http.StatusBadRequest, "Invalid request body", detail)
+		return false
+	}
+
+	s.applyBatchChunk(response, chunk, chunkStart, atomic)
+	return true
+}
+
+// applyBatchChunk applies ops (numbered from offset) and appends their results
+func (s *APIServer) applyBatchChunk(response *BatchResponse, ops []BatchOp, offset int, atomic bool) {
+	if len(ops) == 0 {
+		return
+	}
+
+	outcomes, committed := s.store.ApplyBatch(ops, atomic)
+	if !committed {
+		response.Committed = false
+	}
+
+	for i, outcome := range outcomes {
+		result := BatchItemResult{Index: offset + i, Op: ops[i].Op, User: outcome.User}
+		if outcome.Err != nil {
+			result.User = nil
+			result.Error = batchProblem(outcome.Err)
+			result.Status = result.Error.Status
+		} else {
+			result.Status = http.StatusOK
+			if ops[i].Op == BatchCreate {
+				result.Status = http.StatusCreated
+			}
+		}
+		response.add(result)
+	}
+}
+
+// isTooLarge reports whether reading a body failed at its size limit
+func isTooLarge(err error) bool {
+	var tooLarge *http.MaxBytesError
+	return errors.As(err, &tooLarge)
+}
+
+func (s *APIServer) writeBodyTooLarge(w http.ResponseWriter, r *http.Request) {
+	s.writeError(w, r, http.StatusRequestEntityTooLarge, "Batch too large",
+		fmt.Sprintf("A batch body may be at most %d bytes", maxBatchBodyBytes))
+}
+
+// batchProblem maps an ApplyBatch error to a per-item problem
+func batchProblem(err error) *ProblemDetails {
+	problem := &ProblemDetails{Detail: err.Error()}
+
+	var invalid *ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		problem.Title, problem.Status = "Validation failed", http.StatusBadRequest
+		problem.InvalidParams = invalid.Params
+	case errors.Is(err, ErrUserNotFound):
+		problem.Title, problem.Status = "User not found", http.StatusNotFound
+	case errors.Is(err, ErrUnknownOp):
+		problem.Title, problem.Status = "Unknown operation", http.StatusBadRequest
+		problem.Detail = fmt.Sprintf("op must be %q, %q or %q", BatchCreate, BatchUpdate, BatchDelete)
+	case errors.Is(err, ErrNotApplied):
+		problem.Title, problem.Status = "Not applied", http.StatusFailedDependency
+	default:
+		problem.Title, problem.Status = "Internal server error", http.StatusInternalServerError
+	}
+
+	problem.Type = problemType(problem.Title)
+	return problem
+}
@@ -0,0 +1,211 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func postBatch(t *testing.T, server *APIServer, query, contentType, body string) (int, BatchResponse) {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/api/v1/users:batch"+query, strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+
+	var resp BatchResponse
+	if rec.Header().Get("Content-Type") == "application/json" {
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("decoding batch response: %v", err)
+		}
+	}
+	return rec.Code, resp
+}
+
+func TestApplyBatchSeesEarlierOperations(t *testing.T) {
+	store := NewUserStore()
+	outcomes, committed := store.ApplyBatch([]BatchOp{
+		{Op: BatchCreate, Name: "Ada", Email: "ada@example.com"},
+		{Op: BatchUpdate, ID: 1, Email: "ada@lovelace.dev"},
+		{Op: BatchCreate, Name: "Tmp", Email: "tmp@example.com"},
+		{Op: BatchDelete, ID: 2},
+	}, true)
+
+	if !committed {
+		t.Fatalf("batch not committed: %+v", outcomes)
+	}
+	user, ok := store.GetUser(1)
+	if !ok || user.Email != "ada@lovelace.dev" {
+		t.Errorf("user 1 = %+v; want updated email", user)
+	}
+	if _, ok := store.GetUser(2); ok {
+		t.Error("user 2 still exists after delete")
+	}
+	if next := store.CreateUser("Bob", "bob@example.com"); next.ID != 3 {
+		t.Errorf("next ID = %d; want 3", next.ID)
+	}
+}
+
+func TestApplyBatchAtomicRollback(t *testing.T) {
+	store := NewUserStore()
+	store.CreateUser("Ada", "ada@example.com")
+	sub, _, _ := store.Subscribe(0)
+	defer store.Unsubscribe(sub)
+
+	outcomes, committed := store.ApplyBatch([]BatchOp{
+		{Op: BatchUpdate, ID: 1, Name: "Changed"},
+		{Op: BatchCreate, Name: "New", Email: "new@example.com"},
+		{Op: BatchDelete, ID: 99},
+	}, true)
+
+	if committed {
+		t.Fatal("atomic batch with a failing operation was committed")
+	}
+	if outcomes[0].Err != ErrNotApplied || outcomes[2].Err != ErrUserNotFound {
+		t.Errorf("outcome errors = %v, %v; want ErrNotApplied, ErrUserNotFound", outcomes[0].Err, outcomes[2].Err)
+	}
+	if user, _ := store.GetUser(1); user.Name != "Ada" {
+		t.Errorf("user 1 name = %q after rollback; want Ada", user.Name)
+	}
+	if len(store.GetAllUsers()) != 1 {
+		t.Errorf("store has %d users after rollback; want 1", len(store.GetAllUsers()))
+	}
+	select {
+	case event := <-sub.C:
+		t.Errorf("rolled-back batch published %+v", event)
+	default:
+	}
+}
+
+func TestBatchEndpointModes(t *testing.T) {
+	body := `{"operations": [
+		{"op": "create", "name": "Ada", "email": "ada@example.com"},
+		{"op": "create", "name": "NoEmail"},
+		{"op": "delete", "id": 1},
+		{"op": "rename", "id": 1}
+	]}`
+
+	tests := []struct {
+		name          string
+		query         string
+		wantStatus    int
+		wantCommitted bool
+		wantStatuses  []int
+		wantUsers     int
+	}{
+		{"atomic by default", "", http.StatusUnprocessableEntity, false,
+			[]int{http.StatusFailedDependency, http.StatusBadRequest, http.StatusFailedDependency, http.StatusBadRequest}, 0},
+		{"best effort", "?mode=best-effort", http.StatusOK, true,
+			[]int{http.StatusCreated, http.StatusBadRequest, http.StatusOK, http.StatusBadRequest}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewAPIServer()
+			status, resp := postBatch(t, server, tt.query, "application/json", body)
+
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d; want %d", status, tt.wantStatus)
+			}
+			if resp.Committed != tt.wantCommitted {
+				t.Errorf("committed = %v; want %v", resp.Committed, tt.wantCommitted)
+			}
+			if len(resp.Results) != len(tt.wantStatuses) {
+				t.Fatalf("got %d results; want %d", len(resp.Results), len(tt.wantStatuses))
+			}
+			for i, want := range tt.wantStatuses {
+				if got := resp.Results[i].Status; got != want {
+					t.Errorf("results[%d].status = %d; want %d", i, got, want)
+				}
+			}
+			if n := len(server.store.GetAllUsers()); n != tt.wantUsers {
+				t.Errorf("store has %d users; want %d", n, tt.wantUsers)
+			}
+		})
+	}
+}
+
+func TestBatchEndpointNDJSON(t *testing.T) {
+	server := NewAPIServer()
+
+	var body strings.Builder
+	total := batchChunkSize + 5
+	for i := 1; i <= total; i++ {
+		fmt.Fprintf(&body, `{"op":"create","name":"User %d","email":"user%d@example.com"}`+"\n", i, i)
+	}
+	body.WriteString("{not json}\n")
+	body.WriteString(`{"op":"update","id":1,"name":"First"}` + "\n")
+
+	status, resp := postBatch(t, server, "?mode=best-effort", "application/x-ndjson", body.String())
+	if status != http.StatusOK {
+		t.Fatalf("status = %d; want 200", status)
+	}
+	if resp.Succeeded != total+1 || resp.Failed != 1 {
+		t.Errorf("succeeded/failed = %d/%d; want %d/1", resp.Succeeded, resp.Failed, total+1)
+	}
+	// The first successes are listed, then the failure; the rest are
+	// only counted
+	if len(resp.Results) != maxListedResults+1 || resp.Omitted != total+1-maxListedResults {
+		t.Fatalf("%d results listed, %d omitted; want %d and %d", len(resp.Results), resp.Omitted, maxListedResults+1, total+1-maxListedResults)
+	}
+	for i, result := range resp.Results[:maxListedResults] {
+		if result.Index != i {
+			t.Fatalf("results[%d].index = %d; results out of order", i, result.Index)
+		}
+	}
+	bad := resp.Results[maxListedResults]
+	if bad.Index != total || bad.Status != http.StatusBadRequest || !strings.Contains(bad.Error.Detail, fmt.Sprintf("line %d", total+1)) {
+		t.Errorf("bad line result = %+v; want a 400 naming line %d", bad, total+1)
+	}
+	if user, _ := server.store.GetUser(1); user.Name != "First" {
+		t.Errorf("user 1 name = %q; want the update after the bad line applied", user.Name)
+	}
+}
+
+func TestBatchEndpointAtomicNDJSONRejectsBadLine(t *testing.T) {
+	server := NewAPIServer()
+	body := `{"op":"create","name":"Ada","email":"ada@example.com"}` + "\n{oops\n"
+
+	status, _ := postBatch(t, server, "", "application/x-ndjson", body)
+	if status != http.StatusBadRequest {
+		t.Errorf("status = %d; want 400", status)
+	}
+	if n := len(server.store.GetAllUsers()); n != 0 {
+		t.Errorf("store has %d users; want 0", n)
+	}
+}
+
+func TestBatchEndpointRejectsOversizedBody(t *testing.T) {
+	for _, body := range []struct{ contentType, text string }{
+		{"application/json", `{"operations":[` + strings.Repeat(" ", maxBatchBodyBytes) + "]}"},
+		{"application/x-ndjson", strings.Repeat("\n", maxBatchBodyBytes+1)},
+	} {
+		if status, _ := postBatch(t, NewAPIServer(), "", body.contentType, body.text); status != http.StatusRequestEntityTooLarge {
+			t.Errorf("%s: status = %d; want 413", body.contentType, status)
+		}
+	}
+}
+
+func TestBatchEndpointRejectsBadRequests(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		contentType string
+		wantStatus  int
+	}{
+		{"unknown mode", "?mode=yolo", "application/json", http.StatusBadRequest},
+		{"unsupported media type", "", "text/csv", http.StatusUnsupportedMediaType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, _ := postBatch(t, NewAPIServer(), tt.query, tt.contentType, `{"operations":[]}`)
+			if status != tt.wantStatus {
+				t.Errorf("status = %d; want %d", status, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package apiserver
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"go-learning-guide/examples/breaker"
+)
+
+// Outbound calls: handlers that call other services go through a
+// circuit breaker per dependency, so a slow or failing service makes
+// its calls fail fast instead of tying up every handler waiting on it.
+// The breakers' states are part of the health check.
+
+// outboundTimeout bounds a call made with HTTPClient
+const outboundTimeout = 10 * time.Second
+
+// Breaker returns the breaker for a dependency, creating it with
+// settings on first use; later calls get the same breaker and ignore
+// settings. Changes of state are logged.
+func (s *APIServer) Breaker(name string, settings breaker.Settings) *breaker.Breaker {
+	s.breakersMu.Lock()
+	defer s.breakersMu.Unlock()
+
+	if b, ok := s.breakers[name]; ok {
+		return b
+	}
+	settings.Name = name
+	onChange := settings.OnStateChange
+	settings.OnStateChange = func(name string, from, to breaker.State) {
+		log.Printf("Circuit breaker %s: %v -> %v", name, from, to)
+		if onChange != nil {
+			onChange(name, from, to)
+		}
+	}
+	if s.breakers == nil {
+		s.breakers = make(map[string]*breaker.Breaker)
+	}
+	b := breaker.New(settings)
+	s.breakers[name] = b
+	return b
+}
+
+// HTTPClient returns a client for calls to a dependency, sent through
+// its breaker
+func (s *APIServer) HTTPClient(name string, settings breaker.Settings) *http.Client {
+	return &http.Client{
+		Transport: &breaker.Transport{Breaker: s.Breaker(name, settings)},
+		Timeout:   outboundTimeout,
+	}
+}
+
+// breakerSnapshots returns every breaker's state, by name
+func (s *APIServer) breakerSnapshots() []breaker.Snapshot {
+	s.breakersMu.Lock()
+	breakers := make([]*breaker.Breaker, 0, len(s.breakers))
+	for _, b := range s.breakers {
+		breakers = append(breakers, b)
+	}
+	s.breakersMu.Unlock()
+
+	snapshots := make([]breaker.Snapshot, len(breakers))
+	for i, b := range breakers {
+		snapshots[i] = b.Snapshot()
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Name < snapshots[j].Name })
+	return snapshots
+}
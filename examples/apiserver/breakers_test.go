@@ -0,0 +1,85 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-learning-guide/examples/breaker"
+)
+
+func TestHealthReportsBreakers(t *testing.T) {
+	server := NewAPIServer()
+	health := func() HealthResponse {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v2/health", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("health status = %d", rec.Code)
+		}
+		var resp HealthResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	if resp := health(); resp.Status != "ok" || len(resp.Dependencies) != 0 {
+		t.Errorf("health without dependencies = %+v", resp)
+	}
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer upstream.Close()
+
+	var changes []breaker.State
+	client := server.HTTPClient("payments", breaker.Settings{
+		MinRequests:   2,
+		OnStateChange: func(_ string, _, to breaker.State) { changes = append(changes, to) },
+	})
+	if server.Breaker("payments", breaker.Settings{}) != server.Breaker("payments", breaker.Settings{MinRequests: 99}) {
+		t.Error("Breaker made a second breaker for the same dependency")
+	}
+	server.Breaker("inventory", breaker.Settings{})
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(upstream.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if _, err := client.Get(upstream.URL); !errors.Is(err, breaker.ErrOpen) {
+		t.Errorf("third call: %v, want the breaker to be open", err)
+	}
+	if len(changes) != 1 || changes[0] != breaker.Open {
+		t.Errorf("state changes = %v, want [open]", changes)
+	}
+
+	resp := health()
+	if resp.Status != "degraded" || len(resp.Dependencies) != 2 {
+		t.Fatalf("health = %+v, want degraded with 2 dependencies", resp)
+	}
+	inventory, payments := resp.Dependencies[0], resp.Dependencies[1]
+	if inventory.Name != "inventory" || inventory.State != breaker.Closed {
+		t.Errorf("inventory = %+v", inventory)
+	}
+	if payments.Name != "payments" || payments.State != breaker.Open ||
+		payments.Failures != 2 || payments.Rejected != 1 {
+		t.Errorf("payments = %+v", payments)
+	}
+
+	// The state is written by name
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/health", nil))
+	var raw struct {
+		Dependencies []map[string]interface{} `json:"dependencies"`
+	}
+	json.NewDecoder(rec.Body).Decode(&raw)
+	if len(raw.Dependencies) != 2 || raw.Dependencies[1]["state"] != "open" {
+		t.Errorf("health JSON dependencies = %v", raw.Dependencies)
+	}
+}
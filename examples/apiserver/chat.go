@@ -0,0 +1,441 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+)
+
+// Chat message types sent to clients
+const (
+	ChatText     = "message"  // a message posted to the room
+	ChatJoin     = "join"     // someone entered the room
+	ChatLeave    = "leave"    // someone left the room
+	ChatPresence = "presence" // the current member list, sent on join
+	ChatError    = "error"    // a problem with the client's last input
+)
+
+// ChatMessage is the JSON envelope for everything the server sends
+type ChatMessage struct {
+	ID      uint64       `json:"id,omitempty"`
+	Type    string       `json:"type"`
+	Room    string       `json:"room"`
+	UserID  int          `json:"user_id,omitempty"`
+	Nick    string       `json:"nick,omitempty"`
+	Text    string       `json:"text,omitempty"`
+	Members []ChatMember `json:"members,omitempty"`
+	Time    time.Time    `json:"time"`
+}
+
+// ChatMember is one user present in a room
+type ChatMember struct {
+	UserID int    `json:"user_id"`
+	Nick   string `json:"nick"`
+}
+
+// ChatInput is what clients send over the socket
+type ChatInput struct {
+	Text string `json:"text"`
+}
+
+// ChatRoomInfo summarises a room for the room listing
+type ChatRoomInfo struct {
+	Name    string `json:"name"`
+	Members int    `json:"members"`
+}
+
+const (
+	chatHistorySize    = 100  // messages kept per room
+	chatSendBufferSize = 32   // messages a client may fall behind by
+	chatMaxTextLength  = 2000 // characters per message
+	chatMaxRooms       = 1000 // rooms kept, empty or not
+)
+
+// roomNamePattern restricts room names to simple slugs
+var roomNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+// ChatHub tracks rooms and the clients connected to them. Empty rooms
+// keep their history until the hub has maxRooms rooms and needs the
+// place for a new one; the one idle longest goes first.
+type ChatHub struct {
+	users    *UserStore
+	maxRooms int
+
+	mu     sync.Mutex
+	rooms  map[string]*chatRoom
+	nextID uint64
+}
+
+type chatRoom struct {
+	name       string
+	clients    map[*chatClient]struct{}
+	history    []ChatMessage // oldest first, at most chatHistorySize
+	lastActive time.Time
+}
+
+// chatClient is one WebSocket connection. The nickname always comes
+// from the User record so renames show up in the next message.
+type chatClient struct {
+	userID int
+	room   string
+	conn   *wsConn
+	send   chan ChatMessage // created by ChatHub.join, closed on leave
+}
+
+// NewChatHub creates an empty hub whose nicknames come from users;
+// rooms are created on first join
+func NewChatHub(users *UserStore) *ChatHub {
+	return &ChatHub{
+		users:    users,
+		maxRooms: chatMaxRooms,
+		rooms:    make(map[string]*chatRoom),
+		nextID:   1,
+	}
+}
+
+// nick returns the current display name for a user
+func (h *ChatHub) nick(userID int) (string, bool) {
+	user, ok := h.users.GetUser(userID)
+	if !ok {
+		return "", false
+	}
+	return user.Name, true
+}
+
+// idlestLocked returns the empty room idle longest, or nil if every
+// room has members
+func (h *ChatHub) idlestLocked() *chatRoom {
+	var idlest *chatRoom
+	for _, room := range h.rooms {
+		if len(room.clients) == 0 && (idlest == nil || room.lastActive.Before(idlest.lastActive)) {
+			idlest = room
+		}
+	}
+	return idlest
+}
+
+// canJoin reports whether there is a place for the room, so a client
+// can be turned away before its connection is upgraded
+func (h *ChatHub) canJoin(name string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, exists := h.rooms[name]
+	return exists || len(h.rooms) < h.maxRooms || h.idlestLocked() != nil
+}
+
+// join adds a client to a room, creating it if need be. The newcomer's
+// send channel is created here and primed with the member list and
+// room history, so those always arrive before any live traffic. It
+// reports false if the hub has no place for a new room.
+func (h *ChatHub) join(c *chatClient) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	room, ok := h.rooms[c.room]
+	if !ok {
+		if len(h.rooms) >= h.maxRooms {
+			idlest := h.idlestLocked()
+			if idlest == nil {
+				return false
+			}
+			delete(h.rooms, idlest.name)
+		}
+		room = &chatRoom{name: c.room, clients: make(map[*chatClient]struct{})}
+		h.rooms[c.room] = room
+	}
+	room.lastActive = time.Now()
+
+	nick, _ := h.nick(c.userID)
+	h.broadcastLocked(room, ChatMessage{Type: ChatJoin, UserID: c.userID, Nick: nick})
+
+	c.send = make(chan ChatMessage, chatSendBufferSize+len(room.history)+1)
+	room.clients[c] = struct{}{}
+	c.send <- ChatMessage{
+		Type:    ChatPresence,
+		Room:    room.name,
+		Members: h.membersLocked(room),
+		Time:    time.Now(),
+	}
+	for _, msg := range room.history {
+		c.send <- msg
+	}
+	return true
+}
+
+// leave removes a client and tells the rest of the room
+func (h *ChatHub) leave(c *chatClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	room, ok := h.rooms[c.room]
+	if !ok {
+		return
+	}
+	if _, ok := room.clients[c]; !ok {
+		return
+	}
+	delete(room.clients, c)
+	close(c.send)
+	room.lastActive = time.Now()
+
+	nick, _ := h.nick(c.userID)
+	h.broadcastLocked(room, ChatMessage{Type: ChatLeave, UserID: c.userID, Nick: nick})
+}
+
+// post records a text message in the room history and delivers it.
+// It reports false if the client is no longer connected.
+func (h *ChatHub) post(c *chatClient, nick, text string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	room, ok := h.rooms[c.room]
+	if !ok {
+		return false
+	}
+	if _, ok := room.clients[c]; !ok {
+		return false
+	}
+	msg := h.broadcastLocked(room, ChatMessage{Type: ChatText, UserID: c.userID, Nick: nick, Text: text})
+	room.lastActive = msg.Time
+
+	room.history = append(room.history, msg)
+	if len(room.history) > chatHistorySize {
+		room.history = room.history[len(room.history)-chatHistorySize:]
+	}
+	return true
+}
+
+// reply sends a message to one client only, e.g. to report bad input
+func (h *ChatHub) reply(c *chatClient, msg ChatMessage) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	room, ok := h.rooms[c.room]
+	if !ok {
+		return
+	}
+	if _, ok := room.clients[c]; !ok {
+		return // already dropped; c.send is closed
+	}
+	msg.Room = room.name
+	msg.Time = time.Now()
+	select {
+	case c.send <- msg:
+	default:
+	}
+}
+
+// broadcastLocked stamps and delivers a message to every client in the
+// room. Clients whose send buffer is full are disconnected.
+func (h *ChatHub) broadcastLocked(room *chatRoom, msg ChatMessage) ChatMessage {
+	msg.ID = h.nextID
+	h.nextID++
+	msg.Room = room.name
+	msg.Time = time.Now()
+
+	var dropped []*chatClient
+	for c := range room.clients {
+		select {
+		case c.send <- msg:
+		default:
+			log.Printf("chat: dropping slow client (user %d) from %s", c.userID, room.name)
+			delete(room.clients, c)
+			close(c.send)
+			dropped = append(dropped, c)
+		}
+	}
+	for _, c := range dropped {
+		nick, _ := h.nick(c.userID)
+		h.broadcastLocked(room, ChatMessage{Type: ChatLeave, UserID: c.userID, Nick: nick})
+	}
+	return msg
+}
+
+func (h *ChatHub) membersLocked(room *chatRoom) []ChatMember {
+	seen := make(map[int]bool)
+	members := []ChatMember{}
+	for c := range room.clients {
+		if seen[c.userID] {
+			continue // several tabs, one member
+		}
+		seen[c.userID] = true
+		nick, _ := h.nick(c.userID)
+		members = append(members, ChatMember{UserID: c.userID, Nick: nick})
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].UserID < members[j].UserID })
+	return members
+}
+
+// Rooms lists the rooms that have been used, sorted by name
+func (h *ChatHub) Rooms() []ChatRoomInfo {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	rooms := make([]ChatRoomInfo, 0, len(h.rooms))
+	for _, room := range h.rooms {
+		rooms = append(rooms, ChatRoomInfo{Name: room.name, Members: len(h.membersLocked(room))})
+	}
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].Name < rooms[j].Name })
+	return rooms
+}
+
+// History returns a copy of a room's recent messages
+func (h *ChatHub) History(name string) ([]ChatMessage, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	room, ok := h.rooms[name]
+	if !ok {
+		return nil, false
+	}
+	return append([]ChatMessage{}, room.history...), true
+}
+
+// Chat connection timing
+const (
+	chatPingInterval = 25 * time.Second
+	chatReadTimeout  = 60 * time.Second // must exceed chatPingInterval
+)
+
+// writeLoop delivers queued messages and keeps the connection alive
+// with pings. It returns when the send channel is closed.
+func (c *chatClient) writeLoop(pingInterval time.Duration) {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case msg, ok := <-c.send:
+			if !ok {
+				c.conn.CloseWithStatus(closeGoingAway, "")
+				return
+			}
+			data, err := json.Marshal(msg)
+			if err != nil {
+				log.Printf("chat: encoding message: %v", err)
+				continue
+			}
+			if err := c.conn.WriteText(data); err != nil {
+				c.conn.CloseWithStatus(closeGoingAway, "")
+				return
+			}
+		case <-ticker.C:
+			if err := c.conn.Ping(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Chat handlers
+
+func (s *APIServer) handleChatRooms(w http.ResponseWriter, r *http.Request) {
+	s.writeJSON(w, http.StatusOK, s.chat.Rooms())
+}
+
+func (s *APIServer) handleChatHistory(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["room"]
+	history, ok := s.chat.History(name)
+	if !ok {
+		s.writeError(w, r, http.StatusNotFound, "Room not found", fmt.Sprintf("Room %q has no messages", name))
+		return
+	}
+	s.writeJSON(w, http.StatusOK, history)
+}
+
+// handleChatSocket upgrades to a WebSocket and joins the user given by
+// ?user_id= to the room; the request must carry their key. Each line of
+// input is a ChatInput JSON object.
+func (s *APIServer) handleChatSocket(w http.ResponseWriter, r *http.Request) {
+	room := mux.Vars(r)["room"]
+	if !roomNamePattern.MatchString(room) {
+		s.writeError(w, r, http.StatusBadRequest, "Invalid room name",
+			"Room names are 1-32 lowercase letters, digits or dashes")
+		return
+	}
+	// WebSockets aren't covered by CORS: any site could open one from a
+	// visitor's browser
+	if !sameOrigin(r) {
+		s.writeError(w, r, http.StatusForbidden, "Cross-origin request",
+			"Chat sockets may only be opened by the server's own pages")
+		return
+	}
+
+	userID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+	if err != nil {
+		s.writeError(w, r, http.StatusBadRequest, "Invalid user ID", "The user_id query parameter is required")
+		return
+	}
+	if !s.authorizeUser(w, r, userID) {
+		return
+	}
+	if _, exists := s.store.GetUser(userID); !exists {
+		s.writeError(w, r, http.StatusNotFound, "User not found", fmt.Sprintf("User with ID %d does not exist", userID))
+		return
+	}
+
+	if err := checkWebSocketHandshake(r); err != nil {
+		w.Header().Set("Upgrade", "websocket")
+		s.writeError(w, r, http.StatusUpgradeRequired, "WebSocket upgrade required", err.Error())
+		return
+	}
+	if !s.chat.canJoin(room) {
+		s.writeError(w, r, http.StatusServiceUnavailable, "Too many chat rooms",
+			"Every chat room is in use; join an existing one or try again later")
+		return
+	}
+	conn, err := upgradeWebSocket(w, r)
+	if err != nil {
+		log.Printf("[%s] chat: %v", requestIDFromContext(r.Context()), err)
+		return
+	}
+	conn.readTimeout = chatReadTimeout
+
+	client := &chatClient{userID: userID, room: room, conn: conn}
+	if !s.chat.join(client) {
+		// The last place went since canJoin
+		conn.CloseWithStatus(closeTryAgainLater, "too many rooms")
+		return
+	}
+	defer s.chat.leave(client)
+	go client.writeLoop(chatPingInterval)
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var input ChatInput
+		if err := json.Unmarshal(data, &input); err != nil {
+			s.chat.reply(client, ChatMessage{Type: ChatError, Text: "messages must be JSON like {\"text\": \"hi\"}"})
+			continue
+		}
+		text := strings.TrimSpace(input.Text)
+		if text == "" || utf8.RuneCountInString(text) > chatMaxTextLength {
+			s.chat.reply(client, ChatMessage{Type: ChatError,
+				Text: fmt.Sprintf("text must be 1-%d characters", chatMaxTextLength)})
+			continue
+		}
+
+		// Look the user up each time so renames and deletions take effect
+		nick, ok := s.chat.nick(userID)
+		if !ok {
+			conn.CloseWithStatus(closePolicyViolation, "user deleted")
+			return
+		}
+		if !s.chat.post(client, nick, text) {
+			return // dropped for being too slow
+		}
+	}
+}
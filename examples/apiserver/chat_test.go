@@ -0,0 +1,325 @@
+package apiserver
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// chatTestClient is an in-process WebSocket client for the chat server
+type chatTestClient struct {
+	t    *testing.T
+	conn *wsConn
+}
+
+// dialChat joins a room as the user, sending their key
+func dialChat(t *testing.T, server *APIServer, ts *httptest.Server, room string, userID int) *chatTestClient {
+	t.Helper()
+	return dialChatTarget(t, ts, fmt.Sprintf("/api/v1/chat/rooms/%s/ws?user_id=%d", room, userID),
+		"Authorization: Bearer "+server.Store().UserKey(userID)+"\r\n")
+}
+
+// dialChatTarget makes the WebSocket handshake for target, a path and
+// query, with extra header lines
+func dialChatTarget(t *testing.T, ts *httptest.Server, target, header string) *chatTestClient {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	fmt.Fprintf(conn, "GET %s HTTP/1.1\r\n"+
+		"Host: %s\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n"+
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: %s\r\n%s\r\n",
+		target, ts.Listener.Addr(), key, header)
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatalf("reading handshake: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("handshake status = %d; want 101", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Sec-WebSocket-Accept"); got != websocketAccept(key) {
+		t.Fatalf("Sec-WebSocket-Accept = %q; want %q", got, websocketAccept(key))
+	}
+
+	c := &chatTestClient{t: t, conn: &wsConn{conn: conn, br: br, client: true}}
+	t.Cleanup(func() { conn.Close() })
+	return c
+}
+
+func (c *chatTestClient) say(text string) {
+	c.t.Helper()
+	data, _ := json.Marshal(ChatInput{Text: text})
+	if err := c.conn.WriteText(data); err != nil {
+		c.t.Fatalf("sending %q: %v", text, err)
+	}
+}
+
+// expect reads messages until one of the wanted type arrives
+func (c *chatTestClient) expect(msgType string) ChatMessage {
+	c.t.Helper()
+	c.conn.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			c.t.Fatalf("waiting for %q: %v", msgType, err)
+		}
+		var msg ChatMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			c.t.Fatalf("decoding %s: %v", data, err)
+		}
+		if msg.Type == msgType {
+			return msg
+		}
+	}
+}
+
+func newChatTestServer(t *testing.T) (*APIServer, *httptest.Server) {
+	server := NewAPIServer()
+	captureLog(t)
+	server.store.CreateUser("Alice", "alice@example.com")
+	server.store.CreateUser("Bob", "bob@example.com")
+
+	ts := httptest.NewServer(server)
+	t.Cleanup(ts.Close)
+	return server, ts
+}
+
+func TestChatRoomConversation(t *testing.T) {
+	server, ts := newChatTestServer(t)
+
+	alice := dialChat(t, server, ts, "general", 1)
+	if p := alice.expect(ChatPresence); len(p.Members) != 1 || p.Members[0].Nick != "Alice" {
+		t.Fatalf("alice presence = %+v; want just Alice", p.Members)
+	}
+
+	bob := dialChat(t, server, ts, "general", 2)
+	if p := bob.expect(ChatPresence); len(p.Members) != 2 {
+		t.Fatalf("bob presence = %+v; want Alice and Bob", p.Members)
+	}
+	if j := alice.expect(ChatJoin); j.Nick != "Bob" {
+		t.Errorf("join nick = %q; want Bob", j.Nick)
+	}
+
+	alice.say("hi bob")
+	for name, c := range map[string]*chatTestClient{"alice": alice, "bob": bob} {
+		msg := c.expect(ChatText)
+		if msg.Nick != "Alice" || msg.Text != "hi bob" || msg.Room != "general" {
+			t.Errorf("%s received %+v; want Alice saying %q in general", name, msg, "hi bob")
+		}
+	}
+
+	bob.conn.CloseWithStatus(closeNormal, "")
+	if l := alice.expect(ChatLeave); l.UserID != 2 {
+		t.Errorf("leave user_id = %d; want 2", l.UserID)
+	}
+}
+
+func TestChatRoomsAreIsolated(t *testing.T) {
+	server, ts := newChatTestServer(t)
+
+	alice := dialChat(t, server, ts, "general", 1)
+	alice.expect(ChatPresence)
+	bob := dialChat(t, server, ts, "random", 2)
+	bob.expect(ChatPresence)
+
+	bob.say("anyone here?")
+	bob.expect(ChatText)
+
+	alice.say("just me")
+	if msg := alice.expect(ChatText); msg.Text != "just me" {
+		t.Errorf("alice received %q from another room", msg.Text)
+	}
+}
+
+func TestChatHistoryReplayedToNewcomers(t *testing.T) {
+	server, ts := newChatTestServer(t)
+
+	alice := dialChat(t, server, ts, "general", 1)
+	alice.expect(ChatPresence)
+	for i := 1; i <= 3; i++ {
+		alice.say(fmt.Sprintf("message %d", i))
+		alice.expect(ChatText)
+	}
+
+	bob := dialChat(t, server, ts, "general", 2)
+	bob.expect(ChatPresence)
+	for i := 1; i <= 3; i++ {
+		if msg := bob.expect(ChatText); msg.Text != fmt.Sprintf("message %d", i) {
+			t.Errorf("history[%d] = %q; want %q", i-1, msg.Text, fmt.Sprintf("message %d", i))
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/chat/rooms/general/messages", nil))
+	var history []ChatMessage
+	if err := json.NewDecoder(rec.Body).Decode(&history); err != nil {
+		t.Fatalf("decoding history: %v", err)
+	}
+	if len(history) != 3 {
+		t.Errorf("GET messages returned %d entries; want 3", len(history))
+	}
+}
+
+func TestChatNicknameFollowsUserRecord(t *testing.T) {
+	server, ts := newChatTestServer(t)
+
+	alice := dialChat(t, server, ts, "general", 1)
+	alice.expect(ChatPresence)
+
+	server.store.UpdateUser(1, "Alice Smith", "")
+	alice.say("new name")
+	if msg := alice.expect(ChatText); msg.Nick != "Alice Smith" {
+		t.Errorf("nick = %q; want %q", msg.Nick, "Alice Smith")
+	}
+}
+
+func TestChatRejectsBadInput(t *testing.T) {
+	server, ts := newChatTestServer(t)
+
+	alice := dialChat(t, server, ts, "general", 1)
+	alice.expect(ChatPresence)
+
+	alice.conn.WriteText([]byte("not json"))
+	alice.expect(ChatError)
+
+	alice.say("   ")
+	alice.expect(ChatError)
+
+	alice.say(strings.Repeat("a", chatMaxTextLength+1))
+	alice.expect(ChatError)
+}
+
+func TestChatSocketErrors(t *testing.T) {
+	server, _ := newChatTestServer(t)
+	// No place for any room, so a good handshake is turned away
+	server.chat.maxRooms = 0
+	upgrade := func(keyFor int, extra ...string) http.Header {
+		h := http.Header{
+			"Connection":            {"Upgrade"},
+			"Upgrade":               {"websocket"},
+			"Sec-Websocket-Version": {"13"},
+			"Sec-Websocket-Key":     {"dGhlIHNhbXBsZSBub25jZQ=="},
+		}
+		if keyFor > 0 {
+			h.Set("Authorization", "Bearer "+server.Store().UserKey(keyFor))
+		}
+		for i := 0; i+1 < len(extra); i += 2 {
+			h.Set(extra[i], extra[i+1])
+		}
+		return h
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		header     http.Header
+		wantStatus int
+	}{
+		{"bad room name", "/api/v1/chat/rooms/Bad_Room/ws?user_id=1", upgrade(1), http.StatusBadRequest},
+		{"cross-origin", "/api/v1/chat/rooms/general/ws?user_id=1", upgrade(1, "Origin", "http://evil.example"), http.StatusForbidden},
+		{"missing user", "/api/v1/chat/rooms/general/ws", upgrade(1), http.StatusBadRequest},
+		{"no key", "/api/v1/chat/rooms/general/ws?user_id=1", upgrade(0), http.StatusUnauthorized},
+		{"someone else's key", "/api/v1/chat/rooms/general/ws?user_id=1", upgrade(2), http.StatusUnauthorized},
+		{"key in the query of a plain GET", "/api/v1/chat/rooms/general/ws?user_id=1&access_token=" + server.Store().UserKey(1),
+			http.Header{}, http.StatusUnauthorized},
+		{"unknown user", "/api/v1/chat/rooms/general/ws?user_id=99", upgrade(99), http.StatusNotFound},
+		{"plain GET", "/api/v1/chat/rooms/general/ws?user_id=1", http.Header{"Authorization": {"Bearer " + server.Store().UserKey(1)}},
+			http.StatusUpgradeRequired},
+		{"too many rooms", "/api/v1/chat/rooms/general/ws?user_id=1", upgrade(1, "Origin", "http://example.com"),
+			http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req.Header = tt.header
+			rec := httptest.NewRecorder()
+			server.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d; want %d", rec.Code, tt.wantStatus)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+				t.Errorf("Content-Type = %q; want application/problem+json", ct)
+			}
+		})
+	}
+}
+
+func TestChatHandshakeIsLogged(t *testing.T) {
+	server := NewAPIServer()
+	logs := captureLog(t)
+	server.store.CreateUser("Alice", "alice@example.com")
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	alice := dialChat(t, server, ts, "general", 1)
+	alice.expect(ChatPresence)
+	alice.conn.CloseWithStatus(closeNormal, "")
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(logs.String(), "/api/v1/chat/rooms/general/ws 101") {
+		if time.Now().After(deadline) {
+			t.Fatalf("log does not record the 101 handshake:\n%s", logs.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestChatKeyInQuery(t *testing.T) {
+	// Browsers can't set headers on the handshake
+	server, ts := newChatTestServer(t)
+	alice := dialChatTarget(t, ts, "/api/v1/chat/rooms/general/ws?user_id=1&access_token="+server.Store().UserKey(1), "")
+	if p := alice.expect(ChatPresence); len(p.Members) != 1 || p.Members[0].UserID != 1 {
+		t.Errorf("presence = %+v; want just Alice", p.Members)
+	}
+}
+
+func TestChatEvictsIdleRooms(t *testing.T) {
+	store := NewUserStore()
+	store.CreateUser("Alice", "alice@example.com")
+	store.CreateUser("Bob", "bob@example.com")
+	hub := NewChatHub(store)
+	hub.maxRooms = 2
+
+	left := &chatClient{userID: 1, room: "one"}
+	hub.join(left)
+	hub.post(left, "Alice", "anyone?")
+	hub.leave(left)
+	hub.join(&chatClient{userID: 2, room: "two"})
+
+	// The empty room makes way
+	if !hub.join(&chatClient{userID: 1, room: "three"}) {
+		t.Fatal("join of a third room failed with an empty room to evict")
+	}
+	if _, ok := hub.History("one"); ok {
+		t.Error("the idle empty room was kept")
+	}
+	// Rooms with members don't
+	if hub.canJoin("four") || hub.join(&chatClient{userID: 1, room: "four"}) {
+		t.Error("a new room was created with every room in use")
+	}
+	if !hub.canJoin("two") {
+		t.Error("an existing room can't be joined")
+	}
+	if rooms := hub.Rooms(); len(rooms) != 2 {
+		t.Errorf("Rooms = %+v; want two and three", rooms)
+	}
+}
@@ -0,0 +1,131 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"go-learning-guide/quiz"
+	"go-learning-guide/runner"
+)
+
+// Checking coding challenges: a submission is compiled and run against
+// the challenge's hidden tests by the runner package, on this machine.
+// That is off unless the server is told otherwise (EnableCodeRuns), and
+// even then only pages served by the server itself may ask: a run must
+// be a JSON request, which other sites can't send without a CORS
+// preflight, and must come from the server's own origin.
+
+// runTimeout covers waiting for a free runner, compiling with a cold
+// build cache and running the tests
+const runTimeout = 2 * time.Minute
+
+// maxRunBodyBytes leaves room for JSON escaping of the largest source
+const maxRunBodyBytes = 2 * runner.MaxSourceBytes
+
+// RunRequest is a solution to a coding challenge: a whole main package
+type RunRequest struct {
+	Source string `json:"source"`
+}
+
+// RunResponse is the runner's report on a solution
+type RunResponse struct {
+	ChallengeID string `json:"challenge_id"`
+	runner.Report
+}
+
+// EnableCodeRuns turns on checking coding challenges, which compiles and
+// runs submitted code on this machine; call it before serving
+func (s *APIServer) EnableCodeRuns() {
+	s.runner = runner.New(runner.DefaultLimits, 0)
+}
+
+// sameOrigin reports whether r comes from a page of this server, or not
+// from a browser page at all
+func sameOrigin(r *http.Request) bool {
+	if site := r.Header.Get("Sec-Fetch-Site"); site != "" && site != "same-origin" && site != "none" {
+		return false
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+func (s *APIServer) handleRunChallenge(w http.ResponseWriter, r *http.Request) {
+	if s.runner == nil {
+		s.writeError(w, r, http.StatusForbidden, "Code runs disabled",
+			"This server doesn't run submitted code; start it with -code-runs to allow it")
+		return
+	}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		s.writeError(w, r, http.StatusUnsupportedMediaType, "Unsupported media type", "Send application/json")
+		return
+	}
+	if !sameOrigin(r) {
+		s.writeError(w, r, http.StatusForbidden, "Cross-origin request",
+			"Code runs may only be requested by the guide's own pages")
+		return
+	}
+
+	bank, ok := s.quizBank(w, r)
+	if !ok {
+		return
+	}
+	id := mux.Vars(r)["cid"]
+	if _, exists := bank.Challenge(id); !exists {
+		s.writeError(w, r, http.StatusNotFound, "Challenge not found", fmt.Sprintf("Challenge %q does not exist", id))
+		return
+	}
+	tests, err := quiz.HiddenTests(id)
+	if err != nil {
+		s.writeError(w, r, http.StatusInternalServerError, "Quiz unavailable", err.Error())
+		return
+	}
+
+	var req RunRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRunBodyBytes)).Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			s.writeError(w, r, http.StatusRequestEntityTooLarge, "Submission too large",
+				fmt.Sprintf("Source code is limited to %d bytes", runner.MaxSourceBytes))
+			return
+		}
+		s.writeError(w, r, http.StatusBadRequest, "Invalid JSON", err.Error())
+		return
+	}
+	if req.Source == "" {
+		s.writeProblem(w, r, ProblemDetails{
+			Title:         "Validation failed",
+			Status:        http.StatusBadRequest,
+			Detail:        "There is nothing to run",
+			InvalidParams: []InvalidParam{{Name: "source", Reason: "is required"}},
+		})
+		return
+	}
+
+	report, err := s.runner.Run(r.Context(), req.Source, tests)
+	switch {
+	case errors.Is(err, runner.ErrTooLarge):
+		s.writeError(w, r, http.StatusRequestEntityTooLarge, "Submission too large",
+			fmt.Sprintf("Source code is limited to %d bytes", runner.MaxSourceBytes))
+		return
+	case r.Context().Err() != nil:
+		return // the timeout middleware answers
+	case errors.Is(err, runner.ErrNoSandbox):
+		s.writeError(w, r, http.StatusServiceUnavailable, "Runner unavailable", err.Error())
+		return
+	case err != nil:
+		s.writeError(w, r, http.StatusInternalServerError, "Runner unavailable", err.Error())
+		return
+	}
+	s.writeJSON(w, http.StatusOK, RunResponse{ChallengeID: id, Report: *report})
+}
@@ -0,0 +1,130 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-learning-guide/runner"
+)
+
+const wordCounter = `package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+func countWords(text string) map[string]int {
+	counts := make(map[string]int)
+	for _, word := range strings.Fields(text) {
+		counts[word]++
+	}
+	return counts
+}
+
+func main() {
+	fmt.Println(countWords("hello world hello"))
+}
+`
+
+func TestRunChallenge(t *testing.T) {
+	server := NewAPIServer()
+	server.EnableCodeRuns()
+	do := func(path, source string) *httptest.ResponseRecorder {
+		t.Helper()
+		body, _ := json.Marshal(RunRequest{Source: source})
+		req := httptest.NewRequest("POST", path, strings.NewReader(string(body)))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do("/api/v2/quiz/challenges/no-such-challenge/runs", wordCounter); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown challenge status = %d; want 404", rec.Code)
+	}
+	if rec := do("/api/v2/quiz/challenges/word-counter/runs", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("empty submission status = %d; want 400", rec.Code)
+	}
+	if rec := do("/api/v2/quiz/challenges/word-counter/runs", strings.Repeat("x", 3*runner.MaxSourceBytes)); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("huge submission status = %d; want 413", rec.Code)
+	}
+	if testing.Short() {
+		t.Skip("compiles submissions")
+	}
+
+	if rec := do("/api/v2/quiz/challenges/word-counter/runs", wordCounter); rec.Code == http.StatusServiceUnavailable {
+		t.Skip("no sandbox here: ", rec.Body)
+	}
+	for _, tt := range []struct {
+		name   string
+		source string
+		want   runner.Status
+	}{
+		{"solution", wordCounter, runner.Passed},
+		{"off by one", strings.Replace(wordCounter, "counts[word]++", "counts[word] = 1", 1), runner.Failed},
+		{"template", strings.Replace(wordCounter, "counts := make(map[string]int)", "", 1), runner.CompileError},
+	} {
+		rec := do("/api/v1/quiz/challenges/word-counter/runs", tt.source)
+		var resp RunResponse
+		json.NewDecoder(rec.Body).Decode(&resp)
+		if rec.Code != http.StatusOK || resp.Status != tt.want || resp.ChallengeID != "word-counter" {
+			t.Errorf("%s: %d, status %q; want %q", tt.name, rec.Code, resp.Status, tt.want)
+		}
+		if tt.want != runner.CompileError && len(resp.Cases) != 6 {
+			t.Errorf("%s: %d cases; want 6", tt.name, len(resp.Cases))
+		}
+	}
+}
+
+// Any page a developer visits could post to a server on their machine;
+// runs are off by default, and only the guide's own pages may ask
+func TestRunChallengeRefused(t *testing.T) {
+	body := `{"source":""}` // refused before it could run, if at all
+	send := func(server *APIServer, header http.Header) int {
+		t.Helper()
+		req := httptest.NewRequest("POST", "http://localhost:8080/api/v2/quiz/challenges/fizzbuzz/runs", strings.NewReader(body))
+		req.Header = header
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	jsonFrom := func(origin, site string) http.Header {
+		h := http.Header{"Content-Type": {"application/json"}}
+		if origin != "" {
+			h.Set("Origin", origin)
+		}
+		if site != "" {
+			h.Set("Sec-Fetch-Site", site)
+		}
+		return h
+	}
+
+	if code := send(NewAPIServer(), jsonFrom("", "")); code != http.StatusForbidden {
+		t.Errorf("runs not enabled: status = %d; want 403", code)
+	}
+	server := NewAPIServer()
+	server.EnableCodeRuns()
+	for _, tt := range []struct {
+		name   string
+		header http.Header
+		want   int
+	}{
+		{"simple form post", http.Header{"Content-Type": {"text/plain"}}, http.StatusUnsupportedMediaType},
+		{"no content type", http.Header{}, http.StatusUnsupportedMediaType},
+		{"other origin", jsonFrom("https://evil.example", ""), http.StatusForbidden},
+		{"other site", jsonFrom("", "cross-site"), http.StatusForbidden},
+		{"same site, other port", jsonFrom("http://localhost:3000", "same-site"), http.StatusForbidden},
+	} {
+		if code := send(server, tt.header); code != tt.want {
+			t.Errorf("%s: status = %d; want %d", tt.name, code, tt.want)
+		}
+	}
+	// The guide's own page gets past the checks to the (empty) submission
+	if code := send(server, jsonFrom("http://localhost:8080", "same-origin")); code != http.StatusBadRequest {
+		t.Errorf("same origin: status = %d; want 400", code)
+	}
+}
@@ -0,0 +1,200 @@
+package apiserver
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"go-learning-guide/examples/pubsub"
+)
+
+// Event types published by UserStore
+const (
+	UserCreated = "user.created"
+	UserUpdated = "user.updated"
+	UserDeleted = "user.deleted"
+)
+
+// UserEvent describes one change to the user store
+type UserEvent struct {
+	ID   uint64    `json:"id"`
+	Type string    `json:"type"`
+	User User      `json:"user"`
+	Time time.Time `json:"time"`
+}
+
+const (
+	eventHistorySize     = 256 // events kept for Last-Event-ID replay
+	subscriberBufferSize = 64  // events a subscriber may fall behind by
+)
+
+// eventBus fans store changes out to subscribers and keeps the most
+// recent events in a ring buffer so reconnecting clients can catch up
+type eventBus struct {
+	mu      sync.Mutex
+	nextID  uint64
+	history [eventHistorySize]UserEvent
+	start   int // index of the oldest event in history
+	count   int
+	subs    map[*EventSubscription]struct{}
+}
+
+// EventSubscription receives store changes on C. C is closed when the
+// subscription ends, or if the subscriber falls more than
+// subscriberBufferSize events behind.
+type EventSubscription struct {
+	C       chan UserEvent
+	dropped bool
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{
+		nextID: 1,
+		subs:   make(map[*EventSubscription]struct{}),
+	}
+}
+
+// publish records an event and delivers it without blocking;
+// subscribers that cannot keep up are disconnected
+func (b *eventBus) publish(eventType string, user User) UserEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	event := UserEvent{
+		ID:   b.nextID,
+		Type: eventType,
+		User: user,
+		Time: time.Now(),
+	}
+	b.nextID++
+
+	end := (b.start + b.count) % eventHistorySize
+	b.history[end] = event
+	if b.count < eventHistorySize {
+		b.count++
+	} else {
+		b.start = (b.start + 1) % eventHistorySize
+	}
+
+	for sub := range b.subs {
+		select {
+		case sub.C <- event:
+		default:
+			sub.dropped = true
+			close(sub.C)
+			delete(b.subs, sub)
+		}
+	}
+	return event
+}
+
+// subscribe registers a subscriber and returns the retained events newer
+// than lastID. complete is false when events after lastID are no longer
+// in the history, evicted or lost to a restart, so the client must
+// resynchronise.
+func (b *eventBus) subscribe(lastID uint64) (sub *EventSubscription, replay []UserEvent, complete bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	complete = true
+	if lastID > 0 && lastID+1 < b.nextID && (b.count == 0 || lastID+1 < b.history[b.start].ID) {
+		complete = false
+	}
+	if lastID >= b.nextID {
+		// An ID not yet handed out: it came from before a restart whose
+		// log lost events, or from another store
+		complete = false
+		lastID = 0
+	}
+	if lastID > 0 {
+		for i := 0; i < b.count; i++ {
+			event := b.history[(b.start+i)%eventHistorySize]
+			if event.ID > lastID {
+				replay = append(replay, event)
+			}
+		}
+	}
+
+	sub = &EventSubscription{C: make(chan UserEvent, subscriberBufferSize)}
+	b.subs[sub] = struct{}{}
+	return sub, replay, complete
+}
+
+// lastID returns the ID of the newest event published, or 0
+func (b *eventBus) lastID() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.nextID - 1
+}
+
+// resume makes the next event's ID follow lastID, for a store reopened
+// from disk
+func (b *eventBus) resume(lastID uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.nextID = lastID + 1
+}
+
+// unsubscribe removes a subscriber; it is safe to call more than once
+func (b *eventBus) unsubscribe(sub *EventSubscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subs[sub]; ok {
+		delete(b.subs, sub)
+		close(sub.C)
+	}
+}
+
+// wasDropped reports whether the bus disconnected the subscriber for being slow
+func (b *eventBus) wasDropped(sub *EventSubscription) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return sub.dropped
+}
+
+// PublishEvents relays the store's changes to broker until ctx ends or
+// the broker closes, each on its event type as topic ("user.created")
+// with the UserEvent as payload. If the relay falls behind and the bus
+// drops it, it resubscribes and catches up from the history.
+func (s *UserStore) PublishEvents(ctx context.Context, broker *pubsub.Broker) error {
+	var lastID uint64
+	for {
+		sub, replay, complete := s.Subscribe(lastID)
+		if !complete {
+			log.Printf("Publishing user events: events after %d were evicted before they were published", lastID)
+		}
+		err := func() error {
+			defer s.Unsubscribe(sub)
+			publish := func(event UserEvent) error {
+				if _, err := broker.Publish(ctx, event.Type, event); err != nil {
+					return err
+				}
+				lastID = event.ID
+				return nil
+			}
+			for _, event := range replay {
+				if err := publish(event); err != nil {
+					return err
+				}
+			}
+			for {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case event, ok := <-sub.C:
+					if !ok {
+						return nil // dropped for being slow; catch up
+					}
+					if err := publish(event); err != nil {
+						return err
+					}
+				}
+			}
+		}()
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package apiserver
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-learning-guide/examples/pubsub"
+)
+
+func TestEventBusReplay(t *testing.T) {
+	bus := newEventBus()
+	for i := 1; i <= eventHistorySize+10; i++ {
+		bus.publish(UserCreated, User{ID: i})
+	}
+
+	tests := []struct {
+		name         string
+		lastID       uint64
+		wantFirst    uint64
+		wantCount    int
+		wantComplete bool
+	}{
+		{"new client", 0, 0, 0, true},
+		{"recent", eventHistorySize + 5, eventHistorySize + 6, 5, true},
+		{"oldest retained", 10, 11, eventHistorySize, true},
+		{"evicted", 3, 11, eventHistorySize, false},
+		{"not yet issued", eventHistorySize + 11, 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub, replay, complete := bus.subscribe(tt.lastID)
+			defer bus.unsubscribe(sub)
+
+			if len(replay) != tt.wantCount {
+				t.Fatalf("len(replay) = %d; want %d", len(replay), tt.wantCount)
+			}
+			if tt.wantCount > 0 && replay[0].ID != tt.wantFirst {
+				t.Errorf("replay[0].ID = %d; want %d", replay[0].ID, tt.wantFirst)
+			}
+			if complete != tt.wantComplete {
+				t.Errorf("complete = %v; want %v", complete, tt.wantComplete)
+			}
+		})
+	}
+}
+
+func TestEventBusDropsSlowSubscriber(t *testing.T) {
+	bus := newEventBus()
+	slow, _, _ := bus.subscribe(0)
+	fast, _, _ := bus.subscribe(0)
+
+	for i := 0; i <= subscriberBufferSize; i++ {
+		bus.publish(UserUpdated, User{ID: 1})
+		<-fast.C
+	}
+
+	for range slow.C {
+		// drain until the bus closes the channel
+	}
+	if !bus.wasDropped(slow) {
+		t.Error("slow subscriber was not marked as dropped")
+	}
+	if bus.wasDropped(fast) {
+		t.Error("fast subscriber was dropped")
+	}
+	bus.unsubscribe(slow) // must not double-close
+	bus.unsubscribe(fast)
+}
+
+func TestUserEventsStream(t *testing.T) {
+	server := NewAPIServer()
+	server.heartbeatInterval = 10 * time.Millisecond
+	captureLog(t)
+
+	server.store.CreateUser("Alice", "alice@example.com") // event 1
+	ts := httptest.NewServer(server.router)
+	defer ts.Close()
+
+	req, _ := http.NewRequest("GET", ts.URL+"/api/v1/users/events", nil)
+	req.Header.Set("Last-Event-ID", "0")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET events: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q; want text/event-stream", ct)
+	}
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+
+	waitFor := func(want string) {
+		t.Helper()
+		timeout := time.After(2 * time.Second)
+		for {
+			select {
+			case line, ok := <-lines:
+				if !ok {
+					t.Fatalf("stream ended before %q", want)
+				}
+				if strings.HasPrefix(line, want) {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("timed out waiting for %q", want)
+			}
+		}
+	}
+
+	waitFor(": heartbeat")
+	server.store.UpdateUser(1, "Alice Smith", "")
+	waitFor("id: 2")
+	waitFor("event: user.updated")
+	waitFor(`data: {"id":2,"type":"user.updated","user":{"id":1,"name":"Alice Smith"`)
+}
+
+func TestUserEventsReplayFromLastEventID(t *testing.T) {
+	server := NewAPIServer()
+	captureLog(t)
+
+	server.store.CreateUser("Alice", "alice@example.com") // event 1
+	server.store.CreateUser("Bob", "bob@example.com")     // event 2
+	server.store.DeleteUser(1)                            // event 3
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest("GET", "/api/v1/users/events", nil).WithContext(ctx)
+	req.Header.Set("Last-Event-ID", "1")
+	rec := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		server.router.ServeHTTP(rec, req)
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	<-done
+
+	body := rec.Body.String()
+	if strings.Contains(body, "id: 1\n") {
+		t.Errorf("stream replayed event 1, which the client already had:\n%s", body)
+	}
+	for _, want := range []string{"id: 2\nevent: user.created", "id: 3\nevent: user.deleted"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("stream does not contain %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestPublishEventsToBroker(t *testing.T) {
+	store := NewUserStore()
+	broker := pubsub.New()
+	defer broker.Close(context.Background())
+	created, _ := broker.Subscribe("user.created", pubsub.Options{})
+	all, _ := broker.Subscribe("user.*", pubsub.Options{Buffer: 2 * subscriberBufferSize})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	relayed := make(chan error, 1)
+	go func() { relayed <- store.PublishEvents(ctx, broker) }()
+
+	// Once the relay has subscribed, outrun it; if the bus drops it, it
+	// must catch up from the history without losing events
+	subscribed := func() bool {
+		store.events.mu.Lock()
+		defer store.events.mu.Unlock()
+		return len(store.events.subs) > 0
+	}
+	for !subscribed() {
+		time.Sleep(time.Millisecond)
+	}
+	alice := store.CreateUser("Alice", "alice@example.com")
+	for i := 0; i < subscriberBufferSize; i++ {
+		store.UpdateUser(alice.ID, fmt.Sprintf("Alice %d", i), "")
+	}
+
+	select {
+	case msg := <-created.C():
+		if event := msg.Payload.(UserEvent); event.ID != 1 || event.User.Name != "Alice" {
+			t.Errorf("user.created got %+v", event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no user.created message")
+	}
+	for want := uint64(1); want <= subscriberBufferSize+1; want++ {
+		select {
+		case msg := <-all.C():
+			if event := msg.Payload.(UserEvent); event.ID != want || msg.Topic != event.Type {
+				t.Fatalf("got event %d on %s, want event %d", event.ID, msg.Topic, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("event %d never arrived", want)
+		}
+	}
+
+	cancel()
+	if err := <-relayed; !errors.Is(err, context.Canceled) {
+		t.Errorf("PublishEvents = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,284 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"go-learning-guide/examples/breaker"
+)
+
+// handleHealth reports "degraded" while a dependency's circuit breaker
+// isn't closed. The server itself still answers, so the status code
+// stays 200.
+func (s *APIServer) handleHealth(w http.ResponseWriter, r *http.Request) {
+	response := HealthResponse{
+		Status:       "ok",
+		Timestamp:    time.Now(),
+		Service:      "user-api",
+		Dependencies: s.breakerSnapshots(),
+	}
+	for _, dep := range response.Dependencies {
+		if dep.State != breaker.Closed {
+			response.Status = "degraded"
+		}
+	}
+	s.writeJSON(w, http.StatusOK, response)
+}
+
+func (s *APIServer) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	spec, err := s.openAPISpec()
+	if err != nil {
+		s.writeError(w, r, http.StatusInternalServerError, "Documentation unavailable", err.Error())
+		return
+	}
+	s.writeJSON(w, http.StatusOK, spec)
+}
+
+func (s *APIServer) handleNotFound(w http.ResponseWriter, r *http.Request) {
+	// gorilla/mux loses method mismatches inside subrouters with several
+	// routes and reports them as not found, so check for them here
+	if len(s.allowedMethods(r)) > 0 {
+		s.handleMethodNotAllowed(w, r)
+		return
+	}
+	s.writeError(w, r, http.StatusNotFound, "Resource not found",
+		fmt.Sprintf("No API resource matches %s", r.URL.Path))
+}
+
+func (s *APIServer) handleMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	allowed := s.allowedMethods(r)
+	if len(allowed) > 0 {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+	}
+	s.writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed",
+		fmt.Sprintf("%s is not supported for %s", r.Method, r.URL.Path))
+}
+
+// allowedMethods reports which methods the router would accept for the request's path
+func (s *APIServer) allowedMethods(r *http.Request) []string {
+	var allowed []string
+	for _, method := range []string{"GET", "POST", "PUT", "PATCH", "DELETE"} {
+		probe := r.Clone(r.Context())
+		probe.Method = method
+		var match mux.RouteMatch
+		if s.router.Match(probe, &match) && match.MatchErr == nil {
+			allowed = append(allowed, method)
+		}
+	}
+	return allowed
+}
+
+func (s *APIServer) handleGetUsers(w http.ResponseWriter, r *http.Request) {
+	format, ok := s.listFormat(w, r)
+	if !ok {
+		return
+	}
+	if format != "" {
+		// Same rows as /users/export, without the attachment header
+		w.Header().Set("Content-Type", ContentTypeFor(format))
+		w.WriteHeader(http.StatusOK)
+		if err := s.store.ExportUsers(w, format); err != nil {
+			log.Printf("[%s] listing users: %v", requestIDFromContext(r.Context()), err)
+		}
+		return
+	}
+
+	users := s.store.GetAllUsers()
+	s.writeJSON(w, http.StatusOK, UserListResponse{
+		Users: users,
+		Count: len(users),
+	})
+}
+
+// sseWriteTimeout bounds each write to an event stream so a client that
+// stops reading cannot pin the handler forever
+const sseWriteTimeout = 10 * time.Second
+
+// handleUserEvents streams user changes as Server-Sent Events. Clients
+// reconnecting with Last-Event-ID get the events they missed replayed.
+func (s *APIServer) handleUserEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		s.writeError(w, r, http.StatusInternalServerError, "Streaming unsupported",
+			"The connection does not support streaming responses")
+		return
+	}
+
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("last_event_id") // for the first EventSource connect
+	}
+	var since uint64
+	if lastID != "" {
+		var err error
+		if since, err = strconv.ParseUint(lastID, 10, 64); err != nil {
+			s.writeError(w, r, http.StatusBadRequest, "Invalid Last-Event-ID", err.Error())
+			return
+		}
+	}
+
+	sub, replay, complete := s.store.Subscribe(since)
+	defer s.store.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	write := func(format string, args ...interface{}) bool {
+		rc.SetWriteDeadline(time.Now().Add(sseWriteTimeout)) // not all writers support deadlines
+		if _, err := fmt.Fprintf(w, format, args...); err != nil {
+			return false
+		}
+		flusher.Flush()
+		return true
+	}
+	writeEvent := func(event UserEvent) bool {
+		data, err := json.Marshal(event)
+		if err != nil {
+			log.Printf("Error encoding event %d: %v", event.ID, err)
+			return true
+		}
+		return write("id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	}
+
+	if !write("retry: 3000\n\n") {
+		return
+	}
+	if !complete {
+		// Some events were evicted; tell the client to reload the list
+		if !write("event: resync\ndata: {}\n\n") {
+			return
+		}
+	}
+	for _, event := range replay {
+		if !writeEvent(event) {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(s.heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-sub.C:
+			if !ok {
+				if s.store.events.wasDropped(sub) {
+					log.Printf("[%s] event stream closed: client too slow", requestIDFromContext(r.Context()))
+				}
+				return
+			}
+			if !writeEvent(event) {
+				return
+			}
+		case <-heartbeat.C:
+			if !write(": heartbeat\n\n") {
+				return
+			}
+		}
+	}
+}
+
+func (s *APIServer) handleGetUser(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		s.writeError(w, r, http.StatusBadRequest, "Invalid user ID", err.Error())
+		return
+	}
+
+	user, exists := s.store.GetUser(id)
+	if !exists {
+		s.writeError(w, r, http.StatusNotFound, "User not found", fmt.Sprintf("User with ID %d does not exist", id))
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, user)
+}
+
+func (s *APIServer) handleCreateUser(w http.ResponseWriter, r *http.Request) {
+	var req UserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, r, http.StatusBadRequest, "Invalid JSON", err.Error())
+		return
+	}
+
+	// Validation
+	if invalid := validateNewUser(req.Name, req.Email); len(invalid) > 0 {
+		s.writeProblem(w, r, ProblemDetails{
+			Title:         "Validation failed",
+			Status:        http.StatusBadRequest,
+			Detail:        "Name and email are required",
+			InvalidParams: invalid,
+		})
+		return
+	}
+
+	user := s.store.CreateUser(req.Name, req.Email)
+	s.writeJSON(w, http.StatusCreated, user)
+}
+
+// validateNewUser checks the fields required to create a user
+func validateNewUser(name, email string) []InvalidParam {
+	var invalid []InvalidParam
+	if name == "" {
+		invalid = append(invalid, InvalidParam{Name: "name", Reason: "is required"})
+	}
+	if email == "" {
+		invalid = append(invalid, InvalidParam{Name: "email", Reason: "is required"})
+	}
+	return invalid
+}
+
+func (s *APIServer) handleUpdateUser(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		s.writeError(w, r, http.StatusBadRequest, "Invalid user ID", err.Error())
+		return
+	}
+
+	var req UserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, r, http.StatusBadRequest, "Invalid JSON", err.Error())
+		return
+	}
+
+	user, exists := s.store.UpdateUser(id, req.Name, req.Email)
+	if !exists {
+		s.writeError(w, r, http.StatusNotFound, "User not found", fmt.Sprintf("User with ID %d does not exist", id))
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, user)
+}
+
+func (s *APIServer) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		s.writeError(w, r, http.StatusBadRequest, "Invalid user ID", err.Error())
+		return
+	}
+
+	deleted := s.store.DeleteUser(id)
+	if !deleted {
+		s.writeError(w, r, http.StatusNotFound, "User not found", fmt.Sprintf("User with ID %d does not exist", id))
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, MessageResponse{
+		Message: "User deleted successfully",
+	})
+}
@@ -0,0 +1,33 @@
+package apiserver
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// Request counts: every request that matches a route is counted under
+// the route's routeDocs key, e.g. "GET /api/v2/users/{id}". The counts
+// are kept in sharded counters, so handlers on different CPUs don't
+// contend for one lock just to count themselves.
+
+// countingMiddleware counts the request against its route. Requests
+// that match no route aren't counted, so clients can't add keys.
+func (s *APIServer) countingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route := mux.CurrentRoute(r); route != nil {
+			if tpl, err := route.GetPathTemplate(); err == nil {
+				s.requests.Increment(r.Method + " " + tpl)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *APIServer) handleRequestMetrics(w http.ResponseWriter, r *http.Request) {
+	response := RequestMetricsResponse{Routes: s.requests.Values()}
+	for _, route := range response.Routes {
+		response.Total += route.Count
+	}
+	s.writeJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,46 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-learning-guide/examples/concurrency"
+)
+
+func TestRequestMetrics(t *testing.T) {
+	server := NewAPIServer()
+	captureLog(t)
+	server.store.CreateUser("Alice", "alice@example.com")
+
+	for _, path := range []string{"/api/v2/users/1", "/api/v2/users/1", "/api/v2/users", "/api/v1/users/1", "/api/v2/nothing"} {
+		server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v2/metrics/requests", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	var resp RequestMetricsResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	// The metrics request counts itself; the unmatched path isn't counted
+	want := []concurrency.NamedCount{
+		{Name: "GET /api/v1/users/{id:[0-9]+}", Count: 1},
+		{Name: "GET /api/v2/metrics/requests", Count: 1},
+		{Name: "GET /api/v2/users", Count: 1},
+		{Name: "GET /api/v2/users/{id}", Count: 2},
+	}
+	if len(resp.Routes) != len(want) || resp.Total != 5 {
+		t.Fatalf("got %+v, want %v and a total of 5", resp, want)
+	}
+	for i := range want {
+		if resp.Routes[i] != want[i] {
+			t.Errorf("routes[%d] = %+v; want %+v", i, resp.Routes[i], want[i])
+		}
+	}
+}
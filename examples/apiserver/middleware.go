@@ -0,0 +1,293 @@
+package apiserver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// withMiddleware applies the server's middleware chain to a handler that
+// the router would otherwise call directly
+func (s *APIServer) withMiddleware(h http.Handler) http.Handler {
+	for i := len(s.middlewares) - 1; i >= 0; i-- {
+		h = s.middlewares[i](h)
+	}
+	return h
+}
+
+type contextKey string
+
+const requestIDKey contextKey = "request-id"
+
+// requestIDFromContext returns the ID assigned by requestIDMiddleware
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+func (s *APIServer) requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if id == "" || len(id) > 64 {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey, id)))
+	})
+}
+
+// handlerPanic carries a panic and its original stack out of the
+// goroutine started by withTimeout
+type handlerPanic struct {
+	value interface{}
+	stack []byte
+}
+
+// recoveryMiddleware turns a handler panic into a 500 problem response.
+// It sits inside loggingMiddleware so the 500 is what gets logged.
+func (s *APIServer) recoveryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wrapper := &responseWriterWrapper{
+			ResponseWriter: w,
+			statusCode:     http.StatusOK,
+		}
+
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			if err == http.ErrAbortHandler {
+				panic(err) // deliberate abort, let net/http handle it
+			}
+
+			stack := debug.Stack()
+			if p, ok := err.(handlerPanic); ok {
+				err, stack = p.value, p.stack
+			}
+			log.Printf("[%s] panic: %v\n%s", requestIDFromContext(r.Context()), err, stack)
+
+			if wrapper.wroteHeader {
+				// Too late for a problem response; drop the connection
+				// so the client sees a truncated reply, not a success
+				panic(http.ErrAbortHandler)
+			}
+			s.writeError(wrapper, r, http.StatusInternalServerError, "Internal server error",
+				"The server encountered an unexpected condition")
+		}()
+
+		next.ServeHTTP(wrapper, r)
+	})
+}
+
+// Route timeouts
+const (
+	defaultRouteTimeout = 5 * time.Second
+	healthTimeout       = 1 * time.Second
+)
+
+// withTimeout runs a handler with a deadline on its request context. If
+// the handler has not finished when the deadline passes, its buffered
+// output is discarded and a 503 problem response is sent instead.
+func (s *APIServer) withTimeout(timeout time.Duration, h http.HandlerFunc) http.Handler {
+	return s.timeoutMiddleware(timeout)(h)
+}
+
+func (s *APIServer) timeoutMiddleware(timeout time.Duration) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			r = r.WithContext(ctx)
+
+			// Start from the headers set so far (Vary, CORS, ...) so the
+			// handler can add to them rather than replace them
+			tw := &timeoutWriter{header: w.Header().Clone(), statusCode: http.StatusOK}
+			done := make(chan struct{})
+			panics := make(chan handlerPanic, 1)
+
+			go func() {
+				defer func() {
+					if err := recover(); err != nil {
+						panics <- handlerPanic{value: err, stack: debug.Stack()}
+					}
+				}()
+				next.ServeHTTP(tw, r)
+				close(done)
+			}()
+
+			select {
+			case p := <-panics:
+				panic(p) // re-raise on the serving goroutine for recoveryMiddleware
+			case <-done:
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				dst := w.Header()
+				for k := range dst {
+					if _, ok := tw.header[k]; !ok {
+						delete(dst, k) // removed by the handler
+					}
+				}
+				for k, v := range tw.header {
+					dst[k] = v
+				}
+				w.WriteHeader(tw.statusCode)
+				w.Write(tw.body.Bytes())
+			case <-ctx.Done():
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				tw.timedOut = true
+				if ctx.Err() == context.DeadlineExceeded {
+					s.writeError(w, r, http.StatusServiceUnavailable, "Request timed out",
+						fmt.Sprintf("The request did not complete within %v", timeout))
+				}
+				// Otherwise the client went away; there is nobody to answer
+			}
+		})
+	}
+}
+
+// timeoutWriter buffers a handler's response so it can be dropped
+// if the handler runs past its deadline
+type timeoutWriter struct {
+	mu          sync.Mutex
+	header      http.Header
+	body        bytes.Buffer
+	statusCode  int
+	wroteHeader bool
+	timedOut    bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) WriteHeader(statusCode int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+	tw.statusCode = statusCode
+	tw.wroteHeader = true
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	tw.wroteHeader = true
+	return tw.body.Write(b)
+}
+
+func (s *APIServer) loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		// Create a custom ResponseWriter to capture status code
+		wrapper := &responseWriterWrapper{
+			ResponseWriter: w,
+			statusCode:     http.StatusOK,
+		}
+
+		// Deferred so requests aborted by recoveryMiddleware are logged too
+		defer func() {
+			duration := time.Since(start)
+			log.Printf("[%s] %s %s %d %v", requestIDFromContext(r.Context()), r.Method, r.URL.Path, wrapper.statusCode, duration)
+		}()
+
+		next.ServeHTTP(wrapper, r)
+	})
+}
+
+func (s *APIServer) corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
+
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *APIServer) jsonMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// responseWriterWrapper wraps http.ResponseWriter to capture status code
+type responseWriterWrapper struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+}
+
+func (w *responseWriterWrapper) WriteHeader(statusCode int) {
+	if !w.wroteHeader {
+		w.statusCode = statusCode
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *responseWriterWrapper) Write(b []byte) (int, error) {
+	w.wroteHeader = true // an implicit 200
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush lets streaming handlers such as handleUserEvents push data
+// through the middleware chain
+func (w *responseWriterWrapper) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.wroteHeader = true
+		f.Flush()
+	}
+}
+
+// Hijack lets the chat server take over the connection for WebSockets,
+// recording the 101 the handshake sends behind our back
+func (w *responseWriterWrapper) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil {
+		w.statusCode = http.StatusSwitchingProtocols
+		w.wroteHeader = true
+	}
+	return conn, brw, err
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (w *responseWriterWrapper) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
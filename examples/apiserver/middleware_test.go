@@ -0,0 +1,162 @@
+package apiserver
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// logBuffer is a bytes.Buffer that server goroutines can log into
+// while the test reads it
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// captureLog redirects the standard logger for the duration of a test
+func captureLog(t *testing.T) *logBuffer {
+	buf := &logBuffer{}
+	log.SetOutput(buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return buf
+}
+
+func TestTimeoutMiddleware(t *testing.T) {
+	server := NewAPIServer()
+	logs := captureLog(t)
+
+	canceled := make(chan struct{})
+	slow := func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		close(canceled)
+		w.Write([]byte("too late"))
+	}
+	handler := server.withMiddleware(server.withTimeout(20*time.Millisecond, slow))
+
+	req := httptest.NewRequest("GET", "/api/v1/slow", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d; want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	if strings.Contains(rec.Body.String(), "too late") {
+		t.Errorf("body contains output written after the deadline: %q", rec.Body.String())
+	}
+
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("handler context was not canceled")
+	}
+
+	if !strings.Contains(logs.String(), "GET /api/v1/slow 503") {
+		t.Errorf("log = %q; want the 503 status recorded", logs.String())
+	}
+}
+
+func TestTimeoutMiddlewarePassesThroughFastResponses(t *testing.T) {
+	server := NewAPIServer()
+	fast := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Test", "yes")
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("short and stout"))
+	}
+
+	rec := httptest.NewRecorder()
+	server.withTimeout(time.Second, fast).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+
+	if rec.Code != http.StatusTeapot {
+		t.Errorf("status = %d; want %d", rec.Code, http.StatusTeapot)
+	}
+	if rec.Header().Get("X-Test") != "yes" {
+		t.Errorf("X-Test header = %q; want %q", rec.Header().Get("X-Test"), "yes")
+	}
+	if rec.Body.String() != "short and stout" {
+		t.Errorf("body = %q; want %q", rec.Body.String(), "short and stout")
+	}
+}
+
+func TestRecoveryLogsPanicInsideTimeout(t *testing.T) {
+	server := NewAPIServer()
+	logs := captureLog(t)
+
+	handler := server.withMiddleware(server.withTimeout(time.Second, func(w http.ResponseWriter, r *http.Request) {
+		panic("kaboom")
+	}))
+
+	req := httptest.NewRequest("GET", "/api/v1/panic", nil)
+	req.Header.Set("X-Request-ID", "req-42")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d; want %d", rec.Code, http.StatusInternalServerError)
+	}
+
+	out := logs.String()
+	tests := []string{
+		"[req-42] panic: kaboom",
+		"TestRecoveryLogsPanicInsideTimeout", // original stack, not the re-panic
+		"[req-42] GET /api/v1/panic 500",
+	}
+	for _, want := range tests {
+		if !strings.Contains(out, want) {
+			t.Errorf("log does not contain %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestRecoveryAbortsWhenHeadersAlreadySent(t *testing.T) {
+	server := NewAPIServer()
+	logs := captureLog(t)
+
+	handler := server.withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		panic("halfway")
+	}))
+
+	defer func() {
+		if err := recover(); err != http.ErrAbortHandler {
+			t.Errorf("recovered %v; want http.ErrAbortHandler", err)
+		}
+		if !strings.Contains(logs.String(), "GET /api/v1/partial 200") {
+			t.Errorf("log = %q; want the aborted request logged", logs.String())
+		}
+	}()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/v1/partial", nil))
+}
+
+func TestCORSPreflightAllowsPatch(t *testing.T) {
+	server := NewAPIServer()
+	req := httptest.NewRequest("OPTIONS", "/api/v2/users/1", nil)
+	req.Header.Set("Origin", "http://example.com")
+	req.Header.Set("Access-Control-Request-Method", "PATCH")
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d; want 200", rec.Code)
+	}
+	if allowed := rec.Header().Get("Access-Control-Allow-Methods"); !strings.Contains(allowed, "PATCH") {
+		t.Errorf("Access-Control-Allow-Methods = %q; want PATCH in it", allowed)
+	}
+}
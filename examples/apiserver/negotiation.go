@@ -0,0 +1,314 @@
+package apiserver
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Content negotiation: gzip response compression (Accept-Encoding) and
+// choosing a representation for list endpoints (Accept). Brotli would
+// compress text a little better, but needs a third-party encoder; gzip
+// is understood by every client.
+
+// minCompressSize is the smallest body worth compressing; below it the
+// gzip header and footer eat most of the saving
+const minCompressSize = 1024
+
+// incompressibleTypes are already compressed (or, for event streams,
+// must reach the client unbuffered)
+var incompressibleTypes = []string{
+	"image/png", "image/jpeg", "image/gif", "image/webp", "image/avif",
+	"video/", "audio/", "font/woff", "font/woff2",
+	"application/zip", "application/gzip", "application/x-gzip", "application/zstd",
+	"text/event-stream",
+}
+
+var gzipWriters = sync.Pool{
+	New: func() interface{} { return gzip.NewWriter(nil) },
+}
+
+// compressionMiddleware gzips responses for clients that accept it.
+// Small bodies, partial content and already compressed types are sent
+// as they are, and Vary tells caches the encoding depends on the request.
+func (s *APIServer) compressionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		if r.Method == http.MethodHead || r.Header.Get("Range") != "" ||
+			headerContainsToken(r.Header, "Connection", "upgrade") || !acceptsGzip(r.Header) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w}
+		defer cw.Close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// acceptsGzip reports whether Accept-Encoding allows gzip, honouring
+// q=0 refusals and the * wildcard
+func acceptsGzip(h http.Header) bool {
+	gzipQ, starQ := -1.0, -1.0
+	for _, value := range h.Values("Accept-Encoding") {
+		for _, part := range strings.Split(value, ",") {
+			coding, q := parseQuality(part)
+			switch strings.ToLower(coding) {
+			case "gzip", "x-gzip":
+				gzipQ = q
+			case "*":
+				starQ = q
+			}
+		}
+	}
+	if gzipQ >= 0 {
+		return gzipQ > 0
+	}
+	return starQ > 0
+}
+
+// parseQuality splits "token;q=0.5" into the token and its weight (1 if
+// not given)
+func parseQuality(part string) (string, float64) {
+	token, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+	q := 1.0
+	for _, p := range strings.Split(params, ";") {
+		name, value, ok := strings.Cut(strings.TrimSpace(p), "=")
+		if ok && strings.EqualFold(name, "q") {
+			if v, err := strconv.ParseFloat(value, 64); err == nil {
+				q = v
+			}
+		}
+	}
+	return strings.TrimSpace(token), q
+}
+
+// compressWriter holds back the first minCompressSize bytes of a body to
+// decide whether compressing is worthwhile. Flush decides at once, so
+// streaming responses are compressed as they go.
+type compressWriter struct {
+	http.ResponseWriter
+	status  int // 0 until WriteHeader or the first Write
+	buf     []byte
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.status != 0 {
+		return // superfluous; net/http would log it, the first one wins
+	}
+	w.status = status
+	if !w.compressible() {
+		w.start(false)
+	}
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.decided {
+		if w.gz != nil {
+			return w.gz.Write(p)
+		}
+		return w.ResponseWriter.Write(p)
+	}
+
+	w.buf = append(w.buf, p...)
+	if len(w.buf) >= minCompressSize {
+		if err := w.start(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush sends what has been written so far, compressed if eligible
+func (w *compressWriter) Flush() {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.decided {
+		w.start(true)
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Close finishes the response: small bodies go out uncompressed, and a
+// gzip stream gets its footer
+func (w *compressWriter) Close() error {
+	if !w.decided {
+		if w.status == 0 {
+			return nil // nothing written; net/http sends an empty 200
+		}
+		w.start(false)
+	}
+	if w.gz == nil {
+		return nil
+	}
+	err := w.gz.Close()
+	w.gz.Reset(nil)
+	gzipWriters.Put(w.gz)
+	w.gz = nil
+	return err
+}
+
+// Hijack is only possible before anything has been written
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if w.decided || len(w.buf) > 0 {
+		return nil, nil, errors.New("compressWriter: cannot hijack after writing")
+	}
+	w.decided = true // we must not write after a hijack
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *compressWriter) compressible() bool {
+	switch {
+	case w.status < 200, w.status == http.StatusNoContent,
+		w.status == http.StatusPartialContent, w.status == http.StatusNotModified:
+		return false
+	case w.Header().Get("Content-Encoding") != "":
+		return false
+	}
+	contentType := w.Header().Get("Content-Type")
+	for _, t := range incompressibleTypes {
+		if strings.HasPrefix(contentType, t) {
+			return false
+		}
+	}
+	return true
+}
+
+// start sends the header and any held-back bytes
+func (w *compressWriter) start(compress bool) error {
+	w.decided = true
+	compress = compress && w.compressible()
+
+	h := w.Header()
+	if compress {
+		if h.Get("Content-Type") == "" {
+			// Sniff before compressing, as net/http would have done
+			h.Set("Content-Type", http.DetectContentType(w.buf))
+		}
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		h.Del("Accept-Ranges")
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag) // the bytes differ, the resource does not
+		}
+		w.gz = gzipWriters.Get().(*gzip.Writer)
+		w.gz.Reset(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.gz != nil {
+		_, err = w.gz.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// Media types offered by list endpoints
+const (
+	mediaJSON   = "application/json"
+	mediaNDJSON = "application/x-ndjson"
+	mediaCSV    = "text/csv"
+)
+
+// preferredMediaType picks the offer the Accept header rates highest,
+// preferring earlier offers on ties. Versioned JSON types such as
+// application/vnd.go-learning-guide.v2+json count as application/json.
+// ok is false if the client accepts none of the offers.
+func preferredMediaType(h http.Header, offers ...string) (string, bool) {
+	values := h.Values("Accept")
+	if len(values) == 0 {
+		return offers[0], true
+	}
+
+	type mediaRange struct {
+		typ string
+		q   float64
+	}
+	var ranges []mediaRange
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			typ, q := parseQuality(part)
+			typ = strings.ToLower(typ)
+			if mt, _, err := mime.ParseMediaType(typ); err == nil {
+				typ = mt
+			}
+			if strings.HasPrefix(typ, "application/vnd.") && strings.HasSuffix(typ, "+json") {
+				typ = mediaJSON
+			}
+			ranges = append(ranges, mediaRange{typ, q})
+		}
+	}
+
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		// The most specific matching range decides an offer's weight
+		q, specificity := 0.0, -1
+		major, _, _ := strings.Cut(offer, "/")
+		for _, mr := range ranges {
+			s := -1
+			switch mr.typ {
+			case offer:
+				s = 2
+			case major + "/*":
+				s = 1
+			case "*/*":
+				s = 0
+			}
+			if s > specificity {
+				q, specificity = mr.q, s
+			}
+		}
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best, bestQ > 0
+}
+
+// listFormat negotiates the representation of a list endpoint: "" for
+// JSON, or a streaming export format. It writes a 406 and returns false
+// if the client accepts none of them.
+func (s *APIServer) listFormat(w http.ResponseWriter, r *http.Request) (string, bool) {
+	w.Header().Add("Vary", "Accept")
+	mediaType, ok := preferredMediaType(r.Header, mediaJSON, mediaNDJSON, mediaCSV)
+	if !ok {
+		s.writeError(w, r, http.StatusNotAcceptable, "Not acceptable",
+			"This list is available as "+mediaJSON+", "+mediaNDJSON+" or "+mediaCSV)
+		return "", false
+	}
+	switch mediaType {
+	case mediaNDJSON:
+		return FormatNDJSON, true
+	case mediaCSV:
+		return FormatCSV, true
+	}
+	return "", true
+}
@@ -0,0 +1,165 @@
+package apiserver
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompression(t *testing.T) {
+	server := NewAPIServer()
+	for i := 0; i < 50; i++ {
+		server.Store().CreateUser("Some User", "someone@example.com")
+	}
+
+	get := func(path, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/api/v1/users", "br, gzip;q=0.8")
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("large list not compressed; headers %v", rec.Header())
+	}
+	if !strings.Contains(strings.Join(rec.Header().Values("Vary"), ","), "Accept-Encoding") {
+		t.Errorf("Vary = %q; want Accept-Encoding", rec.Header().Values("Vary"))
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(zr)
+	if !strings.HasPrefix(string(body), `{"users":[`) {
+		t.Errorf("decompressed body = %.40q", body)
+	}
+
+	tests := []struct {
+		name, path, acceptEncoding string
+	}{
+		{"small body", "/api/v1/health", "gzip"},
+		{"not accepted", "/api/v1/users", ""},
+		{"refused", "/api/v1/users", "gzip;q=0, *"},
+	}
+	for _, tt := range tests {
+		rec := get(tt.path, tt.acceptEncoding)
+		if enc := rec.Header().Get("Content-Encoding"); enc != "" {
+			t.Errorf("%s: Content-Encoding = %q; want none", tt.name, enc)
+		}
+		if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Body.String(), "{") {
+			t.Errorf("%s: status %d, body %.20q", tt.name, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestCompressWriterSkipsCompressedTypes(t *testing.T) {
+	handler := (&APIServer{}).compressionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(make([]byte, 4096))
+	}))
+	req := httptest.NewRequest("GET", "/roadmap.png", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Header().Get("Content-Encoding") != "" || rec.Body.Len() != 4096 {
+		t.Errorf("PNG was re-compressed: %v, %d bytes", rec.Header(), rec.Body.Len())
+	}
+}
+
+func TestCompressWriterStreamsOnFlush(t *testing.T) {
+	handler := (&APIServer{}).compressionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Write([]byte("{\"n\":1}\n"))
+		w.(http.Flusher).Flush()
+		w.Write([]byte("{\"n\":2}\n"))
+	}))
+	req := httptest.NewRequest("GET", "/stream", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if !rec.Flushed || rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("flushed=%v encoding=%q; want a flushed gzip stream", rec.Flushed, rec.Header().Get("Content-Encoding"))
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := io.ReadAll(zr); string(body) != "{\"n\":1}\n{\"n\":2}\n" {
+		t.Errorf("body = %q", body)
+	}
+}
+
+func TestListNegotiation(t *testing.T) {
+	server := NewAPIServer()
+	server.Store().CreateUser("Ada Lovelace", "ada@example.com")
+
+	tests := []struct {
+		path, accept   string
+		wantStatus     int
+		wantType, want string
+	}{
+		{"/api/v1/users", "", 200, "application/json", `{"users":`},
+		{"/api/v1/users", "text/csv", 200, "text/csv", "id,name,email,created_at\n1,Ada Lovelace,"},
+		{"/api/v1/users", "application/x-ndjson", 200, "application/x-ndjson", `{"id":1,"name":"Ada Lovelace"`},
+		{"/api/v1/users", "text/csv;q=0.5, application/json", 200, "application/json", `{"users":`},
+		{"/api/v1/users", "text/*", 200, "text/csv", "id,"},
+		{"/api/v2/users", "text/csv", 200, "text/csv", "id,first_name,last_name,email,created_at,updated_at\n1,Ada,Lovelace,"},
+		{"/api/v2/users", "application/x-ndjson", 200, "application/x-ndjson", `{"id":"1","first_name":"Ada"`},
+		{"/api/users", "application/vnd.go-learning-guide.v2+json", 200, "application/json", `{"users":[{"id":"1"`},
+		{"/api/v1/users", "application/xml", 406, "application/problem+json", `{"type":"/problems/not-acceptable"`},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+
+		if rec.Code != tt.wantStatus {
+			t.Errorf("%s Accept %q: status = %d; want %d", tt.path, tt.accept, rec.Code, tt.wantStatus)
+			continue
+		}
+		if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, tt.wantType) {
+			t.Errorf("%s Accept %q: Content-Type = %q; want %s", tt.path, tt.accept, ct, tt.wantType)
+		}
+		if !strings.HasPrefix(rec.Body.String(), tt.want) {
+			t.Errorf("%s Accept %q: body = %.80q; want prefix %q", tt.path, tt.accept, rec.Body, tt.want)
+		}
+	}
+}
+
+func TestEmbeddedSite(t *testing.T) {
+	server := NewAPIServer()
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("GET / = %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	etag := rec.Header().Get("ETag")
+	if rec.Header().Get("Content-Encoding") != "gzip" || !strings.HasPrefix(etag, "W/") {
+		t.Errorf("index not compressed with a weak ETag: %v", rec.Header())
+	}
+
+	// The weakened ETag still revalidates
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("revalidation status = %d; want 304", rec.Code)
+	}
+}
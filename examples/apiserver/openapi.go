@@ -0,0 +1,723 @@
+package apiserver
+
+import (
+	"encoding"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"go-learning-guide/quiz"
+)
+
+// routeDoc describes one API operation for the OpenAPI document.
+// Every v1 route registered under /api/ in setupRoutes needs an entry
+// in routeDocs, keyed by "METHOD /path/template"; v2 routes are
+// documented from them, see v2Changes.
+type routeDoc struct {
+	OperationID string
+	Summary     string
+	Tag         string
+	Request     interface{} // request body type, nil if none
+	RequestType string      // request media type, application/json if empty
+	// AltRequests documents extra request media types, e.g. NDJSON
+	AltRequests map[string]interface{}
+	Status      int         // success status code
+	Response    interface{} // success response body type
+	ContentType string      // success media type, application/json if empty
+	// AltResponses documents other success media types, chosen by Accept
+	AltResponses map[string]interface{}
+	Errors       []int // error status codes returned as ProblemDetails
+	// OtherResponses documents non-problem bodies for other status codes
+	OtherResponses map[int]interface{}
+	Query          []queryParam
+	// UserKey marks routes that need the key of the user they act for,
+	// sent as a bearer token; see auth.go
+	UserKey bool
+}
+
+// queryParam documents one query string parameter
+type queryParam struct {
+	Name        string
+	Type        string // JSON Schema type, string if empty
+	Description string
+	Required    bool
+	Enum        []string
+}
+
+var routeDocs = map[string]routeDoc{
+	"GET /api/v1/users": {
+		OperationID:  "listUsers",
+		Summary:      "List all users",
+		Tag:          "users",
+		Status:       http.StatusOK,
+		Response:     UserListResponse{},
+		Errors:       []int{http.StatusNotAcceptable},
+		AltResponses: map[string]interface{}{mediaNDJSON: User{}, mediaCSV: ""},
+	},
+	"GET /api/v1/users/events": {
+		OperationID: "streamUserEvents",
+		Summary:     "Stream user changes as Server-Sent Events (supports Last-Event-ID)",
+		Tag:         "users",
+		Status:      http.StatusOK,
+		Response:    UserEvent{},
+		ContentType: "text/event-stream",
+		Errors:      []int{http.StatusBadRequest},
+	},
+	"POST /api/v1/users": {
+		OperationID: "createUser",
+		Summary:     "Create a user",
+		Tag:         "users",
+		Request:     UserRequest{},
+		Status:      http.StatusCreated,
+		Response:    User{},
+		Errors:      []int{http.StatusBadRequest},
+	},
+	"POST /api/v1/users:batch": {
+		OperationID: "batchUsers",
+		Summary:     "Create, update and delete many users in one request",
+		Tag:         "users",
+		Request:     BatchRequest{},
+		AltRequests: map[string]interface{}{"application/x-ndjson": BatchOp{}},
+		Status:      http.StatusOK,
+		Response:    BatchResponse{},
+		Errors:      []int{http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType},
+		// An atomic batch that was rolled back still reports every item
+		OtherResponses: map[int]interface{}{http.StatusUnprocessableEntity: BatchResponse{}},
+		Query: []queryParam{
+			{Name: "mode", Description: "atomic: all or nothing (default); best-effort: keep what succeeds",
+				Enum: []string{BatchAtomic, BatchBestEffort}},
+		},
+	},
+	"GET /api/v1/users/export": {
+		OperationID: "exportUsers",
+		Summary:     "Download every user as CSV or NDJSON",
+		Tag:         "users",
+		Status:      http.StatusOK,
+		Response:    "",
+		ContentType: "text/csv",
+		Errors:      []int{http.StatusBadRequest},
+		Query: []queryParam{
+			{Name: "format", Description: "csv (default) or ndjson", Enum: []string{FormatCSV, FormatNDJSON}},
+		},
+	},
+	"POST /api/v1/users/import": {
+		OperationID: "importUsers",
+		Summary:     "Create or update users from a CSV or NDJSON file",
+		Tag:         "users",
+		Request:     "",
+		RequestType: "text/csv",
+		AltRequests: map[string]interface{}{"application/x-ndjson": User{}},
+		Status:      http.StatusOK,
+		Response:    ImportReport{},
+		Errors:      []int{http.StatusBadRequest, http.StatusRequestEntityTooLarge},
+		Query: []queryParam{
+			{Name: "format", Description: "csv or ndjson; defaults from Content-Type, then csv",
+				Enum: []string{FormatCSV, FormatNDJSON}},
+			{Name: "dry_run", Type: "boolean", Description: "validate and count without changing anything"},
+			{Name: "map", Description: "rename a column as field:Column, e.g. name:Full Name (repeatable)"},
+		},
+	},
+	"GET /api/v1/users/{id:[0-9]+}": {
+		OperationID: "getUser",
+		Summary:     "Get a user by ID",
+		Tag:         "users",
+		Status:      http.StatusOK,
+		Response:    User{},
+		Errors:      []int{http.StatusBadRequest, http.StatusNotFound},
+	},
+	"PUT /api/v1/users/{id:[0-9]+}": {
+		OperationID: "updateUser",
+		Summary:     "Update a user",
+		Tag:         "users",
+		Request:     UserRequest{},
+		Status:      http.StatusOK,
+		Response:    User{},
+		Errors:      []int{http.StatusBadRequest, http.StatusNotFound},
+	},
+	"DELETE /api/v1/users/{id:[0-9]+}": {
+		OperationID: "deleteUser",
+		Summary:     "Delete a user",
+		Tag:         "users",
+		Status:      http.StatusOK,
+		Response:    MessageResponse{},
+		Errors:      []int{http.StatusBadRequest, http.StatusNotFound},
+	},
+	"GET /api/v1/users/{id:[0-9]+}/progress": {
+		OperationID: "getProgress",
+		Summary:     "A user's roadmap and exercise progress",
+		Tag:         "progress",
+		Status:      http.StatusOK,
+		Response:    Progress{},
+		Errors:      []int{http.StatusNotFound},
+	},
+	"PUT /api/v1/users/{id:[0-9]+}/progress": {
+		OperationID: "mergeProgress",
+		Summary:     "Merge a device's progress into the user's and return the result",
+		Tag:         "progress",
+		Request:     Progress{},
+		Status:      http.StatusOK,
+		Response:    Progress{},
+		Errors:      []int{http.StatusBadRequest, http.StatusNotFound},
+		UserKey:     true,
+	},
+	"DELETE /api/v1/users/{id:[0-9]+}/progress": {
+		OperationID: "resetProgress",
+		Summary:     "Forget a user's progress",
+		Tag:         "progress",
+		Status:      http.StatusNoContent,
+		Errors:      []int{http.StatusNotFound},
+		UserKey:     true,
+	},
+	"GET /api/v1/progress": {
+		OperationID: "listProgress",
+		Summary:     "Every user's progress in brief",
+		Tag:         "progress",
+		Status:      http.StatusOK,
+		Response:    ProgressListResponse{},
+	},
+	"GET /api/v1/quiz/questions": {
+		OperationID: "listQuestions",
+		Summary:     "Quiz questions, without their answers",
+		Tag:         "quiz",
+		Status:      http.StatusOK,
+		Response:    QuizQuestionsResponse{},
+		Errors:      []int{http.StatusBadRequest, http.StatusInternalServerError},
+		Query: []queryParam{
+			{Name: "difficulty", Type: "string", Description: "Only these levels: beginner, intermediate, advanced or all (repeat or separate with commas)"},
+		},
+	},
+	"GET /api/v1/quiz/questions/{qid}": {
+		OperationID: "getQuestion",
+		Summary:     "A quiz question, without its answer",
+		Tag:         "quiz",
+		Status:      http.StatusOK,
+		Response:    quiz.PublicQuestion{},
+		Errors:      []int{http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"POST /api/v1/quiz/questions/{qid}/answers": {
+		OperationID: "answerQuestion",
+		Summary:     "Grade a choice and record the attempt for a user",
+		Tag:         "quiz",
+		Request:     QuizAnswerRequest{},
+		Status:      http.StatusOK,
+		Response:    QuizAnswerResponse{},
+		Errors:      []int{http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError},
+		UserKey:     true,
+		Query: []queryParam{
+			{Name: "user_id", Type: "string", Description: "The user the attempt is recorded for; send their key", Required: true},
+		},
+	},
+	"GET /api/v1/quiz/challenges": {
+		OperationID: "listChallenges",
+		Summary:     "Coding challenges and their starting templates",
+		Tag:         "quiz",
+		Status:      http.StatusOK,
+		Response:    QuizChallengesResponse{},
+		Errors:      []int{http.StatusBadRequest, http.StatusInternalServerError},
+		Query: []queryParam{
+			{Name: "difficulty", Type: "string", Description: "Only these levels: beginner, intermediate, advanced or all (repeat or separate with commas)"},
+		},
+	},
+	"POST /api/v1/quiz/challenges/{cid}/runs": {
+		OperationID: "runChallenge",
+		Summary:     "Compile a solution and run the challenge's hidden tests against it (servers started with -code-runs only)",
+		Tag:         "quiz",
+		Request:     RunRequest{},
+		Status:      http.StatusOK,
+		Response:    RunResponse{},
+		Errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusRequestEntityTooLarge,
+			http.StatusUnsupportedMediaType, http.StatusInternalServerError, http.StatusServiceUnavailable},
+	},
+	"GET /api/v1/quiz/scores": {
+		OperationID: "listQuizScores",
+		Summary:     "Every user's quiz score; only first attempts count",
+		Tag:         "quiz",
+		Status:      http.StatusOK,
+		Response:    QuizScoresResponse{},
+		Errors:      []int{http.StatusInternalServerError},
+	},
+	"GET /api/v1/users/{id:[0-9]+}/quiz": {
+		OperationID: "getQuizResults",
+		Summary:     "A user's quiz answers and score",
+		Tag:         "quiz",
+		Status:      http.StatusOK,
+		Response:    QuizResultsResponse{},
+		Errors:      []int{http.StatusNotFound, http.StatusInternalServerError},
+		UserKey:     true,
+	},
+	"GET /api/v1/chat/rooms": {
+		OperationID: "listChatRooms",
+		Summary:     "List chat rooms and how many members each has",
+		Tag:         "chat",
+		Status:      http.StatusOK,
+		Response:    []ChatRoomInfo{},
+	},
+	"GET /api/v1/chat/rooms/{room}/messages": {
+		OperationID: "getChatHistory",
+		Summary:     "Recent messages in a chat room",
+		Tag:         "chat",
+		Status:      http.StatusOK,
+		Response:    []ChatMessage{},
+		Errors:      []int{http.StatusNotFound},
+	},
+	"GET /api/v1/chat/rooms/{room}/ws": {
+		OperationID: "joinChatRoom",
+		Summary:     "Join a chat room over WebSocket; send ChatInput, receive ChatMessage",
+		Tag:         "chat",
+		Status:      http.StatusSwitchingProtocols,
+		Errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound,
+			http.StatusUpgradeRequired, http.StatusServiceUnavailable},
+		UserKey: true,
+		Query: []queryParam{
+			{Name: "user_id", Type: "integer", Description: "The user to join as; their name is the nickname", Required: true},
+			{Name: "access_token", Description: "The user's key, for browsers, which can't send it as a header"},
+		},
+	},
+	"GET /api/v1/roadmap": {
+		OperationID: "getRoadmap",
+		Summary:     "The learning roadmap, with estimated durations per stage",
+		Tag:         "roadmap",
+		Status:      http.StatusOK,
+		Response:    RoadmapResponse{},
+		Errors:      []int{http.StatusBadRequest, http.StatusInternalServerError},
+		Query: []queryParam{
+			{Name: "stage", Type: "string", Description: "Only these stages: beginner, intermediate or advanced (repeat or separate with commas)"},
+		},
+	},
+	"GET /api/v1/syntax": {
+		OperationID: "compareSyntax",
+		Summary:     "Go, Python and Java snippets for a concept, best matches first",
+		Tag:         "syntax",
+		Status:      http.StatusOK,
+		Response:    SyntaxResponse{},
+		Errors:      []int{http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError},
+		Query: []queryParam{
+			{Name: "concept", Type: "string", Description: "Concept to look up; matched loosely. Omit to list every concept"},
+			{Name: "lang", Type: "string", Description: "Only these languages, e.g. python (repeat or separate with commas)"},
+		},
+	},
+	"GET /api/v1/health": {
+		OperationID: "getHealth",
+		Summary:     "Service health check",
+		Tag:         "system",
+		Status:      http.StatusOK,
+		Response:    HealthResponse{},
+	},
+	"GET /api/v1/metrics/requests": {
+		OperationID: "getRequestMetrics",
+		Summary:     "Requests served, by route",
+		Tag:         "system",
+		Status:      http.StatusOK,
+		Response:    RequestMetricsResponse{},
+	},
+	"GET /api/v1/openapi.json": {
+		OperationID: "getOpenAPI",
+		Summary:     "This OpenAPI document",
+		Tag:         "system",
+		Status:      http.StatusOK,
+		Response:    map[string]interface{}{},
+		Errors:      []int{http.StatusInternalServerError},
+	},
+}
+
+// v2 serves v1's routes at paths with opaque user IDs, so a v2 route
+// is documented from its v1 counterpart: same summary and responses,
+// the v2 user schemas and a V2 operationId. v2Changes lists the routes
+// whose behaviour differs beyond that.
+var v2Changes = map[string]struct {
+	v1     string // v1 route to start from, if not the same method and path
+	adjust func(*routeDoc)
+}{
+	"GET /api/v2/users": {adjust: func(d *routeDoc) {
+		d.Summary = "List all users in ID order"
+	}},
+	"GET /api/v2/users/{id}": {adjust: func(d *routeDoc) {
+		// opaque IDs: one that isn't a number is just not found
+		d.Errors = withoutStatus(d.Errors, http.StatusBadRequest)
+	}},
+	"PATCH /api/v2/users/{id}": {v1: "PUT /api/v1/users/{id:[0-9]+}", adjust: func(d *routeDoc) {
+		d.Summary = "Change some of a user's fields"
+	}},
+	"DELETE /api/v2/users/{id}": {adjust: func(d *routeDoc) {
+		d.Errors = withoutStatus(d.Errors, http.StatusBadRequest)
+		d.Status = http.StatusNoContent
+		d.Response = nil
+	}},
+}
+
+// routeDocFor returns the documentation for the route with this key,
+// deriving v2 routes from v1 as described at v2Changes
+func routeDocFor(key string) (routeDoc, bool) {
+	if doc, ok := routeDocs[key]; ok {
+		return doc, true
+	}
+	method, path, _ := strings.Cut(key, " ")
+	rest, ok := strings.CutPrefix(path, "/api/v2/")
+	if !ok {
+		return routeDoc{}, false
+	}
+	change := v2Changes[key]
+	v1Key := change.v1
+	if v1Key == "" {
+		v1Key = method + " /api/v1/" + strings.ReplaceAll(rest, "{id}", "{id:[0-9]+}")
+	}
+	doc, ok := routeDocs[v1Key]
+	if !ok {
+		return routeDoc{}, false
+	}
+	doc.OperationID += "V2"
+	doc.Request = userSchemaV2(doc.Request)
+	doc.Response = userSchemaV2(doc.Response)
+	if doc.AltResponses != nil {
+		alt := make(map[string]interface{}, len(doc.AltResponses))
+		for mediaType, v := range doc.AltResponses {
+			alt[mediaType] = userSchemaV2(v)
+		}
+		doc.AltResponses = alt
+	}
+	if change.adjust != nil {
+		change.adjust(&doc)
+	}
+	return doc, true
+}
+
+// userSchemaV2 swaps a v1 user body type for its v2 equivalent
+func userSchemaV2(v interface{}) interface{} {
+	switch v.(type) {
+	case User:
+		return UserV2{}
+	case UserRequest:
+		return UserRequestV2{}
+	case UserListResponse:
+		return UserListResponseV2{}
+	}
+	return v
+}
+
+// withoutStatus returns codes without status, leaving codes untouched
+func withoutStatus(codes []int, status int) []int {
+	var out []int
+	for _, code := range codes {
+		if code != status {
+			out = append(out, code)
+		}
+	}
+	return out
+}
+
+// apiRoute is a single method + path template found in the router
+type apiRoute struct {
+	Method   string
+	Template string
+}
+
+func (r apiRoute) key() string {
+	return r.Method + " " + r.Template
+}
+
+// apiRoutes walks the router and returns every method/path pair under /api/
+func (s *APIServer) apiRoutes() ([]apiRoute, error) {
+	var routes []apiRoute
+	err := s.router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		tpl, err := route.GetPathTemplate()
+		if err != nil || !strings.HasPrefix(tpl, "/api/") {
+			return nil
+		}
+		if route.GetHandler() == nil {
+			return nil // subrouter prefix, not an endpoint
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return fmt.Errorf("route %s must declare its HTTP methods", tpl)
+		}
+		for _, m := range methods {
+			routes = append(routes, apiRoute{Method: m, Template: tpl})
+		}
+		return nil
+	})
+	return routes, err
+}
+
+// openAPISpec builds (once) the OpenAPI 3.1 document for the router
+func (s *APIServer) openAPISpec() (map[string]interface{}, error) {
+	s.specOnce.Do(func() {
+		routes, err := s.apiRoutes()
+		if err != nil {
+			s.specErr = err
+			return
+		}
+		s.spec, s.specErr = buildOpenAPISpec(routes)
+	})
+	return s.spec, s.specErr
+}
+
+// pathVarPattern matches gorilla/mux variables such as {id:[0-9]+}
+var pathVarPattern = regexp.MustCompile(`\{([^}:]+)(?::([^}]+))?\}`)
+
+func buildOpenAPISpec(routes []apiRoute) (map[string]interface{}, error) {
+	gen := &schemaGenerator{schemas: make(map[string]interface{})}
+	paths := make(map[string]interface{})
+
+	var missing []string
+	for _, route := range routes {
+		doc, ok := routeDocFor(route.key())
+		if !ok {
+			missing = append(missing, route.key())
+			continue
+		}
+
+		// Convert {id:[0-9]+} to {id} and describe the variable
+		var params []interface{}
+		for _, m := range pathVarPattern.FindAllStringSubmatch(route.Template, -1) {
+			schema := map[string]interface{}{"type": "string"}
+			if m[2] == "[0-9]+" {
+				schema = map[string]interface{}{"type": "integer", "minimum": 1}
+			} else if m[2] != "" {
+				schema["pattern"] = "^" + m[2] + "$"
+			}
+			params = append(params, map[string]interface{}{
+				"name":     m[1],
+				"in":       "path",
+				"required": true,
+				"schema":   schema,
+			})
+		}
+		for _, q := range doc.Query {
+			schema := map[string]interface{}{"type": "string"}
+			if q.Type != "" {
+				schema["type"] = q.Type
+			}
+			if len(q.Enum) > 0 {
+				schema["enum"] = q.Enum
+			}
+			params = append(params, map[string]interface{}{
+				"name":        q.Name,
+				"in":          "query",
+				"description": q.Description,
+				"required":    q.Required,
+				"schema":      schema,
+			})
+		}
+		path := pathVarPattern.ReplaceAllString(route.Template, "{$1}")
+
+		success := map[string]interface{}{
+			"description": http.StatusText(doc.Status),
+		}
+		if doc.Response != nil {
+			content := gen.content(doc.ContentType, doc.Response)
+			for mediaType, v := range doc.AltResponses {
+				for k, c := range gen.content(mediaType, v) {
+					content[k] = c
+				}
+			}
+			success["content"] = content
+		}
+		responses := map[string]interface{}{
+			strconv.Itoa(doc.Status): success,
+		}
+		for _, code := range doc.Errors {
+			responses[strconv.Itoa(code)] = map[string]interface{}{
+				"description": http.StatusText(code),
+				"content":     gen.problemContent(),
+			}
+		}
+		for code, v := range doc.OtherResponses {
+			responses[strconv.Itoa(code)] = map[string]interface{}{
+				"description": http.StatusText(code),
+				"content":     gen.jsonContent(v),
+			}
+		}
+		responses["default"] = map[string]interface{}{
+			"description": "Unexpected error",
+			"content":     gen.problemContent(),
+		}
+
+		if doc.UserKey {
+			responses[strconv.Itoa(http.StatusUnauthorized)] = map[string]interface{}{
+				"description": http.StatusText(http.StatusUnauthorized),
+				"content":     gen.problemContent(),
+			}
+		}
+
+		op := map[string]interface{}{
+			"operationId": doc.OperationID,
+			"summary":     doc.Summary,
+			"tags":        []string{doc.Tag},
+			"responses":   responses,
+		}
+		if doc.UserKey {
+			op["security"] = []interface{}{map[string]interface{}{"userKey": []string{}}}
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+		if v, ok := apiVersionOf(route.Template); ok && !v.Deprecated.IsZero() {
+			op["deprecated"] = true
+		}
+		if doc.Request != nil {
+			content := gen.content(doc.RequestType, doc.Request)
+			for mediaType, v := range doc.AltRequests {
+				for k, c := range gen.content(mediaType, v) {
+					content[k] = c
+				}
+			}
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content":  content,
+			}
+		}
+
+		item, _ := paths[path].(map[string]interface{})
+		if item == nil {
+			item = make(map[string]interface{})
+			paths[path] = item
+		}
+		item[strings.ToLower(route.Method)] = op
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("routes without OpenAPI documentation: %s", strings.Join(missing, ", "))
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.1.0",
+		"info": map[string]interface{}{
+			"title":   "User API",
+			"version": "2.0.0",
+		},
+		"servers": []interface{}{
+			map[string]interface{}{"url": "http://localhost:8080"},
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": gen.schemas,
+			"securitySchemes": map[string]interface{}{
+				"userKey": map[string]interface{}{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "The key of the user being changed, from guide -user-key",
+				},
+			},
+		},
+	}, nil
+}
+
+// schemaGenerator turns Go types into JSON Schema, collecting named
+// struct types under components/schemas
+type schemaGenerator struct {
+	schemas map[string]interface{}
+}
+
+func (g *schemaGenerator) jsonContent(v interface{}) map[string]interface{} {
+	return g.content("application/json", v)
+}
+
+func (g *schemaGenerator) content(mediaType string, v interface{}) map[string]interface{} {
+	if mediaType == "" {
+		mediaType = "application/json"
+	}
+	return map[string]interface{}{
+		mediaType: map[string]interface{}{
+			"schema": g.schemaFor(reflect.TypeOf(v)),
+		},
+	}
+}
+
+func (g *schemaGenerator) problemContent() map[string]interface{} {
+	return map[string]interface{}{
+		"application/problem+json": map[string]interface{}{
+			"schema": g.schemaFor(reflect.TypeOf(ProblemDetails{})),
+		},
+	}
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+func (g *schemaGenerator) schemaFor(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	if t.Implements(textMarshalerType) {
+		// Written as text, e.g. a circuit breaker's state
+		return map[string]interface{}{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": g.schemaFor(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schemaFor(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		if _, done := g.schemas[t.Name()]; !done {
+			g.schemas[t.Name()] = nil // guard against recursive types
+			g.schemas[t.Name()] = g.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+func (g *schemaGenerator) structSchema(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	required := []string{}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			// encoding/json promotes an embedded struct's fields
+			embedded := g.structSchema(field.Type)
+			for k, v := range embedded["properties"].(map[string]interface{}) {
+				properties[k] = v
+			}
+			required = append(required, embedded["required"].([]string)...)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = g.schemaFor(field.Type)
+		if !strings.Contains(opts, "omitempty") {
+			required = append(required, name)
+		}
+	}
+
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+}
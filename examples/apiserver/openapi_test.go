@@ -0,0 +1,176 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOpenAPIDocumentsEveryRoute(t *testing.T) {
+	server := NewAPIServer()
+
+	routes, err := server.apiRoutes()
+	if err != nil {
+		t.Fatalf("apiRoutes() error: %v", err)
+	}
+
+	registered := make(map[string]bool)
+	for _, route := range routes {
+		registered[route.key()] = true
+		if _, ok := routeDocFor(route.key()); !ok {
+			t.Errorf("route %q has no entry in routeDocs", route.key())
+		}
+	}
+
+	for key := range routeDocs {
+		if !registered[key] {
+			t.Errorf("routeDocs entry %q does not match any registered route", key)
+		}
+	}
+	for key, change := range v2Changes {
+		if !registered[key] {
+			t.Errorf("v2Changes entry %q does not match any registered route", key)
+		}
+		if change.v1 != "" && !registered[change.v1] {
+			t.Errorf("v2Changes entry %q starts from unregistered route %q", key, change.v1)
+		}
+	}
+}
+
+func TestV2RouteDocsFollowV1(t *testing.T) {
+	doc, ok := routeDocFor("GET /api/v2/users")
+	if !ok {
+		t.Fatal("no doc for GET /api/v2/users")
+	}
+	v1 := routeDocs["GET /api/v1/users"]
+	if doc.OperationID != "listUsersV2" || doc.Tag != v1.Tag || !reflect.DeepEqual(doc.Errors, v1.Errors) {
+		t.Errorf("operationId, tag, errors = %q, %q, %v; want listUsersV2, %q, %v", doc.OperationID, doc.Tag, doc.Errors, v1.Tag, v1.Errors)
+	}
+	if _, ok := doc.Response.(UserListResponseV2); !ok {
+		t.Errorf("response = %T; want UserListResponseV2", doc.Response)
+	}
+	if _, ok := doc.AltResponses[mediaNDJSON].(UserV2); !ok {
+		t.Errorf("NDJSON response = %T; want UserV2", doc.AltResponses[mediaNDJSON])
+	}
+	if _, ok := v1.AltResponses[mediaNDJSON].(User); !ok {
+		t.Errorf("v1 NDJSON response changed to %T", v1.AltResponses[mediaNDJSON])
+	}
+
+	doc, ok = routeDocFor("PATCH /api/v2/users/{id}")
+	if !ok {
+		t.Fatal("no doc for PATCH /api/v2/users/{id}")
+	}
+	if doc.OperationID != "updateUserV2" {
+		t.Errorf("operationId = %q; want updateUserV2", doc.OperationID)
+	}
+	if _, ok := doc.Request.(UserRequestV2); !ok {
+		t.Errorf("request = %T; want UserRequestV2", doc.Request)
+	}
+
+	doc, _ = routeDocFor("DELETE /api/v2/users/{id}")
+	if doc.Status != http.StatusNoContent || doc.Response != nil || !reflect.DeepEqual(doc.Errors, []int{http.StatusNotFound}) {
+		t.Errorf("DELETE doc = status %d, response %T, errors %v; want 204, none, [404]", doc.Status, doc.Response, doc.Errors)
+	}
+	if v1 := routeDocs["DELETE /api/v1/users/{id:[0-9]+}"]; len(v1.Errors) != 2 {
+		t.Errorf("v1 DELETE errors changed to %v", v1.Errors)
+	}
+
+	if _, ok := routeDocFor("GET /api/v2/nothing"); ok {
+		t.Error("routeDocFor found a doc for a route v1 doesn't have")
+	}
+}
+
+func TestBuildOpenAPISpecRejectsUndocumentedRoute(t *testing.T) {
+	_, err := buildOpenAPISpec([]apiRoute{{Method: "PATCH", Template: "/api/v1/users/{id:[0-9]+}"}})
+	if err == nil {
+		t.Fatal("buildOpenAPISpec() succeeded for an undocumented route; want error")
+	}
+	if !strings.Contains(err.Error(), "PATCH /api/v1/users/{id:[0-9]+}") {
+		t.Errorf("error %q does not name the undocumented route", err)
+	}
+}
+
+func TestOpenAPIEndpoint(t *testing.T) {
+	server := NewAPIServer()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil)
+	rec := httptest.NewRecorder()
+	server.router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /api/v1/openapi.json status = %d; want %d", rec.Code, http.StatusOK)
+	}
+
+	var spec struct {
+		OpenAPI    string                                `json:"openapi"`
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas map[string]json.RawMessage `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&spec); err != nil {
+		t.Fatalf("decoding spec: %v", err)
+	}
+
+	if spec.OpenAPI != "3.1.0" {
+		t.Errorf("openapi = %q; want %q", spec.OpenAPI, "3.1.0")
+	}
+
+	tests := []struct {
+		path   string
+		method string
+	}{
+		{"/api/v1/users", "get"},
+		{"/api/v1/users", "post"},
+		{"/api/v1/users/{id}", "get"},
+		{"/api/v1/users/{id}", "put"},
+		{"/api/v1/users/{id}", "delete"},
+		{"/api/v1/health", "get"},
+	}
+	for _, tt := range tests {
+		if _, ok := spec.Paths[tt.path][tt.method]; !ok {
+			t.Errorf("spec is missing %s %s", strings.ToUpper(tt.method), tt.path)
+		}
+	}
+
+	for _, name := range []string{"User", "UserRequest", "ProblemDetails"} {
+		if _, ok := spec.Components.Schemas[name]; !ok {
+			t.Errorf("spec is missing schema %q", name)
+		}
+	}
+}
+
+func TestSchemaForUser(t *testing.T) {
+	gen := &schemaGenerator{schemas: make(map[string]interface{})}
+	ref := gen.schemaFor(reflect.TypeOf(User{}))
+
+	if ref["$ref"] != "#/components/schemas/User" {
+		t.Fatalf("schemaFor(User) = %v; want $ref to User", ref)
+	}
+
+	schema := gen.schemas["User"].(map[string]interface{})
+	props := schema["properties"].(map[string]interface{})
+
+	tests := []struct {
+		property string
+		wantType string
+	}{
+		{"id", "integer"},
+		{"name", "string"},
+		{"email", "string"},
+		{"created_at", "string"},
+	}
+	for _, tt := range tests {
+		prop, ok := props[tt.property].(map[string]interface{})
+		if !ok {
+			t.Errorf("User schema is missing property %q", tt.property)
+			continue
+		}
+		if prop["type"] != tt.wantType {
+			t.Errorf("User.%s type = %v; want %s", tt.property, prop["type"], tt.wantType)
+		}
+	}
+}
@@ -0,0 +1,643 @@
+package apiserver
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Durability for UserStore. Every change is appended to a write-ahead
+// log before it is applied to the map, and now and then the whole store
+// is written to a snapshot so older log segments can be deleted. A
+// store directory holds
+//
+//	snapshot.json         users and next ID as of log sequence number N
+//	wal-<first seq>.log   log segments, replayed on top of the snapshot
+//
+// Each log record is a 4-byte little-endian payload length, the CRC-32C
+// of the payload, then the payload: a JSON walRecord. A crash can leave
+// a partial record at the end of the newest segment; it is cut off when
+// the store is opened again.
+
+// SyncPolicy controls when the log is flushed to stable storage
+type SyncPolicy int
+
+const (
+	// SyncAlways fsyncs before a change is acknowledged (the default)
+	SyncAlways SyncPolicy = iota
+	// SyncInterval fsyncs in the background every SyncInterval; a crash
+	// can lose that much acknowledged work
+	SyncInterval
+	// SyncNever leaves flushing to the operating system
+	SyncNever
+)
+
+// PersistOptions configures OpenUserStore. The zero value is safe.
+type PersistOptions struct {
+	Sync         SyncPolicy
+	SyncInterval time.Duration // for SyncInterval; default 1s
+	// SnapshotEvery starts a background snapshot after this many log
+	// records; 0 means 10000 and a negative value turns it off
+	SnapshotEvery int
+}
+
+const (
+	defaultSyncInterval  = time.Second
+	defaultSnapshotEvery = 10000
+
+	walHeaderSize     = 8
+	maxWALRecordBytes = 256 << 20
+	snapshotFileName  = "snapshot.json"
+)
+
+// ErrCorruptLog means the log is damaged somewhere other than its tail
+var ErrCorruptLog = errors.New("corrupt write-ahead log")
+
+var walCRCTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Log operations
+const (
+	walPut      = "put"      // store the user as given
+	walDelete   = "delete"   // remove the user with this ID
+	walProgress = "progress" // store the progress of user ID as given (none: clear it)
+	walQuiz     = "quiz"     // store the quiz answers of user ID as given (none: clear them)
+)
+
+type walOp struct {
+	Op       string      `json:"op"`
+	User     User        `json:"user"`
+	Progress *Progress   `json:"progress,omitempty"`
+	Quiz     *QuizRecord `json:"quiz,omitempty"`
+}
+
+// walRecord is one atomic change: a single mutation, a whole batch or
+// one imported row
+type walRecord struct {
+	Seq    uint64  `json:"seq"`
+	NextID int     `json:"next_id"`
+	Ops    []walOp `json:"ops"`
+}
+
+type storeSnapshot struct {
+	Seq    uint64 `json:"seq"` // last log record included
+	NextID int    `json:"next_id"`
+	// LastEvent is the ID of the last event published, so event IDs
+	// carry on after a restart; each put or delete in the log after the
+	// snapshot published one more
+	LastEvent uint64 `json:"last_event,omitempty"`
+	Users     []User `json:"users"`
+	// Progress and Quiz were added later; older snapshots have none
+	Progress []Progress   `json:"progress,omitempty"`
+	Quiz     []QuizRecord `json:"quiz,omitempty"`
+}
+
+// userLog is the write-ahead log of a persistent UserStore. Records are
+// appended with the store's write lock held; mu also guards the file
+// against the background syncer and segment rotation.
+type userLog struct {
+	dir  string
+	opts PersistOptions
+
+	mu            sync.Mutex
+	file          *os.File
+	segStart      uint64 // sequence number of the current segment's first record
+	seq           uint64 // last sequence number written
+	dirty         bool   // written but not yet fsynced
+	sinceSnapshot int
+	// err is sticky. After a failed write or fsync we cannot know what
+	// reached the disk (the kernel may even have dropped the dirty
+	// pages), so the store refuses further changes, as databases do.
+	err error
+
+	snapMu sync.Mutex // one snapshot at a time
+	snapCh chan struct{}
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// OpenUserStore loads a store from dir, creating the directory if
+// needed, and logs every later change there. Call Close when done.
+func OpenUserStore(dir string, opts PersistOptions) (*UserStore, error) {
+	if opts.SyncInterval <= 0 {
+		opts.SyncInterval = defaultSyncInterval
+	}
+	if opts.SnapshotEvery == 0 {
+		opts.SnapshotEvery = defaultSnapshotEvery
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	s := NewUserStore()
+	secret, err := loadSecret(dir)
+	if err != nil {
+		return nil, err
+	}
+	s.secret = secret
+	snap, err := readSnapshot(dir)
+	if err != nil {
+		return nil, err
+	}
+	for i := range snap.Users {
+		user := snap.Users[i]
+		s.users[user.ID] = &user
+	}
+	for i := range snap.Progress {
+		p := snap.Progress[i].clone()
+		s.progress[p.UserID] = &p
+	}
+	for i := range snap.Quiz {
+		r := snap.Quiz[i].clone()
+		s.quiz[r.UserID] = &r
+	}
+	if snap.NextID > s.nextID {
+		s.nextID = snap.NextID
+	}
+	s.events.resume(snap.LastEvent)
+
+	segments, err := listSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+	seq := snap.Seq
+	for i, start := range segments {
+		path := filepath.Join(dir, segmentName(start))
+		valid, torn, err := readSegment(path, func(rec walRecord) error {
+			if rec.Seq <= seq {
+				return nil // already in the snapshot
+			}
+			if rec.Seq != seq+1 {
+				return fmt.Errorf("%w: %s: record %d follows %d", ErrCorruptLog, path, rec.Seq, seq)
+			}
+			if err := s.replay(rec); err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			seq = rec.Seq
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if torn {
+			if i != len(segments)-1 {
+				return nil, fmt.Errorf("%w: %s is damaged at byte %d", ErrCorruptLog, path, valid)
+			}
+			log.Printf("store: discarding incomplete record at byte %d of %s", valid, path)
+			if err := truncateFile(path, valid); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	l := &userLog{
+		dir:    dir,
+		opts:   opts,
+		seq:    seq,
+		snapCh: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	if len(segments) > 0 {
+		l.segStart = segments[len(segments)-1]
+	} else {
+		l.segStart = seq + 1
+	}
+	if l.file, err = openSegment(dir, l.segStart); err != nil {
+		return nil, err
+	}
+
+	s.wal = l
+	l.wg.Add(1)
+	go l.run(s)
+	return s, nil
+}
+
+// replay applies a recovered record. No events are published, but the
+// IDs they had are used up.
+func (s *UserStore) replay(rec walRecord) error {
+	for _, op := range rec.Ops {
+		switch op.Op {
+		case walPut:
+			user := op.User
+			s.users[user.ID] = &user
+			s.events.resume(s.events.lastID() + 1)
+		case walDelete:
+			s.events.resume(s.events.lastID() + 1)
+			delete(s.users, op.User.ID)
+			delete(s.progress, op.User.ID)
+			delete(s.quiz, op.User.ID)
+		case walProgress:
+			if op.Progress == nil {
+				delete(s.progress, op.User.ID)
+			} else {
+				p := op.Progress.clone()
+				s.progress[op.User.ID] = &p
+			}
+		case walQuiz:
+			if op.Quiz == nil {
+				delete(s.quiz, op.User.ID)
+			} else {
+				r := op.Quiz.clone()
+				s.quiz[op.User.ID] = &r
+			}
+		default:
+			return fmt.Errorf("%w: record %d has unknown op %q", ErrCorruptLog, rec.Seq, op.Op)
+		}
+	}
+	if rec.NextID > s.nextID {
+		s.nextID = rec.NextID
+	}
+	return nil
+}
+
+// Snapshot writes the whole store to disk and deletes the log segments
+// it replaces. It runs automatically every PersistOptions.SnapshotEvery
+// records; changes carry on while the snapshot is written.
+func (s *UserStore) Snapshot() error {
+	l := s.wal
+	if l == nil {
+		return errors.New("store is not persistent")
+	}
+	l.snapMu.Lock()
+	defer l.snapMu.Unlock()
+
+	// Copy the users and start a new segment at the same moment, so the
+	// snapshot covers exactly the segments before the new one
+	s.mu.RLock()
+	snap := storeSnapshot{NextID: s.nextID, LastEvent: s.events.lastID(), Users: make([]User, 0, len(s.users))}
+	for _, user := range s.users {
+		snap.Users = append(snap.Users, *user)
+	}
+	for _, p := range s.progress {
+		snap.Progress = append(snap.Progress, p.clone())
+	}
+	for _, r := range s.quiz {
+		snap.Quiz = append(snap.Quiz, r.clone())
+	}
+	seq, segStart, err := l.rotate()
+	s.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	snap.Seq = seq
+	sort.Slice(snap.Users, func(i, j int) bool { return snap.Users[i].ID < snap.Users[j].ID })
+	sort.Slice(snap.Progress, func(i, j int) bool { return snap.Progress[i].UserID < snap.Progress[j].UserID })
+	sort.Slice(snap.Quiz, func(i, j int) bool { return snap.Quiz[i].UserID < snap.Quiz[j].UserID })
+
+	if err := writeSnapshot(l.dir, snap); err != nil {
+		return err
+	}
+
+	// Compaction: everything before the current segment is now redundant
+	segments, err := listSegments(l.dir)
+	if err != nil {
+		return err
+	}
+	for _, start := range segments {
+		if start < segStart {
+			if err := os.Remove(filepath.Join(l.dir, segmentName(start))); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Close flushes the log and stops background work. The store must not
+// be changed afterwards; closing an in-memory store does nothing.
+func (s *UserStore) Close() error {
+	l := s.wal
+	if l == nil {
+		return nil
+	}
+	select {
+	case <-l.done:
+		return nil // already closed
+	default:
+		close(l.done)
+	}
+	l.wg.Wait()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.syncLocked()
+	if err := l.file.Close(); err != nil && l.err == nil {
+		l.err = err
+	}
+	return l.err
+}
+
+// logLocked appends a change ahead of applying it. The store's write lock
+// must be held, and commitLocked called before it is released. A change
+// that cannot be logged is fatal: the panic becomes a 500 response via
+// the recovery middleware, and the store refuses later changes.
+func (s *UserStore) logLocked(ops ...walOp) {
+	if s.wal == nil {
+		return
+	}
+	nextID := s.nextID
+	for _, op := range ops {
+		if op.User.ID >= nextID {
+			nextID = op.User.ID + 1
+		}
+	}
+	if err := s.wal.append(nextID, ops); err != nil {
+		panic(fmt.Errorf("apiserver: logging user change: %w", err))
+	}
+}
+
+// commitLocked makes logged changes durable according to the sync policy
+func (s *UserStore) commitLocked() {
+	if s.wal == nil {
+		return
+	}
+	if err := s.wal.commit(); err != nil {
+		panic(fmt.Errorf("apiserver: syncing user log: %w", err))
+	}
+}
+
+func (l *userLog) append(nextID int, ops []walOp) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.err != nil {
+		return l.err
+	}
+	frame, err := encodeWALRecord(walRecord{Seq: l.seq + 1, NextID: nextID, Ops: ops})
+	if err != nil {
+		return err
+	}
+	if _, err := l.file.Write(frame); err != nil {
+		l.err = err
+		return err
+	}
+	l.seq++
+	l.dirty = true
+	l.sinceSnapshot++
+	return nil
+}
+
+func (l *userLog) commit() error {
+	l.mu.Lock()
+	if l.opts.Sync == SyncAlways {
+		l.syncLocked()
+	}
+	err := l.err
+	due := l.opts.SnapshotEvery > 0 && l.sinceSnapshot >= l.opts.SnapshotEvery
+	l.mu.Unlock()
+
+	if due {
+		select {
+		case l.snapCh <- struct{}{}:
+		default: // one is already pending
+		}
+	}
+	return err
+}
+
+func (l *userLog) syncLocked() {
+	if !l.dirty || l.err != nil {
+		return
+	}
+	if err := l.file.Sync(); err != nil {
+		l.err = err
+		return
+	}
+	l.dirty = false
+}
+
+// rotate closes the current segment and starts a new one. It returns the
+// last sequence number written and the new segment's first sequence
+// number. The caller must stop appends by holding the store lock.
+func (l *userLog) rotate() (seq, segStart uint64, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.err != nil {
+		return 0, 0, l.err
+	}
+	l.sinceSnapshot = 0
+	if l.segStart == l.seq+1 {
+		return l.seq, l.segStart, nil // current segment is still empty
+	}
+
+	l.syncLocked()
+	if l.err != nil {
+		return 0, 0, l.err
+	}
+	file, err := openSegment(l.dir, l.seq+1)
+	if err != nil {
+		return 0, 0, err
+	}
+	l.file.Close()
+	l.file, l.segStart = file, l.seq+1
+	return l.seq, l.segStart, nil
+}
+
+// run does background fsyncs and snapshots until Close
+func (l *userLog) run(s *UserStore) {
+	defer l.wg.Done()
+
+	var tick <-chan time.Time
+	if l.opts.Sync == SyncInterval {
+		ticker := time.NewTicker(l.opts.SyncInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-tick:
+			l.mu.Lock()
+			l.syncLocked()
+			l.mu.Unlock()
+		case <-l.snapCh:
+			if err := s.Snapshot(); err != nil {
+				log.Printf("store: snapshot failed: %v", err)
+			}
+		case <-l.done:
+			return
+		}
+	}
+}
+
+func encodeWALRecord(rec walRecord) ([]byte, error) {
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	frame := make([]byte, walHeaderSize, walHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(frame[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(frame[4:8], crc32.Checksum(payload, walCRCTable))
+	return append(frame, payload...), nil
+}
+
+// readSegment calls fn for each intact record in a segment. valid is the
+// length of the intact prefix; torn reports that bytes follow it which
+// do not form a complete, checksummed record.
+func readSegment(path string, fn func(walRecord) error) (valid int64, torn bool, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, false, err
+	}
+	defer f.Close()
+
+	r := &countingReader{r: f}
+	var header [walHeaderSize]byte
+	for {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			if err == io.EOF {
+				return valid, false, nil
+			}
+			if err == io.ErrUnexpectedEOF {
+				return valid, true, nil
+			}
+			return valid, false, err
+		}
+		size := binary.LittleEndian.Uint32(header[0:4])
+		if size > maxWALRecordBytes {
+			return valid, true, nil
+		}
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return valid, true, nil
+			}
+			return valid, false, err
+		}
+		if crc32.Checksum(payload, walCRCTable) != binary.LittleEndian.Uint32(header[4:8]) {
+			return valid, true, nil
+		}
+		var rec walRecord
+		if err := json.Unmarshal(payload, &rec); err != nil {
+			return valid, true, nil
+		}
+		if err := fn(rec); err != nil {
+			return valid, false, err
+		}
+		valid = r.n
+	}
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func segmentName(start uint64) string {
+	return fmt.Sprintf("wal-%020d.log", start)
+}
+
+// listSegments returns the first sequence numbers of the log segments
+// in dir, oldest first
+func listSegments(dir string) ([]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var starts []uint64
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, "wal-") || !strings.HasSuffix(name, ".log") {
+			continue
+		}
+		start, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, "wal-"), ".log"), 10, 64)
+		if err != nil {
+			continue
+		}
+		starts = append(starts, start)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+	return starts, nil
+}
+
+func openSegment(dir string, start uint64) (*os.File, error) {
+	f, err := os.OpenFile(filepath.Join(dir, segmentName(start)), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	// Make the new directory entry itself durable
+	if err := syncDir(dir); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func truncateFile(path string, size int64) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := f.Truncate(size); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+func readSnapshot(dir string) (storeSnapshot, error) {
+	var snap storeSnapshot
+	data, err := os.ReadFile(filepath.Join(dir, snapshotFileName))
+	if os.IsNotExist(err) {
+		return snap, nil
+	}
+	if err != nil {
+		return snap, err
+	}
+	// Snapshots are renamed into place whole, so damage here is real
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return snap, fmt.Errorf("%s: %w", snapshotFileName, err)
+	}
+	return snap, nil
+}
+
+// writeSnapshot replaces the snapshot atomically: write a temporary
+// file, fsync it, rename it over the old one and fsync the directory
+func writeSnapshot(dir string, snap storeSnapshot) error {
+	tmp, err := os.CreateTemp(dir, snapshotFileName+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op after a successful rename
+
+	if err := json.NewEncoder(tmp).Encode(snap); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, snapshotFileName)); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
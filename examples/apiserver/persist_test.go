@@ -0,0 +1,231 @@
+package apiserver
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// storeState renders a store's contents for comparison; timestamps go
+// through UTC so values that were round-tripped through JSON still match
+func storeState(s *UserStore) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var lines []string
+	for _, u := range s.users {
+		lines = append(lines, fmt.Sprintf("%d|%s|%s|%s", u.ID, u.Name, u.Email,
+			u.CreatedAt.UTC().Format(time.RFC3339Nano)))
+	}
+	sort.Strings(lines)
+	return fmt.Sprintf("next=%d\n%s", s.nextID, strings.Join(lines, "\n"))
+}
+
+func openTestStore(t *testing.T, dir string) *UserStore {
+	t.Helper()
+	store, err := OpenUserStore(dir, PersistOptions{SnapshotEvery: -1})
+	if err != nil {
+		t.Fatalf("open %s: %v", dir, err)
+	}
+	return store
+}
+
+func TestPersistentStoreSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	store := openTestStore(t, dir)
+	store.CreateUser("Ada", "ada@example.com")
+	store.CreateUser("Bob", "bob@example.com")
+	store.UpdateUser(1, "Ada Lovelace", "")
+	store.ApplyBatch([]BatchOp{
+		{Op: BatchCreate, Name: "Cy", Email: "cy@example.com"},
+		{Op: BatchDelete, ID: 3}, // deleting the newest user must not free its ID
+	}, true)
+	store.DeleteUser(2)
+	want := storeState(store)
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := openTestStore(t, dir)
+	defer reopened.Close()
+	if got := storeState(reopened); got != want {
+		t.Fatalf("after restart:\n%s\nwant:\n%s", got, want)
+	}
+	if user := reopened.CreateUser("Dee", "dee@example.com"); user.ID != 4 {
+		t.Errorf("next ID = %d; want 4", user.ID)
+	}
+}
+
+func TestEventIDsSurviveRestart(t *testing.T) {
+	dir := t.TempDir()
+	store := openTestStore(t, dir)
+	store.CreateUser("Ada", "ada@example.com")
+	store.CreateUser("Bob", "bob@example.com")
+	if err := store.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+	store.UpdateUser(1, "Ada Lovelace", "")
+	store.DeleteUser(2)
+	store.Close()
+
+	reopened := openTestStore(t, dir)
+	defer reopened.Close()
+	// A client that saw every event before the restart is up to date
+	sub, replay, complete := reopened.Subscribe(4)
+	defer reopened.Unsubscribe(sub)
+	if !complete || len(replay) != 0 {
+		t.Errorf("Subscribe(4) = %d events, complete %v; want none, complete", len(replay), complete)
+	}
+	// One that missed events can't catch up: the history starts empty
+	missed, replay, complete := reopened.Subscribe(1)
+	reopened.Unsubscribe(missed)
+	if complete || len(replay) != 0 {
+		t.Errorf("Subscribe(1) = %d events, complete %v; want none, incomplete", len(replay), complete)
+	}
+	reopened.CreateUser("Cy", "cy@example.com")
+	if event := <-sub.C; event.ID != 5 {
+		t.Errorf("first event after restart has ID %d; want 5", event.ID)
+	}
+}
+
+func TestSnapshotCompactsLog(t *testing.T) {
+	dir := t.TempDir()
+	store := openTestStore(t, dir)
+	for i := 0; i < 10; i++ {
+		store.CreateUser(fmt.Sprintf("User %d", i), "u@example.com")
+	}
+	if err := store.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+	store.UpdateUser(5, "Renamed", "")
+	want := storeState(store)
+	store.Close()
+
+	segments, _ := listSegments(dir)
+	if len(segments) != 1 || segments[0] != 11 {
+		t.Errorf("segments after snapshot = %v; want only the one starting at 11", segments)
+	}
+
+	reopened := openTestStore(t, dir)
+	defer reopened.Close()
+	if got := storeState(reopened); got != want {
+		t.Fatalf("after restart:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestAutomaticSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenUserStore(dir, PersistOptions{Sync: SyncNever, SnapshotEvery: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	for i := 0; i < 12; i++ {
+		store.CreateUser("User", "u@example.com")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(filepath.Join(dir, snapshotFileName)); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no snapshot was written")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestRecoveryFromTruncatedLog simulates a crash at every possible point
+// of a write: whatever prefix of the log survives, the store must open
+// with exactly the records that are complete, and keep working.
+func TestRecoveryFromTruncatedLog(t *testing.T) {
+	dir := t.TempDir()
+	store := openTestStore(t, dir)
+	segment := filepath.Join(dir, segmentName(1))
+
+	// states[size] is the expected store once the log is size bytes long
+	states := map[int64]string{0: storeState(store)}
+	record := func() {
+		info, err := os.Stat(segment)
+		if err != nil {
+			t.Fatal(err)
+		}
+		states[info.Size()] = storeState(store)
+	}
+	store.CreateUser("Ada", "ada@example.com")
+	record()
+	store.CreateUser("Bob", "bob@example.com")
+	record()
+	store.UpdateUser(2, "Robert", "")
+	record()
+	store.ApplyBatch([]BatchOp{
+		{Op: BatchCreate, Name: "Cy", Email: "cy@example.com"},
+		{Op: BatchDelete, ID: 1},
+	}, true)
+	record()
+	store.DeleteUser(3)
+	record()
+	store.Close()
+
+	full, err := os.ReadFile(segment)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := states[0]
+	for size := 0; size <= len(full); size++ {
+		if s, ok := states[int64(size)]; ok {
+			want = s
+		}
+
+		crashDir := t.TempDir()
+		crashed := filepath.Join(crashDir, segmentName(1))
+		if err := os.WriteFile(crashed, full[:size], 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		recovered := openTestStore(t, crashDir)
+		if got := storeState(recovered); got != want {
+			recovered.Close()
+			t.Fatalf("log cut at byte %d:\n%s\nwant:\n%s", size, got, want)
+		}
+
+		// New records must land after the intact prefix, not after garbage
+		recovered.CreateUser("After", "after@example.com")
+		afterCrash := storeState(recovered)
+		recovered.Close()
+
+		again := openTestStore(t, crashDir)
+		if got := storeState(again); got != afterCrash {
+			again.Close()
+			t.Fatalf("log cut at byte %d, then written to:\n%s\nwant:\n%s", size, got, afterCrash)
+		}
+		again.Close()
+	}
+}
+
+func TestCorruptTailIsDiscarded(t *testing.T) {
+	dir := t.TempDir()
+	store := openTestStore(t, dir)
+	store.CreateUser("Ada", "ada@example.com")
+	want := storeState(store)
+	store.CreateUser("Bob", "bob@example.com")
+	store.Close()
+
+	// Flip a byte inside the last record's payload
+	segment := filepath.Join(dir, segmentName(1))
+	data, _ := os.ReadFile(segment)
+	data[len(data)-3] ^= 0xFF
+	os.WriteFile(segment, data, 0o644)
+
+	reopened := openTestStore(t, dir)
+	defer reopened.Close()
+	if got := storeState(reopened); got != want {
+		t.Fatalf("after corrupting the last record:\n%s\nwant:\n%s", got, want)
+	}
+}
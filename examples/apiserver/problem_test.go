@@ -0,0 +1,115 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProblemResponses(t *testing.T) {
+	server := NewAPIServer()
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantType   string
+	}{
+		{"unknown user", "GET", "/api/v1/users/42", "", http.StatusNotFound, "/problems/user-not-found"},
+		{"invalid json", "POST", "/api/v1/users", "{", http.StatusBadRequest, "/problems/invalid-json"},
+		{"validation", "POST", "/api/v1/users", `{"name":""}`, http.StatusBadRequest, "/problems/validation-failed"},
+		{"unknown route", "GET", "/api/v1/nothing-here", "", http.StatusNotFound, "/problems/resource-not-found"},
+		{"wrong method", "PATCH", "/api/v1/users", "", http.StatusMethodNotAllowed, "/problems/method-not-allowed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("X-Request-ID", "test-"+tt.name)
+			rec := httptest.NewRecorder()
+			server.router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d; want %d", rec.Code, tt.wantStatus)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+				t.Errorf("Content-Type = %q; want application/problem+json", ct)
+			}
+
+			var problem ProblemDetails
+			if err := json.NewDecoder(rec.Body).Decode(&problem); err != nil {
+				t.Fatalf("decoding problem: %v", err)
+			}
+			if problem.Type != tt.wantType {
+				t.Errorf("type = %q; want %q", problem.Type, tt.wantType)
+			}
+			if problem.Status != tt.wantStatus {
+				t.Errorf("status member = %d; want %d", problem.Status, tt.wantStatus)
+			}
+			if problem.Instance != tt.path {
+				t.Errorf("instance = %q; want %q", problem.Instance, tt.path)
+			}
+			if problem.RequestID != "test-"+tt.name {
+				t.Errorf("request_id = %q; want %q", problem.RequestID, "test-"+tt.name)
+			}
+		})
+	}
+}
+
+func TestRecoveryMiddlewareWritesProblem(t *testing.T) {
+	server := NewAPIServer()
+	handler := server.withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	req := httptest.NewRequest("GET", "/api/v1/panic", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d; want %d", rec.Code, http.StatusInternalServerError)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("Content-Type = %q; want application/problem+json", ct)
+	}
+
+	var problem ProblemDetails
+	if err := json.NewDecoder(rec.Body).Decode(&problem); err != nil {
+		t.Fatalf("decoding problem: %v", err)
+	}
+	if problem.RequestID == "" || problem.RequestID != rec.Header().Get("X-Request-ID") {
+		t.Errorf("request_id = %q; want the X-Request-ID header %q", problem.RequestID, rec.Header().Get("X-Request-ID"))
+	}
+}
+
+func TestValidationProblemListsInvalidParams(t *testing.T) {
+	server := NewAPIServer()
+
+	req := httptest.NewRequest("POST", "/api/v1/users", strings.NewReader(`{"name":"Ada"}`))
+	rec := httptest.NewRecorder()
+	server.router.ServeHTTP(rec, req)
+
+	var problem ProblemDetails
+	if err := json.NewDecoder(rec.Body).Decode(&problem); err != nil {
+		t.Fatalf("decoding problem: %v", err)
+	}
+	if len(problem.InvalidParams) != 1 || problem.InvalidParams[0].Name != "email" {
+		t.Errorf("invalid_params = %+v; want a single entry for email", problem.InvalidParams)
+	}
+}
+
+func TestMethodNotAllowedSetsAllow(t *testing.T) {
+	server := NewAPIServer()
+
+	req := httptest.NewRequest("PATCH", "/api/v1/users/1", nil)
+	rec := httptest.NewRecorder()
+	server.router.ServeHTTP(rec, req)
+
+	if got, want := rec.Header().Get("Allow"), "GET, PUT, DELETE"; got != want {
+		t.Errorf("Allow = %q; want %q", got, want)
+	}
+}
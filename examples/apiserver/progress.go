@@ -0,0 +1,372 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Learning progress: which roadmap topics a user has completed and how
+// they scored on the exercises. The guide keeps a copy in the browser
+// and syncs it here when someone is signed in, so progress follows them
+// across devices and the team can see how far each new hire has got.
+//
+// Devices may be offline for a while, so a sync never overwrites: the
+// state a client sends is merged into the stored one, entry by entry.
+//   - A roadmap topic keeps its most recent change; a tie counts as
+//     completed.
+//   - An exercise keeps its best score; a tie keeps the most recent.
+//   - "Reset all exercises" is recorded as exercises_reset_at, and any
+//     score from before the latest reset is dropped.
+//
+// Merging is commutative and idempotent, so clients can simply send
+// everything they have and adopt what comes back. Anyone may read
+// progress, for the team overview, but changing it takes the user's
+// key; see auth.go.
+
+// Limits on what a client may store, per sync and in all
+const (
+	maxProgressEntries = 1000
+	maxProgressKeyLen  = 100
+)
+
+// Progress is one user's way through the guide
+type Progress struct {
+	UserID    int                      `json:"user_id"`
+	Roadmap   map[string]TopicProgress `json:"roadmap"`
+	Exercises map[string]ExerciseScore `json:"exercises"`
+	// ExercisesResetAt drops every exercise score recorded up to then
+	ExercisesResetAt time.Time `json:"exercises_reset_at,omitempty"`
+	// Revision counts stored changes; a sync that changes nothing keeps it
+	Revision  int64     `json:"revision"`
+	UpdatedAt time.Time `json:"updated_at,omitempty"`
+}
+
+// TopicProgress is the state of one roadmap topic
+type TopicProgress struct {
+	Completed bool      `json:"completed"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ExerciseScore is the best result on one exercise or coding challenge
+type ExerciseScore struct {
+	Score     int       `json:"score"`
+	MaxScore  int       `json:"max_score"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ProgressSummary is one row of the team overview
+type ProgressSummary struct {
+	UserID             int       `json:"user_id"`
+	Name               string    `json:"name"`
+	Email              string    `json:"email"`
+	TopicsCompleted    int       `json:"topics_completed"`
+	ExercisesCompleted int       `json:"exercises_completed"`
+	Score              int       `json:"score"`
+	MaxScore           int       `json:"max_score"`
+	LastActive         time.Time `json:"last_active,omitempty"`
+}
+
+// ProgressListResponse is the team overview, in user ID order
+type ProgressListResponse struct {
+	Progress []ProgressSummary `json:"progress"`
+	Count    int               `json:"count"`
+}
+
+// clone copies p so callers cannot reach the stored maps
+func (p Progress) clone() Progress {
+	c := p
+	c.Roadmap = make(map[string]TopicProgress, len(p.Roadmap))
+	for k, v := range p.Roadmap {
+		c.Roadmap[k] = v
+	}
+	c.Exercises = make(map[string]ExerciseScore, len(p.Exercises))
+	for k, v := range p.Exercises {
+		c.Exercises[k] = v
+	}
+	return c
+}
+
+// checkSize reports the maps of p that have more than
+// maxProgressEntries entries
+func (p Progress) checkSize() []InvalidParam {
+	var invalid []InvalidParam
+	if len(p.Roadmap) > maxProgressEntries {
+		invalid = append(invalid, InvalidParam{Name: "roadmap", Reason: fmt.Sprintf("has more than %d topics", maxProgressEntries)})
+	}
+	if len(p.Exercises) > maxProgressEntries {
+		invalid = append(invalid, InvalidParam{Name: "exercises", Reason: fmt.Sprintf("has more than %d exercises", maxProgressEntries)})
+	}
+	return invalid
+}
+
+// validate checks a client's progress and returns the problems found
+func (p Progress) validate() []InvalidParam {
+	invalid := p.checkSize()
+	for key := range p.Roadmap {
+		if key == "" || len(key) > maxProgressKeyLen {
+			invalid = append(invalid, InvalidParam{Name: "roadmap", Reason: fmt.Sprintf("topic IDs must be 1 to %d bytes", maxProgressKeyLen)})
+			break
+		}
+	}
+	for key, e := range p.Exercises {
+		name := "exercises." + key
+		switch {
+		case key == "" || len(key) > maxProgressKeyLen:
+			invalid = append(invalid, InvalidParam{Name: "exercises", Reason: fmt.Sprintf("exercise IDs must be 1 to %d bytes", maxProgressKeyLen)})
+		case e.MaxScore < 1:
+			invalid = append(invalid, InvalidParam{Name: name, Reason: "max_score must be at least 1"})
+		case e.Score < 0 || e.Score > e.MaxScore:
+			invalid = append(invalid, InvalidParam{Name: name, Reason: "score must be between 0 and max_score"})
+		}
+	}
+	sort.Slice(invalid, func(i, j int) bool { return invalid[i].Name < invalid[j].Name })
+	return invalid
+}
+
+// mergeProgress merges incoming into stored as described at the top of
+// this file. Client clocks are not trusted past now, so a device with a
+// clock in the future cannot win every later conflict. Stored times were
+// clamped when they were merged, so clamping them again changes nothing.
+func mergeProgress(stored, incoming Progress, now time.Time) (merged Progress, changed bool) {
+	clamp := func(t time.Time) time.Time {
+		if t.After(now) {
+			return now
+		}
+		return t
+	}
+	merged = stored.clone()
+	for key, topic := range merged.Roadmap {
+		topic.UpdatedAt = clamp(topic.UpdatedAt)
+		merged.Roadmap[key] = topic
+	}
+
+	reset := merged.ExercisesResetAt
+	if in := clamp(incoming.ExercisesResetAt); in.After(reset) {
+		reset = in
+		merged.ExercisesResetAt = reset
+		changed = true
+	}
+
+	for key, in := range incoming.Roadmap {
+		in.UpdatedAt = clamp(in.UpdatedAt)
+		cur, ok := merged.Roadmap[key]
+		if !ok || in.UpdatedAt.After(cur.UpdatedAt) ||
+			(in.UpdatedAt.Equal(cur.UpdatedAt) && in.Completed && !cur.Completed) {
+			merged.Roadmap[key] = in
+			changed = true
+		}
+	}
+
+	// Scores from before the newest reset go first, on both sides, so a
+	// dropped score can't beat a later one that is kept
+	beforeReset := func(e ExerciseScore) bool {
+		return !reset.IsZero() && !e.UpdatedAt.After(reset)
+	}
+	for key, e := range merged.Exercises {
+		if beforeReset(e) {
+			delete(merged.Exercises, key)
+			changed = true
+		}
+	}
+	for key, in := range incoming.Exercises {
+		in.UpdatedAt = clamp(in.UpdatedAt)
+		if beforeReset(in) {
+			continue
+		}
+		cur, ok := merged.Exercises[key]
+		if !ok || in.Score > cur.Score || (in.Score == cur.Score && in.UpdatedAt.After(cur.UpdatedAt)) {
+			merged.Exercises[key] = in
+			changed = true
+		}
+	}
+
+	if changed {
+		merged.Revision++
+		merged.UpdatedAt = now
+	}
+	return merged, changed
+}
+
+// Progress returns a user's progress; ok is false if there is no such
+// user. Someone who has not started yet has empty progress.
+func (s *UserStore) Progress(userID int) (p Progress, ok bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, exists := s.users[userID]; !exists {
+		return Progress{}, false
+	}
+	if stored, exists := s.progress[userID]; exists {
+		return stored.clone(), true
+	}
+	return Progress{UserID: userID}.clone(), true
+}
+
+// MergeProgress merges a client's progress into the user's and returns
+// the result. It fails with ErrUserNotFound if there is no such user,
+// and with a *ValidationError if the result would hold more than
+// maxProgressEntries topics or exercises.
+func (s *UserStore) MergeProgress(userID int, incoming Progress) (Progress, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.users[userID]; !exists {
+		return Progress{}, ErrUserNotFound
+	}
+	stored := Progress{UserID: userID}
+	if cur, exists := s.progress[userID]; exists {
+		stored = *cur
+	}
+	merged, changed := mergeProgress(stored, incoming, time.Now())
+	merged.UserID = userID
+	if invalid := merged.checkSize(); changed && len(invalid) > 0 {
+		return Progress{}, &ValidationError{Params: invalid}
+	}
+	if changed {
+		s.logLocked(walOp{Op: walProgress, User: User{ID: userID}, Progress: &merged})
+		s.commitLocked()
+		stored := merged.clone()
+		s.progress[userID] = &stored
+	}
+	return merged, nil
+}
+
+// ResetProgress forgets a user's progress entirely. Devices that still
+// hold the old state will bring it back on their next sync; to reset
+// only the exercises everywhere, merge a later exercises_reset_at.
+func (s *UserStore) ResetProgress(userID int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.users[userID]; !exists {
+		return false
+	}
+	if _, exists := s.progress[userID]; exists {
+		s.logLocked(walOp{Op: walProgress, User: User{ID: userID}})
+		s.commitLocked()
+		delete(s.progress, userID)
+	}
+	return true
+}
+
+// ProgressSummaries returns every user's progress in brief, in ID order
+func (s *UserStore) ProgressSummaries() []ProgressSummary {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	summaries := make([]ProgressSummary, 0, len(s.users))
+	for id, user := range s.users {
+		summary := ProgressSummary{UserID: id, Name: user.Name, Email: user.Email}
+		if p, ok := s.progress[id]; ok {
+			for _, t := range p.Roadmap {
+				if t.Completed {
+					summary.TopicsCompleted++
+				}
+			}
+			for _, e := range p.Exercises {
+				if e.Score == e.MaxScore {
+					summary.ExercisesCompleted++
+				}
+				summary.Score += e.Score
+				summary.MaxScore += e.MaxScore
+			}
+			summary.LastActive = p.UpdatedAt
+		}
+		summaries = append(summaries, summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].UserID < summaries[j].UserID })
+	return summaries
+}
+
+// Progress handlers. The same handlers serve v1 and v2; user IDs are
+// parsed as in v2, which accepts everything v1 routes let through.
+
+func (s *APIServer) progressUserID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	rawID := mux.Vars(r)["id"]
+	id, ok := userIDFromV2(rawID)
+	if !ok {
+		s.userNotFoundV2(w, r, rawID)
+	}
+	return id, ok
+}
+
+func (s *APIServer) writeProgress(w http.ResponseWriter, p Progress) {
+	w.Header().Set("ETag", fmt.Sprintf(`"%d"`, p.Revision))
+	s.writeJSON(w, http.StatusOK, p)
+}
+
+func (s *APIServer) handleGetProgress(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.progressUserID(w, r)
+	if !ok {
+		return
+	}
+	p, exists := s.store.Progress(id)
+	if !exists {
+		s.userNotFoundV2(w, r, mux.Vars(r)["id"])
+		return
+	}
+	s.writeProgress(w, p)
+}
+
+func (s *APIServer) handleMergeProgress(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.progressUserID(w, r)
+	if !ok || !s.authorizeUser(w, r, id) {
+		return
+	}
+
+	var incoming Progress
+	if err := json.NewDecoder(r.Body).Decode(&incoming); err != nil {
+		s.writeError(w, r, http.StatusBadRequest, "Invalid JSON", err.Error())
+		return
+	}
+	if invalid := incoming.validate(); len(invalid) > 0 {
+		s.writeProblem(w, r, ProblemDetails{
+			Title:         "Validation failed",
+			Status:        http.StatusBadRequest,
+			Detail:        "The progress could not be stored",
+			InvalidParams: invalid,
+		})
+		return
+	}
+
+	p, err := s.store.MergeProgress(id, incoming)
+	var invalid *ValidationError
+	switch {
+	case errors.Is(err, ErrUserNotFound):
+		s.userNotFoundV2(w, r, mux.Vars(r)["id"])
+		return
+	case errors.As(err, &invalid):
+		s.writeProblem(w, r, ProblemDetails{
+			Title:         "Validation failed",
+			Status:        http.StatusBadRequest,
+			Detail:        "The merged progress would be too large to store",
+			InvalidParams: invalid.Params,
+		})
+		return
+	}
+	s.writeProgress(w, p)
+}
+
+func (s *APIServer) handleResetProgress(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.progressUserID(w, r)
+	if !ok || !s.authorizeUser(w, r, id) {
+		return
+	}
+	if !s.store.ResetProgress(id) {
+		s.userNotFoundV2(w, r, mux.Vars(r)["id"])
+		return
+	}
+	w.Header().Del("Content-Type") // set by jsonMiddleware, but there is no body
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *APIServer) handleListProgress(w http.ResponseWriter, r *http.Request) {
+	summaries := s.store.ProgressSummaries()
+	s.writeJSON(w, http.StatusOK, ProgressListResponse{Progress: summaries, Count: len(summaries)})
+}
@@ -0,0 +1,244 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMergeProgress(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return now.Add(time.Duration(minutes) * time.Minute) }
+
+	stored := Progress{
+		Roadmap: map[string]TopicProgress{
+			"installation": {Completed: true, UpdatedAt: at(-30)},
+			"variables":    {Completed: true, UpdatedAt: at(-10)},
+		},
+		Exercises: map[string]ExerciseScore{
+			"mc-0": {Score: 1, MaxScore: 1, UpdatedAt: at(-20)},
+			"mc-1": {Score: 0, MaxScore: 1, UpdatedAt: at(-20)},
+		},
+		Revision: 3,
+	}
+	// An offline device: it un-completed installation later, saw
+	// variables as not done earlier, did worse on mc-0 and better on mc-1
+	incoming := Progress{
+		Roadmap: map[string]TopicProgress{
+			"installation": {Completed: false, UpdatedAt: at(-5)},
+			"variables":    {Completed: false, UpdatedAt: at(-15)},
+			"functions":    {Completed: true, UpdatedAt: at(60)}, // clock ahead
+		},
+		Exercises: map[string]ExerciseScore{
+			"mc-0": {Score: 0, MaxScore: 1, UpdatedAt: at(-1)},
+			"mc-1": {Score: 1, MaxScore: 1, UpdatedAt: at(-25)},
+		},
+	}
+
+	merged, changed := mergeProgress(stored, incoming, now)
+	if !changed || merged.Revision != 4 {
+		t.Fatalf("changed=%v revision=%d; want a change and revision 4", changed, merged.Revision)
+	}
+	if merged.Roadmap["installation"].Completed || !merged.Roadmap["variables"].Completed {
+		t.Errorf("roadmap = %v; the latest change should win per topic", merged.Roadmap)
+	}
+	if got := merged.Roadmap["functions"].UpdatedAt; !got.Equal(now) {
+		t.Errorf("future timestamp kept as %v; want it clamped to %v", got, now)
+	}
+	if merged.Exercises["mc-0"].Score != 1 || merged.Exercises["mc-1"].Score != 1 {
+		t.Errorf("exercises = %v; want the best score of each", merged.Exercises)
+	}
+	if stored.Roadmap["installation"].Completed != true {
+		t.Error("merge changed its input")
+	}
+
+	// Merging is idempotent and commutative
+	if again, changed := mergeProgress(merged, incoming, now); changed || again.Revision != merged.Revision {
+		t.Errorf("merging the same state twice changed it")
+	}
+	other, _ := mergeProgress(incoming, stored, now)
+	for key, topic := range merged.Roadmap {
+		if other.Roadmap[key] != topic {
+			t.Errorf("topic %s: %v one way, %v the other", key, topic, other.Roadmap[key])
+		}
+	}
+
+	// A reset drops every score from before it, wherever it came from
+	reset, _ := mergeProgress(merged, Progress{
+		ExercisesResetAt: at(-2),
+		Exercises:        map[string]ExerciseScore{"mc-2": {Score: 1, MaxScore: 1, UpdatedAt: at(-1)}},
+	}, now)
+	if len(reset.Exercises) != 1 || reset.Exercises["mc-2"].Score != 1 {
+		t.Errorf("after reset exercises = %v; want only mc-2", reset.Exercises)
+	}
+}
+
+func TestMergeProgressScoreAfterReset(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return now.Add(time.Duration(minutes) * time.Minute) }
+
+	// A better score from before the reset must not hide a worse one
+	// from after it, whichever side either is on
+	old := Progress{Exercises: map[string]ExerciseScore{"a": {Score: 5, MaxScore: 5, UpdatedAt: at(-30)}}}
+	reset := Progress{
+		ExercisesResetAt: at(-20),
+		Exercises:        map[string]ExerciseScore{"a": {Score: 3, MaxScore: 5, UpdatedAt: at(-10)}},
+	}
+	for _, tt := range []struct {
+		name             string
+		stored, incoming Progress
+	}{
+		{"post-reset score incoming", old, reset},
+		{"post-reset score stored", reset, old},
+	} {
+		merged, _ := mergeProgress(tt.stored, tt.incoming, now)
+		if got := merged.Exercises["a"]; len(merged.Exercises) != 1 || got.Score != 3 || !got.UpdatedAt.Equal(at(-10)) {
+			t.Errorf("%s: exercises = %v; want a: 3 from after the reset", tt.name, merged.Exercises)
+		}
+		if !merged.ExercisesResetAt.Equal(at(-20)) {
+			t.Errorf("%s: reset at %v; want %v", tt.name, merged.ExercisesResetAt, at(-20))
+		}
+	}
+}
+
+func TestProgressEndpoints(t *testing.T) {
+	server := NewAPIServer()
+	server.Store().CreateUser("Ada Lovelace", "ada@example.com")
+	server.Store().CreateUser("Bob Smith", "bob@example.com")
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+server.Store().UserKey(1))
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		return rec
+	}
+	decode := func(rec *httptest.ResponseRecorder) Progress {
+		t.Helper()
+		var p Progress
+		if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+			t.Fatalf("decoding %s: %v", rec.Body, err)
+		}
+		return p
+	}
+
+	rec := do("GET", "/api/v2/users/1/progress", "")
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") != `"0"` {
+		t.Fatalf("fresh progress: %d, ETag %q", rec.Code, rec.Header().Get("ETag"))
+	}
+
+	// Two devices sync in turn; the second gets the union back
+	do("PUT", "/api/v2/users/1/progress", `{"roadmap":{"installation":{"completed":true,"updated_at":"2026-01-01T10:00:00Z"}}}`)
+	rec = do("PUT", "/api/v1/users/1/progress", `{"exercises":{"mc-0":{"score":1,"max_score":1,"updated_at":"2026-01-01T11:00:00Z"}}}`)
+	p := decode(rec)
+	if !p.Roadmap["installation"].Completed || p.Exercises["mc-0"].Score != 1 || p.Revision != 2 {
+		t.Errorf("merged = %+v", p)
+	}
+	if rec.Header().Get("ETag") != `"2"` {
+		t.Errorf("ETag = %q; want \"2\"", rec.Header().Get("ETag"))
+	}
+
+	rec = do("PUT", "/api/v2/users/1/progress", `{"exercises":{"mc-1":{"score":3,"max_score":1}}}`)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "exercises.mc-1") {
+		t.Errorf("invalid score: %d %s", rec.Code, rec.Body)
+	}
+	for _, path := range []string{"/api/v2/users/9/progress", "/api/v2/users/x/progress"} {
+		if rec := do("GET", path, ""); rec.Code != http.StatusNotFound {
+			t.Errorf("GET %s status = %d; want 404", path, rec.Code)
+		}
+	}
+
+	var list ProgressListResponse
+	json.NewDecoder(do("GET", "/api/v2/progress", "").Body).Decode(&list)
+	if list.Count != 2 || list.Progress[0].TopicsCompleted != 1 || list.Progress[0].ExercisesCompleted != 1 ||
+		list.Progress[1].Score != 0 {
+		t.Errorf("overview = %+v", list)
+	}
+
+	if rec := do("DELETE", "/api/v2/users/1/progress", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("reset status = %d", rec.Code)
+	}
+	if p := decode(do("GET", "/api/v2/users/1/progress", "")); len(p.Roadmap) != 0 || len(p.Exercises) != 0 {
+		t.Errorf("after reset = %+v", p)
+	}
+}
+
+func TestProgressChangesNeedUserKey(t *testing.T) {
+	server := NewAPIServer()
+	server.Store().CreateUser("Ada Lovelace", "ada@example.com")
+	server.Store().CreateUser("Bob Smith", "bob@example.com")
+
+	for _, auth := range []string{"", "Bearer wrong", "Bearer " + server.Store().UserKey(2)} {
+		for _, method := range []string{"PUT", "DELETE"} {
+			req := httptest.NewRequest(method, "/api/v2/users/1/progress", strings.NewReader(`{}`))
+			if auth != "" {
+				req.Header.Set("Authorization", auth)
+			}
+			rec := httptest.NewRecorder()
+			server.ServeHTTP(rec, req)
+			if rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") == "" {
+				t.Errorf("%s with %q: status %d; want 401 with a challenge", method, auth, rec.Code)
+			}
+		}
+	}
+}
+
+func TestMergedProgressIsBounded(t *testing.T) {
+	store := NewUserStore()
+	store.CreateUser("Ada", "ada@example.com")
+	// Every sync is small, but they add up
+	for i := 0; i < maxProgressEntries; i++ {
+		topic := Progress{Roadmap: map[string]TopicProgress{fmt.Sprintf("topic-%d", i): {Completed: true}}}
+		if _, err := store.MergeProgress(1, topic); err != nil {
+			t.Fatalf("topic %d: %v", i, err)
+		}
+	}
+	_, err := store.MergeProgress(1, Progress{Roadmap: map[string]TopicProgress{"one-too-many": {Completed: true}}})
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("MergeProgress = %v; want a ValidationError", err)
+	}
+	if p, _ := store.Progress(1); len(p.Roadmap) != maxProgressEntries {
+		t.Errorf("stored %d topics; want %d", len(p.Roadmap), maxProgressEntries)
+	}
+	// Syncing what is already there still works
+	if _, err := store.MergeProgress(1, Progress{Roadmap: map[string]TopicProgress{"topic-0": {Completed: true}}}); err != nil {
+		t.Errorf("merging a known topic: %v", err)
+	}
+}
+
+func TestProgressPersistence(t *testing.T) {
+	dir := t.TempDir()
+	store := openTestStore(t, dir)
+	store.CreateUser("Ada", "ada@example.com")
+	store.CreateUser("Bob", "bob@example.com")
+	done := Progress{Roadmap: map[string]TopicProgress{"installation": {Completed: true, UpdatedAt: time.Now()}}}
+	store.MergeProgress(1, done)
+	store.MergeProgress(2, done)
+	if err := store.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+	store.MergeProgress(1, Progress{Exercises: map[string]ExerciseScore{"mc-0": {Score: 1, MaxScore: 1, UpdatedAt: time.Now()}}})
+	store.DeleteUser(2)
+	key := store.UserKey(1)
+	store.Close()
+
+	reopened := openTestStore(t, dir)
+	defer reopened.Close()
+	if reopened.UserKey(1) != key {
+		t.Error("user keys changed with the restart")
+	}
+	p, _ := reopened.Progress(1)
+	if !p.Roadmap["installation"].Completed || p.Exercises["mc-0"].Score != 1 || p.Revision != 2 {
+		t.Errorf("after restart = %+v", p)
+	}
+	if _, ok := reopened.progress[2]; ok {
+		t.Error("progress of a deleted user came back")
+	}
+}
@@ -0,0 +1,375 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"go-learning-guide/quiz"
+)
+
+// The quiz: the Practice tab's questions, served from the quiz package
+// without their answers and graded here. Every graded answer is recorded
+// for a signed-in user, who sends their key (see auth.go), so the score
+// a lead sees is the server's, not whatever a browser claims. Only the
+// first attempt at a question counts towards the score; later attempts
+// are counted but can't improve it. Nothing is graded anonymously: an
+// attempt that isn't recorded would give the answer away for free. For
+// the same reason only the user may read back their answers; everyone's
+// scores, without answers, are public.
+
+// QuizAnswer is one user's record for one question
+type QuizAnswer struct {
+	Attempts int `json:"attempts"`
+	// FirstChoice and FirstCorrect are the attempt that is scored
+	FirstChoice  int       `json:"first_choice"`
+	FirstCorrect bool      `json:"first_correct"`
+	LastChoice   int       `json:"last_choice"`
+	Solved       bool      `json:"solved"` // answered correctly at some attempt
+	AnsweredAt   time.Time `json:"answered_at"`
+}
+
+// QuizRecord is everything a user has answered, by question ID
+type QuizRecord struct {
+	UserID    int                   `json:"user_id"`
+	Answers   map[string]QuizAnswer `json:"answers"`
+	UpdatedAt time.Time             `json:"updated_at,omitempty"`
+}
+
+// QuizScore is a user's standing. Score counts questions answered
+// correctly at the first attempt; MaxScore is the size of the bank.
+type QuizScore struct {
+	UserID   int    `json:"user_id"`
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Answered int    `json:"answered"`
+	Solved   int    `json:"solved"`
+	Score    int    `json:"score"`
+	MaxScore int    `json:"max_score"`
+	Attempts int    `json:"attempts"`
+}
+
+// QuizResultsResponse is one user's answers and score
+type QuizResultsResponse struct {
+	QuizScore
+	Answers map[string]QuizAnswer `json:"answers"`
+}
+
+// QuizScoresResponse is every user's score, in user ID order
+type QuizScoresResponse struct {
+	Scores []QuizScore `json:"scores"`
+	Count  int         `json:"count"`
+}
+
+// QuizQuestionsResponse lists questions without their answers
+type QuizQuestionsResponse struct {
+	Questions []quiz.PublicQuestion `json:"questions"`
+	Count     int                   `json:"count"`
+}
+
+// QuizChallengesResponse lists coding challenges
+type QuizChallengesResponse struct {
+	Challenges []quiz.Challenge `json:"challenges"`
+	Count      int              `json:"count"`
+}
+
+// QuizAnswerRequest is a choice, an index into the question's options
+type QuizAnswerRequest struct {
+	Choice *int `json:"choice"`
+}
+
+// QuizAnswerResponse is the graded answer and the user's record for the
+// question. Recorded is always true; it is kept for older clients.
+type QuizAnswerResponse struct {
+	quiz.Result
+	Recorded     bool `json:"recorded"`
+	Attempts     int  `json:"attempts,omitempty"`
+	FirstCorrect bool `json:"first_correct,omitempty"`
+}
+
+// clone copies r so callers cannot reach the stored map
+func (r QuizRecord) clone() QuizRecord {
+	c := r
+	c.Answers = make(map[string]QuizAnswer, len(r.Answers))
+	for k, v := range r.Answers {
+		c.Answers[k] = v
+	}
+	return c
+}
+
+// score totals a record against the bank; answers to questions that have
+// since been removed from the bank don't count
+func (r QuizRecord) score(bank *quiz.Bank) QuizScore {
+	s := QuizScore{UserID: r.UserID, MaxScore: len(bank.Questions)}
+	for id, a := range r.Answers {
+		if _, ok := bank.Question(id); !ok {
+			continue
+		}
+		s.Answered++
+		s.Attempts += a.Attempts
+		if a.Solved {
+			s.Solved++
+		}
+		if a.FirstCorrect {
+			s.Score++
+		}
+	}
+	return s
+}
+
+// QuizResults returns a user's answers and score; ok is false if there
+// is no such user
+func (s *UserStore) QuizResults(userID int, bank *quiz.Bank) (results QuizResultsResponse, ok bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, exists := s.users[userID]
+	if !exists {
+		return QuizResultsResponse{}, false
+	}
+	record := QuizRecord{UserID: userID}
+	if stored, exists := s.quiz[userID]; exists {
+		record = *stored
+	}
+	record = record.clone()
+	results = QuizResultsResponse{QuizScore: record.score(bank), Answers: record.Answers}
+	results.Name, results.Email = user.Name, user.Email
+	return results, true
+}
+
+// RecordAnswer adds a graded attempt to a user's record and returns the
+// question's updated entry; ok is false if there is no such user
+func (s *UserStore) RecordAnswer(userID int, result quiz.Result) (a QuizAnswer, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.users[userID]; !exists {
+		return QuizAnswer{}, false
+	}
+	record := QuizRecord{UserID: userID}
+	if cur, exists := s.quiz[userID]; exists {
+		record = *cur
+	}
+	record = record.clone()
+
+	now := time.Now()
+	a, answered := record.Answers[result.QuestionID]
+	if !answered {
+		a.FirstChoice = result.Choice
+		a.FirstCorrect = result.Correct
+	}
+	a.Attempts++
+	a.LastChoice = result.Choice
+	a.Solved = a.Solved || result.Correct
+	a.AnsweredAt = now
+	record.Answers[result.QuestionID] = a
+	record.UpdatedAt = now
+
+	s.logLocked(walOp{Op: walQuiz, User: User{ID: userID}, Quiz: &record})
+	s.commitLocked()
+	s.quiz[userID] = &record
+	return a, true
+}
+
+// QuizScores returns every user's score, in ID order
+func (s *UserStore) QuizScores(bank *quiz.Bank) []QuizScore {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	scores := make([]QuizScore, 0, len(s.users))
+	for id, user := range s.users {
+		record := QuizRecord{UserID: id}
+		if r, ok := s.quiz[id]; ok {
+			record = *r
+		}
+		score := record.score(bank)
+		score.Name, score.Email = user.Name, user.Email
+		scores = append(scores, score)
+	}
+	sort.Slice(scores, func(i, j int) bool { return scores[i].UserID < scores[j].UserID })
+	return scores
+}
+
+// Quiz handlers, shared by v1 and v2
+
+// quizBank loads the question bank, reporting a 500 if it is broken
+func (s *APIServer) quizBank(w http.ResponseWriter, r *http.Request) (*quiz.Bank, bool) {
+	bank, err := quiz.Default()
+	if err != nil {
+		s.writeError(w, r, http.StatusInternalServerError, "Quiz unavailable", err.Error())
+		return nil, false
+	}
+	return bank, true
+}
+
+// quizDifficulties parses ?difficulty=, repeated or comma separated, as
+// the guide's difficulty filter offers them; "all" means no filter
+func (s *APIServer) quizDifficulties(w http.ResponseWriter, r *http.Request) ([]quiz.Difficulty, bool) {
+	var difficulties []quiz.Difficulty
+	var invalid []InvalidParam
+	for _, value := range r.URL.Query()["difficulty"] {
+		for _, name := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(name), "all") {
+				return nil, true
+			}
+			d, ok := quiz.ParseDifficulty(name)
+			if !ok {
+				invalid = append(invalid, InvalidParam{Name: "difficulty", Reason: fmt.Sprintf("unknown difficulty %q", strings.TrimSpace(name))})
+				continue
+			}
+			difficulties = append(difficulties, d)
+		}
+	}
+	if len(invalid) > 0 {
+		s.writeProblem(w, r, ProblemDetails{
+			Title:         "Invalid query parameter",
+			Status:        http.StatusBadRequest,
+			Detail:        "Difficulties are beginner, intermediate, advanced and all",
+			InvalidParams: invalid,
+		})
+		return nil, false
+	}
+	return difficulties, true
+}
+
+func (s *APIServer) handleListQuestions(w http.ResponseWriter, r *http.Request) {
+	difficulties, ok := s.quizDifficulties(w, r)
+	if !ok {
+		return
+	}
+	bank, ok := s.quizBank(w, r)
+	if !ok {
+		return
+	}
+	questions := bank.PublicQuestions(difficulties...)
+	s.writeJSON(w, http.StatusOK, QuizQuestionsResponse{Questions: questions, Count: len(questions)})
+}
+
+func (s *APIServer) handleGetQuestion(w http.ResponseWriter, r *http.Request) {
+	bank, ok := s.quizBank(w, r)
+	if !ok {
+		return
+	}
+	id := mux.Vars(r)["qid"]
+	q, exists := bank.Question(id)
+	if !exists {
+		s.writeError(w, r, http.StatusNotFound, "Question not found", fmt.Sprintf("Question %q does not exist", id))
+		return
+	}
+	s.writeJSON(w, http.StatusOK, q.Public())
+}
+
+// handleAnswerQuestion grades a choice and records the attempt for the
+// user given by ?user_id=, who must send their key
+func (s *APIServer) handleAnswerQuestion(w http.ResponseWriter, r *http.Request) {
+	raw := r.URL.Query().Get("user_id")
+	if raw == "" {
+		s.writeProblem(w, r, ProblemDetails{
+			Title:         "Validation failed",
+			Status:        http.StatusBadRequest,
+			Detail:        "Answers are only graded for a signed-in user, so every attempt counts",
+			InvalidParams: []InvalidParam{{Name: "user_id", Reason: "is required"}},
+		})
+		return
+	}
+	userID, ok := userIDFromV2(raw)
+	if !ok {
+		s.userNotFoundV2(w, r, raw)
+		return
+	}
+	if !s.authorizeUser(w, r, userID) {
+		return
+	}
+
+	var req QuizAnswerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, r, http.StatusBadRequest, "Invalid JSON", err.Error())
+		return
+	}
+	if req.Choice == nil {
+		s.writeProblem(w, r, ProblemDetails{
+			Title:         "Validation failed",
+			Status:        http.StatusBadRequest,
+			Detail:        "The answer could not be graded",
+			InvalidParams: []InvalidParam{{Name: "choice", Reason: "is required"}},
+		})
+		return
+	}
+
+	bank, ok := s.quizBank(w, r)
+	if !ok {
+		return
+	}
+	qid := mux.Vars(r)["qid"]
+	result, err := bank.Grade(qid, *req.Choice)
+	switch {
+	case errors.Is(err, quiz.ErrNoQuestion):
+		s.writeError(w, r, http.StatusNotFound, "Question not found", fmt.Sprintf("Question %q does not exist", qid))
+		return
+	case errors.Is(err, quiz.ErrBadChoice):
+		s.writeProblem(w, r, ProblemDetails{
+			Title:         "Validation failed",
+			Status:        http.StatusBadRequest,
+			Detail:        "The answer could not be graded",
+			InvalidParams: []InvalidParam{{Name: "choice", Reason: err.Error()}},
+		})
+		return
+	case err != nil:
+		s.writeError(w, r, http.StatusInternalServerError, "Quiz unavailable", err.Error())
+		return
+	}
+
+	a, exists := s.store.RecordAnswer(userID, result)
+	if !exists {
+		s.userNotFoundV2(w, r, raw)
+		return
+	}
+	resp := QuizAnswerResponse{Result: result, Recorded: true, Attempts: a.Attempts, FirstCorrect: a.FirstCorrect}
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *APIServer) handleListChallenges(w http.ResponseWriter, r *http.Request) {
+	difficulties, ok := s.quizDifficulties(w, r)
+	if !ok {
+		return
+	}
+	bank, ok := s.quizBank(w, r)
+	if !ok {
+		return
+	}
+	challenges := bank.ChallengesFor(difficulties...)
+	s.writeJSON(w, http.StatusOK, QuizChallengesResponse{Challenges: challenges, Count: len(challenges)})
+}
+
+func (s *APIServer) handleGetQuizResults(w http.ResponseWriter, r *http.Request) {
+	// The choices a user made would give away which ones were right
+	id, ok := s.progressUserID(w, r)
+	if !ok || !s.authorizeUser(w, r, id) {
+		return
+	}
+	bank, ok := s.quizBank(w, r)
+	if !ok {
+		return
+	}
+	results, exists := s.store.QuizResults(id, bank)
+	if !exists {
+		s.userNotFoundV2(w, r, mux.Vars(r)["id"])
+		return
+	}
+	s.writeJSON(w, http.StatusOK, results)
+}
+
+func (s *APIServer) handleListQuizScores(w http.ResponseWriter, r *http.Request) {
+	bank, ok := s.quizBank(w, r)
+	if !ok {
+		return
+	}
+	scores := s.store.QuizScores(bank)
+	s.writeJSON(w, http.StatusOK, QuizScoresResponse{Scores: scores, Count: len(scores)})
+}
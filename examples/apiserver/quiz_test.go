@@ -0,0 +1,155 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"go-learning-guide/quiz"
+)
+
+func TestQuizEndpoints(t *testing.T) {
+	server := NewAPIServer()
+	server.Store().CreateUser("Ada Lovelace", "ada@example.com")
+	server.Store().CreateUser("Bob Smith", "bob@example.com")
+
+	doAs := func(key, method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		return rec
+	}
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		return doAs("", method, path, body)
+	}
+
+	rec := do("GET", "/api/v2/quiz/questions?difficulty=beginner,advanced", "")
+	var questions QuizQuestionsResponse
+	json.NewDecoder(strings.NewReader(rec.Body.String())).Decode(&questions)
+	if rec.Code != http.StatusOK || questions.Count != 5 {
+		t.Fatalf("beginner and advanced questions: %d, count %d", rec.Code, questions.Count)
+	}
+	if strings.Contains(rec.Body.String(), `"answer"`) || strings.Contains(rec.Body.String(), `"explanation"`) {
+		t.Error("question list gives the answers away")
+	}
+	if rec := do("GET", "/api/v1/quiz/questions?difficulty=expert", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown difficulty status = %d; want 400", rec.Code)
+	}
+	var challenges QuizChallengesResponse
+	json.NewDecoder(do("GET", "/api/v1/quiz/challenges?difficulty=all", "").Body).Decode(&challenges)
+	if challenges.Count != 3 || challenges.Challenges[0].Template == "" {
+		t.Errorf("challenges = %+v", challenges)
+	}
+
+	// Answers are only graded when they are recorded, so nobody can try
+	// every option first: anonymous answers, and answers without the
+	// user's key, give nothing away
+	for _, rec := range []*httptest.ResponseRecorder{
+		do("POST", "/api/v2/quiz/questions/variable-declarations/answers", `{"choice":3}`),
+		do("POST", "/api/v2/quiz/questions/variable-declarations/answers?user_id=1", `{"choice":3}`),
+		doAs(server.Store().UserKey(2), "POST", "/api/v2/quiz/questions/variable-declarations/answers?user_id=1", `{"choice":3}`),
+	} {
+		if rec.Code == http.StatusOK || strings.Contains(rec.Body.String(), `"explanation"`) {
+			t.Errorf("unrecorded answer: %d %s", rec.Code, rec.Body)
+		}
+	}
+
+	// Ada gets it wrong first; putting it right later doesn't score
+	answer := func(user, question, body string) QuizAnswerResponse {
+		t.Helper()
+		id, _ := strconv.Atoi(user)
+		rec := doAs(server.Store().UserKey(id), "POST", "/api/v2/quiz/questions/"+question+"/answers?user_id="+user, body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("answering %s: %d %s", question, rec.Code, rec.Body)
+		}
+		var resp QuizAnswerResponse
+		json.NewDecoder(rec.Body).Decode(&resp)
+		return resp
+	}
+	if got := answer("1", "slice-operations", `{"choice":0}`); got.Correct || got.Answer != 1 || got.Attempts != 1 {
+		t.Errorf("wrong answer = %+v", got)
+	}
+	if got := answer("1", "slice-operations", `{"choice":1}`); !got.Correct || got.FirstCorrect || got.Attempts != 2 {
+		t.Errorf("second attempt = %+v", got)
+	}
+	answer("1", "variable-declarations", `{"choice":3}`)
+
+	var results QuizResultsResponse
+	json.NewDecoder(doAs(server.Store().UserKey(1), "GET", "/api/v1/users/1/quiz", "").Body).Decode(&results)
+	if results.Score != 1 || results.Solved != 2 || results.Attempts != 3 || results.MaxScore != 8 ||
+		results.Answers["slice-operations"].FirstChoice != 0 {
+		t.Errorf("results = %+v", results)
+	}
+	var scores QuizScoresResponse
+	json.NewDecoder(do("GET", "/api/v2/quiz/scores", "").Body).Decode(&scores)
+	if scores.Count != 2 || scores.Scores[0].Name != "Ada Lovelace" || scores.Scores[0].Score != 1 || scores.Scores[1].Answered != 0 {
+		t.Errorf("scores = %+v", scores)
+	}
+
+	for _, tt := range []struct {
+		key, method, path, body string
+		want                    int
+	}{
+		{"", "GET", "/api/v2/quiz/questions/no-such-question", "", http.StatusNotFound},
+		{"", "POST", "/api/v2/quiz/questions/slice-operations/answers", `{"choice":1}`, http.StatusBadRequest},
+		{"", "POST", "/api/v2/quiz/questions/slice-operations/answers?user_id=1", `{"choice":1}`, http.StatusUnauthorized},
+		{server.Store().UserKey(1), "POST", "/api/v2/quiz/questions/no-such-question/answers?user_id=1", `{"choice":0}`, http.StatusNotFound},
+		{server.Store().UserKey(1), "POST", "/api/v2/quiz/questions/slice-operations/answers?user_id=1", `{"choice":4}`, http.StatusBadRequest},
+		{server.Store().UserKey(1), "POST", "/api/v2/quiz/questions/slice-operations/answers?user_id=1", `{}`, http.StatusBadRequest},
+		{server.Store().UserKey(9), "POST", "/api/v2/quiz/questions/slice-operations/answers?user_id=9", `{"choice":1}`, http.StatusNotFound},
+		// A user's answers would tell others which choices are right
+		{"", "GET", "/api/v2/users/1/quiz", "", http.StatusUnauthorized},
+		{server.Store().UserKey(2), "GET", "/api/v1/users/1/quiz", "", http.StatusUnauthorized},
+		{server.Store().UserKey(9), "GET", "/api/v2/users/9/quiz", "", http.StatusNotFound},
+	} {
+		if rec := doAs(tt.key, tt.method, tt.path, tt.body); rec.Code != tt.want {
+			t.Errorf("%s %s status = %d; want %d", tt.method, tt.path, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestQuizPersistence(t *testing.T) {
+	bank, err := quiz.Default()
+	if err != nil {
+		t.Fatal(err)
+	}
+	grade := func(question string, choice int) quiz.Result {
+		t.Helper()
+		res, err := bank.Grade(question, choice)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	dir := t.TempDir()
+	store := openTestStore(t, dir)
+	store.CreateUser("Ada", "ada@example.com")
+	store.CreateUser("Bob", "bob@example.com")
+	store.RecordAnswer(1, grade("variable-declarations", 3))
+	store.RecordAnswer(2, grade("variable-declarations", 3))
+	if err := store.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+	store.RecordAnswer(1, grade("error-handling", 1))
+	store.DeleteUser(2)
+	store.Close()
+
+	reopened := openTestStore(t, dir)
+	defer reopened.Close()
+	results, _ := reopened.QuizResults(1, bank)
+	if results.Answered != 2 || results.Score != 1 {
+		t.Errorf("after restart = %+v", results)
+	}
+	if _, ok := reopened.quiz[2]; ok {
+		t.Error("quiz answers of a deleted user came back")
+	}
+}
@@ -0,0 +1,81 @@
+package apiserver
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go-learning-guide/roadmap"
+)
+
+// DurationEstimate is a time range with a rounded estimate for planning,
+// e.g. 16-22 days is "2-3 weeks"
+type DurationEstimate struct {
+	MinDays  int    `json:"min_days"`
+	MaxDays  int    `json:"max_days"`
+	Estimate string `json:"estimate"`
+}
+
+// RoadmapStage is one stage of the learning path. Its duration is the
+// sum of its topics' durations.
+type RoadmapStage struct {
+	Stage    string           `json:"stage"`
+	Duration DurationEstimate `json:"duration"`
+	Topics   []roadmap.Topic  `json:"topics"`
+}
+
+// RoadmapResponse is the learning path, or the requested stages of it
+type RoadmapResponse struct {
+	Stages   []RoadmapStage   `json:"stages"`
+	Duration DurationEstimate `json:"duration"` // of the stages listed
+}
+
+func durationEstimate(d roadmap.Duration) DurationEstimate {
+	return DurationEstimate{MinDays: d.MinDays, MaxDays: d.MaxDays, Estimate: d.Approx()}
+}
+
+// handleRoadmap serves the roadmap from golang_learning_roadmap.csv.
+// ?stage=beginner limits it to one stage; repeat it or separate names
+// with commas for several.
+func (s *APIServer) handleRoadmap(w http.ResponseWriter, r *http.Request) {
+	var stages []roadmap.Stage
+	var invalid []InvalidParam
+	for _, value := range r.URL.Query()["stage"] {
+		for _, name := range strings.Split(value, ",") {
+			stage, ok := roadmap.ParseStage(name)
+			if !ok {
+				invalid = append(invalid, InvalidParam{Name: "stage", Reason: fmt.Sprintf("unknown stage %q", strings.TrimSpace(name))})
+				continue
+			}
+			stages = append(stages, stage)
+		}
+	}
+	if len(invalid) > 0 {
+		s.writeProblem(w, r, ProblemDetails{
+			Title:         "Invalid query parameter",
+			Status:        http.StatusBadRequest,
+			Detail:        "Stages are beginner, intermediate and advanced",
+			InvalidParams: invalid,
+		})
+		return
+	}
+
+	rm, err := roadmap.Default()
+	if err != nil {
+		s.writeError(w, r, http.StatusInternalServerError, "Roadmap unavailable", err.Error())
+		return
+	}
+
+	resp := RoadmapResponse{Stages: []RoadmapStage{}}
+	var total roadmap.Duration
+	for _, summary := range rm.Stages(stages...) {
+		resp.Stages = append(resp.Stages, RoadmapStage{
+			Stage:    string(summary.Stage),
+			Duration: durationEstimate(summary.Duration),
+			Topics:   summary.Topics,
+		})
+		total = total.Add(summary.Duration)
+	}
+	resp.Duration = durationEstimate(total)
+	s.writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,41 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRoadmapEndpoint(t *testing.T) {
+	server := NewAPIServer()
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		return rec
+	}
+
+	var all RoadmapResponse
+	json.NewDecoder(get("/api/v1/roadmap").Body).Decode(&all)
+	if len(all.Stages) != 3 || all.Stages[0].Duration.Estimate != "2-3 weeks" {
+		t.Fatalf("roadmap = %+v", all.Stages)
+	}
+	var days int
+	for _, topic := range all.Stages[0].Topics {
+		days += topic.Duration.MinDays
+	}
+	if days != all.Stages[0].Duration.MinDays {
+		t.Errorf("beginner topics add up to %d days; stage says %d", days, all.Stages[0].Duration.MinDays)
+	}
+
+	var some RoadmapResponse
+	json.NewDecoder(get("/api/v2/roadmap?stage=beginner,Advanced").Body).Decode(&some)
+	if len(some.Stages) != 2 || some.Stages[1].Stage != "Advanced" ||
+		some.Duration.MinDays != some.Stages[0].Duration.MinDays+some.Stages[1].Duration.MinDays {
+		t.Errorf("filtered roadmap = %+v", some)
+	}
+
+	if rec := get("/api/v1/roadmap?stage=expert"); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown stage status = %d; want 400", rec.Code)
+	}
+}
@@ -0,0 +1,254 @@
+// Package apiserver implements the user REST API served by
+// examples/web_server.go.
+package apiserver
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"go-learning-guide/examples/breaker"
+	"go-learning-guide/examples/concurrency"
+	"go-learning-guide/runner"
+	"go-learning-guide/site"
+)
+
+// APIServer represents our HTTP server
+type APIServer struct {
+	store       *UserStore
+	chat        *ChatHub
+	runner      *runner.Runner // checks coding challenges, if enabled; see coderun.go
+	router      *mux.Router
+	middlewares []mux.MiddlewareFunc
+
+	// breakers guard outbound calls, by dependency; see breakers.go
+	breakersMu sync.Mutex
+	breakers   map[string]*breaker.Breaker
+
+	// requests counts requests by route; see metrics.go
+	requests concurrency.Counters
+
+	// heartbeatInterval is how often idle event streams send a comment
+	heartbeatInterval time.Duration
+
+	specOnce sync.Once
+	spec     map[string]interface{}
+	specErr  error
+}
+
+// NewAPIServer creates a new API server with an empty in-memory store
+func NewAPIServer() *APIServer {
+	return NewAPIServerWithStore(NewUserStore())
+}
+
+// NewAPIServerWithStore creates an API server around an existing store,
+// e.g. one opened with OpenUserStore
+func NewAPIServerWithStore(store *UserStore) *APIServer {
+	server := &APIServer{
+		store:             store,
+		chat:              NewChatHub(store),
+		router:            mux.NewRouter(),
+		heartbeatInterval: 15 * time.Second,
+	}
+	server.setupRoutes()
+	return server
+}
+
+// Store returns the server's user store
+func (s *APIServer) Store() *UserStore {
+	return s.store
+}
+
+// ServeHTTP makes the server usable as an http.Handler, e.g. in tests
+// or when mounting the API inside another server
+func (s *APIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.routeVersion(s.router).ServeHTTP(w, r)
+}
+
+// setupRoutes configures all the API routes
+func (s *APIServer) setupRoutes() {
+	// Middleware (outermost first)
+	s.middlewares = []mux.MiddlewareFunc{
+		s.requestIDMiddleware,
+		s.countingMiddleware,
+		s.loggingMiddleware,
+		s.compressionMiddleware, // outside recovery, so error bodies are compressed too
+		s.recoveryMiddleware,
+		s.corsMiddleware,
+		s.jsonMiddleware,
+	}
+	s.router.Use(s.middlewares...)
+
+	// API routes, one subrouter per version; see versioning.go
+	versionRoutes := map[string]func(*mux.Router){
+		"v1": s.setupV1Routes,
+		"v2": s.setupV2Routes,
+	}
+	for _, v := range apiVersions {
+		api := s.router.PathPrefix("/api/" + v.Name).Subrouter()
+		api.Use(s.versionHeaders(v))
+		versionRoutes[v.Name](api)
+	}
+
+	// The learning guide itself, embedded in the binary; API paths are
+	// left unmatched so they reach the problem+json NotFoundHandler below
+	s.router.MatcherFunc(isNotAPIPath).Handler(site.NewHandler())
+
+	// gorilla/mux skips middleware for unmatched requests, so wrap the
+	// fallback handlers ourselves to get CORS headers and problem bodies
+	s.router.NotFoundHandler = s.withMiddleware(http.HandlerFunc(s.handleNotFound))
+	s.router.MethodNotAllowedHandler = s.withMiddleware(http.HandlerFunc(s.handleMethodNotAllowed))
+}
+
+// setupV1Routes registers the original API. v1 is deprecated in favour
+// of v2 but keeps working until its sunset date.
+func (s *APIServer) setupV1Routes(api *mux.Router) {
+	// User endpoints
+	api.HandleFunc("/users/events", s.handleUserEvents).Methods("GET") // streaming, no timeout
+	api.Handle("/users", s.withTimeout(defaultRouteTimeout, s.handleGetUsers)).Methods("GET")
+	api.Handle("/users", s.withTimeout(defaultRouteTimeout, s.handleCreateUser)).Methods("POST")
+	api.HandleFunc("/users/export", s.handleExportUsers).Methods("GET") // streaming, no timeout
+	api.Handle("/users/import", s.withTimeout(batchTimeout, s.handleImportUsers)).Methods("POST")
+	api.Handle("/users:batch", s.withTimeout(batchTimeout, s.handleBatchUsers)).Methods("POST")
+	api.Handle("/users/{id:[0-9]+}", s.withTimeout(defaultRouteTimeout, s.handleGetUser)).Methods("GET")
+	api.Handle("/users/{id:[0-9]+}", s.withTimeout(defaultRouteTimeout, s.handleUpdateUser)).Methods("PUT")
+	api.Handle("/users/{id:[0-9]+}", s.withTimeout(defaultRouteTimeout, s.handleDeleteUser)).Methods("DELETE")
+
+	// Learning progress, see progress.go
+	api.Handle("/users/{id:[0-9]+}/progress", s.withTimeout(defaultRouteTimeout, s.handleGetProgress)).Methods("GET")
+	api.Handle("/users/{id:[0-9]+}/progress", s.withTimeout(defaultRouteTimeout, s.handleMergeProgress)).Methods("PUT")
+	api.Handle("/users/{id:[0-9]+}/progress", s.withTimeout(defaultRouteTimeout, s.handleResetProgress)).Methods("DELETE")
+	api.Handle("/progress", s.withTimeout(defaultRouteTimeout, s.handleListProgress)).Methods("GET")
+
+	// Quiz, graded on the server, see quiz.go
+	api.Handle("/quiz/questions", s.withTimeout(defaultRouteTimeout, s.handleListQuestions)).Methods("GET")
+	api.Handle("/quiz/questions/{qid}", s.withTimeout(defaultRouteTimeout, s.handleGetQuestion)).Methods("GET")
+	api.Handle("/quiz/questions/{qid}/answers", s.withTimeout(defaultRouteTimeout, s.handleAnswerQuestion)).Methods("POST")
+	api.Handle("/quiz/challenges", s.withTimeout(defaultRouteTimeout, s.handleListChallenges)).Methods("GET")
+	api.Handle("/quiz/challenges/{cid}/runs", s.withTimeout(runTimeout, s.handleRunChallenge)).Methods("POST")
+	api.Handle("/quiz/scores", s.withTimeout(defaultRouteTimeout, s.handleListQuizScores)).Methods("GET")
+	api.Handle("/users/{id:[0-9]+}/quiz", s.withTimeout(defaultRouteTimeout, s.handleGetQuizResults)).Methods("GET")
+
+	// Chat
+	api.Handle("/chat/rooms", s.withTimeout(defaultRouteTimeout, s.handleChatRooms)).Methods("GET")
+	api.Handle("/chat/rooms/{room}/messages", s.withTimeout(defaultRouteTimeout, s.handleChatHistory)).Methods("GET")
+	api.HandleFunc("/chat/rooms/{room}/ws", s.handleChatSocket).Methods("GET") // hijacked, no timeout
+
+	// Learning roadmap, see roadmap.go
+	api.Handle("/roadmap", s.withTimeout(defaultRouteTimeout, s.handleRoadmap)).Methods("GET")
+
+	// Go, Python and Java side by side, see syntax.go
+	api.Handle("/syntax", s.withTimeout(defaultRouteTimeout, s.handleSyntax)).Methods("GET")
+
+	// Health check
+	api.Handle("/health", s.withTimeout(healthTimeout, s.handleHealth)).Methods("GET")
+	api.Handle("/metrics/requests", s.withTimeout(defaultRouteTimeout, s.handleRequestMetrics)).Methods("GET")
+
+	// API documentation
+	api.Handle("/openapi.json", s.withTimeout(defaultRouteTimeout, s.handleOpenAPI)).Methods("GET")
+}
+
+// setupV2Routes registers the v2 API: the user resource in its v2
+// representation, see users_v2.go
+func (s *APIServer) setupV2Routes(api *mux.Router) {
+	api.Handle("/users", s.withTimeout(defaultRouteTimeout, s.handleGetUsersV2)).Methods("GET")
+	api.Handle("/users", s.withTimeout(defaultRouteTimeout, s.handleCreateUserV2)).Methods("POST")
+	api.Handle("/users/{id}", s.withTimeout(defaultRouteTimeout, s.handleGetUserV2)).Methods("GET")
+	api.Handle("/users/{id}", s.withTimeout(defaultRouteTimeout, s.handleUpdateUserV2)).Methods("PATCH")
+	api.Handle("/users/{id}", s.withTimeout(defaultRouteTimeout, s.handleDeleteUserV2)).Methods("DELETE")
+
+	api.Handle("/users/{id}/progress", s.withTimeout(defaultRouteTimeout, s.handleGetProgress)).Methods("GET")
+	api.Handle("/users/{id}/progress", s.withTimeout(defaultRouteTimeout, s.handleMergeProgress)).Methods("PUT")
+	api.Handle("/users/{id}/progress", s.withTimeout(defaultRouteTimeout, s.handleResetProgress)).Methods("DELETE")
+	api.Handle("/progress", s.withTimeout(defaultRouteTimeout, s.handleListProgress)).Methods("GET")
+	api.Handle("/quiz/questions", s.withTimeout(defaultRouteTimeout, s.handleListQuestions)).Methods("GET")
+	api.Handle("/quiz/questions/{qid}", s.withTimeout(defaultRouteTimeout, s.handleGetQuestion)).Methods("GET")
+	api.Handle("/quiz/questions/{qid}/answers", s.withTimeout(defaultRouteTimeout, s.handleAnswerQuestion)).Methods("POST")
+	api.Handle("/quiz/challenges", s.withTimeout(defaultRouteTimeout, s.handleListChallenges)).Methods("GET")
+	api.Handle("/quiz/challenges/{cid}/runs", s.withTimeout(runTimeout, s.handleRunChallenge)).Methods("POST")
+	api.Handle("/quiz/scores", s.withTimeout(defaultRouteTimeout, s.handleListQuizScores)).Methods("GET")
+	api.Handle("/users/{id}/quiz", s.withTimeout(defaultRouteTimeout, s.handleGetQuizResults)).Methods("GET")
+	api.Handle("/roadmap", s.withTimeout(defaultRouteTimeout, s.handleRoadmap)).Methods("GET")
+	api.Handle("/syntax", s.withTimeout(defaultRouteTimeout, s.handleSyntax)).Methods("GET")
+
+	api.Handle("/health", s.withTimeout(healthTimeout, s.handleHealth)).Methods("GET")
+	api.Handle("/metrics/requests", s.withTimeout(defaultRouteTimeout, s.handleRequestMetrics)).Methods("GET")
+	api.Handle("/openapi.json", s.withTimeout(defaultRouteTimeout, s.handleOpenAPI)).Methods("GET")
+}
+
+func isNotAPIPath(r *http.Request, _ *mux.RouteMatch) bool {
+	return !strings.HasPrefix(r.URL.Path, "/api/")
+}
+
+func (s *APIServer) writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		log.Printf("Error encoding JSON: %v", err)
+	}
+}
+
+// writeError sends an RFC 7807 problem response with the given title and detail
+func (s *APIServer) writeError(w http.ResponseWriter, r *http.Request, status int, title, detail string) {
+	s.writeProblem(w, r, ProblemDetails{
+		Title:  title,
+		Status: status,
+		Detail: detail,
+	})
+}
+
+// writeProblem fills in the common problem members and writes the response
+func (s *APIServer) writeProblem(w http.ResponseWriter, r *http.Request, problem ProblemDetails) {
+	if problem.Type == "" {
+		problem.Type = problemType(problem.Title)
+	}
+	if problem.Instance == "" {
+		problem.Instance = r.URL.RequestURI()
+	}
+	if problem.RequestID == "" {
+		problem.RequestID = requestIDFromContext(r.Context())
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	s.writeJSON(w, problem.Status, problem)
+}
+
+var nonSlugChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// problemType derives a problem type URI from its title,
+// e.g. "User not found" becomes "/problems/user-not-found"
+func problemType(title string) string {
+	slug := nonSlugChars.ReplaceAllString(strings.ToLower(title), "-")
+	return "/problems/" + strings.Trim(slug, "-")
+}
+
+// Start starts the server
+func (s *APIServer) Start(port string) error {
+	log.Printf("Starting server on port %s", port)
+	log.Printf("Health check: http://localhost%s/api/v2/health", port)
+	log.Printf("API v2 endpoints (also at /api/... with Accept: application/vnd.go-learning-guide.v2+json):")
+	log.Printf("  GET    /api/v2/users")
+	log.Printf("  POST   /api/v2/users")
+	log.Printf("  GET    /api/v2/users/{id}")
+	log.Printf("  PATCH  /api/v2/users/{id}")
+	log.Printf("  DELETE /api/v2/users/{id}")
+	log.Printf("API v1 endpoints (deprecated):")
+	log.Printf("  GET    /api/v1/users")
+	log.Printf("  POST   /api/v1/users")
+	log.Printf("  POST   /api/v1/users:batch?mode=atomic|best-effort")
+	log.Printf("  GET    /api/v1/users/export?format=csv|ndjson")
+	log.Printf("  POST   /api/v1/users/import?format=csv|ndjson&dry_run=true&map=field:Column")
+	log.Printf("  GET    /api/v1/users/{id}")
+	log.Printf("  PUT    /api/v1/users/{id}")
+	log.Printf("  DELETE /api/v1/users/{id}")
+	log.Printf("  GET    /api/v1/users/events (Server-Sent Events)")
+	log.Printf("  GET    /api/v1/chat/rooms/{room}/ws?user_id={id} (WebSocket)")
+	log.Printf("OpenAPI document: http://localhost%s/api/v1/openapi.json", port)
+
+	return http.ListenAndServe(port, s)
+}
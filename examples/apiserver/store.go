@@ -0,0 +1,162 @@
+package apiserver
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// User represents a user in our system
+type User struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+	// UpdatedAt is zero for users stored before it was tracked
+	UpdatedAt time.Time `json:"updated_at"`
+	// LastName is the part of Name that v2 shows as the last name, kept
+	// when v2 sets the name so that the split reads back as it was
+	// written. nil when v1 set the name; see nameParts.
+	LastName *string `json:"last_name,omitempty"`
+}
+
+// UserStore manages user data in memory. Stores opened with
+// OpenUserStore also log every change to disk; see persist.go.
+type UserStore struct {
+	mu     sync.RWMutex
+	users  map[int]*User
+	nextID int
+	// progress is kept per user and removed with them; see progress.go
+	progress map[int]*Progress
+	// quiz holds graded answers per user, likewise; see quiz.go
+	quiz   map[int]*QuizRecord
+	events *eventBus
+	wal    *userLog // nil for a purely in-memory store
+	// secret signs user keys; see auth.go
+	secret []byte
+}
+
+// NewUserStore creates a new in-memory user store
+func NewUserStore() *UserStore {
+	return &UserStore{
+		users:    make(map[int]*User),
+		nextID:   1,
+		progress: make(map[int]*Progress),
+		quiz:     make(map[int]*QuizRecord),
+		events:   newEventBus(),
+		secret:   newSecret(),
+	}
+}
+
+// CreateUser adds a new user
+func (s *UserStore) CreateUser(name, email string) *User {
+	return s.createUser(User{Name: name, Email: email})
+}
+
+// CreateUserNamed adds a new user with the name given in two parts, as
+// v2 takes it
+func (s *UserStore) CreateUserNamed(first, last, email string) *User {
+	last = strings.TrimSpace(last)
+	return s.createUser(User{Name: joinName(first, last), Email: email, LastName: &last})
+}
+
+func (s *UserStore) createUser(user User) *User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	user.ID = s.nextID
+	user.CreatedAt, user.UpdatedAt = now, now
+	s.logLocked(walOp{Op: walPut, User: user})
+	s.commitLocked()
+
+	s.users[s.nextID] = &user
+	s.nextID++
+	s.events.publish(UserCreated, user)
+	return &user
+}
+
+// GetUser retrieves a user by ID
+func (s *UserStore) GetUser(id int) (*User, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, exists := s.users[id]
+	return user, exists
+}
+
+// GetAllUsers returns all users
+func (s *UserStore) GetAllUsers() []*User {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := make([]*User, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, user)
+	}
+	return users
+}
+
+// UpdateUser updates an existing user; empty fields are left unchanged
+func (s *UserStore) UpdateUser(id int, name, email string) (*User, bool) {
+	return s.EditUser(id, func(u *User) {
+		if name != "" {
+			u.Name, u.LastName = name, nil
+		}
+		if email != "" {
+			u.Email = email
+		}
+	})
+}
+
+// EditUser changes a user with edit while holding the store lock, so
+// edits that depend on the current value (like replacing half of the
+// name) cannot race with other writers. edit gets a copy; its ID and
+// CreatedAt are kept.
+func (s *UserStore) EditUser(id int, edit func(u *User)) (*User, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, exists := s.users[id]
+	if !exists {
+		return nil, false
+	}
+
+	updated := *user
+	edit(&updated)
+	updated.ID, updated.CreatedAt = user.ID, user.CreatedAt
+	updated.UpdatedAt = time.Now()
+	s.logLocked(walOp{Op: walPut, User: updated})
+	s.commitLocked()
+
+	*user = updated
+	s.events.publish(UserUpdated, *user)
+	return user, true
+}
+
+// DeleteUser removes a user
+func (s *UserStore) DeleteUser(id int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, exists := s.users[id]
+	if exists {
+		s.logLocked(walOp{Op: walDelete, User: User{ID: id}})
+		s.commitLocked()
+		delete(s.users, id)
+		delete(s.progress, id)
+		delete(s.quiz, id)
+		s.events.publish(UserDeleted, *user)
+	}
+	return exists
+}
+
+// Subscribe streams store changes newer than lastID; see eventBus.subscribe
+func (s *UserStore) Subscribe(lastID uint64) (*EventSubscription, []UserEvent, bool) {
+	return s.events.subscribe(lastID)
+}
+
+// Unsubscribe stops a subscription created by Subscribe
+func (s *UserStore) Unsubscribe(sub *EventSubscription) {
+	s.events.unsubscribe(sub)
+}
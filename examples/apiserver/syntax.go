@@ -0,0 +1,87 @@
+package apiserver
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go-learning-guide/syntax"
+)
+
+// SyntaxMatch is one concept with its snippets. Score is how well the
+// concept matched the query, 1 for an exact match; it is left out when
+// listing everything.
+type SyntaxMatch struct {
+	Concept  string            `json:"concept"`
+	Score    float64           `json:"score,omitempty"`
+	Snippets map[string]string `json:"snippets"`
+}
+
+// SyntaxResponse lists the concepts that match, best first
+type SyntaxResponse struct {
+	Query     string        `json:"query,omitempty"`
+	Languages []string      `json:"languages"`
+	Matches   []SyntaxMatch `json:"matches"`
+	Count     int           `json:"count"`
+}
+
+// handleSyntax looks up go_syntax_comparison.csv. ?concept= is matched
+// loosely (case, word order, prefixes and typos are forgiven); without it
+// every concept is listed. ?lang=python limits the snippets to some
+// languages; repeat it or separate names with commas for several.
+func (s *APIServer) handleSyntax(w http.ResponseWriter, r *http.Request) {
+	table, err := syntax.Default()
+	if err != nil {
+		s.writeError(w, r, http.StatusInternalServerError, "Syntax comparison unavailable", err.Error())
+		return
+	}
+
+	query := r.URL.Query()
+	languages := table.Languages
+	if values := query["lang"]; len(values) > 0 {
+		languages = nil
+		var invalid []InvalidParam
+		for _, value := range values {
+			for _, name := range strings.Split(value, ",") {
+				lang, ok := table.Language(name)
+				if !ok {
+					invalid = append(invalid, InvalidParam{Name: "lang", Reason: fmt.Sprintf("unknown language %q", strings.TrimSpace(name))})
+					continue
+				}
+				languages = append(languages, lang)
+			}
+		}
+		if len(invalid) > 0 {
+			s.writeProblem(w, r, ProblemDetails{
+				Title:         "Invalid query parameter",
+				Status:        http.StatusBadRequest,
+				Detail:        "Languages are " + strings.Join(table.Languages, ", "),
+				InvalidParams: invalid,
+			})
+			return
+		}
+	}
+
+	concept := strings.TrimSpace(query.Get("concept"))
+	var matches []syntax.Match
+	if concept == "" {
+		for _, e := range table.Entries {
+			matches = append(matches, syntax.Match{Entry: e})
+		}
+	} else if matches = table.Search(concept); len(matches) == 0 {
+		s.writeError(w, r, http.StatusNotFound, "Concept not found",
+			fmt.Sprintf("Nothing like %q; concepts are %s", concept, strings.Join(table.Concepts(), ", ")))
+		return
+	}
+
+	resp := SyntaxResponse{Query: concept, Languages: languages, Matches: make([]SyntaxMatch, len(matches))}
+	for i, m := range matches {
+		snippets := make(map[string]string, len(languages))
+		for _, lang := range languages {
+			snippets[lang] = m.Snippets[lang]
+		}
+		resp.Matches[i] = SyntaxMatch{Concept: m.Concept, Score: m.Score, Snippets: snippets}
+	}
+	resp.Count = len(resp.Matches)
+	s.writeJSON(w, http.StatusOK, resp)
+}
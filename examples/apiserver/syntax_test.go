@@ -0,0 +1,40 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSyntaxEndpoint(t *testing.T) {
+	server := NewAPIServer()
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		return rec
+	}
+
+	var resp SyntaxResponse
+	json.NewDecoder(get("/api/v1/syntax?concept=erorr+handling&lang=python").Body).Decode(&resp)
+	if resp.Count == 0 || resp.Matches[0].Concept != "Error Handling" {
+		t.Fatalf("matches = %+v", resp.Matches)
+	}
+	if snippets := resp.Matches[0].Snippets; len(snippets) != 1 || !strings.HasPrefix(snippets["Python"], "try:") {
+		t.Errorf("snippets = %v; want only Python", snippets)
+	}
+
+	var all SyntaxResponse
+	json.NewDecoder(get("/api/v2/syntax").Body).Decode(&all)
+	if all.Count != 8 || len(all.Languages) != 3 {
+		t.Errorf("listing: %d concepts in %v", all.Count, all.Languages)
+	}
+
+	if rec := get("/api/v1/syntax?lang=cobol"); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown language status = %d; want 400", rec.Code)
+	}
+	if rec := get("/api/v1/syntax?concept=kubernetes"); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown concept status = %d; want 404", rec.Code)
+	}
+}
@@ -0,0 +1,61 @@
+package apiserver
+
+import (
+	"time"
+
+	"go-learning-guide/examples/breaker"
+	"go-learning-guide/examples/concurrency"
+)
+
+// UserRequest represents the request body for creating/updating users
+type UserRequest struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// ProblemDetails represents an RFC 7807 error response
+// (Content-Type: application/problem+json)
+type ProblemDetails struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+
+	// Extension members
+	RequestID     string         `json:"request_id,omitempty"`
+	InvalidParams []InvalidParam `json:"invalid_params,omitempty"`
+}
+
+// InvalidParam describes one field that failed validation
+type InvalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// UserListResponse represents the response body for listing users
+type UserListResponse struct {
+	Users []*User `json:"users"`
+	Count int     `json:"count"`
+}
+
+// MessageResponse represents a plain confirmation message
+type MessageResponse struct {
+	Message string `json:"message"`
+}
+
+// HealthResponse represents the health check response
+type HealthResponse struct {
+	Status    string    `json:"status"` // "ok" or "degraded"
+	Timestamp time.Time `json:"timestamp"`
+	Service   string    `json:"service"`
+	// Dependencies are the circuit breakers of outbound calls
+	Dependencies []breaker.Snapshot `json:"dependencies,omitempty"`
+}
+
+// RequestMetricsResponse counts the requests served since the server
+// started, by route
+type RequestMetricsResponse struct {
+	Routes []concurrency.NamedCount `json:"routes"`
+	Total  int64                    `json:"total"`
+}
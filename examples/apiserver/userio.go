@@ -0,0 +1,584 @@
+package apiserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Data formats for import and export
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// csvColumns is the export column order and the default import header
+var csvColumns = []string{"id", "name", "email", "created_at"}
+
+const (
+	exportPageSize     = 500  // users copied per store read lock
+	maxReportedErrors  = 1000 // per-line errors kept in an ImportReport
+	maxImportLineBytes = 1 << 20
+	// maxImportedID bounds the IDs an import may set, so the IDs handed
+	// out after it are nowhere near overflowing
+	maxImportedID = 1<<31 - 1
+)
+
+// ContentTypeFor returns the media type used for a data format
+func ContentTypeFor(format string) string {
+	if format == FormatCSV {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/x-ndjson"
+}
+
+// Page returns up to limit users with IDs from fromID upwards, in ID
+// order, plus the ID to continue from (0 once there are no more)
+func (s *UserStore) Page(fromID, limit int) (users []User, next int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// Walk the users rather than the ID range, which can have huge gaps
+	ids := make([]int, 0, len(s.users))
+	for id := range s.users {
+		if id >= fromID {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	if len(ids) > limit {
+		next = ids[limit]
+		ids = ids[:limit]
+	}
+	users = make([]User, 0, len(ids))
+	for _, id := range ids {
+		users = append(users, *s.users[id])
+	}
+	return users, next
+}
+
+// EachUser calls fn for every user in ID order, stopping at the first
+// error. The IDs are sorted once, up front: users created after the
+// call are left out, and ones deleted before fn reaches them skipped.
+// Only one page of users is copied at a time, and the store lock is not
+// held while fn runs; afterPage (if not nil) runs between pages.
+func (s *UserStore) EachUser(fn func(User) error, afterPage func() error) error {
+	s.mu.RLock()
+	ids := make([]int, 0, len(s.users))
+	for id := range s.users {
+		ids = append(ids, id)
+	}
+	s.mu.RUnlock()
+	sort.Ints(ids)
+
+	for {
+		page := ids[:min(len(ids), exportPageSize)]
+		ids = ids[len(page):]
+		for _, user := range s.usersByID(page) {
+			if err := fn(user); err != nil {
+				return err
+			}
+		}
+		if afterPage != nil {
+			if err := afterPage(); err != nil {
+				return err
+			}
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+	}
+}
+
+// usersByID copies the users with the given IDs that still exist
+func (s *UserStore) usersByID(ids []int) []User {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	users := make([]User, 0, len(ids))
+	for _, id := range ids {
+		if user, ok := s.users[id]; ok {
+			users = append(users, *user)
+		}
+	}
+	return users
+}
+
+// ExportUsers streams every user in ID order; see EachUser
+func (s *UserStore) ExportUsers(w io.Writer, format string) error {
+	enc, err := newUserEncoder(w, format)
+	if err != nil {
+		return err
+	}
+	return s.EachUser(enc.encode, enc.flush)
+}
+
+// userEncoder writes users in one of the data formats
+type userEncoder struct {
+	csv  *csv.Writer
+	json *json.Encoder
+}
+
+func newUserEncoder(w io.Writer, format string) (*userEncoder, error) {
+	switch format {
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(csvColumns); err != nil {
+			return nil, err
+		}
+		return &userEncoder{csv: cw}, nil
+	case FormatNDJSON:
+		return &userEncoder{json: json.NewEncoder(w)}, nil
+	default:
+		return nil, fmt.Errorf("unknown format %q (want %s or %s)", format, FormatCSV, FormatNDJSON)
+	}
+}
+
+func (e *userEncoder) encode(user User) error {
+	if e.json != nil {
+		return e.json.Encode(user) // Encode adds the newline
+	}
+	return e.csv.Write([]string{
+		strconv.Itoa(user.ID),
+		user.Name,
+		user.Email,
+		user.CreatedAt.Format(time.RFC3339Nano),
+	})
+}
+
+func (e *userEncoder) flush() error {
+	if e.csv != nil {
+		e.csv.Flush()
+		return e.csv.Error()
+	}
+	return nil
+}
+
+// ColumnMap maps user fields (id, name, email, created_at) to the column
+// names used in an import file, e.g. {"name": "Full Name"}. Fields that
+// are not mapped use their own name.
+type ColumnMap map[string]string
+
+// ParseColumnMap parses "field:Column" pairs such as "name:Full Name"
+func ParseColumnMap(specs []string) (ColumnMap, error) {
+	columns := make(ColumnMap)
+	for _, spec := range specs {
+		field, column, ok := strings.Cut(spec, ":")
+		field, column = strings.TrimSpace(field), strings.TrimSpace(column)
+		if !ok || column == "" {
+			return nil, fmt.Errorf("column mapping %q must look like field:Column", spec)
+		}
+		if !isUserField(field) {
+			return nil, fmt.Errorf("column mapping %q: unknown field %q (want one of %s)",
+				spec, field, strings.Join(csvColumns, ", "))
+		}
+		columns[field] = column
+	}
+	return columns, nil
+}
+
+func isUserField(name string) bool {
+	for _, c := range csvColumns {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (m ColumnMap) column(field string) string {
+	if c, ok := m[field]; ok {
+		return c
+	}
+	return field
+}
+
+// ImportRow is one decoded input record. Err is set when the line could
+// not be turned into a user; decoding continues with the next line.
+type ImportRow struct {
+	Line         int
+	User         User
+	HasID        bool
+	HasCreatedAt bool
+	Err          error
+}
+
+// UserDecoder reads users from CSV (with a header row) or NDJSON
+type UserDecoder struct {
+	format  string
+	columns ColumnMap
+
+	csv   *csv.Reader
+	index map[string]int // field -> CSV column position
+
+	lines *bufio.Scanner
+	line  int
+}
+
+// NewUserDecoder prepares to read users. For CSV the header row is read
+// immediately so missing columns are reported before any data.
+func NewUserDecoder(r io.Reader, format string, columns ColumnMap) (*UserDecoder, error) {
+	d := &UserDecoder{format: format, columns: columns}
+
+	switch format {
+	case FormatCSV:
+		d.csv = csv.NewReader(r)
+		d.csv.FieldsPerRecord = -1 // we report short rows per line instead
+		header, err := d.csv.Read()
+		if err != nil {
+			if err == io.EOF {
+				return nil, errors.New("CSV input is empty; a header row is required")
+			}
+			return nil, fmt.Errorf("reading CSV header: %w", err)
+		}
+		d.index = make(map[string]int)
+		for i, name := range header {
+			name = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")) // spreadsheets add a BOM
+			for _, field := range csvColumns {
+				if strings.EqualFold(name, columns.column(field)) {
+					d.index[field] = i
+				}
+			}
+		}
+		for _, field := range []string{"name", "email"} {
+			if _, ok := d.index[field]; !ok {
+				return nil, fmt.Errorf("CSV header has no %q column for %s", columns.column(field), field)
+			}
+		}
+
+	case FormatNDJSON:
+		d.lines = bufio.NewScanner(r)
+		d.lines.Buffer(make([]byte, 64*1024), maxImportLineBytes)
+
+	default:
+		return nil, fmt.Errorf("unknown format %q (want %s or %s)", format, FormatCSV, FormatNDJSON)
+	}
+	return d, nil
+}
+
+// Next returns the next row, or io.EOF when the input is exhausted.
+// Other errors mean the input cannot be read any further.
+func (d *UserDecoder) Next() (ImportRow, error) {
+	if d.csv != nil {
+		return d.nextCSV()
+	}
+	return d.nextNDJSON()
+}
+
+func (d *UserDecoder) nextCSV() (ImportRow, error) {
+	record, err := d.csv.Read()
+	if err == io.EOF {
+		return ImportRow{}, io.EOF
+	}
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return ImportRow{Line: parseErr.StartLine, Err: parseErr.Err}, nil
+	}
+	if err != nil {
+		return ImportRow{}, err
+	}
+
+	line, _ := d.csv.FieldPos(0)
+	values := make(map[string]string)
+	for field, i := range d.index {
+		if i >= len(record) {
+			return ImportRow{Line: line, Err: fmt.Errorf("row has %d columns; %s is column %d", len(record), field, i+1)}, nil
+		}
+		values[field] = strings.TrimSpace(record[i])
+	}
+	return buildImportRow(line, values), nil
+}
+
+func (d *UserDecoder) nextNDJSON() (ImportRow, error) {
+	for d.lines.Scan() {
+		d.line++
+		text := bytes.TrimSpace(d.lines.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		var raw map[string]json.RawMessage
+		if err := json.Unmarshal(text, &raw); err != nil {
+			return ImportRow{Line: d.line, Err: err}, nil
+		}
+		values := make(map[string]string)
+		for _, field := range csvColumns {
+			v, ok := raw[d.columns.column(field)]
+			if !ok || string(v) == "null" {
+				continue
+			}
+			var s string
+			if err := json.Unmarshal(v, &s); err != nil {
+				// Numbers (IDs) arrive unquoted
+				s = string(v)
+			}
+			values[field] = strings.TrimSpace(s)
+		}
+		return buildImportRow(d.line, values), nil
+	}
+	if err := d.lines.Err(); err != nil {
+		return ImportRow{}, err
+	}
+	return ImportRow{}, io.EOF
+}
+
+// buildImportRow converts field values into a user, collecting every
+// problem with the line rather than stopping at the first
+func buildImportRow(line int, values map[string]string) ImportRow {
+	row := ImportRow{Line: line}
+	row.User.Name = values["name"]
+	row.User.Email = values["email"]
+	invalid := validateNewUser(row.User.Name, row.User.Email)
+
+	if v := values["id"]; v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id < 1 || id > maxImportedID {
+			invalid = append(invalid, InvalidParam{Name: "id", Reason: fmt.Sprintf("must be an integer from 1 to %d", maxImportedID)})
+		}
+		row.User.ID, row.HasID = id, true
+	}
+	if v := values["created_at"]; v != "" {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			invalid = append(invalid, InvalidParam{Name: "created_at", Reason: "must be an RFC 3339 timestamp"})
+		}
+		row.User.CreatedAt, row.HasCreatedAt = t, true
+	}
+
+	if len(invalid) > 0 {
+		row.Err = &ValidationError{Params: invalid}
+	}
+	return row
+}
+
+// ImportLineError reports one rejected input line
+type ImportLineError struct {
+	Line          int            `json:"line"`
+	Message       string         `json:"message"`
+	InvalidParams []InvalidParam `json:"invalid_params,omitempty"`
+}
+
+// ImportReport summarises an import
+type ImportReport struct {
+	DryRun          bool              `json:"dry_run"`
+	Rows            int               `json:"rows"`
+	Created         int               `json:"created"`
+	Updated         int               `json:"updated"`
+	Failed          int               `json:"failed"`
+	Errors          []ImportLineError `json:"errors"`
+	ErrorsTruncated bool              `json:"errors_truncated,omitempty"`
+}
+
+func (r *ImportReport) addError(line int, err error) {
+	r.Failed++
+	if len(r.Errors) >= maxReportedErrors {
+		r.ErrorsTruncated = true
+		return
+	}
+	lineErr := ImportLineError{Line: line, Message: err.Error()}
+	var invalid *ValidationError
+	if errors.As(err, &invalid) {
+		lineErr.Message = "validation failed"
+		lineErr.InvalidParams = invalid.Params
+	}
+	r.Errors = append(r.Errors, lineErr)
+}
+
+// importState tracks what a dry run would have done, so later rows see
+// the IDs that earlier rows would have created
+type importState struct {
+	dryRun bool
+	nextID int
+	seen   map[int]bool
+}
+
+// Import loads users from dec. Rows with an ID update that user, or
+// create it with that ID if it does not exist; rows without an ID are
+// created with the next free ID. Invalid rows are reported by line and
+// skipped. With dryRun nothing is changed but the report is the same.
+// Rows are applied batchChunkSize at a time, each under one store lock.
+func (s *UserStore) Import(dec *UserDecoder, dryRun bool) (*ImportReport, error) {
+	report := &ImportReport{DryRun: dryRun, Errors: []ImportLineError{}}
+	state := &importState{dryRun: dryRun, seen: make(map[int]bool)}
+	if dryRun {
+		s.mu.RLock()
+		state.nextID = s.nextID
+		s.mu.RUnlock()
+	}
+
+	chunk := make([]ImportRow, 0, batchChunkSize)
+	for {
+		row, err := dec.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			s.importChunk(chunk, state, report)
+			return report, err
+		}
+		report.Rows++
+		if row.Err != nil {
+			report.addError(row.Line, row.Err)
+			continue
+		}
+		chunk = append(chunk, row)
+		if len(chunk) == batchChunkSize {
+			s.importChunk(chunk, state, report)
+			chunk = chunk[:0]
+		}
+	}
+	s.importChunk(chunk, state, report)
+	return report, nil
+}
+
+func (s *UserStore) importChunk(rows []ImportRow, state *importState, report *ImportReport) {
+	if len(rows) == 0 {
+		return
+	}
+	if state.dryRun {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+	} else {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+	}
+
+	for _, row := range rows {
+		user := row.User
+		user.UpdatedAt = time.Now()
+		if !row.HasCreatedAt {
+			user.CreatedAt = user.UpdatedAt
+		}
+
+		if state.dryRun {
+			if !row.HasID {
+				user.ID = state.nextID
+			}
+			_, exists := s.users[user.ID]
+			if exists || state.seen[user.ID] {
+				report.Updated++
+			} else {
+				report.Created++
+			}
+			state.seen[user.ID] = true
+			if user.ID >= state.nextID {
+				state.nextID = user.ID + 1
+			}
+			continue
+		}
+
+		if !row.HasID {
+			user.ID = s.nextID
+		}
+		existing, ok := s.users[user.ID]
+		if ok && !row.HasCreatedAt {
+			user.CreatedAt = existing.CreatedAt
+		}
+		s.logLocked(walOp{Op: walPut, User: user}) // one record per row; synced below
+		if ok {
+			*existing = user
+			report.Updated++
+			s.events.publish(UserUpdated, user)
+		} else {
+			s.users[user.ID] = &user
+			report.Created++
+			s.events.publish(UserCreated, user)
+		}
+		if user.ID >= s.nextID {
+			s.nextID = user.ID + 1
+		}
+	}
+	if !state.dryRun {
+		s.commitLocked()
+	}
+}
+
+// formatFromRequest picks csv or ndjson from ?format= or the Content-Type
+func formatFromRequest(r *http.Request, fallback string) string {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format
+	}
+	switch ct := r.Header.Get("Content-Type"); {
+	case strings.HasPrefix(ct, "text/csv"):
+		return FormatCSV
+	case strings.HasPrefix(ct, "application/x-ndjson"):
+		return FormatNDJSON
+	}
+	return fallback
+}
+
+// handleExportUsers streams the whole store as CSV or NDJSON
+func (s *APIServer) handleExportUsers(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = FormatCSV
+	}
+	if format != FormatCSV && format != FormatNDJSON {
+		s.writeError(w, r, http.StatusBadRequest, "Unknown format",
+			fmt.Sprintf("format must be %s or %s", FormatCSV, FormatNDJSON))
+		return
+	}
+
+	w.Header().Set("Content-Type", ContentTypeFor(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="users.%s"`, format))
+	w.WriteHeader(http.StatusOK)
+
+	if err := s.store.ExportUsers(w, format); err != nil {
+		// Headers are gone; all we can do is stop and log
+		log.Printf("[%s] export failed: %v", requestIDFromContext(r.Context()), err)
+	}
+}
+
+// handleImportUsers loads users from a CSV or NDJSON body. Use
+// ?dry_run=true to validate without changing anything, and
+// ?map=name:Full%20Name (repeatable) to rename CSV columns.
+func (s *APIServer) handleImportUsers(w http.ResponseWriter, r *http.Request) {
+	format := formatFromRequest(r, FormatCSV)
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+
+	columns, err := ParseColumnMap(r.URL.Query()["map"])
+	if err != nil {
+		s.writeError(w, r, http.StatusBadRequest, "Invalid column mapping", err.Error())
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, maxBatchBodyBytes)
+	dec, err := NewUserDecoder(body, format, columns)
+	if err != nil {
+		if isTooLarge(err) {
+			s.writeImportTooLarge(w, r, "")
+			return
+		}
+		s.writeError(w, r, http.StatusBadRequest, "Invalid import file", err.Error())
+		return
+	}
+
+	report, err := s.store.Import(dec, dryRun)
+	if err != nil {
+		var imported string
+		if !dryRun && report.Created+report.Updated > 0 {
+			imported = fmt.Sprintf(" (%d rows were imported before the error)", report.Created+report.Updated)
+		}
+		if isTooLarge(err) {
+			s.writeImportTooLarge(w, r, imported)
+			return
+		}
+		s.writeError(w, r, http.StatusBadRequest, "Invalid import file", err.Error()+imported)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, report)
+}
+
+func (s *APIServer) writeImportTooLarge(w http.ResponseWriter, r *http.Request, imported string) {
+	s.writeError(w, r, http.StatusRequestEntityTooLarge, "Import too large",
+		fmt.Sprintf("An import file may be at most %d bytes%s", maxBatchBodyBytes, imported))
+}
@@ -0,0 +1,203 @@
+package apiserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExportImportRoundTrip(t *testing.T) {
+	for _, format := range []string{FormatCSV, FormatNDJSON} {
+		t.Run(format, func(t *testing.T) {
+			src := NewUserStore()
+			for i := 0; i < exportPageSize+3; i++ {
+				src.CreateUser("User, \"quoted\"", "user@example.com")
+			}
+			src.DeleteUser(2) // exports must skip gaps
+
+			var buf bytes.Buffer
+			if err := src.ExportUsers(&buf, format); err != nil {
+				t.Fatalf("export: %v", err)
+			}
+
+			dst := NewUserStore()
+			dec, err := NewUserDecoder(&buf, format, nil)
+			if err != nil {
+				t.Fatalf("decoder: %v", err)
+			}
+			report, err := dst.Import(dec, false)
+			if err != nil {
+				t.Fatalf("import: %v", err)
+			}
+			if report.Created != exportPageSize+2 || report.Failed != 0 {
+				t.Fatalf("report = %+v", report)
+			}
+
+			want, got := src.GetAllUsers(), dst.GetAllUsers()
+			if len(got) != len(want) {
+				t.Fatalf("imported %d users; want %d", len(got), len(want))
+			}
+			for _, w := range want {
+				g, ok := dst.GetUser(w.ID)
+				if !ok || g.Name != w.Name || !g.CreatedAt.Equal(w.CreatedAt) {
+					t.Fatalf("user %d = %+v; want %+v", w.ID, g, w)
+				}
+			}
+			if _, ok := dst.GetUser(2); ok {
+				t.Error("deleted user 2 came back")
+			}
+		})
+	}
+}
+
+func TestEachUserListsUsersAsOfTheCall(t *testing.T) {
+	store := NewUserStore()
+	for i := 0; i < exportPageSize+2; i++ {
+		store.CreateUser("User", "user@example.com")
+	}
+	var ids []int
+	pages := 0
+	err := store.EachUser(func(u User) error {
+		ids = append(ids, u.ID)
+		return nil
+	}, func() error {
+		if pages++; pages == 1 {
+			store.DeleteUser(exportPageSize + 2)
+			store.CreateUser("Late", "late@example.com")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != exportPageSize+1 || ids[0] != 1 || ids[len(ids)-1] != exportPageSize+1 || pages != 2 {
+		t.Errorf("listed %d users, %d to %d, in %d pages; want 1 to %d in 2",
+			len(ids), ids[0], ids[len(ids)-1], pages, exportPageSize+1)
+	}
+}
+
+func TestImportReportsErrorsPerLine(t *testing.T) {
+	input := "Full Name,Mail\n" +
+		"Ada,ada@example.com\n" +
+		",missing@example.com\n" +
+		"\"bad quote,x@example.com\n"
+
+	columns, err := ParseColumnMap([]string{"name:Full Name", "email:Mail"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec, err := NewUserDecoder(strings.NewReader(input), FormatCSV, columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := NewUserStore().Import(dec, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Created != 1 || report.Failed != 2 {
+		t.Fatalf("report = %+v; want 1 created, 2 failed", report)
+	}
+	if report.Errors[0].Line != 3 || report.Errors[0].InvalidParams[0].Name != "name" {
+		t.Errorf("first error = %+v; want line 3, name", report.Errors[0])
+	}
+	if report.Errors[1].Line != 4 {
+		t.Errorf("second error on line %d; want 4", report.Errors[1].Line)
+	}
+}
+
+func TestImportBoundsIDs(t *testing.T) {
+	input := `{"id":1,"name":"Ada","email":"ada@example.com"}` + "\n" +
+		`{"id":2000000000,"name":"Bob","email":"bob@example.com"}` + "\n" +
+		`{"id":9223372036854775807,"name":"Cy","email":"cy@example.com"}` + "\n"
+	store := NewUserStore()
+	dec, err := NewUserDecoder(strings.NewReader(input), FormatNDJSON, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := store.Import(dec, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Created != 2 || report.Failed != 1 || report.Errors[0].Line != 3 {
+		t.Fatalf("report = %+v; want the ID that would overflow rejected", report)
+	}
+
+	// Paging walks the users, not the two billion IDs between them
+	users, next := store.Page(1, 1)
+	if len(users) != 1 || users[0].ID != 1 || next != 2000000000 {
+		t.Fatalf("Page(1, 1) = %v, %d", users, next)
+	}
+	if users, next = store.Page(next, 10); len(users) != 1 || users[0].Name != "Bob" || next != 0 {
+		t.Errorf("Page(next, 10) = %v, %d", users, next)
+	}
+}
+
+func TestImportDryRunChangesNothing(t *testing.T) {
+	server := NewAPIServer()
+	server.Store().CreateUser("Ada", "ada@example.com")
+
+	body := `{"id": 1, "name": "Ada L", "email": "ada@example.com"}
+{"name": "Bob", "email": "bob@example.com"}
+{"id": 2, "name": "Bob B", "email": "bob@example.com"}
+`
+	req := httptest.NewRequest("POST", "/api/v1/users/import?dry_run=true", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+
+	if rec.Code != 200 {
+		t.Fatalf("status = %d; body %s", rec.Code, rec.Body)
+	}
+	var report ImportReport
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	// The third line updates the user the second line would create
+	if !report.DryRun || report.Created != 1 || report.Updated != 2 {
+		t.Errorf("report = %+v; want 1 created, 2 updated", report)
+	}
+	if users := server.Store().GetAllUsers(); len(users) != 1 || users[0].Name != "Ada" {
+		t.Errorf("dry run changed the store: %+v", users)
+	}
+}
+
+func TestImportTooLarge(t *testing.T) {
+	for _, body := range []struct{ contentType, text string }{
+		{"text/csv", strings.Repeat("x", maxBatchBodyBytes+1)}, // still in the header
+		{"application/x-ndjson", strings.Repeat("\n", maxBatchBodyBytes+1)},
+	} {
+		server := NewAPIServer()
+		req := httptest.NewRequest("POST", "/api/v1/users/import", strings.NewReader(body.text))
+		req.Header.Set("Content-Type", body.contentType)
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		if rec.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("%s of %d bytes: status = %d; want 413", body.contentType, len(body.text), rec.Code)
+		}
+	}
+}
+
+func TestExportEndpoint(t *testing.T) {
+	server := NewAPIServer()
+	server.Store().CreateUser("Ada", "ada@example.com")
+
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/users/export", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+		t.Errorf("Content-Type = %q; want text/csv", ct)
+	}
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	if len(lines) != 2 || lines[0] != "id,name,email,created_at" || !strings.HasPrefix(lines[1], "1,Ada,") {
+		t.Errorf("export = %q", rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/users/export?format=xml", nil))
+	if rec.Code != 400 {
+		t.Errorf("format=xml status = %d; want 400", rec.Code)
+	}
+}
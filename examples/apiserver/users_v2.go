@@ -0,0 +1,271 @@
+package apiserver
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// UserV2 is the v2 representation of a user. IDs are opaque strings,
+// the name is split in two and updated_at is always present.
+type UserV2 struct {
+	ID        string    `json:"id"`
+	FirstName string    `json:"first_name"`
+	LastName  string    `json:"last_name"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// UserRequestV2 is the body for creating (POST) or changing (PATCH) a
+// user in v2. On PATCH, fields left out are unchanged; "last_name": ""
+// removes the last name.
+type UserRequestV2 struct {
+	FirstName *string `json:"first_name,omitempty"`
+	LastName  *string `json:"last_name,omitempty"`
+	Email     *string `json:"email,omitempty"`
+}
+
+// UserListResponseV2 lists users in ID order
+type UserListResponseV2 struct {
+	Users []UserV2 `json:"users"`
+	Count int      `json:"count"`
+}
+
+// The store keeps one name per user, as v1 always has, plus which part
+// of it is the last name when v2 wrote it. A name set through v1 is
+// split at the last space, so "Mary Ann Smith" reads back as "Mary Ann"
+// and "Smith"; a single word is a first name with no last name.
+
+// nameParts returns u's name as v2 shows it
+func nameParts(u User) (first, last string) {
+	name := strings.TrimSpace(u.Name)
+	if u.LastName != nil {
+		if *u.LastName == "" {
+			return name, ""
+		}
+		if first, ok := strings.CutSuffix(name, " "+*u.LastName); ok {
+			return strings.TrimSpace(first), *u.LastName
+		}
+	}
+	if i := strings.LastIndexByte(name, ' '); i >= 0 {
+		return strings.TrimSpace(name[:i]), name[i+1:]
+	}
+	return name, ""
+}
+
+func joinName(first, last string) string {
+	return strings.TrimSpace(strings.TrimSpace(first) + " " + strings.TrimSpace(last))
+}
+
+// userToV2 adapts a stored user to the v2 representation
+func userToV2(u User) UserV2 {
+	first, last := nameParts(u)
+	updated := u.UpdatedAt
+	if updated.IsZero() {
+		updated = u.CreatedAt // stored before updated_at was tracked
+	}
+	return UserV2{
+		ID:        strconv.Itoa(u.ID),
+		FirstName: first,
+		LastName:  last,
+		Email:     u.Email,
+		CreatedAt: u.CreatedAt,
+		UpdatedAt: updated,
+	}
+}
+
+// csvColumnsV2 is the CSV header of v2 user lists
+var csvColumnsV2 = []string{"id", "first_name", "last_name", "email", "created_at", "updated_at"}
+
+// writeUsersV2 streams every user in the v2 representation as CSV or
+// NDJSON
+func (s *APIServer) writeUsersV2(w io.Writer, format string) error {
+	if format == FormatNDJSON {
+		enc := json.NewEncoder(w)
+		return s.store.EachUser(func(u User) error { return enc.Encode(userToV2(u)) }, nil)
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvColumnsV2); err != nil {
+		return err
+	}
+	return s.store.EachUser(func(u User) error {
+		v2 := userToV2(u)
+		return cw.Write([]string{
+			v2.ID, v2.FirstName, v2.LastName, v2.Email,
+			v2.CreatedAt.Format(time.RFC3339Nano), v2.UpdatedAt.Format(time.RFC3339Nano),
+		})
+	}, func() error {
+		cw.Flush()
+		return cw.Error()
+	})
+}
+
+// userIDFromV2 parses a v2 ID. They are opaque to clients, so anything
+// that is not one of ours is simply not found.
+func userIDFromV2(id string) (int, bool) {
+	n, err := strconv.Atoi(id)
+	if err != nil || n < 1 || strconv.Itoa(n) != id {
+		return 0, false
+	}
+	return n, true
+}
+
+func (s *APIServer) userNotFoundV2(w http.ResponseWriter, r *http.Request, id string) {
+	s.writeError(w, r, http.StatusNotFound, "User not found", fmt.Sprintf("User %q does not exist", id))
+}
+
+// v2 handlers
+
+func (s *APIServer) handleGetUsersV2(w http.ResponseWriter, r *http.Request) {
+	format, ok := s.listFormat(w, r)
+	if !ok {
+		return
+	}
+	if format != "" {
+		w.Header().Set("Content-Type", ContentTypeFor(format))
+		w.WriteHeader(http.StatusOK)
+		if err := s.writeUsersV2(w, format); err != nil {
+			log.Printf("[%s] listing users: %v", requestIDFromContext(r.Context()), err)
+		}
+		return
+	}
+
+	stored := s.store.GetAllUsers()
+	sort.Slice(stored, func(i, j int) bool { return stored[i].ID < stored[j].ID })
+
+	users := make([]UserV2, len(stored))
+	for i, u := range stored {
+		users[i] = userToV2(*u)
+	}
+	s.writeJSON(w, http.StatusOK, UserListResponseV2{Users: users, Count: len(users)})
+}
+
+func (s *APIServer) handleGetUserV2(w http.ResponseWriter, r *http.Request) {
+	rawID := mux.Vars(r)["id"]
+	id, ok := userIDFromV2(rawID)
+	if !ok {
+		s.userNotFoundV2(w, r, rawID)
+		return
+	}
+	user, exists := s.store.GetUser(id)
+	if !exists {
+		s.userNotFoundV2(w, r, rawID)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, userToV2(*user))
+}
+
+func (s *APIServer) handleCreateUserV2(w http.ResponseWriter, r *http.Request) {
+	var req UserRequestV2
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, r, http.StatusBadRequest, "Invalid JSON", err.Error())
+		return
+	}
+
+	var first, last, email string
+	if req.FirstName != nil {
+		first = strings.TrimSpace(*req.FirstName)
+	}
+	if req.LastName != nil {
+		last = strings.TrimSpace(*req.LastName)
+	}
+	if req.Email != nil {
+		email = *req.Email
+	}
+
+	var invalid []InvalidParam
+	if first == "" {
+		invalid = append(invalid, InvalidParam{Name: "first_name", Reason: "is required"})
+	}
+	if email == "" {
+		invalid = append(invalid, InvalidParam{Name: "email", Reason: "is required"})
+	}
+	if len(invalid) > 0 {
+		s.writeProblem(w, r, ProblemDetails{
+			Title:         "Validation failed",
+			Status:        http.StatusBadRequest,
+			Detail:        "First name and email are required",
+			InvalidParams: invalid,
+		})
+		return
+	}
+
+	user := s.store.CreateUserNamed(first, last, email)
+	v2 := userToV2(*user)
+	w.Header().Set("Location", "/api/v2/users/"+v2.ID)
+	s.writeJSON(w, http.StatusCreated, v2)
+}
+
+func (s *APIServer) handleUpdateUserV2(w http.ResponseWriter, r *http.Request) {
+	rawID := mux.Vars(r)["id"]
+	id, ok := userIDFromV2(rawID)
+	if !ok {
+		s.userNotFoundV2(w, r, rawID)
+		return
+	}
+
+	var req UserRequestV2
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, r, http.StatusBadRequest, "Invalid JSON", err.Error())
+		return
+	}
+	var invalid []InvalidParam
+	if req.FirstName != nil && strings.TrimSpace(*req.FirstName) == "" {
+		invalid = append(invalid, InvalidParam{Name: "first_name", Reason: "must not be empty"})
+	}
+	if req.Email != nil && *req.Email == "" {
+		invalid = append(invalid, InvalidParam{Name: "email", Reason: "must not be empty"})
+	}
+	if len(invalid) > 0 {
+		s.writeProblem(w, r, ProblemDetails{
+			Title:         "Validation failed",
+			Status:        http.StatusBadRequest,
+			Detail:        "Fields that are sent must not be empty",
+			InvalidParams: invalid,
+		})
+		return
+	}
+
+	// Replacing only half of the name needs the other half as stored,
+	// so do the merge under the store lock
+	user, exists := s.store.EditUser(id, func(u *User) {
+		first, last := nameParts(*u)
+		if req.FirstName != nil {
+			first = *req.FirstName
+		}
+		if req.LastName != nil {
+			last = strings.TrimSpace(*req.LastName)
+		}
+		u.Name, u.LastName = joinName(first, last), &last
+		if req.Email != nil {
+			u.Email = *req.Email
+		}
+	})
+	if !exists {
+		s.userNotFoundV2(w, r, rawID)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, userToV2(*user))
+}
+
+func (s *APIServer) handleDeleteUserV2(w http.ResponseWriter, r *http.Request) {
+	rawID := mux.Vars(r)["id"]
+	id, ok := userIDFromV2(rawID)
+	if !ok || !s.store.DeleteUser(id) {
+		s.userNotFoundV2(w, r, rawID)
+		return
+	}
+	w.Header().Del("Content-Type") // set by jsonMiddleware, but there is no body
+	w.WriteHeader(http.StatusNoContent)
+}
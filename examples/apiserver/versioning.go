@@ -0,0 +1,192 @@
+package apiserver
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// API versions live side by side under /api/<version>/ and share the
+// store. Clients pick one by path, or call an unversioned path such as
+// /api/users and name the version in the Accept header:
+//
+//	Accept: application/vnd.go-learning-guide.v1+json
+//	Accept: application/json; version=1
+//
+// Without either, unversioned paths get latestAPIVersion.
+
+// apiVersion describes one version of the API
+type apiVersion struct {
+	Name string
+	// Deprecated and Sunset are zero while the version is supported.
+	// Deprecated responses carry Deprecation (RFC 9745), Sunset
+	// (RFC 8594) and a successor-version Link where one exists.
+	Deprecated time.Time
+	Sunset     time.Time
+}
+
+// apiVersions lists every version served, oldest first
+var apiVersions = []apiVersion{
+	{
+		Name:       "v1",
+		Deprecated: time.Date(2026, time.October, 1, 0, 0, 0, 0, time.UTC),
+		Sunset:     time.Date(2027, time.June, 30, 0, 0, 0, 0, time.UTC),
+	},
+	{
+		Name: "v2",
+	},
+}
+
+const latestAPIVersion = "v2"
+
+var (
+	versionSegment  = regexp.MustCompile(`^v[0-9]+$`)
+	vendorMediaType = regexp.MustCompile(`^application/vnd\.go-learning-guide\.(v[0-9]+)\+json$`)
+)
+
+func findAPIVersion(name string) (apiVersion, bool) {
+	for _, v := range apiVersions {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return apiVersion{}, false
+}
+
+func supportedVersions() string {
+	names := make([]string, len(apiVersions))
+	for i, v := range apiVersions {
+		names[i] = v.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// acceptedVersion returns the API version named in the Accept header,
+// or "" if it does not name one
+func acceptedVersion(h http.Header) string {
+	for _, value := range h.Values("Accept") {
+		for _, part := range strings.Split(value, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil {
+				continue
+			}
+			if m := vendorMediaType.FindStringSubmatch(mediaType); m != nil {
+				return m[1]
+			}
+			if v := params["version"]; v != "" && mediaType == "application/json" {
+				if _, err := strconv.Atoi(v); err == nil {
+					return "v" + v
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// routeVersion sends unversioned API paths to the version asked for in
+// the Accept header and rejects Accept headers that contradict the
+// version in the path. It runs before routing, so it wraps the router.
+func (s *APIServer) routeVersion(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rest, ok := strings.CutPrefix(r.URL.Path, "/api/")
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		segment, _, _ := strings.Cut(rest, "/")
+		versioned := versionSegment.MatchString(segment)
+		if !versioned {
+			// The answer depends on Accept, so caches must key on it
+			w.Header().Add("Vary", "Accept")
+		}
+
+		wanted := acceptedVersion(r.Header)
+		if wanted != "" {
+			if _, known := findAPIVersion(wanted); !known {
+				s.withMiddleware(s.notAcceptable(fmt.Sprintf(
+					"API version %s does not exist; supported versions are %s", wanted, supportedVersions()))).ServeHTTP(w, r)
+				return
+			}
+		}
+
+		if versioned {
+			if wanted != "" && wanted != segment {
+				s.withMiddleware(s.notAcceptable(fmt.Sprintf(
+					"The path asks for API %s but the Accept header asks for %s", segment, wanted))).ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if wanted == "" {
+			wanted = latestAPIVersion
+		}
+		rewritten := r.Clone(r.Context())
+		rewritten.URL.Path = "/api/" + wanted + "/" + rest
+		rewritten.URL.RawPath = ""
+		next.ServeHTTP(w, rewritten)
+	})
+}
+
+func (s *APIServer) notAcceptable(detail string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.writeError(w, r, http.StatusNotAcceptable, "API version not available", detail)
+	})
+}
+
+// versionHeaders labels responses with their API version and, for
+// deprecated versions, when they go away and what replaces them
+func (s *APIServer) versionHeaders(v apiVersion) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("API-Version", v.Name)
+			if !v.Deprecated.IsZero() {
+				w.Header().Set("Deprecation", fmt.Sprintf("@%d", v.Deprecated.Unix()))
+				if !v.Sunset.IsZero() {
+					w.Header().Set("Sunset", v.Sunset.UTC().Format(http.TimeFormat))
+				}
+				if successor, ok := s.successorPath(r, v.Name); ok {
+					w.Header().Add("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", successor))
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// successorPath finds the same resource in the latest version, if that
+// version lets it be fetched
+func (s *APIServer) successorPath(r *http.Request, from string) (string, bool) {
+	path, ok := strings.CutPrefix(r.URL.Path, "/api/"+from+"/")
+	if !ok || from == latestAPIVersion {
+		return "", false
+	}
+	probe := r.Clone(r.Context())
+	probe.Method = http.MethodGet // v2 may change with a different verb (PATCH, not PUT)
+	probe.URL.Path = "/api/" + latestAPIVersion + "/" + path
+	probe.URL.RawPath = ""
+
+	var match mux.RouteMatch
+	if !s.router.Match(probe, &match) || match.MatchErr != nil {
+		return "", false
+	}
+	return probe.URL.Path, true
+}
+
+// apiVersionOf returns the version a route template belongs to
+func apiVersionOf(template string) (apiVersion, bool) {
+	rest, ok := strings.CutPrefix(template, "/api/")
+	if !ok {
+		return apiVersion{}, false
+	}
+	segment, _, _ := strings.Cut(rest, "/")
+	return findAPIVersion(segment)
+}
@@ -0,0 +1,198 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestVersionNegotiation(t *testing.T) {
+	server := NewAPIServer()
+	server.Store().CreateUser("Ada Lovelace", "ada@example.com")
+
+	tests := []struct {
+		name        string
+		path        string
+		accept      string
+		wantStatus  int
+		wantVersion string
+	}{
+		{"v1 by path", "/api/v1/users/1", "", http.StatusOK, "v1"},
+		{"v2 by path", "/api/v2/users/1", "", http.StatusOK, "v2"},
+		{"unversioned defaults to latest", "/api/users/1", "", http.StatusOK, "v2"},
+		{"vendor media type", "/api/users/1", "application/vnd.go-learning-guide.v1+json", http.StatusOK, "v1"},
+		{"version parameter", "/api/users/1", "text/html, application/json; version=1", http.StatusOK, "v1"},
+		{"matching path and header", "/api/v2/users/1", "application/json; version=2", http.StatusOK, "v2"},
+		{"conflicting path and header", "/api/v1/users/1", "application/json; version=2", http.StatusNotAcceptable, ""},
+		{"unknown version", "/api/users/1", "application/vnd.go-learning-guide.v9+json", http.StatusNotAcceptable, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+			server.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d; want %d (body %s)", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if got := rec.Header().Get("API-Version"); got != tt.wantVersion {
+				t.Errorf("API-Version = %q; want %q", got, tt.wantVersion)
+			}
+			if strings.HasPrefix(tt.path, "/api/users") && rec.Header().Get("Vary") != "Accept" {
+				t.Errorf("unversioned response is missing Vary: Accept")
+			}
+		})
+	}
+}
+
+func TestV1DeprecationHeaders(t *testing.T) {
+	server := NewAPIServer()
+	server.Store().CreateUser("Ada Lovelace", "ada@example.com")
+
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest("PUT", "/api/v1/users/1", strings.NewReader(`{"name":"Ada"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	if got := rec.Header().Get("Deprecation"); !strings.HasPrefix(got, "@") {
+		t.Errorf("Deprecation = %q; want @<unix time>", got)
+	}
+	if got := rec.Header().Get("Sunset"); !strings.HasSuffix(got, "GMT") {
+		t.Errorf("Sunset = %q; want an HTTP date", got)
+	}
+	if got := rec.Header().Get("Link"); got != `</api/v2/users/1>; rel="successor-version"` {
+		t.Errorf("Link = %q", got)
+	}
+
+	// No v2 equivalent: no successor link
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/chat/rooms", nil))
+	if got := rec.Header().Get("Link"); got != "" {
+		t.Errorf("chat rooms Link = %q; want none", got)
+	}
+
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v2/users", nil))
+	if got := rec.Header().Get("Deprecation"); got != "" {
+		t.Errorf("v2 Deprecation = %q; want none", got)
+	}
+}
+
+func TestUserV2Lifecycle(t *testing.T) {
+	server := NewAPIServer()
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	rec := do("POST", "/api/v2/users", `{"first_name":"Mary Ann","last_name":"Smith","email":"mas@example.com"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create status = %d: %s", rec.Code, rec.Body)
+	}
+	var created UserV2
+	json.NewDecoder(rec.Body).Decode(&created)
+	if created.ID != "1" || created.FirstName != "Mary Ann" || created.LastName != "Smith" {
+		t.Errorf("created = %+v", created)
+	}
+	if rec.Header().Get("Location") != "/api/v2/users/1" {
+		t.Errorf("Location = %q", rec.Header().Get("Location"))
+	}
+
+	// v1 sees the same user with the joined name
+	if user, _ := server.Store().GetUser(1); user.Name != "Mary Ann Smith" {
+		t.Errorf("stored name = %q", user.Name)
+	}
+
+	rec = do("PATCH", "/api/v2/users/1", `{"last_name":"Jones"}`)
+	var patched UserV2
+	json.NewDecoder(rec.Body).Decode(&patched)
+	if patched.FirstName != "Mary Ann" || patched.LastName != "Jones" || patched.Email != "mas@example.com" {
+		t.Errorf("patched = %+v", patched)
+	}
+	if !patched.UpdatedAt.After(created.UpdatedAt) {
+		t.Errorf("updated_at did not move: %v then %v", created.UpdatedAt, patched.UpdatedAt)
+	}
+
+	if rec := do("PATCH", "/api/v2/users/1", `{"first_name":""}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("empty first_name status = %d; want 400", rec.Code)
+	}
+	for _, id := range []string{"abc", "01", "99"} {
+		if rec := do("GET", "/api/v2/users/"+id, ""); rec.Code != http.StatusNotFound {
+			t.Errorf("GET user %q status = %d; want 404", id, rec.Code)
+		}
+	}
+	if rec := do("DELETE", "/api/v2/users/1", ""); rec.Code != http.StatusNoContent || rec.Body.Len() != 0 {
+		t.Errorf("delete status = %d, body %q; want 204 and no body", rec.Code, rec.Body)
+	}
+}
+
+func TestNameParts(t *testing.T) {
+	str := func(s string) *string { return &s }
+	tests := []struct {
+		name        string
+		lastName    *string
+		first, last string
+	}{
+		{"Ada Lovelace", nil, "Ada", "Lovelace"},
+		{"Mary Ann Smith", nil, "Mary Ann", "Smith"},
+		{"Cher", nil, "Cher", ""},
+		{"  padded  name ", nil, "padded", "name"},
+		// written through v2
+		{"Mary Ann", str(""), "Mary Ann", ""},
+		{"Mary Ann Smith", str("Ann Smith"), "Mary", "Ann Smith"},
+		// a last name that no longer fits the name is ignored
+		{"Mary Ann", str("Smith"), "Mary", "Ann"},
+	}
+	for _, tt := range tests {
+		first, last := nameParts(User{Name: tt.name, LastName: tt.lastName})
+		if first != tt.first || last != tt.last {
+			t.Errorf("nameParts(%q, %v) = %q, %q; want %q, %q", tt.name, tt.lastName, first, last, tt.first, tt.last)
+		}
+	}
+}
+
+func TestUserV2NameRoundTrips(t *testing.T) {
+	server := NewAPIServer()
+	do := func(method, path, body string) UserV2 {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		if rec.Code/100 != 2 {
+			t.Fatalf("%s %s status = %d: %s", method, path, rec.Code, rec.Body)
+		}
+		var user UserV2
+		json.NewDecoder(rec.Body).Decode(&user)
+		return user
+	}
+
+	user := do("POST", "/api/v2/users", `{"first_name":"Mary Ann","email":"ma@example.com"}`)
+	if user.FirstName != "Mary Ann" || user.LastName != "" {
+		t.Errorf("created = %q, %q; want Mary Ann, no last name", user.FirstName, user.LastName)
+	}
+	if user = do("GET", "/api/v2/users/1", ""); user.FirstName != "Mary Ann" || user.LastName != "" {
+		t.Errorf("read back = %q, %q; want Mary Ann, no last name", user.FirstName, user.LastName)
+	}
+
+	user = do("PATCH", "/api/v2/users/1", `{"last_name":"van der Berg"}`)
+	if user.FirstName != "Mary Ann" || user.LastName != "van der Berg" {
+		t.Errorf("after last_name = %q, %q; want Mary Ann, van der Berg", user.FirstName, user.LastName)
+	}
+	user = do("PATCH", "/api/v2/users/1", `{"first_name":"Anne Marie"}`)
+	if user.FirstName != "Anne Marie" || user.LastName != "van der Berg" {
+		t.Errorf("after first_name = %q, %q; want Anne Marie, van der Berg", user.FirstName, user.LastName)
+	}
+
+	// Renaming through v1 drops the v2 split
+	server.Store().UpdateUser(1, "Jo Bloggs Smith", "")
+	if user = do("GET", "/api/v2/users/1", ""); user.FirstName != "Jo Bloggs" || user.LastName != "Smith" {
+		t.Errorf("after v1 rename = %q, %q; want Jo Bloggs, Smith", user.FirstName, user.LastName)
+	}
+}
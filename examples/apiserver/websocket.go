@@ -0,0 +1,316 @@
+package apiserver
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A minimal RFC 6455 WebSocket implementation: enough for the chat
+// server (text messages, ping/pong, close) without a dependency.
+
+// websocketGUID is the fixed key suffix from RFC 6455 section 1.3
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Frame opcodes
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// Close status codes
+const (
+	closeNormal          = 1000
+	closeGoingAway       = 1001
+	closeProtocolError   = 1002
+	closePolicyViolation = 1008
+	closeMessageTooBig   = 1009
+	closeTryAgainLater   = 1013
+)
+
+// maxMessageSize limits a single (possibly fragmented) message
+const maxMessageSize = 64 * 1024
+
+var (
+	errBadHandshake = errors.New("websocket: bad handshake")
+	errConnClosed   = errors.New("websocket: connection closed")
+)
+
+// wsConn is one end of a WebSocket connection. Reads must come from a
+// single goroutine; writes are safe for concurrent use.
+type wsConn struct {
+	conn   net.Conn
+	br     *bufio.Reader
+	client bool // clients mask their frames, servers must not
+
+	// readTimeout, if set, is how long the peer may stay silent; every
+	// frame received (including pongs) pushes the deadline back
+	readTimeout time.Duration
+
+	writeMu sync.Mutex
+	closed  bool
+}
+
+// websocketAccept computes the Sec-WebSocket-Accept value for a key
+func websocketAccept(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func headerContainsToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkWebSocketHandshake validates an upgrade request before anything
+// is written, so errors can still be reported as problem responses
+func checkWebSocketHandshake(r *http.Request) error {
+	if r.Method != http.MethodGet {
+		return fmt.Errorf("%w: method must be GET", errBadHandshake)
+	}
+	if !headerContainsToken(r.Header, "Connection", "upgrade") ||
+		!headerContainsToken(r.Header, "Upgrade", "websocket") {
+		return fmt.Errorf("%w: not a websocket upgrade request", errBadHandshake)
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		return fmt.Errorf("%w: unsupported Sec-WebSocket-Version", errBadHandshake)
+	}
+	key, err := base64.StdEncoding.DecodeString(r.Header.Get("Sec-WebSocket-Key"))
+	if err != nil || len(key) != 16 {
+		return fmt.Errorf("%w: invalid Sec-WebSocket-Key", errBadHandshake)
+	}
+	return nil
+}
+
+// upgradeWebSocket completes the opening handshake over a hijacked
+// connection. Call checkWebSocketHandshake first.
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	conn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("websocket: hijack: %w", err)
+	}
+
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + websocketAccept(r.Header.Get("Sec-WebSocket-Key")) + "\r\n\r\n"
+	if _, err := brw.WriteString(response); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := brw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &wsConn{conn: conn, br: brw.Reader}, nil
+}
+
+// ReadMessage returns the next text or binary message, answering pings
+// and close frames along the way
+func (c *wsConn) ReadMessage() (opcode int, payload []byte, err error) {
+	var message []byte
+	messageOp := -1
+
+	for {
+		if c.readTimeout > 0 {
+			c.conn.SetReadDeadline(time.Now().Add(c.readTimeout))
+		}
+		fin, op, data, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch op {
+		case opPing:
+			if err := c.writeFrame(opPong, data); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			code := closeNormal
+			if len(data) >= 2 {
+				code = int(binary.BigEndian.Uint16(data))
+			}
+			c.CloseWithStatus(code, "")
+			return 0, nil, errConnClosed
+		case opText, opBinary:
+			if messageOp != -1 {
+				c.CloseWithStatus(closeProtocolError, "expected continuation frame")
+				return 0, nil, errConnClosed
+			}
+			messageOp = op
+		case opContinuation:
+			if messageOp == -1 {
+				c.CloseWithStatus(closeProtocolError, "unexpected continuation frame")
+				return 0, nil, errConnClosed
+			}
+		default:
+			c.CloseWithStatus(closeProtocolError, "unknown opcode")
+			return 0, nil, errConnClosed
+		}
+
+		if len(message)+len(data) > maxMessageSize {
+			c.CloseWithStatus(closeMessageTooBig, "message too big")
+			return 0, nil, errConnClosed
+		}
+		message = append(message, data...)
+		if fin {
+			return messageOp, message, nil
+		}
+	}
+}
+
+func (c *wsConn) readFrame() (fin bool, opcode int, payload []byte, err error) {
+	var head [2]byte
+	if _, err = io.ReadFull(c.br, head[:]); err != nil {
+		return
+	}
+	fin = head[0]&0x80 != 0
+	opcode = int(head[0] & 0x0F)
+	masked := head[1]&0x80 != 0
+
+	if head[0]&0x70 != 0 {
+		c.CloseWithStatus(closeProtocolError, "reserved bits set")
+		return false, 0, nil, errConnClosed
+	}
+	if masked == c.client {
+		// Client-to-server frames must be masked, server-to-client must not
+		c.CloseWithStatus(closeProtocolError, "bad masking")
+		return false, 0, nil, errConnClosed
+	}
+
+	length := uint64(head[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.br, ext[:]); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.br, ext[:]); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if opcode >= opClose && (length > 125 || !fin) {
+		c.CloseWithStatus(closeProtocolError, "invalid control frame")
+		return false, 0, nil, errConnClosed
+	}
+	if length > maxMessageSize {
+		c.CloseWithStatus(closeMessageTooBig, "message too big")
+		return false, 0, nil, errConnClosed
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err = io.ReadFull(c.br, mask[:]); err != nil {
+			return
+		}
+	}
+
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(c.br, payload); err != nil {
+		return
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return fin, opcode, payload, nil
+}
+
+// WriteText sends a single-frame text message
+func (c *wsConn) WriteText(data []byte) error {
+	return c.writeFrame(opText, data)
+}
+
+// Ping sends a ping control frame
+func (c *wsConn) Ping() error {
+	return c.writeFrame(opPing, nil)
+}
+
+func (c *wsConn) writeFrame(opcode int, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.closed {
+		return errConnClosed
+	}
+
+	frame := make([]byte, 0, len(payload)+14)
+	frame = append(frame, 0x80|byte(opcode)) // FIN + opcode
+
+	var maskBit byte
+	if c.client {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n <= 125:
+		frame = append(frame, maskBit|byte(n))
+	case n <= 0xFFFF:
+		frame = append(frame, maskBit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+
+	if c.client {
+		// The mask only defeats proxy cache poisoning; it need not be secret
+		mask := [4]byte{byte(time.Now().UnixNano()), 0x5A, 0xA5, 0x3C}
+		frame = append(frame, mask[:]...)
+		for i, b := range payload {
+			frame = append(frame, b^mask[i%4])
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// CloseWithStatus sends a close frame and closes the connection
+func (c *wsConn) CloseWithStatus(code int, reason string) error {
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	payload = append(payload, reason...)
+	if len(payload) > 125 {
+		payload = payload[:125]
+	}
+	c.writeFrame(opClose, payload) // best effort
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	return c.conn.Close()
+}
@@ -0,0 +1,138 @@
+package apiserver
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// wsPipe returns a connected client/server pair over an in-memory pipe
+func wsPipe() (client, server *wsConn) {
+	c, s := net.Pipe()
+	client = &wsConn{conn: c, br: bufio.NewReader(c), client: true}
+	server = &wsConn{conn: s, br: bufio.NewReader(s)}
+	return client, server
+}
+
+func TestWebSocketAccept(t *testing.T) {
+	// Example from RFC 6455 section 1.3
+	got := websocketAccept("dGhlIHNhbXBsZSBub25jZQ==")
+	if want := "s3pPLMBiTxaQ9kYGzzhZRbK+xOo="; got != want {
+		t.Errorf("websocketAccept() = %q; want %q", got, want)
+	}
+}
+
+func TestCheckWebSocketHandshake(t *testing.T) {
+	valid := func() *http.Request {
+		r, _ := http.NewRequest("GET", "/ws", nil)
+		r.Header.Set("Connection", "keep-alive, Upgrade")
+		r.Header.Set("Upgrade", "websocket")
+		r.Header.Set("Sec-WebSocket-Version", "13")
+		r.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+		return r
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(r *http.Request)
+		wantErr bool
+	}{
+		{"valid", func(r *http.Request) {}, false},
+		{"wrong method", func(r *http.Request) { r.Method = "POST" }, true},
+		{"no upgrade", func(r *http.Request) { r.Header.Del("Upgrade") }, true},
+		{"old version", func(r *http.Request) { r.Header.Set("Sec-WebSocket-Version", "8") }, true},
+		{"short key", func(r *http.Request) { r.Header.Set("Sec-WebSocket-Key", "c2hvcnQ=") }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := valid()
+			tt.modify(r)
+			err := checkWebSocketHandshake(r)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkWebSocketHandshake() error = %v; wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWebSocketFrameRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		size int
+	}{
+		{"empty", 0},
+		{"7-bit length", 125},
+		{"16-bit length", 126},
+		{"largest 16-bit length", 65535},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := wsPipe()
+			defer client.conn.Close()
+			defer server.conn.Close()
+
+			payload := bytes.Repeat([]byte("x"), tt.size)
+			go client.WriteText(payload)
+
+			op, got, err := server.ReadMessage()
+			if err != nil {
+				t.Fatalf("ReadMessage() error: %v", err)
+			}
+			if op != opText {
+				t.Errorf("opcode = %d; want %d", op, opText)
+			}
+			if !bytes.Equal(got, payload) {
+				t.Errorf("payload of %d bytes came back as %d bytes", len(payload), len(got))
+			}
+		})
+	}
+}
+
+func TestWebSocketReassemblesFragments(t *testing.T) {
+	client, server := wsPipe()
+	defer client.conn.Close()
+	defer server.conn.Close()
+
+	go func() {
+		// "Hel" (text, not final) + ping + "lo" (continuation, final)
+		client.conn.Write([]byte{0x01, 0x83, 0, 0, 0, 0, 'H', 'e', 'l'})
+		client.conn.Write([]byte{0x89, 0x80, 0, 0, 0, 0})
+		client.conn.Write([]byte{0x80, 0x82, 0, 0, 0, 0, 'l', 'o'})
+	}()
+	go func() {
+		// Drain the pong the server sends back
+		client.readFrame()
+	}()
+
+	_, got, err := server.ReadMessage()
+	if err != nil {
+		t.Fatalf("ReadMessage() error: %v", err)
+	}
+	if string(got) != "Hello" {
+		t.Errorf("message = %q; want %q", got, "Hello")
+	}
+}
+
+func TestWebSocketRejectsUnmaskedClientFrame(t *testing.T) {
+	client, server := wsPipe()
+	defer client.conn.Close()
+
+	go func() {
+		client.conn.Write([]byte{0x81, 0x02, 'h', 'i'}) // unmasked text frame
+		// Read the close frame the server answers with
+		_, op, data, _ := client.readFrame()
+		if op != opClose || len(data) < 2 || int(data[0])<<8|int(data[1]) != closeProtocolError {
+			t.Errorf("server replied with opcode %d payload %v; want close %d", op, data, closeProtocolError)
+		}
+	}()
+
+	_, _, err := server.ReadMessage()
+	if err == nil || !strings.Contains(err.Error(), "closed") {
+		t.Errorf("ReadMessage() error = %v; want connection closed", err)
+	}
+}
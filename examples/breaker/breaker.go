@@ -0,0 +1,365 @@
+// Package breaker is a circuit breaker for calls to other services. When
+// too many recent calls to a dependency fail, the breaker opens and
+// fails calls at once instead of letting each wait on a service that is
+// down; after a while it lets a few probe calls through, and closes
+// again if they succeed.
+//
+//	b := breaker.New(breaker.Settings{Name: "payments"})
+//	err := b.Do(ctx, func(ctx context.Context) error { ... })
+//	if errors.Is(err, breaker.ErrOpen) { ... }
+//
+// For HTTP clients, Transport wraps an http.RoundTripper.
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go-learning-guide/examples/clock"
+)
+
+// State is where a breaker is in its cycle
+type State int
+
+// The states of a breaker
+const (
+	// Closed lets every call through, counting failures
+	Closed State = iota
+	// Open fails every call with ErrOpen until OpenTimeout has passed
+	Open
+	// HalfOpen lets Probes calls through to test the dependency
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+// MarshalText writes the state by name, for JSON
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText reads a state written by MarshalText
+func (s *State) UnmarshalText(text []byte) error {
+	for _, state := range []State{Closed, Open, HalfOpen} {
+		if state.String() == string(text) {
+			*s = state
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown circuit breaker state %q", text)
+}
+
+// ErrOpen is returned, wrapped, for calls the breaker didn't let through
+var ErrOpen = errors.New("circuit breaker is open")
+
+// Defaults for a Settings' zero fields
+const (
+	DefaultWindow      = 10 * time.Second
+	DefaultBuckets     = 10
+	DefaultMinRequests = 20
+	DefaultFailureRate = 0.5
+	DefaultOpenTimeout = 30 * time.Second
+	DefaultProbes      = 1
+)
+
+// Settings configure a breaker
+type Settings struct {
+	// Name identifies the dependency in errors, callbacks and health
+	// checks
+	Name string
+
+	// Window is how far back failures are counted, in Buckets steps:
+	// each bucket covers Window/Buckets and is dropped as a whole
+	Window  time.Duration
+	Buckets int
+	// The breaker opens when at least MinRequests calls in the window
+	// include FailureRate (0 to 1) or more failures
+	MinRequests int
+	FailureRate float64
+
+	// OpenTimeout is how long the breaker stays open before probing
+	OpenTimeout time.Duration
+	// Probes is how many calls go through at once when half-open; that
+	// many must succeed to close the breaker, and one failure opens it
+	Probes int
+
+	// IsFailure says whether a call's error counts against the
+	// dependency; nil counts every error. Calls the caller cancelled
+	// don't count either way.
+	IsFailure func(error) bool
+	// OnStateChange, if set, is called after every change of state.
+	// It must not block; the breaker isn't locked while it runs.
+	OnStateChange func(name string, from, to State)
+
+	// Clock is the time source; nil means clock.Real
+	Clock clock.Clock
+}
+
+// bucket counts the calls of one slice of the window
+type bucket struct {
+	slot      int64 // which slice of time this is, to spot stale buckets
+	successes int
+	failures  int
+}
+
+// Breaker is a circuit breaker. It is safe for concurrent use.
+type Breaker struct {
+	settings   Settings
+	bucketSize time.Duration
+
+	mu       sync.Mutex
+	state    State
+	since    time.Time // when the state last changed
+	buckets  []bucket
+	rejected int64
+	// generation changes with the state, so calls that started in an
+	// earlier state don't count in this one
+	generation uint64
+	// Half-open bookkeeping
+	probing   int
+	succeeded int
+}
+
+// New creates a closed breaker
+func New(settings Settings) *Breaker {
+	if settings.Window <= 0 {
+		settings.Window = DefaultWindow
+	}
+	if settings.Buckets <= 0 {
+		settings.Buckets = DefaultBuckets
+	}
+	if settings.MinRequests <= 0 {
+		settings.MinRequests = DefaultMinRequests
+	}
+	if settings.FailureRate <= 0 || settings.FailureRate > 1 {
+		settings.FailureRate = DefaultFailureRate
+	}
+	if settings.OpenTimeout <= 0 {
+		settings.OpenTimeout = DefaultOpenTimeout
+	}
+	if settings.Probes <= 0 {
+		settings.Probes = DefaultProbes
+	}
+	if settings.Clock == nil {
+		settings.Clock = clock.Real{}
+	}
+	bucketSize := settings.Window / time.Duration(settings.Buckets)
+	if bucketSize <= 0 {
+		bucketSize = 1
+	}
+	return &Breaker{
+		settings:   settings,
+		bucketSize: bucketSize,
+		since:      settings.Clock.Now(),
+		buckets:    make([]bucket, settings.Buckets),
+	}
+}
+
+// Name returns the breaker's name
+func (b *Breaker) Name() string { return b.settings.Name }
+
+// transition is a change of state to report once unlocked
+type transition struct {
+	from, to State
+	changed  bool
+}
+
+func (b *Breaker) notify(t transition) {
+	if t.changed && b.settings.OnStateChange != nil {
+		b.settings.OnStateChange(b.settings.Name, t.from, t.to)
+	}
+}
+
+// setState moves to a new state; the caller holds b.mu
+func (b *Breaker) setState(to State, now time.Time) transition {
+	t := transition{from: b.state, to: to, changed: b.state != to}
+	b.state = to
+	b.since = now
+	b.generation++
+	b.probing, b.succeeded = 0, 0
+	if to == Closed {
+		// A fresh start: the failures that opened the breaker are history
+		for i := range b.buckets {
+			b.buckets[i] = bucket{}
+		}
+	}
+	return t
+}
+
+// allow asks to make a call. It returns the generation to report the
+// outcome against, or ErrOpen.
+func (b *Breaker) allow() (uint64, error) {
+	b.mu.Lock()
+	now := b.settings.Clock.Now()
+	var t transition
+	if b.state == Open && now.Sub(b.since) >= b.settings.OpenTimeout {
+		t = b.setState(HalfOpen, now)
+	}
+	var err error
+	switch {
+	case b.state == Open:
+		err = fmt.Errorf("%s: %w", b.settings.Name, ErrOpen)
+	case b.state == HalfOpen && b.probing >= b.settings.Probes:
+		err = fmt.Errorf("%s: %w (probing)", b.settings.Name, ErrOpen)
+	case b.state == HalfOpen:
+		b.probing++
+	}
+	if err != nil {
+		b.rejected++
+	}
+	generation := b.generation
+	b.mu.Unlock()
+
+	b.notify(t)
+	return generation, err
+}
+
+// outcome of a call
+type outcome int
+
+const (
+	success outcome = iota
+	failure
+	ignored // the caller gave up; says nothing about the dependency
+)
+
+// record counts a call's outcome
+func (b *Breaker) record(generation uint64, result outcome) {
+	b.mu.Lock()
+	now := b.settings.Clock.Now()
+	var t transition
+	if generation == b.generation {
+		switch b.state {
+		case Closed:
+			if result != ignored {
+				b.count(now, result == failure)
+				if requests, failures := b.totals(now); requests >= b.settings.MinRequests &&
+					float64(failures) >= b.settings.FailureRate*float64(requests) {
+					t = b.setState(Open, now)
+				}
+			}
+		case HalfOpen:
+			b.probing--
+			switch result {
+			case failure:
+				t = b.setState(Open, now)
+			case success:
+				b.succeeded++
+				if b.succeeded >= b.settings.Probes {
+					t = b.setState(Closed, now)
+				}
+			}
+		}
+	}
+	b.mu.Unlock()
+
+	b.notify(t)
+}
+
+// slot is the window slice that now falls in
+func (b *Breaker) slot(now time.Time) int64 {
+	return now.UnixNano() / int64(b.bucketSize)
+}
+
+// count adds a call to the window; the caller holds b.mu
+func (b *Breaker) count(now time.Time, failed bool) {
+	slot := b.slot(now)
+	bk := &b.buckets[slot%int64(len(b.buckets))]
+	if bk.slot != slot {
+		*bk = bucket{slot: slot}
+	}
+	if failed {
+		bk.failures++
+	} else {
+		bk.successes++
+	}
+}
+
+// totals adds up the window; the caller holds b.mu
+func (b *Breaker) totals(now time.Time) (requests, failures int) {
+	current := b.slot(now)
+	for _, bk := range b.buckets {
+		if bk.slot > current-int64(len(b.buckets)) && bk.slot <= current {
+			requests += bk.successes + bk.failures
+			failures += bk.failures
+		}
+	}
+	return requests, failures
+}
+
+// isFailure classifies a call's error
+func (b *Breaker) isFailure(ctx context.Context, err error) outcome {
+	switch {
+	case err == nil:
+		return success
+	case ctx.Err() != nil && errors.Is(err, context.Canceled):
+		return ignored
+	case b.settings.IsFailure != nil && !b.settings.IsFailure(err):
+		return success
+	}
+	return failure
+}
+
+// Do calls fn if the breaker allows it, and counts how it went. When it
+// doesn't, it returns an error wrapping ErrOpen without calling fn.
+func (b *Breaker) Do(ctx context.Context, fn func(context.Context) error) (err error) {
+	generation, err := b.allow()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			b.record(generation, failure)
+			panic(p)
+		}
+	}()
+	err = fn(ctx)
+	b.record(generation, b.isFailure(ctx, err))
+	return err
+}
+
+// State returns the breaker's current state. An open breaker whose
+// OpenTimeout has passed reports HalfOpen, as the next call finds it.
+func (b *Breaker) State() State {
+	return b.Snapshot().State
+}
+
+// Snapshot is a breaker's state and recent counts, for health checks
+type Snapshot struct {
+	Name        string    `json:"name"`
+	State       State     `json:"state"`
+	Since       time.Time `json:"since"`
+	Requests    int       `json:"requests"` // calls counted in the window
+	Failures    int       `json:"failures"`
+	FailureRate float64   `json:"failure_rate"`
+	Rejected    int64     `json:"rejected"` // calls failed with ErrOpen, ever
+}
+
+// Snapshot returns the breaker's state and counts
+func (b *Breaker) Snapshot() Snapshot {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.settings.Clock.Now()
+	s := Snapshot{Name: b.settings.Name, State: b.state, Since: b.since, Rejected: b.rejected}
+	if s.State == Open && now.Sub(b.since) >= b.settings.OpenTimeout {
+		s.State = HalfOpen
+	}
+	s.Requests, s.Failures = b.totals(now)
+	if s.Requests > 0 {
+		s.FailureRate = float64(s.Failures) / float64(s.Requests)
+	}
+	return s
+}
@@ -0,0 +1,270 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go-learning-guide/examples/clock/clocktest"
+)
+
+var errDown = errors.New("service down")
+
+// changes records state changes as "from>to"
+type changes struct {
+	mu  sync.Mutex
+	log []string
+}
+
+func (c *changes) record(name string, from, to State) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.log = append(c.log, fmt.Sprintf("%s:%v>%v", name, from, to))
+}
+
+func (c *changes) String() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return fmt.Sprint(c.log)
+}
+
+func newTestBreaker(c *clocktest.Fake, ch *changes) *Breaker {
+	return New(Settings{
+		Name:          "dep",
+		Window:        10 * time.Second,
+		Buckets:       10,
+		MinRequests:   4,
+		FailureRate:   0.5,
+		OpenTimeout:   5 * time.Second,
+		Probes:        2,
+		OnStateChange: ch.record,
+		Clock:         c,
+	})
+}
+
+func call(b *Breaker, err error) error {
+	return b.Do(context.Background(), func(context.Context) error { return err })
+}
+
+func TestBreakerCycle(t *testing.T) {
+	c, ch := clocktest.New(), &changes{}
+	b := newTestBreaker(c, ch)
+
+	// 1 failure in 4 stays closed; 2 in 4 opens
+	for _, err := range []error{nil, nil, errDown, nil} {
+		call(b, err)
+	}
+	if b.State() != Closed {
+		t.Fatalf("state %v after 1 failure in 4", b.State())
+	}
+	call(b, errDown)
+	call(b, errDown)
+	if b.State() != Open {
+		t.Fatalf("state %v after 3 failures in 6", b.State())
+	}
+
+	// Open: calls fail at once
+	called := false
+	err := b.Do(context.Background(), func(context.Context) error { called = true; return nil })
+	if !errors.Is(err, ErrOpen) || called {
+		t.Fatalf("open breaker: err %v, called %v", err, called)
+	}
+
+	// After OpenTimeout, two probes go through, a third is refused
+	c.Advance(5 * time.Second)
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	started := make(chan struct{}, 2)
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.Do(context.Background(), func(context.Context) error {
+				started <- struct{}{}
+				<-release
+				return nil
+			})
+		}()
+	}
+	<-started
+	<-started
+	if b.State() != HalfOpen {
+		t.Errorf("state %v while probing", b.State())
+	}
+	if err := call(b, nil); !errors.Is(err, ErrOpen) {
+		t.Errorf("third probe: %v, want ErrOpen", err)
+	}
+	close(release)
+	wg.Wait()
+	if b.State() != Closed {
+		t.Fatalf("state %v after two good probes", b.State())
+	}
+
+	want := "[dep:closed>open dep:open>half-open dep:half-open>closed]"
+	if got := ch.String(); got != want {
+		t.Errorf("state changes %s, want %s", got, want)
+	}
+	if s := b.Snapshot(); s.Rejected != 2 || s.Requests != 0 {
+		t.Errorf("snapshot %+v, want 2 rejected and a fresh window", s)
+	}
+}
+
+func TestBreakerFailedProbeReopens(t *testing.T) {
+	c, ch := clocktest.New(), &changes{}
+	b := newTestBreaker(c, ch)
+	for i := 0; i < 4; i++ {
+		call(b, errDown)
+	}
+	c.Advance(5 * time.Second)
+	if err := call(b, errDown); !errors.Is(err, errDown) {
+		t.Fatalf("probe: %v", err)
+	}
+	if b.State() != Open {
+		t.Fatalf("state %v after a failed probe", b.State())
+	}
+	// The open period starts again
+	c.Advance(4 * time.Second)
+	if err := call(b, nil); !errors.Is(err, ErrOpen) {
+		t.Errorf("got %v, want still open", err)
+	}
+	want := "[dep:closed>open dep:open>half-open dep:half-open>open]"
+	if got := ch.String(); got != want {
+		t.Errorf("state changes %s, want %s", got, want)
+	}
+}
+
+func TestBreakerWindowSlides(t *testing.T) {
+	c := clocktest.New()
+	b := newTestBreaker(c, &changes{})
+
+	call(b, errDown)
+	call(b, errDown)
+	call(b, errDown)
+	// The failures age out of the 10s window
+	c.Advance(11 * time.Second)
+	call(b, errDown)
+	call(b, nil)
+	call(b, nil)
+	if b.State() != Closed {
+		t.Fatalf("state %v, but only 1 failure in 3 is in the window", b.State())
+	}
+	if s := b.Snapshot(); s.Requests != 3 || s.Failures != 1 {
+		t.Errorf("snapshot %+v, want 3 requests and 1 failure", s)
+	}
+	call(b, errDown)
+	if b.State() != Open {
+		t.Errorf("state %v after 2 failures in 4", b.State())
+	}
+}
+
+func TestBreakerIgnoresCallerCancellation(t *testing.T) {
+	b := newTestBreaker(clocktest.New(), &changes{})
+	for i := 0; i < 10; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		b.Do(ctx, func(ctx context.Context) error { return ctx.Err() })
+	}
+	if s := b.Snapshot(); s.State != Closed || s.Requests != 0 {
+		t.Errorf("snapshot %+v, want cancelled calls not counted", s)
+	}
+}
+
+func TestBreakerIsFailure(t *testing.T) {
+	errNotFound := errors.New("not found")
+	b := New(Settings{
+		MinRequests: 2,
+		IsFailure:   func(err error) bool { return !errors.Is(err, errNotFound) },
+	})
+	for i := 0; i < 5; i++ {
+		call(b, errNotFound)
+	}
+	if b.State() != Closed {
+		t.Errorf("state %v: a not found is the caller's problem", b.State())
+	}
+}
+
+func TestBreakerStaleResults(t *testing.T) {
+	c := clocktest.New()
+	b := newTestBreaker(c, &changes{})
+
+	// A slow call starts while closed and finishes after the breaker has
+	// opened and half-opened; it must not count as a probe
+	release, started := make(chan struct{}), make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		b.Do(context.Background(), func(context.Context) error {
+			close(started)
+			<-release
+			return nil
+		})
+	}()
+	<-started
+	for i := 0; i < 4; i++ {
+		call(b, errDown)
+	}
+	c.Advance(5 * time.Second)
+	call(b, nil) // first probe
+	close(release)
+	<-done
+	if b.State() != HalfOpen {
+		t.Errorf("state %v; the stale success counted as the second probe", b.State())
+	}
+}
+
+func TestBreakerPanicCountsAsFailure(t *testing.T) {
+	b := New(Settings{MinRequests: 1})
+	func() {
+		defer func() { recover() }()
+		b.Do(context.Background(), func(context.Context) error { panic("boom") })
+	}()
+	if b.State() != Open {
+		t.Errorf("state %v after a panic", b.State())
+	}
+}
+
+func TestTransport(t *testing.T) {
+	status := http.StatusOK
+	var mu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	b := New(Settings{Name: "upstream", MinRequests: 2, FailureRate: 0.6})
+	client := &http.Client{Transport: &Transport{Breaker: b}}
+
+	get := func() (*http.Response, error) {
+		resp, err := client.Get(srv.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return resp, err
+	}
+
+	if resp, err := get(); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("got %v, %v", resp, err)
+	}
+	mu.Lock()
+	status = http.StatusBadGateway
+	mu.Unlock()
+	// 5xx responses come back as responses, but count
+	for i := 0; i < 2; i++ {
+		if resp, err := get(); err != nil || resp.StatusCode != http.StatusBadGateway {
+			t.Fatalf("got %v, %v; want the 502", resp, err)
+		}
+	}
+	if b.State() != Open {
+		t.Fatalf("state %v after 2 failures in 3", b.State())
+	}
+	if _, err := get(); !errors.Is(err, ErrOpen) {
+		t.Errorf("got %v, want ErrOpen through the client", err)
+	}
+}
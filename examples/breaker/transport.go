@@ -0,0 +1,62 @@
+package breaker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// Transport is an http.RoundTripper that sends requests through a
+// breaker. Transport errors and responses that IsFailure picks out
+// count as failures; while the breaker is open, requests fail at once
+// with an error wrapping ErrOpen.
+//
+//	client := &http.Client{Transport: &breaker.Transport{Breaker: b}}
+type Transport struct {
+	Breaker *Breaker
+	// Base sends the requests; nil means http.DefaultTransport
+	Base http.RoundTripper
+	// IsFailure says whether a response counts against the dependency;
+	// nil counts 5xx responses
+	IsFailure func(*http.Response) bool
+}
+
+// statusError counts a bad response as a failure; RoundTrip still
+// returns the response itself
+type statusError struct{ status int }
+
+func (e statusError) Error() string { return fmt.Sprintf("status %d", e.status) }
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	var resp *http.Response
+	err := t.Breaker.Do(req.Context(), func(ctx context.Context) error {
+		var err error
+		resp, err = base.RoundTrip(req)
+		if err != nil {
+			return err
+		}
+		if t.failed(resp) {
+			return statusError{resp.StatusCode}
+		}
+		return nil
+	})
+	if _, ok := err.(statusError); ok {
+		return resp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (t *Transport) failed(resp *http.Response) bool {
+	if t.IsFailure != nil {
+		return t.IsFailure(resp)
+	}
+	return resp.StatusCode >= 500
+}
@@ -0,0 +1,142 @@
+// Package clock is the time source the concurrency examples share. The
+// scheduler, workers' job deadlines, retries, circuit breakers and the
+// durable queue read the time and wait through a Clock, so their tests
+// can move time with a fake one (package clocktest) instead of sleeping.
+package clock
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Clock tells the time and makes timers
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a timer made by a Clock
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+}
+
+// Real is the system clock
+type Real struct{}
+
+// Now returns the current time
+func (Real) Now() time.Time { return time.Now() }
+
+// NewTimer starts a time.Timer
+func (Real) NewTimer(d time.Duration) Timer { return realTimer{time.NewTimer(d)} }
+
+type realTimer struct{ t *time.Timer }
+
+func (t realTimer) C() <-chan time.Time { return t.t.C }
+func (t realTimer) Stop() bool          { return t.t.Stop() }
+
+// Sleep waits for d on c, or until ctx ends, which it reports
+func Sleep(ctx context.Context, c Clock, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	t := c.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Signal wakes goroutines waiting for state guarded by a mutex to
+// change, like sync.Cond, but a wait can also end at a time on a Clock
+// or with a context. The zero value is ready to use.
+type Signal struct {
+	ch chan struct{} // closed, and replaced, by Broadcast
+}
+
+// Broadcast wakes every goroutine waiting on s. The caller holds the
+// mutex the waiters passed to Wait.
+func (s *Signal) Broadcast() {
+	if s.ch != nil {
+		close(s.ch)
+		s.ch = nil
+	}
+}
+
+// Wait unlocks mu, which the caller holds, and waits for Broadcast, for
+// c to reach wake unless it is zero, or for ctx to end. It locks mu
+// again before returning ctx's error, if any. As with sync.Cond, the
+// caller checks its state again after every wait.
+func (s *Signal) Wait(ctx context.Context, mu sync.Locker, c Clock, wake time.Time) error {
+	if s.ch == nil {
+		s.ch = make(chan struct{})
+	}
+	changed := s.ch
+	var due <-chan time.Time
+	if !wake.IsZero() {
+		t := c.NewTimer(wake.Sub(c.Now()))
+		defer t.Stop()
+		due = t.C()
+	}
+	mu.Unlock()
+	defer mu.Lock()
+
+	select {
+	case <-changed:
+	case <-due:
+	case <-ctx.Done():
+	}
+	return ctx.Err()
+}
+
+// WithDeadline is context.WithDeadline with the deadline kept by c: the
+// context ends with context.DeadlineExceeded once c reaches deadline
+func WithDeadline(parent context.Context, c Clock, deadline time.Time) (context.Context, context.CancelFunc) {
+	if _, ok := c.(Real); ok {
+		return context.WithDeadline(parent, deadline)
+	}
+	ctx, cancel := context.WithCancelCause(parent)
+	dctx := &deadlineCtx{Context: ctx, deadline: deadline}
+	d := deadline.Sub(c.Now())
+	if d <= 0 {
+		cancel(context.DeadlineExceeded)
+		return dctx, func() { cancel(context.Canceled) }
+	}
+	t := c.NewTimer(d)
+	go func() {
+		select {
+		case <-t.C():
+			cancel(context.DeadlineExceeded)
+		case <-ctx.Done():
+			t.Stop()
+		}
+	}()
+	// Stop the timer before returning, so a fake clock doesn't still
+	// count it once the caller is done
+	return dctx, func() {
+		cancel(context.Canceled)
+		t.Stop()
+	}
+}
+
+// deadlineCtx reports the deadline it ends at, and DeadlineExceeded
+// once it has
+type deadlineCtx struct {
+	context.Context
+	deadline time.Time
+}
+
+func (c *deadlineCtx) Deadline() (time.Time, bool) { return c.deadline, true }
+
+func (c *deadlineCtx) Err() error {
+	err := c.Context.Err()
+	if err != nil && errors.Is(context.Cause(c.Context), context.DeadlineExceeded) {
+		return context.DeadlineExceeded
+	}
+	return err
+}
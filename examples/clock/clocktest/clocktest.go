@@ -0,0 +1,147 @@
+// Package clocktest provides a fake clock.Clock for tests: time only
+// moves when the test says so, and the test can wait for the code under
+// test to set its timers instead of sleeping.
+package clocktest
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"go-learning-guide/examples/clock"
+)
+
+// Start is when a fake clock starts: 2024-01-01, a Monday, at midnight
+// UTC
+var Start = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Fake is a clock.Clock that only moves when told to. Its zero value is
+// not usable; call New or NewAuto.
+type Fake struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*timer
+	// changed is closed, and replaced, whenever a timer is set or goes
+	changed chan struct{}
+	// auto fires timers as they are set; see NewAuto
+	auto  bool
+	waits []time.Duration
+}
+
+type timer struct {
+	clock *Fake
+	at    time.Time
+	c     chan time.Time
+}
+
+// New returns a fake clock at Start
+func New() *Fake {
+	return &Fake{now: Start, changed: make(chan struct{})}
+}
+
+// NewAuto returns a fake clock at Start that moves on to each timer as
+// soon as it is set, firing it and any others due by then: for code
+// that only sleeps, such as retries, so it runs at once
+func NewAuto() *Fake {
+	c := New()
+	c.auto = true
+	return c
+}
+
+// Now returns the fake time
+func (c *Fake) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTimer sets a timer that fires when the clock reaches now plus d
+func (c *Fake) NewTimer(d time.Duration) clock.Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.waits = append(c.waits, d)
+	t := &timer{clock: c, at: c.now.Add(d), c: make(chan time.Time, 1)}
+	if !t.at.After(c.now) {
+		t.c <- c.now
+		return t
+	}
+	c.timers = append(c.timers, t)
+	c.changedLocked()
+	if c.auto {
+		c.advanceLocked(d)
+	}
+	return t
+}
+
+func (t *timer) C() <-chan time.Time { return t.c }
+
+func (t *timer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, other := range c.timers {
+		if other == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			c.changedLocked()
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Fake) changedLocked() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// Advance moves the clock on, firing the timers that come due
+func (c *Fake) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.advanceLocked(d)
+}
+
+func (c *Fake) advanceLocked(d time.Duration) {
+	c.now = c.now.Add(d)
+	pending := c.timers[:0]
+	for _, t := range c.timers {
+		if t.at.After(c.now) {
+			pending = append(pending, t)
+		} else {
+			t.c <- c.now
+		}
+	}
+	if len(pending) != len(c.timers) {
+		c.timers = pending
+		c.changedLocked()
+	}
+}
+
+// Waits returns the duration of every timer set so far, in order
+func (c *Fake) Waits() []time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]time.Duration(nil), c.waits...)
+}
+
+// WaitForTimers waits until n timers are set and not yet fired, e.g. by
+// workers waiting for a job to come due. It fails the test if that
+// doesn't happen within a few seconds of real time.
+func (c *Fake) WaitForTimers(t testing.TB, n int) {
+	t.Helper()
+	giveUp := time.NewTimer(5 * time.Second)
+	defer giveUp.Stop()
+	for {
+		c.mu.Lock()
+		set, changed := len(c.timers), c.changed
+		c.mu.Unlock()
+		if set == n {
+			return
+		}
+		select {
+		case <-changed:
+		case <-giveUp.C:
+			t.Fatalf("%d timers set, want %d", set, n)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package concurrency
+
+import (
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Counter is a count that many goroutines add to at once. The
+// implementations trade the cost of Add against the cost of Value;
+// compare them with
+//
+//	go test -run '^$' -bench Counter -cpu 1,4,16 ./examples/concurrency
+type Counter interface {
+	Add(delta int64)
+	Increment()
+	Value() int64
+}
+
+// MutexCounter guards an int64 with a RWMutex. Every Add takes the
+// lock, so under contention the goroutines queue for it.
+type MutexCounter struct {
+	mu    sync.RWMutex
+	value int64
+}
+
+// Add adds delta to the counter
+func (c *MutexCounter) Add(delta int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.value += delta
+}
+
+// Increment adds one to the counter
+func (c *MutexCounter) Increment() { c.Add(1) }
+
+// Value returns the counter's value
+func (c *MutexCounter) Value() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.value
+}
+
+// AtomicCounter is a single atomic.Int64: no lock, but every CPU that
+// adds to it needs the same cache line, which bounces between them
+type AtomicCounter struct {
+	value atomic.Int64
+}
+
+// Add adds delta to the counter
+func (c *AtomicCounter) Add(delta int64) { c.value.Add(delta) }
+
+// Increment adds one to the counter
+func (c *AtomicCounter) Increment() { c.value.Add(1) }
+
+// Value returns the counter's value
+func (c *AtomicCounter) Value() int64 { return c.value.Load() }
+
+// cacheLineSize is the size of a CPU cache line on common hardware
+const cacheLineSize = 64
+
+// shard is one part of a ShardedCounter, padded to a cache line of its
+// own so that CPUs adding to neighbouring shards don't contend
+type shard struct {
+	value atomic.Int64
+	_     [cacheLineSize - 8]byte
+}
+
+// ShardedCounter spreads its count over a shard per P (per CPU running
+// Go code), so concurrent Adds mostly touch different cache lines. Value
+// adds up the shards, which makes it the slowest to read. The zero
+// value is not usable; use NewShardedCounter.
+type ShardedCounter struct {
+	shards []shard
+	next   atomic.Uint32 // shard for the next P to ask for one
+	// slots hands out shard indexes. A sync.Pool keeps a cache per P,
+	// so a goroutine usually gets the index its P used last time.
+	slots sync.Pool
+}
+
+// NewShardedCounter creates a counter with a shard per P
+func NewShardedCounter() *ShardedCounter {
+	c := &ShardedCounter{shards: make([]shard, runtime.GOMAXPROCS(0))}
+	c.slots.New = func() any {
+		i := int(c.next.Add(1)-1) % len(c.shards)
+		return &i
+	}
+	return c
+}
+
+// Add adds delta to the counter
+func (c *ShardedCounter) Add(delta int64) {
+	i := c.slots.Get().(*int)
+	c.shards[*i].value.Add(delta)
+	c.slots.Put(i)
+}
+
+// Increment adds one to the counter
+func (c *ShardedCounter) Increment() { c.Add(1) }
+
+// Value returns the sum of the shards. Adds that run meanwhile may or
+// may not be included.
+func (c *ShardedCounter) Value() int64 {
+	var total int64
+	for i := range c.shards {
+		total += c.shards[i].value.Load()
+	}
+	return total
+}
+
+// Counters is a set of named counters, created on first use, e.g. one
+// per API route. Looking up an existing name takes no lock.
+type Counters struct {
+	counters sync.Map // name -> Counter
+	// New creates each counter; nil means NewShardedCounter
+	New func() Counter
+}
+
+// Get returns the counter with the given name, creating it if needed
+func (c *Counters) Get(name string) Counter {
+	if counter, ok := c.counters.Load(name); ok {
+		return counter.(Counter)
+	}
+	var counter Counter
+	if c.New != nil {
+		counter = c.New()
+	} else {
+		counter = NewShardedCounter()
+	}
+	actual, _ := c.counters.LoadOrStore(name, counter)
+	return actual.(Counter)
+}
+
+// Increment adds one to the named counter
+func (c *Counters) Increment(name string) { c.Get(name).Increment() }
+
+// NamedCount is the value of one of a Counters' counters
+type NamedCount struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
+
+// Values returns the value of every counter, sorted by name
+func (c *Counters) Values() []NamedCount {
+	var values []NamedCount
+	c.counters.Range(func(name, counter any) bool {
+		values = append(values, NamedCount{Name: name.(string), Count: counter.(Counter).Value()})
+		return true
+	})
+	sort.Slice(values, func(i, j int) bool { return values[i].Name < values[j].Name })
+	return values
+}
@@ -0,0 +1,121 @@
+package concurrency
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func counters() map[string]func() Counter {
+	return map[string]func() Counter{
+		"mutex":   func() Counter { return &MutexCounter{} },
+		"atomic":  func() Counter { return &AtomicCounter{} },
+		"sharded": func() Counter { return NewShardedCounter() },
+	}
+}
+
+func TestCounters(t *testing.T) {
+	for name, newCounter := range counters() {
+		t.Run(name, func(t *testing.T) {
+			c := newCounter()
+			var wg sync.WaitGroup
+			for g := 0; g < 8; g++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := 0; i < 1000; i++ {
+						c.Increment()
+					}
+					c.Add(-500)
+				}()
+			}
+			wg.Wait()
+			if got := c.Value(); got != 8*500 {
+				t.Errorf("Value() = %d; want %d", got, 8*500)
+			}
+		})
+	}
+}
+
+func TestNamedCounters(t *testing.T) {
+	var c Counters
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				c.Increment("GET /users")
+				if i%10 == 0 {
+					c.Increment("POST /users")
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	want := []NamedCount{{"GET /users", 400}, {"POST /users", 40}}
+	if got := c.Values(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Values() = %v; want %v", got, want)
+	}
+	if c.Get("GET /users") != c.Get("GET /users") {
+		t.Error("Get returned a different counter for the same name")
+	}
+
+	atomic := Counters{New: func() Counter { return &AtomicCounter{} }}
+	if _, ok := atomic.Get("x").(*AtomicCounter); !ok {
+		t.Error("New was not used")
+	}
+}
+
+// Benchmarks: every goroutine adds to the same counter. Run them with
+// -cpu 1,4,16 to see how each copes as contention grows.
+func benchmarkCounter(b *testing.B, c Counter) {
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			c.Increment()
+		}
+	})
+}
+
+func BenchmarkMutexCounter(b *testing.B) {
+	benchmarkCounter(b, &MutexCounter{})
+}
+
+func BenchmarkAtomicCounter(b *testing.B) {
+	benchmarkCounter(b, &AtomicCounter{})
+}
+
+func BenchmarkShardedCounter(b *testing.B) {
+	benchmarkCounter(b, NewShardedCounter())
+}
+
+// Sharding costs on the read side: Value visits every shard
+func BenchmarkShardedCounterValue(b *testing.B) {
+	c := NewShardedCounter()
+	for i := 0; i < b.N; i++ {
+		c.Value()
+	}
+}
+
+// BenchmarkNamedCounters counts requests over a handful of routes, the
+// way the API server does
+func BenchmarkNamedCounters(b *testing.B) {
+	for name, newCounter := range counters() {
+		b.Run(name, func(b *testing.B) {
+			c := &Counters{New: newCounter}
+			routes := make([]string, 8)
+			for i := range routes {
+				routes[i] = fmt.Sprintf("GET /api/v2/route%d", i)
+			}
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					c.Increment(routes[i%len(routes)])
+					i++
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,30 @@
+// Package leaktest checks that a test doesn't leave goroutines behind.
+// The tests of the concurrency examples (workers, brokers, queues) share
+// it.
+package leaktest
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+// Check fails the test if it leaves more goroutines running than it
+// started with, and prints their stacks. Goroutines take a moment to
+// exit once told to, so it waits a little before giving up.
+func Check(t testing.TB) {
+	t.Helper()
+	before := runtime.NumGoroutine()
+	t.Cleanup(func() {
+		deadline := time.Now().Add(2 * time.Second)
+		for runtime.NumGoroutine() > before {
+			if time.Now().After(deadline) {
+				buf := make([]byte, 1<<16)
+				buf = buf[:runtime.Stack(buf, true)]
+				t.Errorf("%d goroutines still running, want %d:\n%s", runtime.NumGoroutine(), before, buf)
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+}
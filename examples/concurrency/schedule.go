@@ -0,0 +1,151 @@
+package concurrency
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule says when a recurring job runs
+type Schedule interface {
+	// Next returns the first run after t, or the zero time for never
+	Next(t time.Time) time.Time
+}
+
+// Every runs at a fixed interval
+type Every time.Duration
+
+// Next returns t plus the interval
+func (e Every) Next(t time.Time) time.Time {
+	if e <= 0 {
+		return time.Time{}
+	}
+	return t.Add(time.Duration(e))
+}
+
+// Cron is a schedule in crontab form, parsed by ParseCron
+type Cron struct {
+	minute, hour, dom, month, dow uint64 // bit i set: i matches
+	// In crontab, when both days are restricted a day matching either
+	// one counts
+	domAny, dowAny bool
+}
+
+// cronFields are the five crontab fields and their ranges
+var cronFields = []struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 6},
+}
+
+// ParseCron parses a crontab schedule: minute, hour, day of month,
+// month and day of week (0 is Sunday), separated by spaces. Each field
+// is *, a number, a range like 1-5, or a list of those like 0,30, and
+// *, ranges and lists may take a step like */15. "@hourly", "@daily",
+// "@weekly" and "@monthly" are shorthands.
+func ParseCron(spec string) (*Cron, error) {
+	switch spec {
+	case "@hourly":
+		spec = "0 * * * *"
+	case "@daily", "@midnight":
+		spec = "0 0 * * *"
+	case "@weekly":
+		spec = "0 0 * * 0"
+	case "@monthly":
+		spec = "0 0 1 * *"
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("cron %q: want %d fields, got %d", spec, len(cronFields), len(fields))
+	}
+	var bits [5]uint64
+	for i, field := range fields {
+		b, err := parseCronField(field, cronFields[i].min, cronFields[i].max)
+		if err != nil {
+			return nil, fmt.Errorf("cron %q: %s: %w", spec, cronFields[i].name, err)
+		}
+		bits[i] = b
+	}
+	return &Cron{
+		minute: bits[0], hour: bits[1], dom: bits[2], month: bits[3], dow: bits[4],
+		domAny: fields[2] == "*",
+		dowAny: fields[4] == "*",
+	}, nil
+}
+
+// parseCronField turns one field into a bit set
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if rangePart, stepPart, ok := strings.Cut(part, "/"); ok {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("bad step %q", stepPart)
+			}
+			part, step = rangePart, n
+		}
+		lo, hi := min, max
+		if part != "*" {
+			first, last, isRange := strings.Cut(part, "-")
+			var err error
+			if lo, err = strconv.Atoi(first); err != nil {
+				return 0, fmt.Errorf("bad value %q", first)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(last); err != nil {
+					return 0, fmt.Errorf("bad value %q", last)
+				}
+			} else if step > 1 {
+				hi = max // 5/15 is 5-max/15
+			}
+			if lo < min || hi > max || lo > hi {
+				return 0, fmt.Errorf("%q is outside %d-%d", part, min, max)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func (c *Cron) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<t.Day()) != 0
+	dow := c.dow&(1<<t.Weekday()) != 0
+	if c.domAny || c.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next returns the first minute after t that the schedule matches, in
+// t's location. It gives up, returning the zero time, after five years
+// without a match, e.g. for February 30th.
+func (c *Cron) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, loc).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<t.Month()) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case c.hour&(1<<t.Hour()) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case c.minute&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
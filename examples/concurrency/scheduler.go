@@ -0,0 +1,250 @@
+package concurrency
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+
+	"go-learning-guide/examples/clock"
+)
+
+// Scheduler is a Source that hands out jobs by priority and time
+// rather than in the order they came:
+//
+//   - a job isn't handed out before its RunAt
+//   - of the jobs that are due, the one with the highest Priority goes
+//     first, then the one due earliest, then the one submitted first
+//   - a job whose Key matches a pending job's is dropped as a duplicate
+//   - Recurring jobs are submitted again each time their schedule says
+//
+// Workers take jobs from it by setting their Source. It is safe for
+// concurrent use.
+type Scheduler struct {
+	clock clock.Clock
+
+	mu      sync.Mutex
+	ready   jobHeap // due, best first
+	delayed jobHeap // not yet due, soonest first
+	keys    map[string]*scheduled
+	seq     uint64
+	closed  bool
+	changed clock.Signal // wakes workers waiting in Next
+}
+
+// scheduled is a job in one of the heaps
+type scheduled struct {
+	job      Job
+	seq      uint64
+	index    int       // in its heap
+	schedule Schedule  // for recurring jobs
+	stopped  *bool     // set when a recurring job is stopped
+	due      time.Time // job.RunAt, or when it was submitted
+}
+
+// NewScheduler creates a scheduler; a nil clock means clock.Real
+func NewScheduler(c clock.Clock) *Scheduler {
+	if c == nil {
+		c = clock.Real{}
+	}
+	return &Scheduler{
+		clock: c,
+		ready: jobHeap{byPriority: true},
+		keys:  make(map[string]*scheduled),
+	}
+}
+
+// Submit queues a job. It reports false, and drops the job, if the
+// scheduler is closed or a job with the same Key is still pending.
+func (s *Scheduler) Submit(job Job) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed || (job.Key != "" && s.keys[job.Key] != nil) {
+		return false
+	}
+	s.pushLocked(&scheduled{job: job})
+	return true
+}
+
+// Recurring submits job for each time schedule gives after now, until
+// the returned stop is called. Each run is an ordinary job with
+// RunAt set; the next is submitted once a worker has taken the last,
+// so runs of one recurring job never pile up.
+func (s *Scheduler) Recurring(job Job, schedule Schedule) (stop func()) {
+	stopped := new(bool)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if next := schedule.Next(s.clock.Now()); !s.closed && !next.IsZero() {
+		job.RunAt = next
+		s.pushLocked(&scheduled{job: job, schedule: schedule, stopped: stopped})
+	}
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		*stopped = true
+		// Withdraw the pending run, if there is one
+		for _, h := range []*jobHeap{&s.ready, &s.delayed} {
+			for _, item := range h.items {
+				if item.stopped == stopped {
+					heap.Remove(h, item.index)
+					s.forgetLocked(item)
+					return
+				}
+			}
+		}
+	}
+}
+
+// pushLocked adds an item to the right heap; the caller holds s.mu
+func (s *Scheduler) pushLocked(item *scheduled) {
+	s.seq++
+	item.seq = s.seq
+	item.due = item.job.RunAt
+	if item.due.IsZero() {
+		item.due = s.clock.Now()
+	}
+	if item.job.Key != "" && s.keys[item.job.Key] == nil {
+		s.keys[item.job.Key] = item
+	}
+	if item.due.After(s.clock.Now()) {
+		heap.Push(&s.delayed, item)
+	} else {
+		heap.Push(&s.ready, item)
+	}
+	s.changed.Broadcast()
+}
+
+// forgetLocked releases a job's key once it is no longer pending
+func (s *Scheduler) forgetLocked(item *scheduled) {
+	if item.job.Key != "" && s.keys[item.job.Key] == item {
+		delete(s.keys, item.job.Key)
+	}
+}
+
+// takeLocked removes and returns the best ready job, if any; the caller
+// holds s.mu
+func (s *Scheduler) takeLocked() (Job, bool) {
+	now := s.clock.Now()
+	for s.delayed.Len() > 0 && !s.delayed.items[0].due.After(now) {
+		heap.Push(&s.ready, heap.Pop(&s.delayed))
+	}
+	if s.ready.Len() == 0 {
+		return Job{}, false
+	}
+	item := heap.Pop(&s.ready).(*scheduled)
+	s.forgetLocked(item)
+
+	if item.schedule != nil && !*item.stopped {
+		// Count from when this run was due, but don't make up for runs
+		// missed while no worker was free
+		next := item.schedule.Next(item.due)
+		if !next.IsZero() && !next.After(now) {
+			next = item.schedule.Next(now)
+		}
+		if !next.IsZero() {
+			job := item.job
+			job.RunAt = next
+			s.pushLocked(&scheduled{job: job, schedule: item.schedule, stopped: item.stopped})
+		}
+	}
+	return item.job, true
+}
+
+// TryNext returns the best ready job without waiting
+func (s *Scheduler) TryNext() (Job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return Job{}, false
+	}
+	return s.takeLocked()
+}
+
+// Next waits for a job to be due and returns the best one. It returns
+// false once the scheduler is closed, or if ctx ends first.
+func (s *Scheduler) Next(ctx context.Context) (Job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for !s.closed {
+		if job, ok := s.takeLocked(); ok {
+			return job, true
+		}
+		var wake time.Time
+		if s.delayed.Len() > 0 {
+			wake = s.delayed.items[0].due
+		}
+		if s.changed.Wait(ctx, &s.mu, s.clock, wake) != nil {
+			break
+		}
+	}
+	return Job{}, false
+}
+
+// Len returns how many jobs are pending, due or not
+func (s *Scheduler) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ready.Len() + s.delayed.Len()
+}
+
+// Close stops the scheduler: Next returns false from now on, so workers
+// waiting on it quit, and Submit drops jobs. It returns the jobs that
+// were still pending, recurring ones included.
+func (s *Scheduler) Close() []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	var pending []Job
+	for s.ready.Len() > 0 {
+		pending = append(pending, heap.Pop(&s.ready).(*scheduled).job)
+	}
+	for s.delayed.Len() > 0 {
+		pending = append(pending, heap.Pop(&s.delayed).(*scheduled).job)
+	}
+	s.keys = make(map[string]*scheduled)
+	s.changed.Broadcast()
+	return pending
+}
+
+// jobHeap is a heap of scheduled jobs. byPriority orders due jobs by
+// priority, then due time, then arrival; otherwise it orders jobs that
+// aren't due yet by when they will be.
+type jobHeap struct {
+	items      []*scheduled
+	byPriority bool
+}
+
+func (h *jobHeap) Len() int { return len(h.items) }
+
+func (h *jobHeap) Less(i, j int) bool {
+	a, b := h.items[i], h.items[j]
+	if h.byPriority && a.job.Priority != b.job.Priority {
+		return a.job.Priority > b.job.Priority
+	}
+	if !a.due.Equal(b.due) {
+		return a.due.Before(b.due)
+	}
+	return a.seq < b.seq
+}
+
+func (h *jobHeap) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+	h.items[i].index, h.items[j].index = i, j
+}
+
+func (h *jobHeap) Push(x any) {
+	item := x.(*scheduled)
+	item.index = len(h.items)
+	h.items = append(h.items, item)
+}
+
+func (h *jobHeap) Pop() any {
+	n := len(h.items) - 1
+	item := h.items[n]
+	h.items[n] = nil
+	h.items = h.items[:n]
+	return item
+}
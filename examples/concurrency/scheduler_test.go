@@ -0,0 +1,253 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"go-learning-guide/examples/clock/clocktest"
+	"go-learning-guide/examples/concurrency/leaktest"
+)
+
+// takeAll drains the ready jobs, returning their IDs in order
+func takeAll(s *Scheduler) []int {
+	var ids []int
+	for {
+		job, ok := s.TryNext()
+		if !ok {
+			return ids
+		}
+		ids = append(ids, job.ID)
+	}
+}
+
+func TestSchedulerPriority(t *testing.T) {
+	s := NewScheduler(clocktest.New())
+	for id, priority := range []int{1, 5, 3, 5, 0} {
+		s.Submit(Job{ID: id, Priority: priority})
+	}
+	// Highest first; equal priorities in the order they came
+	if got := takeAll(s); !reflect.DeepEqual(got, []int{1, 3, 2, 0, 4}) {
+		t.Errorf("order %v", got)
+	}
+}
+
+func TestSchedulerRunAt(t *testing.T) {
+	clock := clocktest.New()
+	s := NewScheduler(clock)
+	now := clock.Now()
+	s.Submit(Job{ID: 1, RunAt: now.Add(10 * time.Minute), Priority: 9})
+	s.Submit(Job{ID: 2, RunAt: now.Add(5 * time.Minute)})
+	s.Submit(Job{ID: 3})
+
+	if got := takeAll(s); !reflect.DeepEqual(got, []int{3}) {
+		t.Fatalf("ready now: %v", got)
+	}
+	clock.Advance(5 * time.Minute)
+	s.Submit(Job{ID: 4})
+	// Both due, same priority: the one due earlier goes first
+	if got := takeAll(s); !reflect.DeepEqual(got, []int{2, 4}) {
+		t.Fatalf("after 5m: %v", got)
+	}
+
+	// A worker waiting in Next wakes when the next job comes due
+	got := make(chan Job)
+	go func() {
+		job, _ := s.Next(context.Background())
+		got <- job
+	}()
+	clock.WaitForTimers(t, 1)
+	clock.Advance(5 * time.Minute)
+	if job := <-got; job.ID != 1 {
+		t.Errorf("Next = job %d, want 1", job.ID)
+	}
+}
+
+func TestSchedulerNextWakesOnSubmit(t *testing.T) {
+	leaktest.Check(t)
+	s := NewScheduler(clocktest.New())
+	got := make(chan Job)
+	go func() {
+		job, _ := s.Next(context.Background())
+		got <- job
+	}()
+	s.Submit(Job{ID: 7})
+	if job := <-got; job.ID != 7 {
+		t.Errorf("Next = job %d, want 7", job.ID)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, ok := s.Next(ctx); ok {
+		t.Error("Next returned a job with nothing ready and ctx done")
+	}
+}
+
+func TestSchedulerDedup(t *testing.T) {
+	s := NewScheduler(clocktest.New())
+	if !s.Submit(Job{ID: 1, Key: "report"}) {
+		t.Fatal("first submit dropped")
+	}
+	if s.Submit(Job{ID: 2, Key: "report"}) {
+		t.Error("duplicate accepted while the first is pending")
+	}
+	if !s.Submit(Job{ID: 3, Key: "other"}) || !s.Submit(Job{ID: 4}) {
+		t.Error("jobs with other keys, or none, dropped")
+	}
+	takeAll(s)
+	if !s.Submit(Job{ID: 5, Key: "report"}) {
+		t.Error("key still taken once the job was handed out")
+	}
+}
+
+func TestSchedulerRecurring(t *testing.T) {
+	clock := clocktest.New()
+	s := NewScheduler(clock)
+	stop := s.Recurring(Job{ID: 1, Key: "tick"}, Every(time.Minute))
+
+	if got := takeAll(s); len(got) != 0 {
+		t.Fatalf("ran before its first time: %v", got)
+	}
+	if s.Submit(Job{ID: 2, Key: "tick"}) {
+		t.Error("a job with the recurring job's key was accepted")
+	}
+	for i := 0; i < 2; i++ {
+		clock.Advance(time.Minute)
+		if got := takeAll(s); !reflect.DeepEqual(got, []int{1}) {
+			t.Fatalf("minute %d: %v", i+1, got)
+		}
+	}
+
+	// Runs missed while nobody took jobs aren't made up
+	clock.Advance(5 * time.Minute)
+	if got := takeAll(s); !reflect.DeepEqual(got, []int{1}) {
+		t.Fatalf("after 5 idle minutes: %v", got)
+	}
+	clock.Advance(time.Minute)
+	if got := takeAll(s); !reflect.DeepEqual(got, []int{1}) {
+		t.Fatalf("a minute later: %v", got)
+	}
+
+	stop()
+	if s.Len() != 0 {
+		t.Errorf("%d jobs pending after stop", s.Len())
+	}
+	clock.Advance(time.Hour)
+	if got := takeAll(s); len(got) != 0 {
+		t.Errorf("ran after stop: %v", got)
+	}
+}
+
+func TestSchedulerFeedsWorkers(t *testing.T) {
+	leaktest.Check(t)
+	s := NewScheduler(clocktest.New())
+	for id, priority := range []int{0, 2, 1} {
+		s.Submit(Job{ID: id, Priority: priority})
+	}
+
+	w := NewWorker(1, nil)
+	w.Source = s
+	w.Handle = func(ctx context.Context, job Job) (string, error) { return "", nil }
+	results := make(chan Result)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go w.Start(results, &wg)
+
+	var order []int
+	for i := 0; i < 3; i++ {
+		order = append(order, (<-results).JobID)
+	}
+	if !reflect.DeepEqual(order, []int{1, 2, 0}) {
+		t.Errorf("worker ran %v, want by priority", order)
+	}
+
+	// Closing the scheduler stops its workers
+	s.Submit(Job{ID: 9, RunAt: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)})
+	if pending := s.Close(); len(pending) != 1 || pending[0].ID != 9 {
+		t.Errorf("Close returned %v", pending)
+	}
+	wg.Wait()
+	if s.Submit(Job{ID: 10}) {
+		t.Error("Submit accepted a job after Close")
+	}
+}
+
+func TestWorkerDeadline(t *testing.T) {
+	leaktest.Check(t)
+	clock := clocktest.New()
+	called := false
+	w := NewWorker(1, nil)
+	w.Clock = clock
+	w.Handle = func(ctx context.Context, job Job) (string, error) {
+		called = true
+		if deadline, ok := ctx.Deadline(); !ok || !deadline.Equal(job.Deadline) {
+			return "", errors.New("no deadline")
+		}
+		if job.Data == "slow" {
+			<-ctx.Done()
+			return "", ctx.Err()
+		}
+		return "done", nil
+	}
+
+	late := w.process(Job{ID: 1, Deadline: clock.Now().Add(-time.Second)})
+	if !errors.Is(late.Err, context.DeadlineExceeded) || called || late.Attempts != 0 {
+		t.Errorf("expired job: %+v, called %v; want it failed unrun", late, called)
+	}
+	inTime := w.process(Job{ID: 2, Deadline: clock.Now().Add(time.Hour)})
+	if inTime.Err != nil || inTime.Output != "done" {
+		t.Errorf("job in time: %+v", inTime)
+	}
+
+	// The deadline is kept by the worker's clock
+	slow := make(chan Result)
+	go func() { slow <- w.process(Job{ID: 3, Data: "slow", Deadline: clock.Now().Add(time.Hour)}) }()
+	clock.WaitForTimers(t, 1)
+	clock.Advance(time.Hour)
+	if r := <-slow; !errors.Is(r.Err, context.DeadlineExceeded) {
+		t.Errorf("job past its deadline: %+v", r)
+	}
+}
+
+func TestCron(t *testing.T) {
+	// 2024-01-01 is a Monday
+	from := time.Date(2024, 1, 1, 10, 30, 15, 0, time.UTC)
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, 1, 1, 10, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 1, 1, 10, 45, 0, 0, time.UTC)},
+		{"0 * * * *", time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC)},
+		{"30 10 * * *", time.Date(2024, 1, 2, 10, 30, 0, 0, time.UTC)},
+		{"0 9-17/4 * * *", time.Date(2024, 1, 1, 13, 0, 0, 0, time.UTC)},
+		{"0 0 * * 0", time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1,15 * *", time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// Both days restricted: either matches
+		{"0 0 20 * 3", time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		c, err := ParseCron(tt.spec)
+		if err != nil {
+			t.Errorf("ParseCron(%q): %v", tt.spec, err)
+			continue
+		}
+		if got := c.Next(from); !got.Equal(tt.want) {
+			t.Errorf("%q: Next = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "5-1 * * * *", "*/0 * * * *", "a * * * *"} {
+		if _, err := ParseCron(spec); err == nil {
+			t.Errorf("ParseCron(%q) succeeded", spec)
+		}
+	}
+}
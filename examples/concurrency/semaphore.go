@@ -0,0 +1,226 @@
+package concurrency
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Semaphore bounds how much work runs at once by weight: a job that
+// needs four times the memory can Acquire 4 where a small one takes 1.
+// Waiters are served first come, first served, so a heavy job isn't
+// starved by a stream of light ones; the cost is that a light job waits
+// behind a heavy one even when it would fit.
+type Semaphore struct {
+	size int64
+
+	mu      sync.Mutex
+	used    int64
+	waiters list.List // of *waiter, oldest first
+}
+
+// waiter is an Acquire waiting its turn; ready is closed once it has
+// its weight
+type waiter struct {
+	n     int64
+	ready chan struct{}
+}
+
+// NewSemaphore creates a semaphore of the given total weight
+func NewSemaphore(size int64) *Semaphore {
+	return &Semaphore{size: size}
+}
+
+// Acquire takes n from the semaphore, waiting until that much is free
+// and every earlier waiter has been served, or until ctx ends. Asking
+// for more than the semaphore's size fails at once.
+func (s *Semaphore) Acquire(ctx context.Context, n int64) error {
+	if n > s.size {
+		return fmt.Errorf("semaphore: acquiring %d of %d would never succeed", n, s.size)
+	}
+
+	s.mu.Lock()
+	if s.used+n <= s.size && s.waiters.Len() == 0 {
+		s.used += n
+		s.mu.Unlock()
+		return nil
+	}
+	w := &waiter{n: n, ready: make(chan struct{})}
+	elem := s.waiters.PushBack(w)
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		select {
+		case <-w.ready:
+			// Served while ctx was ending: give it back
+			s.used -= n
+		default:
+			s.waiters.Remove(elem)
+		}
+		// Either way the waiters behind this one may fit now
+		s.notifyLocked()
+		s.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// TryAcquire takes n if it is free and nobody is waiting, without
+// blocking, and reports whether it did
+func (s *Semaphore) TryAcquire(n int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.used+n <= s.size && s.waiters.Len() == 0 {
+		s.used += n
+		return true
+	}
+	return false
+}
+
+// Release gives back n taken by Acquire or TryAcquire
+func (s *Semaphore) Release(n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.used -= n
+	if s.used < 0 {
+		panic("semaphore: released more than was acquired")
+	}
+	s.notifyLocked()
+}
+
+// notifyLocked serves waiters in order for as long as the next one
+// fits; the caller holds s.mu
+func (s *Semaphore) notifyLocked() {
+	for {
+		front := s.waiters.Front()
+		if front == nil {
+			return
+		}
+		w := front.Value.(*waiter)
+		if s.used+w.n > s.size {
+			return // FIFO: nobody overtakes the head
+		}
+		s.used += w.n
+		s.waiters.Remove(front)
+		close(w.ready)
+	}
+}
+
+// ItemError is the error ParallelMap reports for one item
+type ItemError struct {
+	Index int
+	Err   error
+}
+
+func (e *ItemError) Error() string { return fmt.Sprintf("item %d: %v", e.Index, e.Err) }
+
+func (e *ItemError) Unwrap() error { return e.Err }
+
+// MapOption changes how ParallelMap runs
+type MapOption func(*mapConfig)
+
+type mapConfig struct {
+	collect bool
+	weight  func(i int) int64
+}
+
+// CollectErrors makes ParallelMap run every item even when some fail,
+// and return the results with all the errors joined, in input order
+func CollectErrors() MapOption {
+	return func(c *mapConfig) { c.collect = true }
+}
+
+// Weight gives item i the weight weight(i) instead of 1. A weight above
+// the limit counts as the limit, so such an item runs alone.
+func Weight(weight func(i int) int64) MapOption {
+	return func(c *mapConfig) { c.weight = weight }
+}
+
+// ParallelMap calls fn on every item with at most limit weight of calls
+// running at once, and returns the results in input order. Items start
+// in input order too.
+//
+// By default it behaves like an errgroup: the first failure cancels the
+// context passed to the other calls, no more items start, and that
+// failure, as an *ItemError, is returned with no results. With
+// CollectErrors every item runs, failed items leave zero values in the
+// results, and the errors come back joined.
+func ParallelMap[T, R any](ctx context.Context, items []T, limit int, fn func(context.Context, T) (R, error), opts ...MapOption) ([]R, error) {
+	var config mapConfig
+	for _, opt := range opts {
+		opt(&config)
+	}
+	if limit <= 0 {
+		limit = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	sem := NewSemaphore(int64(limit))
+	results := make([]R, len(items))
+
+	var mu sync.Mutex
+	var errs []*ItemError
+	fail := func(i int, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, &ItemError{Index: i, Err: err})
+		if !config.collect {
+			cancel()
+		}
+	}
+
+	var wg sync.WaitGroup
+	var stopped error // why items were left unstarted
+	for i, item := range items {
+		weight := int64(1)
+		if config.weight != nil {
+			weight = min(max(config.weight(i), 1), int64(limit))
+		}
+		// Acquire may succeed on a cancelled ctx if there is room
+		if stopped = ctx.Err(); stopped != nil {
+			break
+		}
+		if stopped = sem.Acquire(ctx, weight); stopped != nil {
+			break // cancelled, by a failure or by the caller
+		}
+		wg.Add(1)
+		go func(i int, item T) {
+			defer wg.Done()
+			defer sem.Release(weight)
+			result, err := fn(ctx, item)
+			if err != nil {
+				fail(i, err)
+				return
+			}
+			results[i] = result
+		}(i, item)
+	}
+	wg.Wait()
+
+	if !config.collect {
+		if len(errs) > 0 {
+			return nil, errs[0]
+		}
+		if stopped != nil {
+			return nil, stopped // the caller gave up
+		}
+		return results, nil
+	}
+
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Index < errs[j].Index })
+	joined := make([]error, 0, len(errs)+1)
+	for _, err := range errs {
+		joined = append(joined, err)
+	}
+	if stopped != nil {
+		joined = append(joined, stopped) // the caller gave up; some items never ran
+	}
+	return results, errors.Join(joined...)
+}
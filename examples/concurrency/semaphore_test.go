@@ -0,0 +1,239 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go-learning-guide/examples/concurrency/leaktest"
+)
+
+// waiting reports how many Acquires are queued on s
+func waiting(s *Semaphore) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.waiters.Len()
+}
+
+// acquireAsync starts an Acquire once the ones before it are queued, so
+// the queue order is known
+func acquireAsync(t *testing.T, ctx context.Context, s *Semaphore, n int64) <-chan error {
+	t.Helper()
+	queued := waiting(s)
+	done := make(chan error, 1)
+	go func() { done <- s.Acquire(ctx, n) }()
+	deadline := time.Now().Add(2 * time.Second)
+	for waiting(s) == queued {
+		if time.Now().After(deadline) {
+			t.Fatal("Acquire never queued")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return done
+}
+
+func assertWaiting(t *testing.T, done <-chan error) {
+	t.Helper()
+	select {
+	case err := <-done:
+		t.Fatalf("Acquire returned %v, want it still waiting", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestSemaphoreWeights(t *testing.T) {
+	s := NewSemaphore(4)
+	if err := s.Acquire(context.Background(), 3); err != nil {
+		t.Fatal(err)
+	}
+	if s.TryAcquire(2) {
+		t.Error("TryAcquire(2) succeeded with 1 free")
+	}
+	if !s.TryAcquire(1) {
+		t.Error("TryAcquire(1) failed with 1 free")
+	}
+	s.Release(4)
+	if err := s.Acquire(context.Background(), 5); err == nil {
+		t.Error("Acquire(5) of 4 succeeded")
+	}
+}
+
+func TestSemaphoreFIFO(t *testing.T) {
+	leaktest.Check(t)
+	ctx := context.Background()
+	s := NewSemaphore(2)
+	s.Acquire(ctx, 2)
+
+	heavy := acquireAsync(t, ctx, s, 2)
+	light := acquireAsync(t, ctx, s, 1)
+
+	// The light one would fit, but the heavy one is first in line
+	s.Release(1)
+	assertWaiting(t, light)
+	if s.TryAcquire(1) {
+		t.Error("TryAcquire jumped the queue")
+	}
+	s.Release(1)
+	if err := <-heavy; err != nil {
+		t.Fatal(err)
+	}
+	assertWaiting(t, light)
+	s.Release(2)
+	if err := <-light; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSemaphoreAcquireCancelled(t *testing.T) {
+	leaktest.Check(t)
+	s := NewSemaphore(2)
+	s.Acquire(context.Background(), 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	heavy := acquireAsync(t, ctx, s, 2)
+	light := acquireAsync(t, context.Background(), s, 1)
+	assertWaiting(t, light)
+
+	// Once the head of the line gives up, the one behind it fits
+	cancel()
+	if err := <-heavy; !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled Acquire = %v", err)
+	}
+	if err := <-light; err != nil {
+		t.Fatal(err)
+	}
+	s.Release(2)
+	if !s.TryAcquire(2) {
+		t.Error("the cancelled Acquire kept its weight")
+	}
+}
+
+func TestParallelMapOrderAndLimit(t *testing.T) {
+	leaktest.Check(t)
+	items := []int{5, 1, 4, 2, 3, 0, 6, 2}
+	var running, most atomic.Int32
+	got, err := ParallelMap(context.Background(), items, 3, func(ctx context.Context, n int) (string, error) {
+		now := running.Add(1)
+		defer running.Add(-1)
+		for {
+			old := most.Load()
+			if now <= old || most.CompareAndSwap(old, now) {
+				break
+			}
+		}
+		time.Sleep(time.Duration(n) * time.Millisecond) // finish out of order
+		return strconv.Itoa(n), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"5", "1", "4", "2", "3", "0", "6", "2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if most.Load() > 3 {
+		t.Errorf("%d calls ran at once, limit 3", most.Load())
+	}
+}
+
+func TestParallelMapWeights(t *testing.T) {
+	leaktest.Check(t)
+	items := []int{1, 4, 1, 1, 9, 1}
+	var mu sync.Mutex
+	var load, most int
+	_, err := ParallelMap(context.Background(), items, 4, func(ctx context.Context, w int) (int, error) {
+		w = min(w, 4)
+		mu.Lock()
+		load += w
+		most = max(most, load)
+		mu.Unlock()
+		time.Sleep(2 * time.Millisecond)
+		mu.Lock()
+		load -= w
+		mu.Unlock()
+		return w, nil
+	}, Weight(func(i int) int64 { return int64(items[i]) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if most > 4 {
+		t.Errorf("weight %d ran at once, limit 4", most)
+	}
+}
+
+func TestParallelMapStopsOnFirstError(t *testing.T) {
+	leaktest.Check(t)
+	errBad := errors.New("bad item")
+	var started atomic.Int32
+	items := make([]int, 20)
+	for i := range items {
+		items[i] = i
+	}
+	got, err := ParallelMap(context.Background(), items, 2, func(ctx context.Context, n int) (int, error) {
+		started.Add(1)
+		if n == 3 {
+			return 0, errBad
+		}
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(5 * time.Millisecond):
+			return n, nil
+		}
+	})
+	var itemErr *ItemError
+	if !errors.As(err, &itemErr) || itemErr.Index != 3 || !errors.Is(err, errBad) || got != nil {
+		t.Fatalf("got %v, %v; want item 3's error and no results", got, err)
+	}
+	if n := started.Load(); n > 6 {
+		t.Errorf("%d items started after the failure stopped the rest", n)
+	}
+}
+
+func TestParallelMapCollectErrors(t *testing.T) {
+	leaktest.Check(t)
+	items := []string{"1", "x", "3", "y"}
+	got, err := ParallelMap(context.Background(), items, 2, func(ctx context.Context, s string) (int, error) {
+		return strconv.Atoi(s)
+	}, CollectErrors())
+	if !reflect.DeepEqual(got, []int{1, 0, 3, 0}) {
+		t.Errorf("got %v", got)
+	}
+	want := `item 1: strconv.Atoi: parsing "x": invalid syntax` + "\n" +
+		`item 3: strconv.Atoi: parsing "y": invalid syntax`
+	if err == nil || err.Error() != want {
+		t.Errorf("err = %v, want\n%s", err, want)
+	}
+	var numErr *strconv.NumError
+	if !errors.As(err, &numErr) {
+		t.Error("the joined error doesn't wrap the items' errors")
+	}
+}
+
+func TestParallelMapCallerCancels(t *testing.T) {
+	leaktest.Check(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	items := []int{0, 1, 2, 3}
+	_, err := ParallelMap(ctx, items, 1, func(ctx context.Context, n int) (int, error) {
+		if n == 1 {
+			cancel()
+		}
+		return n, nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+
+	got, err := ParallelMap(context.Background(), []int{}, 4, func(ctx context.Context, n int) (string, error) {
+		return fmt.Sprint(n), nil
+	})
+	if err != nil || len(got) != 0 {
+		t.Errorf("no items: %v, %v", got, err)
+	}
+}
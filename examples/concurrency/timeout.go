@@ -0,0 +1,110 @@
+// Package concurrency holds the reusable pieces behind
+// examples/concurrency_patterns.go, written so they don't leak
+// goroutines and can be tested on their own.
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// AbandonedError is returned by RunWithTimeout when it stops waiting for
+// the work, because the timeout passed or ctx was cancelled. The work
+// has been told to stop through its context, but may still be running;
+// Done and Finished say when it returns.
+type AbandonedError struct {
+	// Err is context.DeadlineExceeded if the timeout (or a deadline of
+	// the caller's context) passed and context.Canceled if the caller
+	// cancelled
+	Err error
+	// Waited is how long RunWithTimeout waited before giving up
+	Waited time.Duration
+
+	done    chan struct{}
+	workErr error // set before done is closed
+}
+
+func (e *AbandonedError) Error() string {
+	return fmt.Sprintf("work abandoned after %v: %v", e.Waited, e.Err)
+}
+
+func (e *AbandonedError) Unwrap() error { return e.Err }
+
+// Timeout reports whether the work was abandoned because a deadline
+// passed rather than because it was cancelled
+func (e *AbandonedError) Timeout() bool {
+	return errors.Is(e.Err, context.DeadlineExceeded)
+}
+
+// Done is closed when the abandoned work returns. Work that never checks
+// its context may run to the end, or forever.
+func (e *AbandonedError) Done() <-chan struct{} { return e.done }
+
+// Finished reports whether the abandoned work has returned yet, and the
+// error it returned if so
+func (e *AbandonedError) Finished() (finished bool, err error) {
+	select {
+	case <-e.done:
+		return true, e.workErr
+	default:
+		return false, nil
+	}
+}
+
+// result is what the work returned
+type result[T any] struct {
+	value T
+	err   error
+}
+
+// RunWithTimeout runs work in its own goroutine and waits at most d for
+// it. The context passed to work is cancelled when RunWithTimeout
+// returns, so work that honours it stops rather than running on unseen.
+//
+// If the work returns in time, its result is returned as is. Otherwise,
+// and when the work fails once its context has ended (most likely
+// because it did), the error is an *AbandonedError, which unwraps to
+// context.DeadlineExceeded or context.Canceled, so
+//
+//	errors.Is(err, context.DeadlineExceeded)
+//
+// tells a timeout from a cancellation.
+func RunWithTimeout[T any](ctx context.Context, d time.Duration, work func(context.Context) (T, error)) (T, error) {
+	ctx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+
+	start := time.Now()
+	// Buffered, so the goroutine can always deliver and exit, even once
+	// nobody is waiting
+	results := make(chan result[T], 1)
+	abandoned := &AbandonedError{done: make(chan struct{})}
+	go func() {
+		defer close(abandoned.done)
+		value, err := work(ctx)
+		abandoned.workErr = err
+		results <- result[T]{value, err}
+	}()
+
+	select {
+	case r := <-results:
+		if r.err == nil || ctx.Err() == nil {
+			return r.value, r.err
+		}
+	case <-ctx.Done():
+		// The work may have succeeded at the same moment; prefer its
+		// result to throwing it away
+		select {
+		case r := <-results:
+			if r.err == nil {
+				return r.value, nil
+			}
+		default:
+		}
+	}
+	abandoned.Err = ctx.Err()
+	abandoned.Waited = time.Since(start)
+	var zero T
+	return zero, abandoned
+}
@@ -0,0 +1,152 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go-learning-guide/examples/concurrency/leaktest"
+)
+
+// sleepWork sleeps for d unless its context ends first
+func sleepWork(d time.Duration) func(context.Context) (string, error) {
+	return func(ctx context.Context) (string, error) {
+		select {
+		case <-time.After(d):
+			return "done", nil
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+}
+
+func TestRunWithTimeoutCompletes(t *testing.T) {
+	leaktest.Check(t)
+
+	got, err := RunWithTimeout(context.Background(), time.Second, sleepWork(10*time.Millisecond))
+	if err != nil || got != "done" {
+		t.Fatalf("got %q, %v; want done", got, err)
+	}
+
+	wantErr := errors.New("broken")
+	_, err = RunWithTimeout(context.Background(), time.Second, func(context.Context) (int, error) {
+		return 0, wantErr
+	})
+	if err != wantErr {
+		t.Errorf("got %v, want the work's own error", err)
+	}
+}
+
+func TestRunWithTimeoutDeadline(t *testing.T) {
+	leaktest.Check(t)
+
+	start := time.Now()
+	got, err := RunWithTimeout(context.Background(), 20*time.Millisecond, sleepWork(time.Minute))
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("returned after %v", elapsed)
+	}
+	if got != "" {
+		t.Errorf("got %q, want the zero value", got)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want a deadline error", err)
+	}
+	var abandoned *AbandonedError
+	if !errors.As(err, &abandoned) || !abandoned.Timeout() {
+		t.Fatalf("got %#v, want an *AbandonedError that timed out", err)
+	}
+	if !strings.Contains(err.Error(), "abandoned") {
+		t.Errorf("error %q doesn't say the work was abandoned", err)
+	}
+
+	// The work saw its context end and stopped
+	select {
+	case <-abandoned.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("abandoned work is still running")
+	}
+	finished, workErr := abandoned.Finished()
+	if !finished || !errors.Is(workErr, context.DeadlineExceeded) {
+		t.Errorf("Finished() = %v, %v; want true and the work's deadline error", finished, workErr)
+	}
+}
+
+func TestRunWithTimeoutCancel(t *testing.T) {
+	leaktest.Check(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	_, err := RunWithTimeout(ctx, time.Minute, sleepWork(time.Minute))
+	if !errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want a cancellation", err)
+	}
+	var abandoned *AbandonedError
+	if !errors.As(err, &abandoned) || abandoned.Timeout() {
+		t.Fatalf("got %#v, want an *AbandonedError that was cancelled", err)
+	}
+	<-abandoned.Done()
+}
+
+func TestRunWithTimeoutParentDeadline(t *testing.T) {
+	leaktest.Check(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := RunWithTimeout(ctx, time.Minute, sleepWork(time.Minute))
+	var abandoned *AbandonedError
+	if !errors.As(err, &abandoned) || !abandoned.Timeout() {
+		t.Fatalf("got %v, want the caller's deadline to count as a timeout", err)
+	}
+	<-abandoned.Done()
+}
+
+// Work that ignores its context can't be stopped, but its goroutine
+// still exits when it finishes, and the caller can tell
+func TestRunWithTimeoutFinishesLate(t *testing.T) {
+	leaktest.Check(t)
+
+	release := make(chan struct{})
+	_, err := RunWithTimeout(context.Background(), 10*time.Millisecond, func(context.Context) (int, error) {
+		<-release
+		return 42, nil
+	})
+	var abandoned *AbandonedError
+	if !errors.As(err, &abandoned) {
+		t.Fatalf("got %v, want an *AbandonedError", err)
+	}
+	if finished, _ := abandoned.Finished(); finished {
+		t.Fatal("Finished() before the work returned")
+	}
+
+	close(release)
+	select {
+	case <-abandoned.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("work never reported finishing")
+	}
+	if finished, workErr := abandoned.Finished(); !finished || workErr != nil {
+		t.Errorf("Finished() = %v, %v; want true, nil", finished, workErr)
+	}
+}
+
+// The work's context is cancelled once RunWithTimeout returns, so
+// anything it started with that context stops too
+func TestRunWithTimeoutCancelsWorkContext(t *testing.T) {
+	leaktest.Check(t)
+
+	var workCtx context.Context
+	_, err := RunWithTimeout(context.Background(), time.Minute, func(ctx context.Context) (int, error) {
+		workCtx = ctx
+		return 1, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-workCtx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("the work's context outlived the call")
+	}
+}
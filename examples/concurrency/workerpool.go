@@ -0,0 +1,208 @@
+package concurrency
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"go-learning-guide/examples/clock"
+	"go-learning-guide/examples/pubsub"
+	"go-learning-guide/examples/retry"
+)
+
+// Job represents work to be done
+type Job struct {
+	ID   int
+	Data string
+	// Retry, if set, runs the job again when it fails, as the policy
+	// says; without it a job is tried once
+	Retry *retry.Policy
+	// Deadline, if set, bounds the job, retries included. A job picked
+	// up after its deadline fails without running.
+	Deadline time.Time
+
+	// Scheduling, used by Scheduler and ignored on a plain channel
+	Priority int       // higher runs first among ready jobs
+	RunAt    time.Time // not before this; zero means now
+	Key      string    // if set, a job with the same Key pending makes this one a duplicate
+
+	// Receipt is set by a Source that hands the job out more than once,
+	// to tell this delivery apart in Acker.Done
+	Receipt string
+}
+
+// Result represents the result of a job
+type Result struct {
+	JobID    int
+	Output   string
+	Worker   int
+	Err      error // why the job failed, after any retries
+	Attempts int
+}
+
+// HandlerFunc does a job, returning its output
+type HandlerFunc func(ctx context.Context, job Job) (string, error)
+
+// Source hands jobs to workers
+type Source interface {
+	// Next waits for the next job. It returns false when there will be
+	// no more, or when ctx ends first.
+	Next(ctx context.Context) (Job, bool)
+}
+
+// Acker is a Source that needs to hear how each job it handed out went,
+// e.g. to delete it from durable storage only once it is done. Workers
+// call Done after each job of such a source.
+type Acker interface {
+	Done(job Job, result Result)
+}
+
+// ChanSource is a channel as a Source: jobs in the order they were
+// sent, until the channel is closed
+type ChanSource <-chan Job
+
+// Next receives the next job from the channel
+func (c ChanSource) Next(ctx context.Context) (Job, bool) {
+	select {
+	case job, ok := <-c:
+		return job, ok
+	case <-ctx.Done():
+		return Job{}, false
+	}
+}
+
+// Worker represents a worker in our worker pool
+type Worker struct {
+	ID   int
+	Jobs <-chan Job
+	// Source, if set, is where the worker takes jobs from instead of
+	// Jobs, e.g. a Scheduler
+	Source Source
+	Quit   chan bool
+	// Handle does the work; NewWorker's simulates 100ms of it
+	Handle HandlerFunc
+	// Log, if set, gets a line for each finished job and when the
+	// worker stops
+	Log io.Writer
+	// Broker, if set, also gets each Result, on "worker.<id>.done" or
+	// "worker.<id>.failed"
+	Broker *pubsub.Broker
+	// Clock keeps jobs' deadlines, and times retries whose policy has
+	// no clock of its own; nil means clock.Real
+	Clock clock.Clock
+}
+
+// NewWorker creates a new worker
+func NewWorker(id int, jobs <-chan Job) *Worker {
+	return &Worker{
+		ID:     id,
+		Jobs:   jobs,
+		Quit:   make(chan bool),
+		Handle: simulateWork,
+	}
+}
+
+// simulateWork is the work of the examples: a short sleep
+func simulateWork(ctx context.Context, job Job) (string, error) {
+	select {
+	case <-time.After(100 * time.Millisecond):
+		return fmt.Sprintf("Processed: %s", job.Data), nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// Start begins the worker's job processing. It returns when its source
+// has no more jobs (Jobs is closed) or on a send to Quit. results may
+// be nil when results are only wanted from the Broker.
+func (w *Worker) Start(results chan<- Result, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	var source Source = ChanSource(w.Jobs)
+	if w.Source != nil {
+		source = w.Source
+	}
+	// Quit stops the wait for a job; a job in progress finishes
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-w.Quit:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		job, ok := source.Next(ctx)
+		if !ok {
+			w.logf("Worker %d quitting\n", w.ID)
+			return
+		}
+		result := w.process(job)
+		w.publish(result)
+		if results != nil {
+			results <- result
+		}
+		if acker, ok := source.(Acker); ok {
+			acker.Done(job, result)
+		}
+		w.logf("Worker %d finished job %d\n", w.ID, job.ID)
+	}
+}
+
+// process does one job, retrying it if the job asks for that
+func (w *Worker) process(job Job) Result {
+	c := w.Clock
+	if c == nil {
+		c = clock.Real{}
+	}
+	ctx := context.Background()
+	if !job.Deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = clock.WithDeadline(ctx, c, job.Deadline)
+		defer cancel()
+	}
+	result := Result{JobID: job.ID, Worker: w.ID}
+	if err := ctx.Err(); err != nil {
+		result.Err = err // too late to start
+		return result
+	}
+	attempt := func(ctx context.Context) (string, error) {
+		result.Attempts++
+		return w.Handle(ctx, job)
+	}
+	if job.Retry == nil {
+		result.Output, result.Err = attempt(ctx)
+	} else {
+		policy := *job.Retry
+		if policy.Clock == nil {
+			policy.Clock = c
+		}
+		result.Output, result.Err = retry.Do(ctx, policy, attempt)
+	}
+	return result
+}
+
+// publish sends a result to the broker, if there is one
+func (w *Worker) publish(result Result) {
+	if w.Broker == nil {
+		return
+	}
+	outcome := "done"
+	if result.Err != nil {
+		outcome = "failed"
+	}
+	topic := fmt.Sprintf("worker.%d.%s", w.ID, outcome)
+	if _, err := w.Broker.Publish(context.Background(), topic, result); err != nil {
+		w.logf("Worker %d could not publish job %d: %v\n", w.ID, result.JobID, err)
+	}
+}
+
+func (w *Worker) logf(format string, args ...any) {
+	if w.Log != nil {
+		fmt.Fprintf(w.Log, format, args...)
+	}
+}
@@ -0,0 +1,161 @@
+package concurrency
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-learning-guide/examples/concurrency/leaktest"
+	"go-learning-guide/examples/pubsub"
+	"go-learning-guide/examples/retry"
+)
+
+// runPool runs workers over jobs until the channel is drained and
+// returns the results by job ID
+func runPool(t *testing.T, workers []*Worker, jobs chan Job, all []Job) map[int]Result {
+	t.Helper()
+	results := make(chan Result, len(all))
+	var wg sync.WaitGroup
+	for _, w := range workers {
+		wg.Add(1)
+		go w.Start(results, &wg)
+	}
+	for _, job := range all {
+		jobs <- job
+	}
+	close(jobs)
+	wg.Wait()
+	close(results)
+
+	byID := make(map[int]Result)
+	for r := range results {
+		byID[r.JobID] = r
+	}
+	return byID
+}
+
+func TestWorkerPool(t *testing.T) {
+	leaktest.Check(t)
+
+	jobs := make(chan Job)
+	var workers []*Worker
+	for i := 1; i <= 3; i++ {
+		w := NewWorker(i, jobs)
+		w.Handle = func(_ context.Context, job Job) (string, error) {
+			return strings.ToUpper(job.Data), nil
+		}
+		workers = append(workers, w)
+	}
+	var all []Job
+	for i := 1; i <= 10; i++ {
+		all = append(all, Job{ID: i, Data: fmt.Sprintf("job-%d", i)})
+	}
+
+	results := runPool(t, workers, jobs, all)
+	if len(results) != 10 {
+		t.Fatalf("%d results, want 10", len(results))
+	}
+	for id, r := range results {
+		if r.Output != fmt.Sprintf("JOB-%d", id) || r.Err != nil || r.Attempts != 1 {
+			t.Errorf("job %d: %+v", id, r)
+		}
+		if r.Worker < 1 || r.Worker > 3 {
+			t.Errorf("job %d done by worker %d", id, r.Worker)
+		}
+	}
+}
+
+func TestWorkerRetryIsPerJob(t *testing.T) {
+	leaktest.Check(t)
+
+	errBusy := errors.New("busy")
+	var mu sync.Mutex
+	failures := make(map[int]int)
+	jobs := make(chan Job)
+	w := NewWorker(1, jobs)
+	w.Handle = func(_ context.Context, job Job) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if failures[job.ID] < 2 {
+			failures[job.ID]++
+			return "", errBusy
+		}
+		return "done", nil
+	}
+
+	policy := &retry.Policy{Initial: time.Millisecond, MaxAttempts: 5, Retryable: retry.Is(errBusy)}
+	results := runPool(t, []*Worker{w}, jobs, []Job{
+		{ID: 1, Retry: policy},
+		{ID: 2},
+		{ID: 3, Retry: &retry.Policy{Initial: time.Millisecond, MaxAttempts: 2}},
+	})
+
+	if r := results[1]; r.Err != nil || r.Output != "done" || r.Attempts != 3 {
+		t.Errorf("retried job: %+v, want done after 3 attempts", r)
+	}
+	if r := results[2]; !errors.Is(r.Err, errBusy) || r.Attempts != 1 {
+		t.Errorf("job without retry: %+v, want one failed attempt", r)
+	}
+	var exhausted *retry.ExhaustedError
+	if r := results[3]; !errors.As(r.Err, &exhausted) || r.Attempts != 2 {
+		t.Errorf("job with 2 attempts: %+v, want to give up after 2", r)
+	}
+}
+
+func TestWorkerQuitAndLog(t *testing.T) {
+	leaktest.Check(t)
+
+	var log bytes.Buffer
+	w := NewWorker(7, make(chan Job))
+	w.Log = &log
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go w.Start(make(chan Result), &wg)
+	w.Quit <- true
+	wg.Wait()
+	if got := log.String(); got != "Worker 7 quitting\n" {
+		t.Errorf("logged %q", got)
+	}
+}
+
+func TestWorkerPublishesResults(t *testing.T) {
+	leaktest.Check(t)
+	broker := pubsub.New()
+	defer broker.Close(context.Background())
+	failed, _ := broker.Subscribe("worker.*.failed", pubsub.Options{})
+	all, _ := broker.Subscribe("worker.#", pubsub.Options{})
+
+	jobs := make(chan Job)
+	w := NewWorker(3, jobs)
+	w.Broker = broker
+	w.Handle = func(ctx context.Context, job Job) (string, error) {
+		if job.Data == "bad" {
+			return "", errors.New("bad input")
+		}
+		return job.Data, nil
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go w.Start(nil, &wg) // results only through the broker
+	jobs <- Job{ID: 1, Data: "good"}
+	jobs <- Job{ID: 2, Data: "bad"}
+	close(jobs)
+	wg.Wait()
+
+	msg := <-failed.C()
+	if r := msg.Payload.(Result); msg.Topic != "worker.3.failed" || r.JobID != 2 || r.Err == nil {
+		t.Errorf("failed got %s %+v", msg.Topic, r)
+	}
+	var topics []string
+	for i := 0; i < 2; i++ {
+		topics = append(topics, (<-all.C()).Topic)
+	}
+	if got := strings.Join(topics, " "); got != "worker.3.done worker.3.failed" {
+		t.Errorf("worker.# got %s", got)
+	}
+}
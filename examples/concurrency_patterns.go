@@ -1,65 +1,22 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
-)
-
-// Worker represents a worker in our worker pool
-type Worker struct {
-	ID   int
-	Jobs <-chan Job
-	Quit chan bool
-}
 
-// Job represents work to be done
-type Job struct {
-	ID   int
-	Data string
-}
-
-// Result represents the result of a job
-type Result struct {
-	JobID  int
-	Output string
-	Worker int
-}
-
-// NewWorker creates a new worker
-func NewWorker(id int, jobs <-chan Job) *Worker {
-	return &Worker{
-		ID:   id,
-		Jobs: jobs,
-		Quit: make(chan bool),
-	}
-}
-
-// Start begins the worker's job processing
-func (w *Worker) Start(results chan<- Result, wg *sync.WaitGroup) {
-	defer wg.Done()
-	
-	for {
-		select {
-		case job := <-w.Jobs:
-			// Simulate work
-			time.Sleep(time.Millisecond * 100)
-			result := Result{
-				JobID:  job.ID,
-				Output: fmt.Sprintf("Processed: %s", job.Data),
-				Worker: w.ID,
-			}
-			results <- result
-			fmt.Printf("Worker %d finished job %d\n", w.ID, job.ID)
-			
-		case <-w.Quit:
-			fmt.Printf("Worker %d quitting\n", w.ID)
-			return
-		}
-	}
-}
+	"go-learning-guide/examples/concurrency"
+	"go-learning-guide/examples/pubsub"
+	"go-learning-guide/examples/retry"
+)
 
-// Counter demonstrates safe concurrent counter
+// Counter demonstrates safe concurrent counter. examples/concurrency has
+// faster ones for heavy contention, with benchmarks.
 type Counter struct {
 	mu    sync.RWMutex
 	value int
@@ -157,21 +114,14 @@ func fanIn(inputs ...<-chan int) <-chan int {
 	return out
 }
 
-// Timeout and cancellation example
-func doWorkWithTimeout(timeout time.Duration) (string, error) {
-	done := make(chan string, 1)
-	
-	go func() {
-		// Simulate long-running work
-		time.Sleep(2 * time.Second)
-		done <- "Work completed!"
-	}()
-	
+// Timeout and cancellation example: slow work that stops early when its
+// context ends, so a caller that gives up doesn't leave it running
+func doWork(ctx context.Context) (string, error) {
 	select {
-	case result := <-done:
-		return result, nil
-	case <-time.After(timeout):
-		return "", fmt.Errorf("work timed out after %v", timeout)
+	case <-time.After(2 * time.Second): // Simulate long-running work
+		return "Work completed!", nil
+	case <-ctx.Done():
+		return "", ctx.Err()
 	}
 }
 
@@ -252,20 +202,21 @@ func main() {
 	const numWorkers = 3
 	const numJobs = 10
 	
-	jobs := make(chan Job, numJobs)
-	results := make(chan Result, numJobs)
+	jobs := make(chan concurrency.Job, numJobs)
+	results := make(chan concurrency.Result, numJobs)
 	
 	// Start workers
 	var workerWg sync.WaitGroup
 	for i := 1; i <= numWorkers; i++ {
 		workerWg.Add(1)
-		worker := NewWorker(i, jobs)
+		worker := concurrency.NewWorker(i, jobs)
+		worker.Log = os.Stdout
 		go worker.Start(results, &workerWg)
 	}
 	
 	// Send jobs
 	for i := 1; i <= numJobs; i++ {
-		jobs <- Job{
+		jobs <- concurrency.Job{
 			ID:   i,
 			Data: fmt.Sprintf("job-data-%d", i),
 		}
@@ -283,6 +234,121 @@ func main() {
 			result.JobID, result.Output, result.Worker)
 	}
 
+	// ==================== RETRY WITH BACKOFF ====================
+	fmt.Println("\n--- Retry with Backoff ---")
+	
+	// A job that fails twice before it works, like a call to a service
+	// that is restarting
+	errUnavailable := errors.New("service unavailable")
+	flakyJobs := make(chan concurrency.Job, 2)
+	flakyResults := make(chan concurrency.Result, 2)
+	flakyWorker := concurrency.NewWorker(1, flakyJobs)
+	failures := make(map[int]int) // one worker, so no lock is needed
+	flakyWorker.Handle = func(ctx context.Context, job concurrency.Job) (string, error) {
+		if failures[job.ID] < 2 {
+			failures[job.ID]++
+			return "", errUnavailable
+		}
+		return fmt.Sprintf("Processed: %s", job.Data), nil
+	}
+	
+	// Jobs opt into retrying one by one
+	policy := &retry.Policy{
+		Initial:     50 * time.Millisecond,
+		MaxAttempts: 5,
+		Retryable:   retry.Is(errUnavailable),
+		OnRetry: func(attempt int, err error, wait time.Duration) {
+			fmt.Printf("Attempt %d failed (%v), retrying in %v\n", attempt, err, wait)
+		},
+	}
+	flakyJobs <- concurrency.Job{ID: 1, Data: "flaky-data-1", Retry: policy}
+	flakyJobs <- concurrency.Job{ID: 2, Data: "flaky-data-2"}
+	close(flakyJobs)
+	
+	var flakyWg sync.WaitGroup
+	flakyWg.Add(1)
+	go flakyWorker.Start(flakyResults, &flakyWg)
+	flakyWg.Wait()
+	close(flakyResults)
+	
+	for result := range flakyResults {
+		if result.Err != nil {
+			fmt.Printf("Job %d failed after %d attempt(s): %v\n", result.JobID, result.Attempts, result.Err)
+		} else {
+			fmt.Printf("Job %d -> %s after %d attempt(s)\n", result.JobID, result.Output, result.Attempts)
+		}
+	}
+
+	// ==================== PUBLISH/SUBSCRIBE ====================
+	fmt.Println("\n--- Publish/Subscribe ---")
+	
+	broker := pubsub.New()
+	failedSub, _ := broker.Subscribe("worker.*.failed", pubsub.Options{})
+	everything, _ := broker.Subscribe("#", pubsub.Options{})
+	
+	// The worker publishes its results instead of sending them on a channel
+	pubJobs := make(chan concurrency.Job, 3)
+	pubWorker := concurrency.NewWorker(1, pubJobs)
+	pubWorker.Broker = broker
+	pubWorker.Handle = func(ctx context.Context, job concurrency.Job) (string, error) {
+		if job.Data == "" {
+			return "", errors.New("no data")
+		}
+		return fmt.Sprintf("Processed: %s", job.Data), nil
+	}
+	pubJobs <- concurrency.Job{ID: 1, Data: "pub-data-1"}
+	pubJobs <- concurrency.Job{ID: 2}
+	pubJobs <- concurrency.Job{ID: 3, Data: "pub-data-3"}
+	close(pubJobs)
+	
+	var pubWg sync.WaitGroup
+	pubWg.Add(1)
+	go pubWorker.Start(nil, &pubWg)
+	pubWg.Wait()
+	broker.Publish(context.Background(), "user.created", "alice")
+	
+	// Close delivers what is queued, then closes every subscription
+	closed := make(chan error, 1)
+	go func() { closed <- broker.Close(context.Background()) }()
+	for msg := range failedSub.C() {
+		result := msg.Payload.(concurrency.Result)
+		fmt.Printf("Failed: job %d (%v)\n", result.JobID, result.Err)
+	}
+	for msg := range everything.C() {
+		fmt.Printf("Message on %s\n", msg.Topic)
+	}
+	<-closed
+	m := everything.Metrics()
+	fmt.Printf("Subscription %q: %d delivered, %d dropped\n", m.Pattern, m.Delivered, m.Dropped)
+
+	// ==================== PRIORITY SCHEDULING ====================
+	fmt.Println("\n--- Priority Scheduling ---")
+	
+	// A scheduler instead of a channel: the worker asks it for the most
+	// urgent job that is due
+	sched := concurrency.NewScheduler(nil)
+	sched.Submit(concurrency.Job{ID: 1, Data: "routine"})
+	sched.Submit(concurrency.Job{ID: 2, Data: "later", Priority: 10, RunAt: time.Now().Add(50 * time.Millisecond)})
+	sched.Submit(concurrency.Job{ID: 3, Data: "urgent", Priority: 10})
+	sched.Submit(concurrency.Job{ID: 4, Data: "report", Key: "daily-report"})
+	fmt.Printf("Duplicate report accepted: %v\n", sched.Submit(concurrency.Job{ID: 5, Data: "report", Key: "daily-report"}))
+	
+	schedResults := make(chan concurrency.Result)
+	schedWorker := concurrency.NewWorker(1, nil)
+	schedWorker.Source = sched
+	schedWorker.Handle = func(ctx context.Context, job concurrency.Job) (string, error) {
+		return job.Data, nil
+	}
+	var schedWg sync.WaitGroup
+	schedWg.Add(1)
+	go schedWorker.Start(schedResults, &schedWg)
+	for i := 0; i < 4; i++ {
+		result := <-schedResults
+		fmt.Printf("Ran job %d (%s)\n", result.JobID, result.Output)
+	}
+	sched.Close()
+	schedWg.Wait()
+
 	// ==================== PIPELINE PATTERN ====================
 	fmt.Println("\n--- Pipeline Pattern ---")
 	
@@ -314,6 +380,30 @@ func main() {
 	}
 	fmt.Println()
 
+	// ==================== BOUNDED PARALLEL MAP ====================
+	fmt.Println("\n--- Bounded Parallel Map ---")
+	
+	// Unlike fan-out, results come back in input order, and big files
+	// count as 2 of the limit of 3
+	files := []string{"a.txt", "big.iso", "b.txt", "huge.iso", "c.txt"}
+	sizes, err := concurrency.ParallelMap(context.Background(), files, 3,
+		func(ctx context.Context, name string) (int, error) {
+			time.Sleep(10 * time.Millisecond)
+			return len(name) * 100, nil
+		},
+		concurrency.Weight(func(i int) int64 {
+			if strings.HasSuffix(files[i], ".iso") {
+				return 2
+			}
+			return 1
+		}))
+	fmt.Printf("Sizes: %v (error: %v)\n", sizes, err)
+	
+	// The first failure cancels the rest, errgroup style
+	_, err = concurrency.ParallelMap(context.Background(), []string{"1", "two", "3"}, 2,
+		func(ctx context.Context, s string) (int, error) { return strconv.Atoi(s) })
+	fmt.Printf("First error: %v\n", err)
+
 	// ==================== MUTEX FOR SHARED STATE ====================
 	fmt.Println("\n--- Mutex for Shared State ---")
 	
@@ -338,21 +428,37 @@ func main() {
 	// ==================== TIMEOUT AND CANCELLATION ====================
 	fmt.Println("\n--- Timeout and Cancellation ---")
 	
+	ctx := context.Background()
+	
 	// Test with short timeout (should timeout)
-	result, err := doWorkWithTimeout(1 * time.Second)
+	result, err := concurrency.RunWithTimeout(ctx, 1*time.Second, doWork)
 	if err != nil {
 		fmt.Printf("Error: %v\n", err)
 	} else {
 		fmt.Printf("Success: %s\n", result)
 	}
 	
+	// The abandoned work was told to stop through its context
+	var abandoned *concurrency.AbandonedError
+	if errors.As(err, &abandoned) {
+		<-abandoned.Done()
+		_, workErr := abandoned.Finished()
+		fmt.Printf("Abandoned work stopped: %v (timeout: %t)\n", workErr, abandoned.Timeout())
+	}
+	
 	// Test with long timeout (should complete)
-	result, err = doWorkWithTimeout(3 * time.Second)
+	result, err = concurrency.RunWithTimeout(ctx, 3*time.Second, doWork)
 	if err != nil {
 		fmt.Printf("Error: %v\n", err)
 	} else {
 		fmt.Printf("Success: %s\n", result)
 	}
+	
+	// Cancelling is told apart from timing out
+	cancelCtx, cancel := context.WithCancel(ctx)
+	time.AfterFunc(100*time.Millisecond, cancel)
+	_, err = concurrency.RunWithTimeout(cancelCtx, 3*time.Second, doWork)
+	fmt.Printf("Cancelled: %v (deadline: %t)\n", errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded))
 
 	// ==================== DONE PATTERN ====================
 	fmt.Println("\n--- Done Pattern ---")
@@ -0,0 +1,225 @@
+package jobqueue
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// On disk, a queue directory holds
+//
+//	snapshot.json         every unsettled and dead job as of record N
+//	seg-<first seq>.log   log segments, replayed on top of the snapshot
+//
+// Each record is a 4-byte little-endian payload length, the CRC-32C of
+// the payload, then the payload: a JSON record. A crash can leave a
+// partial record at the end of the newest segment; it is cut off when
+// the queue is opened again. Compaction writes a new snapshot and
+// deletes the segments it covers.
+
+const (
+	headerSize       = 8
+	maxRecordBytes   = 64 << 20
+	snapshotFileName = "snapshot.json"
+)
+
+// ErrCorrupt means the log is damaged somewhere other than its tail
+var ErrCorrupt = errors.New("jobqueue: corrupt log")
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Record operations
+const (
+	opEnqueue = "enqueue" // a new job
+	opLease   = "lease"   // handed out, for attempt Attempt, until Until
+	opAck     = "ack"     // done; forget it
+	opNack    = "nack"    // failed; visible again at Until
+	opDead    = "dead"    // out of attempts; moved to the dead-letter queue
+	opRequeue = "requeue" // out of the dead-letter queue, with fresh attempts
+)
+
+// record is one change to the queue
+type record struct {
+	Seq     uint64     `json:"seq"`
+	Op      string     `json:"op"`
+	ID      int        `json:"id"`
+	Job     *storedJob `json:"job,omitempty"`
+	Attempt int        `json:"attempt,omitempty"`
+	Until   time.Time  `json:"until,omitempty"`
+	Error   string     `json:"error,omitempty"`
+}
+
+// storedJob is the part of a Job that is kept; Retry policies hold
+// functions and stay in memory only
+type storedJob struct {
+	ID       int       `json:"id"`
+	Data     string    `json:"data"`
+	Priority int       `json:"priority,omitempty"`
+	RunAt    time.Time `json:"run_at,omitempty"`
+	Key      string    `json:"key,omitempty"`
+	Deadline time.Time `json:"deadline,omitempty"`
+}
+
+// storedMessage is a job's state in a snapshot
+type storedMessage struct {
+	Job       storedJob `json:"job"`
+	Attempts  int       `json:"attempts"`
+	VisibleAt time.Time `json:"visible_at,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+	Dead      bool      `json:"dead,omitempty"`
+}
+
+type snapshot struct {
+	Seq      uint64          `json:"seq"` // last record included
+	NextID   int             `json:"next_id"`
+	Messages []storedMessage `json:"messages"`
+}
+
+func encodeRecord(rec record) ([]byte, error) {
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	frame := make([]byte, headerSize, headerSize+len(payload))
+	binary.LittleEndian.PutUint32(frame[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(frame[4:8], crc32.Checksum(payload, crcTable))
+	return append(frame, payload...), nil
+}
+
+// readSegment calls fn for each intact record in a segment. valid is the
+// length of the intact prefix; torn reports that bytes follow it which
+// do not form a complete, checksummed record.
+func readSegment(path string, fn func(record) error) (valid int64, torn bool, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false, err
+	}
+	for len(data) > 0 {
+		if len(data) < headerSize {
+			return valid, true, nil
+		}
+		size := binary.LittleEndian.Uint32(data[0:4])
+		if size > maxRecordBytes || int(size) > len(data)-headerSize {
+			return valid, true, nil
+		}
+		payload := data[headerSize : headerSize+size]
+		if crc32.Checksum(payload, crcTable) != binary.LittleEndian.Uint32(data[4:8]) {
+			return valid, true, nil
+		}
+		var rec record
+		if err := json.Unmarshal(payload, &rec); err != nil {
+			return valid, true, nil
+		}
+		if err := fn(rec); err != nil {
+			return valid, false, err
+		}
+		valid += int64(headerSize + size)
+		data = data[headerSize+size:]
+	}
+	return valid, false, nil
+}
+
+func segmentName(start uint64) string {
+	return fmt.Sprintf("seg-%020d.log", start)
+}
+
+// listSegments returns the first sequence numbers of the segments in
+// dir, oldest first
+func listSegments(dir string) ([]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var starts []uint64
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, "seg-") || !strings.HasSuffix(name, ".log") {
+			continue
+		}
+		start, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, "seg-"), ".log"), 10, 64)
+		if err != nil {
+			continue
+		}
+		starts = append(starts, start)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+	return starts, nil
+}
+
+func openSegment(dir string, start uint64) (*os.File, error) {
+	return os.OpenFile(filepath.Join(dir, segmentName(start)), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+}
+
+func truncateFile(path string, size int64) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := f.Truncate(size); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+func readSnapshot(dir string) (snapshot, error) {
+	var snap snapshot
+	data, err := os.ReadFile(filepath.Join(dir, snapshotFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return snap, nil
+	}
+	if err != nil {
+		return snap, err
+	}
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return snap, fmt.Errorf("%w: %s: %v", ErrCorrupt, snapshotFileName, err)
+	}
+	return snap, nil
+}
+
+// writeSnapshot replaces the snapshot atomically: a temporary file,
+// fsynced, renamed over the old one
+func writeSnapshot(dir string, snap snapshot) error {
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, snapshotFileName+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // fails harmlessly once renamed
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, snapshotFileName)); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// syncDir makes a rename or new file in dir durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
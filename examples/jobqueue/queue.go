@@ -0,0 +1,565 @@
+// Package jobqueue is a durable queue of worker pool jobs. Jobs survive
+// a restart, and each is delivered at least once:
+//
+//   - Next leases a job to a worker for Options.Visibility; if the job
+//     is neither acked nor nacked by then, it is delivered again
+//   - a job isn't delivered before its RunAt; of the jobs that are
+//     ready, the one with the highest Priority goes first, and jobs of
+//     equal priority go in the order they were enqueued
+//   - Ack settles a job for good; Nack puts it back for another attempt
+//   - after Options.MaxAttempts deliveries, a job that still fails goes
+//     to the dead-letter queue instead, to be looked at and Requeued
+//   - when the queue is opened again after a crash, jobs that were
+//     leased are delivered again at once
+//
+// A Queue is a concurrency.Source and Acker, so a worker pool takes
+// jobs from it by setting each worker's Source, and the workers ack or
+// nack each job as it finishes:
+//
+//	q, err := jobqueue.Open("jobs", jobqueue.Options{})
+//	w := concurrency.NewWorker(1, nil)
+//	w.Source = q
+package jobqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-learning-guide/examples/clock"
+	"go-learning-guide/examples/concurrency"
+)
+
+// Defaults for an Options' zero fields
+const (
+	DefaultVisibility   = 30 * time.Second
+	DefaultMaxAttempts  = 5
+	DefaultCompactEvery = 1000
+)
+
+// Options configure a queue. The zero value is safe.
+type Options struct {
+	// Visibility is how long a worker has to finish a job before it is
+	// delivered to another
+	Visibility time.Duration
+	// MaxAttempts is how many deliveries a job gets before it goes to
+	// the dead-letter queue
+	MaxAttempts int
+	// RetryDelay is how long a nacked job waits before it is delivered
+	// again
+	RetryDelay time.Duration
+	// CompactEvery writes a snapshot, and deletes the log segments it
+	// replaces, after this many records; negative turns it off
+	CompactEvery int
+	// NoSync skips the fsync after each change. It is much faster, but
+	// a crash of the machine can lose the most recent changes.
+	NoSync bool
+	// Clock is the time source; nil means the system clock
+	Clock clock.Clock
+}
+
+// Errors
+var (
+	ErrClosed = errors.New("jobqueue: queue is closed")
+	// ErrStaleReceipt is returned when acking or nacking a delivery
+	// whose job was since delivered again, or settled
+	ErrStaleReceipt = errors.New("jobqueue: stale receipt")
+)
+
+// message is a job and where it is in its life
+type message struct {
+	job         concurrency.Job
+	attempts    int       // deliveries so far
+	leasedUntil time.Time // zero unless delivered and not yet settled
+	visibleAt   time.Time // not before this, after a Nack
+	lastErr     string
+	dead        bool
+}
+
+// Queue is a durable job queue stored in a directory. It is safe for
+// concurrent use.
+type Queue struct {
+	dir   string
+	opts  Options
+	clock clock.Clock
+
+	mu       sync.Mutex
+	messages map[int]*message
+	live     []int // IDs of jobs neither settled nor dead, ascending
+	nextID   int
+
+	file          *os.File
+	segStart      uint64 // first record of the current segment
+	seq           uint64 // last record written
+	sinceSnapshot int
+	// err is sticky: after a failed write we cannot know what reached
+	// the disk, so the queue refuses further changes
+	err     error
+	closed  bool
+	changed clock.Signal // wakes workers waiting in Next
+}
+
+// Open loads the queue in dir, creating the directory if needed. Call
+// Close when done.
+func Open(dir string, opts Options) (*Queue, error) {
+	if opts.Visibility <= 0 {
+		opts.Visibility = DefaultVisibility
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DefaultMaxAttempts
+	}
+	if opts.CompactEvery == 0 {
+		opts.CompactEvery = DefaultCompactEvery
+	}
+	if opts.Clock == nil {
+		opts.Clock = clock.Real{}
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	q := &Queue{
+		dir:      dir,
+		opts:     opts,
+		clock:    opts.Clock,
+		messages: make(map[int]*message),
+		nextID:   1,
+	}
+	snap, err := readSnapshot(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, sm := range snap.Messages {
+		q.messages[sm.Job.ID] = &message{
+			job:       sm.Job.job(),
+			attempts:  sm.Attempts,
+			visibleAt: sm.VisibleAt,
+			lastErr:   sm.LastError,
+			dead:      sm.Dead,
+		}
+		if !sm.Dead {
+			q.live = append(q.live, sm.Job.ID)
+		}
+	}
+	sort.Ints(q.live)
+	q.nextID = max(q.nextID, snap.NextID)
+
+	segments, err := listSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+	q.seq = snap.Seq
+	for i, start := range segments {
+		path := filepath.Join(dir, segmentName(start))
+		valid, torn, err := readSegment(path, func(rec record) error {
+			if rec.Seq <= q.seq {
+				return nil // already in the snapshot
+			}
+			if rec.Seq != q.seq+1 {
+				return fmt.Errorf("%w: %s: record %d follows %d", ErrCorrupt, path, rec.Seq, q.seq)
+			}
+			if err := q.apply(rec); err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			q.seq = rec.Seq
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if torn {
+			if i != len(segments)-1 {
+				return nil, fmt.Errorf("%w: %s is damaged at byte %d", ErrCorrupt, path, valid)
+			}
+			log.Printf("jobqueue: discarding incomplete record at byte %d of %s", valid, path)
+			if err := truncateFile(path, valid); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Whoever held the leases died with the last process
+	for _, m := range q.messages {
+		m.leasedUntil = time.Time{}
+	}
+
+	if len(segments) > 0 {
+		q.segStart = segments[len(segments)-1]
+	} else {
+		q.segStart = q.seq + 1
+	}
+	if q.file, err = openSegment(dir, q.segStart); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func (j storedJob) job() concurrency.Job {
+	return concurrency.Job{ID: j.ID, Data: j.Data, Priority: j.Priority, RunAt: j.RunAt, Key: j.Key, Deadline: j.Deadline}
+}
+
+func storeJob(job concurrency.Job) storedJob {
+	return storedJob{ID: job.ID, Data: job.Data, Priority: job.Priority, RunAt: job.RunAt, Key: job.Key, Deadline: job.Deadline}
+}
+
+// apply makes a logged change to the in-memory state
+func (q *Queue) apply(rec record) error {
+	if rec.Op == opEnqueue {
+		if rec.Job == nil {
+			return fmt.Errorf("%w: record %d enqueues no job", ErrCorrupt, rec.Seq)
+		}
+		q.messages[rec.ID] = &message{job: rec.Job.job()}
+		q.live = append(q.live, rec.ID) // IDs only grow
+		q.nextID = max(q.nextID, rec.ID+1)
+		return nil
+	}
+
+	m := q.messages[rec.ID]
+	if m == nil {
+		return fmt.Errorf("%w: record %d: %s of unknown job %d", ErrCorrupt, rec.Seq, rec.Op, rec.ID)
+	}
+	switch rec.Op {
+	case opLease:
+		m.attempts = rec.Attempt
+		m.leasedUntil = rec.Until
+	case opAck:
+		delete(q.messages, rec.ID)
+		q.removeLive(rec.ID)
+	case opNack:
+		m.leasedUntil = time.Time{}
+		m.visibleAt = rec.Until
+		m.lastErr = rec.Error
+	case opDead:
+		m.leasedUntil = time.Time{}
+		m.lastErr = rec.Error
+		m.dead = true
+		q.removeLive(rec.ID)
+	case opRequeue:
+		m.attempts = 0
+		m.visibleAt = time.Time{}
+		m.dead = false
+		i := sort.SearchInts(q.live, rec.ID)
+		q.live = append(q.live[:i], append([]int{rec.ID}, q.live[i:]...)...)
+	default:
+		return fmt.Errorf("%w: record %d has unknown op %q", ErrCorrupt, rec.Seq, rec.Op)
+	}
+	return nil
+}
+
+func (q *Queue) removeLive(id int) {
+	if i := sort.SearchInts(q.live, id); i < len(q.live) && q.live[i] == id {
+		q.live = append(q.live[:i], q.live[i+1:]...)
+	}
+}
+
+// writeLocked logs a change, then applies it; the caller holds q.mu
+func (q *Queue) writeLocked(rec record) error {
+	if q.closed {
+		return ErrClosed
+	}
+	if q.err != nil {
+		return q.err
+	}
+	rec.Seq = q.seq + 1
+	frame, err := encodeRecord(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := q.file.Write(frame); err != nil {
+		q.err = err
+		return err
+	}
+	if !q.opts.NoSync {
+		if err := q.file.Sync(); err != nil {
+			q.err = err
+			return err
+		}
+	}
+	q.seq++
+	if err := q.apply(rec); err != nil {
+		q.err = err
+		return err
+	}
+
+	q.sinceSnapshot++
+	if q.opts.CompactEvery > 0 && q.sinceSnapshot >= q.opts.CompactEvery {
+		if err := q.compactLocked(); err != nil {
+			log.Printf("jobqueue: compaction failed: %v", err)
+		}
+	}
+	return nil
+}
+
+// compactLocked writes a snapshot of the queue, starts a new segment
+// and deletes the old ones; the caller holds q.mu
+func (q *Queue) compactLocked() error {
+	q.sinceSnapshot = 0
+	snap := snapshot{Seq: q.seq, NextID: q.nextID, Messages: make([]storedMessage, 0, len(q.messages))}
+	for _, m := range q.messages {
+		snap.Messages = append(snap.Messages, storedMessage{
+			Job:       storeJob(m.job),
+			Attempts:  m.attempts,
+			VisibleAt: m.visibleAt,
+			LastError: m.lastErr,
+			Dead:      m.dead,
+		})
+	}
+	sort.Slice(snap.Messages, func(i, j int) bool { return snap.Messages[i].Job.ID < snap.Messages[j].Job.ID })
+	if err := writeSnapshot(q.dir, snap); err != nil {
+		return err
+	}
+
+	file, err := openSegment(q.dir, q.seq+1)
+	if err != nil {
+		return err
+	}
+	q.file.Close()
+	q.file, q.segStart = file, q.seq+1
+
+	segments, err := listSegments(q.dir)
+	if err != nil {
+		return err
+	}
+	for _, start := range segments {
+		if start < q.segStart {
+			if err := os.Remove(filepath.Join(q.dir, segmentName(start))); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Enqueue stores a job and returns the ID it was given, which replaces
+// job.ID. It returns once the job is on disk.
+func (q *Queue) Enqueue(job concurrency.Job) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job.ID = q.nextID
+	stored := storeJob(job)
+	if err := q.writeLocked(record{Op: opEnqueue, ID: job.ID, Job: &stored}); err != nil {
+		return 0, err
+	}
+	q.changed.Broadcast()
+	return job.ID, nil
+}
+
+// leaseLocked delivers the visible job with the highest priority, the
+// oldest if several tie, moving jobs out of attempts to the dead-letter
+// queue on the way; the caller holds q.mu
+func (q *Queue) leaseLocked() (concurrency.Job, bool, error) {
+	now := q.clock.Now()
+	var best *message
+	bestID := 0
+	for i := 0; i < len(q.live); i++ {
+		id := q.live[i]
+		m := q.messages[id]
+		if (!m.leasedUntil.IsZero() && m.leasedUntil.After(now)) || m.visibleAt.After(now) || m.job.RunAt.After(now) {
+			continue
+		}
+		if m.attempts >= q.opts.MaxAttempts {
+			// Its last lease ran out: the worker died or hung
+			reason := m.lastErr
+			if !m.leasedUntil.IsZero() || reason == "" {
+				reason = "lease expired"
+			}
+			if err := q.writeLocked(record{Op: opDead, ID: id, Error: reason}); err != nil {
+				return concurrency.Job{}, false, err
+			}
+			i-- // removed from live
+			continue
+		}
+		// live is in ID order, so the first of a priority is the oldest
+		if best == nil || m.job.Priority > best.job.Priority {
+			best, bestID = m, id
+		}
+	}
+	if best == nil {
+		return concurrency.Job{}, false, nil
+	}
+	attempt := best.attempts + 1
+	rec := record{Op: opLease, ID: bestID, Attempt: attempt, Until: now.Add(q.opts.Visibility)}
+	if err := q.writeLocked(rec); err != nil {
+		return concurrency.Job{}, false, err
+	}
+	job := best.job
+	job.Receipt = strconv.Itoa(bestID) + "." + strconv.Itoa(attempt)
+	return job, true, nil
+}
+
+// wakeLocked returns when the next job becomes visible, or the zero
+// time if none is waiting; the caller holds q.mu
+func (q *Queue) wakeLocked() time.Time {
+	var wake time.Time
+	for _, id := range q.live {
+		m := q.messages[id]
+		at := m.visibleAt
+		if m.leasedUntil.After(at) {
+			at = m.leasedUntil
+		}
+		if m.job.RunAt.After(at) {
+			at = m.job.RunAt
+		}
+		if wake.IsZero() || at.Before(wake) {
+			wake = at
+		}
+	}
+	return wake
+}
+
+// Next leases the next visible job, waiting for one if need be. It
+// returns false when the queue is closed or has failed, or when ctx
+// ends first. The job's Receipt identifies the lease to Ack or Nack.
+func (q *Queue) Next(ctx context.Context) (concurrency.Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for !q.closed && q.err == nil {
+		job, ok, err := q.leaseLocked()
+		if err != nil || ok {
+			return job, ok
+		}
+		if q.changed.Wait(ctx, &q.mu, q.clock, q.wakeLocked()) != nil {
+			break
+		}
+	}
+	return concurrency.Job{}, false
+}
+
+// leasedLocked finds the message a receipt was issued for, as long as
+// that delivery is still the latest; the caller holds q.mu
+func (q *Queue) leasedLocked(receipt string) (int, *message, error) {
+	idText, attemptText, _ := strings.Cut(receipt, ".")
+	id, err1 := strconv.Atoi(idText)
+	attempt, err2 := strconv.Atoi(attemptText)
+	if err1 != nil || err2 != nil {
+		return 0, nil, fmt.Errorf("jobqueue: bad receipt %q", receipt)
+	}
+	m := q.messages[id]
+	if m == nil || m.dead || m.leasedUntil.IsZero() || m.attempts != attempt {
+		return 0, nil, fmt.Errorf("%w %q", ErrStaleReceipt, receipt)
+	}
+	return id, m, nil
+}
+
+// Ack settles the delivery with the given receipt: the job is done and
+// is removed from the queue
+func (q *Queue) Ack(receipt string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	id, _, err := q.leasedLocked(receipt)
+	if err != nil {
+		return err
+	}
+	return q.writeLocked(record{Op: opAck, ID: id})
+}
+
+// Nack reports that the delivery with the given receipt failed. The job
+// is delivered again after Options.RetryDelay, or goes to the
+// dead-letter queue if it has had Options.MaxAttempts deliveries.
+func (q *Queue) Nack(receipt string, cause error) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	id, m, err := q.leasedLocked(receipt)
+	if err != nil {
+		return err
+	}
+	reason := "failed"
+	if cause != nil {
+		reason = cause.Error()
+	}
+	rec := record{Op: opNack, ID: id, Until: q.clock.Now().Add(q.opts.RetryDelay), Error: reason}
+	if m.attempts >= q.opts.MaxAttempts {
+		rec = record{Op: opDead, ID: id, Error: reason}
+	}
+	if err := q.writeLocked(rec); err != nil {
+		return err
+	}
+	q.changed.Broadcast()
+	return nil
+}
+
+// Done acks a job that succeeded and nacks one that failed, for workers
+// that take jobs from the queue. A delivery that has gone stale is left
+// alone; the job's later delivery decides its fate.
+func (q *Queue) Done(job concurrency.Job, result concurrency.Result) {
+	var err error
+	if result.Err == nil {
+		err = q.Ack(job.Receipt)
+	} else {
+		err = q.Nack(job.Receipt, result.Err)
+	}
+	if err != nil && !errors.Is(err, ErrStaleReceipt) && !errors.Is(err, ErrClosed) {
+		log.Printf("jobqueue: settling job %d: %v", job.ID, err)
+	}
+}
+
+// DeadJob is a job in the dead-letter queue
+type DeadJob struct {
+	Job      concurrency.Job
+	Attempts int
+	Error    string // why its last attempt failed
+}
+
+// Dead lists the dead-letter queue, oldest job first
+func (q *Queue) Dead() []DeadJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var dead []DeadJob
+	for _, m := range q.messages {
+		if m.dead {
+			dead = append(dead, DeadJob{Job: m.job, Attempts: m.attempts, Error: m.lastErr})
+		}
+	}
+	sort.Slice(dead, func(i, j int) bool { return dead[i].Job.ID < dead[j].Job.ID })
+	return dead
+}
+
+// Requeue moves a job from the dead-letter queue back into the queue,
+// with its attempts reset
+func (q *Queue) Requeue(id int) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if m := q.messages[id]; m == nil || !m.dead {
+		return fmt.Errorf("jobqueue: job %d is not in the dead-letter queue", id)
+	}
+	if err := q.writeLocked(record{Op: opRequeue, ID: id}); err != nil {
+		return err
+	}
+	q.changed.Broadcast()
+	return nil
+}
+
+// Len returns how many jobs are waiting or being worked on, not
+// counting the dead-letter queue
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.live)
+}
+
+// Close flushes the log and closes it. Workers waiting in Next stop;
+// jobs they hold are delivered again when the queue is next opened.
+func (q *Queue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return nil
+	}
+	q.closed = true
+	q.changed.Broadcast()
+	if err := q.file.Sync(); err != nil && q.err == nil {
+		q.err = err
+	}
+	if err := q.file.Close(); err != nil && q.err == nil {
+		q.err = err
+	}
+	return q.err
+}
@@ -0,0 +1,358 @@
+package jobqueue
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"go-learning-guide/examples/clock/clocktest"
+	"go-learning-guide/examples/concurrency"
+)
+
+func openQueue(t *testing.T, dir string, opts Options) *Queue {
+	t.Helper()
+	q, err := Open(dir, opts)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { q.Close() })
+	return q
+}
+
+func enqueue(t *testing.T, q *Queue, data ...string) {
+	t.Helper()
+	for _, d := range data {
+		if _, err := q.Enqueue(concurrency.Job{Data: d}); err != nil {
+			t.Fatalf("Enqueue(%q): %v", d, err)
+		}
+	}
+}
+
+// tryNext leases a job without waiting
+func tryNext(q *Queue) (concurrency.Job, bool) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return q.Next(ctx)
+}
+
+func TestEnqueueLeaseAck(t *testing.T) {
+	q := openQueue(t, t.TempDir(), Options{Clock: clocktest.New()})
+	for i, d := range []string{"a", "b"} {
+		id, err := q.Enqueue(concurrency.Job{ID: 99, Data: d})
+		if err != nil || id != i+1 {
+			t.Fatalf("Enqueue(%q) = %d, %v; want ID %d", d, id, err, i+1)
+		}
+	}
+
+	a, ok := tryNext(q)
+	if !ok || a.ID != 1 || a.Data != "a" || a.Receipt != "1.1" {
+		t.Fatalf("first lease: %+v, %v", a, ok)
+	}
+	b, _ := tryNext(q)
+	if b.ID != 2 {
+		t.Fatalf("second lease: job %d, want 2", b.ID)
+	}
+	if _, ok := tryNext(q); ok {
+		t.Fatal("leased a job that is already out")
+	}
+
+	if err := q.Ack(a.Receipt); err != nil {
+		t.Fatalf("Ack: %v", err)
+	}
+	if err := q.Ack(a.Receipt); !errors.Is(err, ErrStaleReceipt) {
+		t.Errorf("second Ack = %v, want ErrStaleReceipt", err)
+	}
+	if q.Len() != 1 {
+		t.Errorf("Len = %d, want 1", q.Len())
+	}
+}
+
+func TestVisibilityTimeout(t *testing.T) {
+	clock := clocktest.New()
+	q := openQueue(t, t.TempDir(), Options{Clock: clock, Visibility: time.Minute})
+	enqueue(t, q, "slow")
+	first, _ := tryNext(q)
+
+	// A worker waiting in Next gets the job once the lease runs out
+	got := make(chan concurrency.Job)
+	go func() {
+		job, _ := q.Next(context.Background())
+		got <- job
+	}()
+	clock.WaitForTimers(t, 1)
+	clock.Advance(time.Minute)
+	second := <-got
+	if second.ID != first.ID || second.Receipt != "1.2" {
+		t.Fatalf("redelivered %+v", second)
+	}
+
+	// The first worker finishing late doesn't settle the job
+	if err := q.Ack(first.Receipt); !errors.Is(err, ErrStaleReceipt) {
+		t.Errorf("late Ack = %v, want ErrStaleReceipt", err)
+	}
+	if err := q.Ack(second.Receipt); err != nil {
+		t.Errorf("Ack: %v", err)
+	}
+}
+
+func TestNackDeadLetter(t *testing.T) {
+	clock := clocktest.New()
+	q := openQueue(t, t.TempDir(), Options{Clock: clock, MaxAttempts: 3, RetryDelay: time.Second})
+	enqueue(t, q, "bad")
+
+	for attempt := 1; attempt <= 3; attempt++ {
+		job, ok := tryNext(q)
+		if !ok {
+			t.Fatalf("attempt %d: no job", attempt)
+		}
+		if err := q.Nack(job.Receipt, errors.New("boom")); err != nil {
+			t.Fatalf("Nack: %v", err)
+		}
+		if _, ok := tryNext(q); ok {
+			t.Fatalf("attempt %d: redelivered before the retry delay", attempt)
+		}
+		clock.Advance(time.Second)
+	}
+
+	if _, ok := tryNext(q); ok || q.Len() != 0 {
+		t.Fatalf("job still queued after %d attempts", 3)
+	}
+	dead := q.Dead()
+	if len(dead) != 1 || dead[0].Job.Data != "bad" || dead[0].Attempts != 3 || dead[0].Error != "boom" {
+		t.Fatalf("Dead = %+v", dead)
+	}
+
+	if err := q.Requeue(dead[0].Job.ID); err != nil {
+		t.Fatalf("Requeue: %v", err)
+	}
+	if job, ok := tryNext(q); !ok || job.Receipt != "1.1" {
+		t.Errorf("after Requeue: %+v, %v", job, ok)
+	}
+	if err := q.Requeue(1); err == nil {
+		t.Error("Requeue of a job not in the dead-letter queue succeeded")
+	}
+}
+
+func TestExpiredLeasesUseAttempts(t *testing.T) {
+	// A job whose worker keeps dying ends up dead too
+	clock := clocktest.New()
+	q := openQueue(t, t.TempDir(), Options{Clock: clock, MaxAttempts: 2, Visibility: time.Minute})
+	enqueue(t, q, "crashes")
+	for i := 0; i < 2; i++ {
+		if _, ok := tryNext(q); !ok {
+			t.Fatalf("delivery %d: no job", i+1)
+		}
+		clock.Advance(time.Minute)
+	}
+	if _, ok := tryNext(q); ok {
+		t.Fatal("delivered a third time")
+	}
+	if dead := q.Dead(); len(dead) != 1 || dead[0].Error != "lease expired" {
+		t.Errorf("Dead = %+v", dead)
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	dir := t.TempDir()
+	clock := clocktest.New()
+	q, err := Open(dir, Options{Clock: clock, MaxAttempts: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	enqueue(t, q, "done", "in flight", "waiting", "dead")
+	done, _ := tryNext(q)
+	inFlight, _ := tryNext(q)
+	waiting, _ := tryNext(q)
+	q.Ack(done.Receipt)
+	for i := 0; i < 2; i++ {
+		dead, _ := tryNext(q)
+		q.Nack(dead.Receipt, errors.New("gave up"))
+	}
+	q.Nack(waiting.Receipt, errors.New("retry"))
+	q.Close() // as if the process died: "in flight" is still leased
+
+	// A crash can leave half a record at the end of the log
+	segments, _ := listSegments(dir)
+	path := filepath.Join(dir, segmentName(segments[len(segments)-1]))
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{42, 0, 0, 0, 1, 2})
+	f.Close()
+
+	q = openQueue(t, dir, Options{Clock: clock, MaxAttempts: 2})
+	if q.Len() != 2 {
+		t.Errorf("Len = %d, want 2", q.Len())
+	}
+	job, ok := tryNext(q)
+	if !ok || job.ID != inFlight.ID || job.Receipt != "2.2" {
+		t.Errorf("after restart: %+v, %v; want the job that was in flight, on attempt 2", job, ok)
+	}
+	if job, _ := tryNext(q); job.Data != "waiting" {
+		t.Errorf("next: %+v, want the nacked job", job)
+	}
+	if d := q.Dead(); len(d) != 1 || d[0].Job.Data != "dead" {
+		t.Errorf("Dead = %+v", d)
+	}
+	// The torn record was cut off, so new records follow good ones
+	enqueue(t, q, "new")
+	q.Close()
+	q = openQueue(t, dir, Options{Clock: clock})
+	if q.Len() != 3 {
+		t.Errorf("after a second restart Len = %d, want 3", q.Len())
+	}
+}
+
+func TestCorruptLog(t *testing.T) {
+	dir := t.TempDir()
+	q, err := Open(dir, Options{Clock: clocktest.New(), CompactEvery: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	enqueue(t, q, "a", "b")
+	q.Close()
+
+	// Damage short of the tail of the newest segment is an error
+	path := filepath.Join(dir, segmentName(1))
+	data, _ := os.ReadFile(path)
+	data[headerSize+2] ^= 0xff
+	os.WriteFile(path, data, 0o644)
+	os.WriteFile(filepath.Join(dir, segmentName(3)), nil, 0o644)
+	if _, err := Open(dir, Options{}); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Open = %v, want ErrCorrupt", err)
+	}
+}
+
+func TestCompaction(t *testing.T) {
+	dir := t.TempDir()
+	clock := clocktest.New()
+	q := openQueue(t, dir, Options{Clock: clock, CompactEvery: 4, MaxAttempts: 1})
+	enqueue(t, q, "a", "b", "c", "d", "e")
+	for i := 0; i < 3; i++ {
+		job, _ := tryNext(q)
+		q.Ack(job.Receipt)
+	}
+	job, _ := tryNext(q)
+	q.Nack(job.Receipt, errors.New("boom"))
+	q.Close()
+
+	segments, _ := listSegments(dir)
+	if len(segments) != 1 {
+		t.Errorf("%d segments after compaction, want 1", len(segments))
+	}
+	if _, err := os.Stat(filepath.Join(dir, snapshotFileName)); err != nil {
+		t.Fatalf("no snapshot: %v", err)
+	}
+
+	q = openQueue(t, dir, Options{Clock: clock})
+	if q.Len() != 1 || len(q.Dead()) != 1 {
+		t.Errorf("after reopening: Len %d, %d dead; want 1 and 1", q.Len(), len(q.Dead()))
+	}
+	if id, _ := q.Enqueue(concurrency.Job{Data: "f"}); id != 6 {
+		t.Errorf("next ID %d, want 6", id)
+	}
+}
+
+func TestPriorityAndRunAt(t *testing.T) {
+	dir := t.TempDir()
+	clock := clocktest.New()
+	q := openQueue(t, dir, Options{Clock: clock})
+	for _, job := range []concurrency.Job{
+		{Data: "low"},
+		{Data: "later", Priority: 9, RunAt: clock.Now().Add(time.Hour)},
+		{Data: "high", Priority: 5},
+		{Data: "low too"},
+	} {
+		if _, err := q.Enqueue(job); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+	// Both survive a restart
+	q.Close()
+	q = openQueue(t, dir, Options{Clock: clock})
+
+	var order []string
+	for {
+		job, ok := tryNext(q)
+		if !ok {
+			break
+		}
+		order = append(order, job.Data)
+	}
+	if want := []string{"high", "low", "low too"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("leased %q, want %q", order, want)
+	}
+
+	// A worker waiting in Next gets the job once it is due
+	got := make(chan concurrency.Job)
+	go func() {
+		job, _ := q.Next(context.Background())
+		got <- job
+	}()
+	clock.WaitForTimers(t, 1)
+	clock.Advance(time.Hour)
+	if job := <-got; job.Data != "later" || !job.RunAt.Equal(clock.Now()) {
+		t.Errorf("due job: %+v", job)
+	}
+}
+
+// settlingQueue tells the test each time a worker settles a job
+type settlingQueue struct {
+	*Queue
+	settled chan struct{}
+}
+
+func (q settlingQueue) Done(job concurrency.Job, result concurrency.Result) {
+	q.Queue.Done(job, result)
+	q.settled <- struct{}{}
+}
+
+func TestQueueFeedsWorkers(t *testing.T) {
+	q := openQueue(t, t.TempDir(), Options{Clock: clocktest.New(), MaxAttempts: 2, NoSync: true})
+	enqueue(t, q, "ok", "fail", "ok")
+
+	settled := make(chan struct{})
+	w := concurrency.NewWorker(1, nil)
+	w.Source = settlingQueue{q, settled}
+	w.Handle = func(ctx context.Context, job concurrency.Job) (string, error) {
+		if job.Data == "fail" {
+			return "", errors.New("boom")
+		}
+		return job.Data, nil
+	}
+	results := make(chan concurrency.Result, 10)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go w.Start(results, &wg)
+
+	// Successes are acked; the failure is nacked until it is dead
+	for i := 0; i < 4; i++ {
+		<-settled
+	}
+	if q.Len() != 0 || len(q.Dead()) != 1 {
+		t.Fatalf("Len %d, %d dead; want 0 and 1", q.Len(), len(q.Dead()))
+	}
+	// Closing the queue stops its workers
+	q.Close()
+	wg.Wait()
+	close(results)
+
+	failures := 0
+	for r := range results {
+		if r.Err != nil {
+			failures++
+		}
+	}
+	if failures != 2 {
+		t.Errorf("%d failed runs, want 2", failures)
+	}
+	if dead := q.Dead(); dead[0].Job.Data != "fail" {
+		t.Errorf("Dead = %+v", dead)
+	}
+}
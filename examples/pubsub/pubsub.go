@@ -0,0 +1,456 @@
+// Package pubsub is an in-process publish/subscribe broker. Messages are
+// published on dot-separated topics ("user.created", "worker.2.done")
+// and delivered to every subscription whose pattern matches:
+//
+//   - "user.created" matches only that topic
+//   - "*" matches exactly one word: "worker.*.done"
+//   - "#" matches any number of words, none included: "user.#", "#"
+//
+// Each subscription has a buffer of its own, so a slow subscriber only
+// slows the others if its overflow policy is Block.
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is one published message
+type Message struct {
+	Topic   string
+	Payload any
+	Time    time.Time
+}
+
+// Policy says what happens when a subscription's buffer is full
+type Policy int
+
+// The overflow policies
+const (
+	// DropOldest makes room by discarding the oldest queued message
+	DropOldest Policy = iota
+	// DropNewest discards the message being published
+	DropNewest
+	// Block makes Publish wait for room, or for its context to end
+	Block
+)
+
+func (p Policy) String() string {
+	switch p {
+	case DropOldest:
+		return "drop-oldest"
+	case DropNewest:
+		return "drop-newest"
+	case Block:
+		return "block"
+	}
+	return fmt.Sprintf("Policy(%d)", int(p))
+}
+
+// DefaultBuffer is the buffer of a subscription that doesn't set one
+const DefaultBuffer = 64
+
+// Options configure a subscription
+type Options struct {
+	Buffer int // messages queued before the policy applies
+	Policy Policy
+}
+
+// Errors
+var (
+	ErrClosed     = errors.New("pubsub: broker is closed")
+	ErrBadTopic   = errors.New("pubsub: invalid topic")
+	ErrBadPattern = errors.New("pubsub: invalid pattern")
+)
+
+// Broker routes messages from publishers to subscriptions. It is safe
+// for concurrent use.
+type Broker struct {
+	mu     sync.RWMutex
+	subs   map[*Subscription]struct{}
+	closed bool
+	// publishing counts Publish calls in progress, which Close waits for
+	publishing sync.WaitGroup
+}
+
+// New creates a broker
+func New() *Broker {
+	return &Broker{subs: make(map[*Subscription]struct{})}
+}
+
+// Subscribe starts a subscription to the topics matching pattern
+func (b *Broker) Subscribe(pattern string, opts Options) (*Subscription, error) {
+	words, err := splitPattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Buffer <= 0 {
+		opts.Buffer = DefaultBuffer
+	}
+	s := &Subscription{
+		broker:  b,
+		pattern: pattern,
+		words:   words,
+		opts:    opts,
+		out:     make(chan Message),
+		wake:    make(chan struct{}, 1),
+		space:   make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, ErrClosed
+	}
+	b.subs[s] = struct{}{}
+	go s.forward()
+	return s, nil
+}
+
+// Publish sends payload to every subscription matching topic and returns
+// how many queued it. It only waits for subscriptions with the Block
+// policy; if ctx ends first, the message is dropped for those still
+// full and ctx's error is returned.
+func (b *Broker) Publish(ctx context.Context, topic string, payload any) (int, error) {
+	words, err := splitTopic(topic)
+	if err != nil {
+		return 0, err
+	}
+
+	b.mu.RLock()
+	if b.closed {
+		b.mu.RUnlock()
+		return 0, ErrClosed
+	}
+	b.publishing.Add(1)
+	defer b.publishing.Done()
+	var matched []*Subscription
+	for s := range b.subs {
+		if match(s.words, words) {
+			matched = append(matched, s)
+		}
+	}
+	b.mu.RUnlock()
+
+	msg := Message{Topic: topic, Payload: payload, Time: time.Now()}
+	queued := 0
+	var firstErr error
+	for _, s := range matched {
+		ok, err := s.enqueue(ctx, msg)
+		if ok {
+			queued++
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return queued, firstErr
+}
+
+// Close stops the broker gracefully: Publish and Subscribe fail from
+// now on, publishes in progress finish, and each subscription's channel
+// is closed once its subscriber has received everything queued. If ctx
+// ends first, whatever is left is discarded and ctx's error returned.
+func (b *Broker) Close(ctx context.Context) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	subs := make([]*Subscription, 0, len(b.subs))
+	for s := range b.subs {
+		subs = append(subs, s)
+	}
+	b.mu.Unlock()
+
+	// A publisher blocked on a full subscription waits for its
+	// subscriber, which is still being served
+	published := make(chan struct{})
+	go func() {
+		b.publishing.Wait()
+		close(published)
+	}()
+	select {
+	case <-published:
+	case <-ctx.Done():
+		for _, s := range subs {
+			s.Unsubscribe()
+		}
+		<-published
+		return ctx.Err()
+	}
+
+	for _, s := range subs {
+		s.drain()
+	}
+	for _, s := range subs {
+		select {
+		case <-s.done:
+		case <-ctx.Done():
+			for _, s := range subs {
+				s.Unsubscribe()
+			}
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Metrics returns the metrics of every current subscription
+func (b *Broker) Metrics() []Metrics {
+	b.mu.RLock()
+	subs := make([]*Subscription, 0, len(b.subs))
+	for s := range b.subs {
+		subs = append(subs, s)
+	}
+	b.mu.RUnlock()
+
+	metrics := make([]Metrics, len(subs))
+	for i, s := range subs {
+		metrics[i] = s.Metrics()
+	}
+	return metrics
+}
+
+// Subscription receives the messages of the topics its pattern matches
+type Subscription struct {
+	broker  *Broker
+	pattern string
+	words   []string
+	opts    Options
+	out     chan Message
+
+	mu       sync.Mutex
+	queue    []Message
+	draining bool // deliver what is queued, then close
+	stopped  bool
+	waiting  int // publishers waiting for room
+	metrics  Metrics
+
+	wake  chan struct{} // something was queued, or draining started
+	space chan struct{} // something was delivered
+	stop  chan struct{} // closed by Unsubscribe
+	done  chan struct{} // closed when C is
+}
+
+// C delivers the subscription's messages. It is closed after
+// Unsubscribe, or once drained when the broker closes.
+func (s *Subscription) C() <-chan Message { return s.out }
+
+// Pattern returns the pattern the subscription was made with
+func (s *Subscription) Pattern() string { return s.pattern }
+
+// Unsubscribe ends the subscription at once, discarding anything queued,
+// and closes C. It is safe to call more than once.
+func (s *Subscription) Unsubscribe() {
+	s.broker.mu.Lock()
+	delete(s.broker.subs, s)
+	s.broker.mu.Unlock()
+
+	s.mu.Lock()
+	if !s.stopped {
+		s.stopped = true
+		s.metrics.Dropped += uint64(len(s.queue))
+		s.queue = nil
+		close(s.stop)
+	}
+	s.mu.Unlock()
+	<-s.done
+}
+
+// drain closes C once everything queued has been delivered
+func (s *Subscription) drain() {
+	s.mu.Lock()
+	s.draining = true
+	s.mu.Unlock()
+	signal(s.wake)
+}
+
+// signal wakes one waiter without blocking
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// enqueue queues a message as the policy says, reporting whether it was
+// queued
+func (s *Subscription) enqueue(ctx context.Context, msg Message) (bool, error) {
+	var waitStart time.Time
+	for {
+		s.mu.Lock()
+		if s.stopped || s.draining {
+			s.metrics.Dropped++
+			s.mu.Unlock()
+			return false, nil
+		}
+		if len(s.queue) < s.opts.Buffer {
+			s.queue = append(s.queue, msg)
+			s.metrics.Received++
+			if !waitStart.IsZero() {
+				s.metrics.Blocked += time.Since(waitStart)
+			}
+			s.mu.Unlock()
+			signal(s.wake)
+			return true, nil
+		}
+
+		switch s.opts.Policy {
+		case DropNewest:
+			s.metrics.Dropped++
+			s.mu.Unlock()
+			return false, nil
+		case DropOldest:
+			s.queue = append(s.queue[1:], msg)
+			s.metrics.Received++
+			s.metrics.Dropped++
+			s.mu.Unlock()
+			return true, nil
+		}
+
+		// Block: wait for the subscriber to take something
+		s.waiting++
+		s.mu.Unlock()
+		if waitStart.IsZero() {
+			waitStart = time.Now()
+		}
+		select {
+		case <-s.space:
+			s.mu.Lock()
+			s.waiting--
+			s.mu.Unlock()
+		case <-s.stop:
+			s.mu.Lock()
+			s.waiting--
+			s.mu.Unlock()
+		case <-ctx.Done():
+			s.mu.Lock()
+			s.waiting--
+			s.metrics.Dropped++
+			s.metrics.Blocked += time.Since(waitStart)
+			s.mu.Unlock()
+			// Pass on any room that was made meanwhile
+			signal(s.space)
+			return false, ctx.Err()
+		}
+	}
+}
+
+// forward moves queued messages to C, one at a time
+func (s *Subscription) forward() {
+	defer close(s.done)
+	defer close(s.out)
+	for {
+		s.mu.Lock()
+		for len(s.queue) == 0 {
+			if s.draining || s.stopped {
+				s.mu.Unlock()
+				return
+			}
+			s.mu.Unlock()
+			select {
+			case <-s.wake:
+			case <-s.stop:
+			}
+			s.mu.Lock()
+		}
+		msg := s.queue[0]
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+		signal(s.space)
+
+		select {
+		case s.out <- msg:
+			s.mu.Lock()
+			s.metrics.Delivered++
+			s.mu.Unlock()
+		case <-s.stop:
+			s.mu.Lock()
+			s.metrics.Dropped++
+			s.mu.Unlock()
+			return
+		}
+	}
+}
+
+// Metrics count what happened to a subscription's messages
+type Metrics struct {
+	Pattern   string        `json:"pattern"`
+	Policy    string        `json:"policy"`
+	Received  uint64        `json:"received"`  // queued for the subscriber
+	Delivered uint64        `json:"delivered"` // taken from C
+	Dropped   uint64        `json:"dropped"`   // lost to the policy, Unsubscribe or closing
+	Pending   int           `json:"pending"`   // queued but not yet taken
+	Waiting   int           `json:"waiting"`   // publishers waiting for room now, with Block
+	Blocked   time.Duration `json:"blocked"`   // publishers' total wait, with Block
+}
+
+// Metrics returns the subscription's counts so far
+func (s *Subscription) Metrics() Metrics {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := s.metrics
+	m.Pattern = s.pattern
+	m.Policy = s.opts.Policy.String()
+	m.Pending = len(s.queue)
+	m.Waiting = s.waiting
+	return m
+}
+
+// splitTopic checks a topic to publish on: words separated by dots, no
+// wildcards
+func splitTopic(topic string) ([]string, error) {
+	words := strings.Split(topic, ".")
+	for _, w := range words {
+		if w == "" || strings.ContainsAny(w, "*#") {
+			return nil, fmt.Errorf("%w %q", ErrBadTopic, topic)
+		}
+	}
+	return words, nil
+}
+
+// splitPattern checks a subscription pattern: like a topic, but words
+// may be * or #
+func splitPattern(pattern string) ([]string, error) {
+	words := strings.Split(pattern, ".")
+	for _, w := range words {
+		if w == "" || (w != "*" && w != "#" && strings.ContainsAny(w, "*#")) {
+			return nil, fmt.Errorf("%w %q", ErrBadPattern, pattern)
+		}
+	}
+	return words, nil
+}
+
+// match reports whether a pattern's words match a topic's
+func match(pattern, topic []string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case "#":
+			// Try every number of words for #, fewest first
+			for skip := 0; skip <= len(topic); skip++ {
+				if match(pattern[1:], topic[skip:]) {
+					return true
+				}
+			}
+			return false
+		case "*":
+			if len(topic) == 0 {
+				return false
+			}
+		default:
+			if len(topic) == 0 || topic[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, topic = pattern[1:], topic[1:]
+	}
+	return len(topic) == 0
+}
@@ -0,0 +1,294 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go-learning-guide/examples/concurrency/leaktest"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		topic   string
+		want    bool
+	}{
+		{"user.created", "user.created", true},
+		{"user.created", "user.deleted", false},
+		{"user.*", "user.created", true},
+		{"user.*", "user", false},
+		{"user.*", "user.created.v2", false},
+		{"*.created", "user.created", true},
+		{"worker.*.done", "worker.3.done", true},
+		{"worker.*.done", "worker.3.failed", false},
+		{"user.#", "user", true},
+		{"user.#", "user.created", true},
+		{"user.#", "user.created.v2", true},
+		{"user.#", "users.created", false},
+		{"#", "anything.at.all", true},
+		{"#.done", "worker.1.done", true},
+		{"#.done", "done", true},
+		{"#.done", "worker.1.failed", false},
+		{"a.#.z", "a.z", true},
+		{"a.#.z", "a.b.c.z", true},
+		{"a.#.*", "a", false},
+		{"a.#.*", "a.b", true},
+	}
+	for _, tt := range tests {
+		p, err := splitPattern(tt.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		topic, err := splitTopic(tt.topic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := match(p, topic); got != tt.want {
+			t.Errorf("match(%q, %q) = %v, want %v", tt.pattern, tt.topic, got, tt.want)
+		}
+	}
+}
+
+func TestBadTopicsAndPatterns(t *testing.T) {
+	b := New()
+	defer b.Close(context.Background())
+	for _, pattern := range []string{"", "user.", "a..b", "user*", "us#er"} {
+		if _, err := b.Subscribe(pattern, Options{}); !errors.Is(err, ErrBadPattern) {
+			t.Errorf("Subscribe(%q) = %v, want ErrBadPattern", pattern, err)
+		}
+	}
+	for _, topic := range []string{"", "user.*", "user.#", ".user"} {
+		if _, err := b.Publish(context.Background(), topic, nil); !errors.Is(err, ErrBadTopic) {
+			t.Errorf("Publish(%q) = %v, want ErrBadTopic", topic, err)
+		}
+	}
+}
+
+// receive takes n messages from s, failing the test if they don't come
+func receive(t *testing.T, s *Subscription, n int) []string {
+	t.Helper()
+	var got []string
+	for i := 0; i < n; i++ {
+		select {
+		case msg := <-s.C():
+			got = append(got, fmt.Sprintf("%s=%v", msg.Topic, msg.Payload))
+		case <-time.After(5 * time.Second):
+			t.Fatalf("got %v, then nothing", got)
+		}
+	}
+	return got
+}
+
+func TestPublishRoutesByPattern(t *testing.T) {
+	leaktest.Check(t)
+	b := New()
+	defer b.Close(context.Background())
+
+	users, _ := b.Subscribe("user.*", Options{})
+	done, _ := b.Subscribe("worker.*.done", Options{})
+	all, _ := b.Subscribe("#", Options{})
+
+	ctx := context.Background()
+	for _, topic := range []string{"user.created", "worker.1.done", "worker.1.failed", "user.deleted"} {
+		if _, err := b.Publish(ctx, topic, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := receive(t, users, 2); !reflect.DeepEqual(got, []string{"user.created=1", "user.deleted=1"}) {
+		t.Errorf("user.* got %v", got)
+	}
+	if got := receive(t, done, 1); !reflect.DeepEqual(got, []string{"worker.1.done=1"}) {
+		t.Errorf("worker.*.done got %v", got)
+	}
+	if got := receive(t, all, 4); len(got) != 4 {
+		t.Errorf("# got %v", got)
+	}
+	if n, _ := b.Publish(ctx, "nobody.listens", 0); n != 1 {
+		t.Errorf("queued for %d subscriptions, want 1 (#)", n)
+	}
+	all.Unsubscribe() // Close would wait for it to be read
+}
+
+func TestOverflowPolicies(t *testing.T) {
+	leaktest.Check(t)
+	ctx := context.Background()
+
+	// Nobody reads until five messages are published to a buffer of two.
+	// The forwarder holds one more, ready to hand over.
+	for _, tt := range []struct {
+		policy Policy
+		want   []string
+	}{
+		{DropOldest, []string{"t=0", "t=3", "t=4"}},
+		{DropNewest, []string{"t=0", "t=1", "t=2"}},
+	} {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			b := New()
+			defer b.Close(ctx)
+			s, _ := b.Subscribe("t", Options{Buffer: 2, Policy: tt.policy})
+
+			b.Publish(ctx, "t", 0)
+			waitFor(t, func() bool { return s.Metrics().Pending == 0 }) // 0 is with the forwarder
+			for i := 1; i <= 4; i++ {
+				b.Publish(ctx, "t", i)
+			}
+			if got := receive(t, s, 3); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			// Delivered is counted just after the hand-over
+			waitFor(t, func() bool { return s.Metrics().Delivered == 3 })
+			m := s.Metrics()
+			if m.Dropped != 2 || m.Delivered != 3 || m.Pending != 0 {
+				t.Errorf("metrics %+v, want 2 dropped and 3 delivered", m)
+			}
+		})
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestBlockPolicy(t *testing.T) {
+	leaktest.Check(t)
+	b := New()
+	defer b.Close(context.Background())
+	s, _ := b.Subscribe("t", Options{Buffer: 1, Policy: Block})
+
+	ctx := context.Background()
+	b.Publish(ctx, "t", 0) // taken by the forwarder
+	waitFor(t, func() bool { return s.Metrics().Pending == 0 })
+	b.Publish(ctx, "t", 1) // fills the buffer
+
+	// The next publish waits for the subscriber
+	published := make(chan error, 1)
+	go func() {
+		_, err := b.Publish(ctx, "t", 2)
+		published <- err
+	}()
+	waitFor(t, func() bool { return s.Metrics().Waiting == 1 })
+	select {
+	case <-published:
+		t.Fatal("Publish didn't block on a full subscription")
+	default:
+	}
+	if got := receive(t, s, 3); !reflect.DeepEqual(got, []string{"t=0", "t=1", "t=2"}) {
+		t.Errorf("got %v", got)
+	}
+	if err := <-published; err != nil {
+		t.Fatal(err)
+	}
+	if m := s.Metrics(); m.Blocked <= 0 || m.Dropped != 0 || m.Waiting != 0 {
+		t.Errorf("metrics %+v, want time blocked and nothing dropped", m)
+	}
+
+	// Unless its context ends first
+	b.Publish(ctx, "t", 3)
+	waitFor(t, func() bool { return s.Metrics().Pending == 0 })
+	b.Publish(ctx, "t", 4)
+	short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if n, err := b.Publish(short, "t", 5); !errors.Is(err, context.DeadlineExceeded) || n != 0 {
+		t.Errorf("Publish = %d, %v; want a deadline error", n, err)
+	}
+	if m := s.Metrics(); m.Dropped != 1 {
+		t.Errorf("metrics %+v, want 1 dropped", m)
+	}
+	s.Unsubscribe()
+}
+
+func TestUnsubscribe(t *testing.T) {
+	leaktest.Check(t)
+	b := New()
+	defer b.Close(context.Background())
+	s, _ := b.Subscribe("t", Options{})
+	b.Publish(context.Background(), "t", 1)
+	b.Publish(context.Background(), "t", 2)
+
+	s.Unsubscribe()
+	s.Unsubscribe()
+	if _, ok := <-s.C(); ok {
+		t.Error("C still open after Unsubscribe")
+	}
+	if n, _ := b.Publish(context.Background(), "t", 3); n != 0 {
+		t.Errorf("queued for %d subscriptions after Unsubscribe", n)
+	}
+	if m := s.Metrics(); m.Dropped != 2 {
+		t.Errorf("metrics %+v, want the 2 queued messages dropped", m)
+	}
+	if len(b.Metrics()) != 0 {
+		t.Errorf("broker still lists %v", b.Metrics())
+	}
+}
+
+func TestCloseDrains(t *testing.T) {
+	leaktest.Check(t)
+	b := New()
+	s, _ := b.Subscribe("#", Options{Buffer: 10})
+	for i := 0; i < 5; i++ {
+		b.Publish(context.Background(), fmt.Sprintf("t.%d", i), i)
+	}
+
+	// Close waits for the subscriber, which only starts reading once
+	// Close is under way
+	closed := make(chan error, 1)
+	go func() { closed <- b.Close(context.Background()) }()
+	select {
+	case err := <-closed:
+		t.Fatalf("Close = %v before anything was read", err)
+	default:
+	}
+	var got []string
+	for msg := range s.C() {
+		got = append(got, msg.Topic)
+	}
+	if err := <-closed; err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(got, " ") != "t.0 t.1 t.2 t.3 t.4" {
+		t.Errorf("got %v, want all five before C closed", got)
+	}
+
+	if _, err := b.Publish(context.Background(), "t", 0); !errors.Is(err, ErrClosed) {
+		t.Errorf("Publish after Close = %v", err)
+	}
+	if _, err := b.Subscribe("t", Options{}); !errors.Is(err, ErrClosed) {
+		t.Errorf("Subscribe after Close = %v", err)
+	}
+	if err := b.Close(context.Background()); err != nil {
+		t.Errorf("second Close = %v", err)
+	}
+}
+
+func TestCloseGivesUp(t *testing.T) {
+	leaktest.Check(t)
+	b := New()
+	s, _ := b.Subscribe("t", Options{Buffer: 1, Policy: Block})
+	for i := 0; i < 2; i++ {
+		b.Publish(context.Background(), "t", i)
+	}
+	// A publisher blocked on a subscriber that never reads
+	go b.Publish(context.Background(), "t", 2)
+	waitFor(t, func() bool { return s.Metrics().Waiting == 1 })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := b.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Close = %v, want to give up", err)
+	}
+	for range s.C() {
+	}
+}
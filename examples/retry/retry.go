@@ -0,0 +1,264 @@
+// Package retry runs an operation again when it fails with an error
+// worth retrying, waiting a little longer each time (exponential
+// backoff), with optional jitter so that many clients failing at once
+// don't all retry at the same moment.
+//
+//	policy := retry.Policy{
+//		Initial:     100 * time.Millisecond,
+//		MaxAttempts: 5,
+//		Jitter:      retry.FullJitter,
+//		Retryable:   retry.Is(ErrUnavailable),
+//	}
+//	err := policy.Do(ctx, func(ctx context.Context) error { ... })
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"go-learning-guide/examples/clock"
+)
+
+// Jitter is how a wait is randomized
+type Jitter int
+
+// The jitter strategies, as described in "Exponential Backoff And
+// Jitter" on the AWS Architecture Blog. b is the backoff for the
+// attempt: Initial * Multiplier^(attempt-1), at most Max.
+const (
+	// NoJitter waits exactly b
+	NoJitter Jitter = iota
+	// FullJitter waits anywhere from 0 to b
+	FullJitter
+	// EqualJitter waits b/2 plus anywhere from 0 to b/2
+	EqualJitter
+	// DecorrelatedJitter waits anywhere from Initial to three times the
+	// previous wait, at most Max; it ignores Multiplier
+	DecorrelatedJitter
+)
+
+func (j Jitter) String() string {
+	switch j {
+	case NoJitter:
+		return "none"
+	case FullJitter:
+		return "full"
+	case EqualJitter:
+		return "equal"
+	case DecorrelatedJitter:
+		return "decorrelated"
+	}
+	return fmt.Sprintf("Jitter(%d)", int(j))
+}
+
+// Defaults for a Policy's zero fields
+const (
+	DefaultInitial     = 100 * time.Millisecond
+	DefaultMax         = 10 * time.Second
+	DefaultMultiplier  = 2.0
+	DefaultMaxAttempts = 5
+)
+
+// Policy says how to retry. The zero value retries every error up to
+// DefaultMaxAttempts times, doubling the wait from DefaultInitial. A
+// Policy is safe to share between goroutines.
+type Policy struct {
+	Initial    time.Duration // the first wait
+	Max        time.Duration // the longest single wait
+	Multiplier float64       // how much each wait grows
+	Jitter     Jitter
+
+	// MaxAttempts counts the first call too; negative means no limit,
+	// in which case MaxElapsed should be set
+	MaxAttempts int
+	// MaxElapsed gives up rather than wait past this long after the
+	// first call; 0 means no limit
+	MaxElapsed time.Duration
+
+	// Retryable says whether an error is worth another attempt; nil
+	// retries everything. Errors marked Permanent are never retried,
+	// and nothing is once ctx has ended.
+	Retryable func(error) bool
+
+	// OnRetry, if set, is called before each wait
+	OnRetry func(attempt int, err error, wait time.Duration)
+
+	// Clock times the waits; nil means clock.Real. Tests use a fake one
+	// so they run instantly and deterministically.
+	Clock clock.Clock
+	Rand  func() float64 // in [0, 1); nil means math/rand
+}
+
+// ExhaustedError is returned when a Policy's limits stop the retries.
+// It unwraps to the last error.
+type ExhaustedError struct {
+	Attempts int
+	Elapsed  time.Duration
+	Err      error
+}
+
+func (e *ExhaustedError) Error() string {
+	return fmt.Sprintf("gave up after %d attempts in %v: %v", e.Attempts, e.Elapsed, e.Err)
+}
+
+func (e *ExhaustedError) Unwrap() error { return e.Err }
+
+// permanent marks an error that must not be retried
+type permanent struct{ err error }
+
+func (p permanent) Error() string { return p.err.Error() }
+func (p permanent) Unwrap() error { return p.err }
+
+// Permanent marks err as not worth retrying, whatever Retryable says.
+// Do returns err itself, not the wrapper.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanent{err}
+}
+
+// Is returns a Retryable that retries errors matching any of targets,
+// as errors.Is sees it
+func Is(targets ...error) func(error) bool {
+	return func(err error) bool {
+		for _, target := range targets {
+			if errors.Is(err, target) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// As is a Retryable that retries errors of type E, as errors.As sees
+// it: Retryable: retry.As[*net.OpError]
+func As[E error](err error) bool {
+	var target E
+	return errors.As(err, &target)
+}
+
+// Do calls fn until it succeeds, fails with an error not worth
+// retrying, the policy's limits are reached or ctx ends. It returns
+// nil, fn's error as is if it isn't retryable, an *ExhaustedError, or
+// an error matching both ctx.Err() and fn's last error.
+func (p Policy) Do(ctx context.Context, fn func(context.Context) error) error {
+	_, err := Do(ctx, p, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, fn(ctx)
+	})
+	return err
+}
+
+// Do is Policy.Do for functions that return a value
+func Do[T any](ctx context.Context, p Policy, fn func(context.Context) (T, error)) (T, error) {
+	p = p.withDefaults()
+	start := p.Clock.Now()
+	var zero T
+	var prevWait time.Duration
+	for attempt := 1; ; attempt++ {
+		value, err := fn(ctx)
+		if err == nil {
+			return value, nil
+		}
+		var perm permanent
+		if errors.As(err, &perm) {
+			return zero, perm.err
+		}
+		if ctx.Err() != nil {
+			return zero, contextError(ctx, err)
+		}
+		if p.Retryable != nil && !p.Retryable(err) {
+			return zero, err
+		}
+
+		elapsed := p.Clock.Now().Sub(start)
+		if p.MaxAttempts > 0 && attempt >= p.MaxAttempts {
+			return zero, &ExhaustedError{Attempts: attempt, Elapsed: elapsed, Err: err}
+		}
+		wait := p.backoff(attempt, prevWait)
+		if p.MaxElapsed > 0 && elapsed+wait > p.MaxElapsed {
+			return zero, &ExhaustedError{Attempts: attempt, Elapsed: elapsed, Err: err}
+		}
+		prevWait = wait
+
+		if p.OnRetry != nil {
+			p.OnRetry(attempt, err, wait)
+		}
+		if sleepErr := clock.Sleep(ctx, p.Clock, wait); sleepErr != nil {
+			return zero, contextError(ctx, err)
+		}
+	}
+}
+
+// contextError reports that ctx ended while retrying, keeping the last
+// error for errors.Is and errors.As
+func contextError(ctx context.Context, last error) error {
+	return fmt.Errorf("retry stopped: %w (last error: %w)", ctx.Err(), last)
+}
+
+func (p Policy) withDefaults() Policy {
+	if p.Initial <= 0 {
+		p.Initial = DefaultInitial
+	}
+	if p.Max <= 0 {
+		p.Max = DefaultMax
+	}
+	if p.Max < p.Initial {
+		p.Max = p.Initial
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = DefaultMultiplier
+	}
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = DefaultMaxAttempts
+	}
+	if p.Clock == nil {
+		p.Clock = clock.Real{}
+	}
+	if p.Rand == nil {
+		p.Rand = rand.Float64
+	}
+	return p
+}
+
+// Backoff returns the wait after the given failed attempt (1 for the
+// first), without jitter: what NoJitter waits, and the most FullJitter
+// and EqualJitter wait
+func (p Policy) Backoff(attempt int) time.Duration {
+	p = p.withDefaults()
+	return p.exponential(attempt)
+}
+
+func (p Policy) exponential(attempt int) time.Duration {
+	b := float64(p.Initial) * math.Pow(p.Multiplier, float64(attempt-1))
+	if b >= float64(p.Max) || math.IsInf(b, 0) || math.IsNaN(b) {
+		return p.Max
+	}
+	return time.Duration(b)
+}
+
+// backoff is the jittered wait after attempt; prev is the wait before
+func (p Policy) backoff(attempt int, prev time.Duration) time.Duration {
+	switch p.Jitter {
+	case FullJitter:
+		return time.Duration(p.Rand() * float64(p.exponential(attempt)))
+	case EqualJitter:
+		b := p.exponential(attempt)
+		return b/2 + time.Duration(p.Rand()*float64(b-b/2))
+	case DecorrelatedJitter:
+		if prev < p.Initial {
+			prev = p.Initial
+		}
+		upper := 3 * float64(prev)
+		wait := time.Duration(float64(p.Initial) + p.Rand()*(upper-float64(p.Initial)))
+		if wait > p.Max || wait < 0 {
+			wait = p.Max
+		}
+		return wait
+	}
+	return p.exponential(attempt)
+}
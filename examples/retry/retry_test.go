@@ -0,0 +1,249 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"reflect"
+	"testing"
+	"time"
+
+	"go-learning-guide/examples/clock/clocktest"
+)
+
+var errFlaky = errors.New("flaky")
+
+// failing returns an operation that fails n times, then succeeds
+func failing(n int, err error) (fn func(context.Context) error, calls *int) {
+	calls = new(int)
+	return func(context.Context) error {
+		*calls++
+		if *calls <= n {
+			return err
+		}
+		return nil
+	}, calls
+}
+
+func TestBackoffGrowsToMax(t *testing.T) {
+	clock := clocktest.NewAuto()
+	p := Policy{Initial: 100 * time.Millisecond, Max: time.Second, MaxAttempts: 7, Clock: clock}
+	fn, calls := failing(6, errFlaky)
+	if err := p.Do(context.Background(), fn); err != nil {
+		t.Fatal(err)
+	}
+	if *calls != 7 {
+		t.Errorf("%d calls, want 7", *calls)
+	}
+	want := []time.Duration{
+		100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond,
+		800 * time.Millisecond, time.Second, time.Second,
+	}
+	if !reflect.DeepEqual(clock.Waits(), want) {
+		t.Errorf("waited %v, want %v", clock.Waits(), want)
+	}
+}
+
+func TestMaxAttempts(t *testing.T) {
+	clock := clocktest.NewAuto()
+	p := Policy{MaxAttempts: 3, Clock: clock}
+	fn, calls := failing(10, errFlaky)
+	err := p.Do(context.Background(), fn)
+
+	var exhausted *ExhaustedError
+	if !errors.As(err, &exhausted) || exhausted.Attempts != 3 {
+		t.Fatalf("got %v, want to give up after 3 attempts", err)
+	}
+	if !errors.Is(err, errFlaky) {
+		t.Errorf("%v does not wrap the last error", err)
+	}
+	if *calls != 3 || len(clock.Waits()) != 2 {
+		t.Errorf("%d calls and %d waits, want 3 and 2", *calls, len(clock.Waits()))
+	}
+	if exhausted.Elapsed != 300*time.Millisecond {
+		t.Errorf("elapsed %v, want 300ms", exhausted.Elapsed)
+	}
+}
+
+func TestMaxElapsed(t *testing.T) {
+	clock := clocktest.NewAuto()
+	// Waits of 1s, 2s and 4s: the third would end past 5s
+	p := Policy{Initial: time.Second, Max: time.Minute, MaxAttempts: -1, MaxElapsed: 5 * time.Second, Clock: clock}
+	fn, calls := failing(100, errFlaky)
+	err := p.Do(context.Background(), fn)
+
+	var exhausted *ExhaustedError
+	if !errors.As(err, &exhausted) {
+		t.Fatalf("got %v, want an *ExhaustedError", err)
+	}
+	if *calls != 3 || exhausted.Elapsed != 3*time.Second {
+		t.Errorf("%d calls over %v, want 3 over 3s", *calls, exhausted.Elapsed)
+	}
+}
+
+type tempError struct{ code int }
+
+func (e *tempError) Error() string { return fmt.Sprintf("temporary failure %d", e.code) }
+
+func TestRetryable(t *testing.T) {
+	errOther := errors.New("bad request")
+	tests := []struct {
+		name      string
+		retryable func(error) bool
+		err       error
+		wantCalls int
+	}{
+		{"nil retries all", nil, errOther, 3},
+		{"Is matches", Is(errFlaky), fmt.Errorf("reading: %w", errFlaky), 3},
+		{"Is does not match", Is(errFlaky), errOther, 1},
+		{"Is with several", Is(fs.ErrNotExist, errFlaky), errFlaky, 3},
+		{"As matches", As[*tempError], fmt.Errorf("call: %w", &tempError{503}), 3},
+		{"As does not match", As[*tempError], errOther, 1},
+		{"Permanent wins", nil, Permanent(errFlaky), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := Policy{MaxAttempts: 3, Retryable: tt.retryable, Clock: clocktest.NewAuto()}
+			fn, calls := failing(10, tt.err)
+			err := p.Do(context.Background(), fn)
+			if *calls != tt.wantCalls {
+				t.Errorf("%d calls, want %d", *calls, tt.wantCalls)
+			}
+			if err == nil {
+				t.Fatal("succeeded")
+			}
+			if tt.wantCalls == 1 {
+				var perm permanent
+				if errors.As(err, &perm) {
+					t.Errorf("got the Permanent wrapper %v, want the error itself", err)
+				}
+			}
+		})
+	}
+}
+
+func TestContextCancelledWhileWaiting(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// Cancelled just before the second wait
+	onRetry := func(attempt int, err error, wait time.Duration) {
+		if attempt == 2 {
+			cancel()
+		}
+	}
+	fn, calls := failing(10, errFlaky)
+	err := Policy{MaxAttempts: 10, OnRetry: onRetry, Clock: clocktest.NewAuto()}.Do(ctx, fn)
+	if !errors.Is(err, context.Canceled) || !errors.Is(err, errFlaky) {
+		t.Fatalf("got %v, want the cancellation and the last error", err)
+	}
+	if *calls != 2 {
+		t.Errorf("%d calls, want 2", *calls)
+	}
+}
+
+func TestContextEndedDuringAttempt(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	err := Policy{Clock: clocktest.NewAuto()}.Do(ctx, func(ctx context.Context) error {
+		calls++
+		cancel()
+		return ctx.Err()
+	})
+	if calls != 1 || !errors.Is(err, context.Canceled) {
+		t.Errorf("%d calls, error %v; want one call and a cancellation", calls, err)
+	}
+}
+
+func TestDoReturnsValue(t *testing.T) {
+	calls := 0
+	got, err := Do(context.Background(), Policy{Clock: clocktest.NewAuto()}, func(context.Context) (string, error) {
+		calls++
+		if calls < 3 {
+			return "", errFlaky
+		}
+		return "ok", nil
+	})
+	if err != nil || got != "ok" || calls != 3 {
+		t.Errorf("got %q, %v after %d calls; want ok on the third", got, err, calls)
+	}
+}
+
+func TestJitter(t *testing.T) {
+	// A fixed sequence of random numbers makes the waits predictable
+	seq := func(values ...float64) func() float64 {
+		i := 0
+		return func() float64 {
+			v := values[i%len(values)]
+			i++
+			return v
+		}
+	}
+	tests := []struct {
+		jitter Jitter
+		rand   []float64
+		want   []time.Duration
+	}{
+		{NoJitter, []float64{0.5}, []time.Duration{100, 200, 400}},
+		{FullJitter, []float64{0.5, 0, 0.25}, []time.Duration{50, 0, 100}},
+		{EqualJitter, []float64{0, 1, 0.5}, []time.Duration{50, 200, 300}},
+		// From Initial to 3x the previous wait: [100, 300], [100, 900], [100, 1000 (Max)]
+		{DecorrelatedJitter, []float64{1, 0.5, 1}, []time.Duration{300, 500, 1000}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.jitter.String(), func(t *testing.T) {
+			clock := clocktest.NewAuto()
+			p := Policy{
+				Initial: 100, Max: 1000, MaxAttempts: 4,
+				Jitter: tt.jitter, Clock: clock, Rand: seq(tt.rand...),
+			}
+			fn, _ := failing(10, errFlaky)
+			p.Do(context.Background(), fn)
+			if !reflect.DeepEqual(clock.Waits(), tt.want) {
+				t.Errorf("waited %v, want %v", clock.Waits(), tt.want)
+			}
+		})
+	}
+}
+
+func TestJitterStaysInRange(t *testing.T) {
+	for _, jitter := range []Jitter{FullJitter, EqualJitter, DecorrelatedJitter} {
+		clock := clocktest.NewAuto()
+		p := Policy{Initial: time.Millisecond, Max: 50 * time.Millisecond, MaxAttempts: 200, Jitter: jitter, Clock: clock}
+		fn, _ := failing(1000, errFlaky)
+		p.Do(context.Background(), fn)
+		for i, d := range clock.Waits() {
+			if d < 0 || d > p.Max {
+				t.Errorf("%v jitter: wait %d is %v, outside [0, %v]", jitter, i+1, d, p.Max)
+			}
+		}
+	}
+}
+
+func TestOnRetry(t *testing.T) {
+	var attempts []int
+	p := Policy{
+		MaxAttempts: 3,
+		Clock:       clocktest.NewAuto(),
+		OnRetry: func(attempt int, err error, wait time.Duration) {
+			if !errors.Is(err, errFlaky) || wait <= 0 {
+				t.Errorf("OnRetry(%d, %v, %v)", attempt, err, wait)
+			}
+			attempts = append(attempts, attempt)
+		},
+	}
+	fn, _ := failing(10, errFlaky)
+	p.Do(context.Background(), fn)
+	if !reflect.DeepEqual(attempts, []int{1, 2}) {
+		t.Errorf("OnRetry called for attempts %v, want [1 2]", attempts)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := Policy{Initial: time.Second, Multiplier: 3, Max: time.Minute}
+	for attempt, want := range map[int]time.Duration{1: time.Second, 2: 3 * time.Second, 4: 27 * time.Second, 5: time.Minute, 500: time.Minute} {
+		if got := p.Backoff(attempt); got != want {
+			t.Errorf("Backoff(%d) = %v, want %v", attempt, got, want)
+		}
+	}
+}
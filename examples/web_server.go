@@ -1,351 +1,67 @@
+// Command web_server runs the user REST API from the apiserver package.
+// Read examples/apiserver to see how the routes, middleware and
+// handlers are put together.
 package main
 
 import (
-	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
-	"net/http"
-	"strconv"
-	"strings"
-	"sync"
-	"time"
+	"os"
+	"os/signal"
+	"syscall"
 
-	"github.com/gorilla/mux"
+	"go-learning-guide/examples/apiserver"
 )
 
-// User represents a user in our system
-type User struct {
-	ID        int       `json:"id"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email"`
-	CreatedAt time.Time `json:"created_at"`
-}
-
-// UserStore manages user data (in-memory for this example)
-type UserStore struct {
-	mu     sync.RWMutex
-	users  map[int]*User
-	nextID int
-}
-
-// NewUserStore creates a new user store
-func NewUserStore() *UserStore {
-	return &UserStore{
-		users:  make(map[int]*User),
-		nextID: 1,
-	}
-}
-
-// CreateUser adds a new user
-func (s *UserStore) CreateUser(name, email string) *User {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	user := &User{
-		ID:        s.nextID,
-		Name:      name,
-		Email:     email,
-		CreatedAt: time.Now(),
-	}
-
-	s.users[s.nextID] = user
-	s.nextID++
-	return user
-}
-
-// GetUser retrieves a user by ID
-func (s *UserStore) GetUser(id int) (*User, bool) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	user, exists := s.users[id]
-	return user, exists
-}
-
-// GetAllUsers returns all users
-func (s *UserStore) GetAllUsers() []*User {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	users := make([]*User, 0, len(s.users))
-	for _, user := range s.users {
-		users = append(users, user)
-	}
-	return users
-}
-
-// UpdateUser updates an existing user
-func (s *UserStore) UpdateUser(id int, name, email string) (*User, bool) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	user, exists := s.users[id]
-	if !exists {
-		return nil, false
-	}
-
-	if name != "" {
-		user.Name = name
-	}
-	if email != "" {
-		user.Email = email
-	}
-
-	return user, true
-}
-
-// DeleteUser removes a user
-func (s *UserStore) DeleteUser(id int) bool {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	_, exists := s.users[id]
-	if exists {
-		delete(s.users, id)
-	}
-	return exists
-}
-
-// UserRequest represents the request body for creating/updating users
-type UserRequest struct {
-	Name  string `json:"name"`
-	Email string `json:"email"`
-}
-
-// ErrorResponse represents an error response
-type ErrorResponse struct {
-	Error   string `json:"error"`
-	Message string `json:"message"`
-}
-
-// APIServer represents our HTTP server
-type APIServer struct {
-	store  *UserStore
-	router *mux.Router
-}
-
-// NewAPIServer creates a new API server
-func NewAPIServer() *APIServer {
-	server := &APIServer{
-		store:  NewUserStore(),
-		router: mux.NewRouter(),
-	}
-	server.setupRoutes()
-	return server
-}
-
-// setupRoutes configures all the API routes
-func (s *APIServer) setupRoutes() {
-	// Middleware
-	s.router.Use(s.loggingMiddleware)
-	s.router.Use(s.corsMiddleware)
-	s.router.Use(s.jsonMiddleware)
-
-	// API routes
-	api := s.router.PathPrefix("/api/v1").Subrouter()
-	
-	// User endpoints
-	api.HandleFunc("/users", s.handleGetUsers).Methods("GET")
-	api.HandleFunc("/users", s.handleCreateUser).Methods("POST")
-	api.HandleFunc("/users/{id:[0-9]+}", s.handleGetUser).Methods("GET")
-	api.HandleFunc("/users/{id:[0-9]+}", s.handleUpdateUser).Methods("PUT")
-	api.HandleFunc("/users/{id:[0-9]+}", s.handleDeleteUser).Methods("DELETE")
-
-	// Health check
-	api.HandleFunc("/health", s.handleHealth).Methods("GET")
-
-	// Static file serving (for a simple frontend)
-	s.router.PathPrefix("/").Handler(http.FileServer(http.Dir("./static/")))
-}
-
-// Middleware functions
-
-func (s *APIServer) loggingMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		
-		// Create a custom ResponseWriter to capture status code
-		wrapper := &responseWriterWrapper{
-			ResponseWriter: w,
-			statusCode:     http.StatusOK,
-		}
-		
-		next.ServeHTTP(wrapper, r)
-		
-		duration := time.Since(start)
-		log.Printf("%s %s %d %v", r.Method, r.URL.Path, wrapper.statusCode, duration)
-	})
-}
-
-func (s *APIServer) corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
+func main() {
+	dataDir := flag.String("data", "data/users", "directory for the user log and snapshots (empty: memory only)")
+	keyFor := flag.Int("user-key", 0, "print the key of the user with this ID and exit")
+	flag.Parse()
+
+	// Progress changes and quiz answers need the user's key
+	if *keyFor != 0 {
+		if *dataDir == "" {
+			log.Fatal("-user-key needs -data: keys of a memory-only store change with every start")
 		}
-
-		next.ServeHTTP(w, r)
-	})
-}
-
-func (s *APIServer) jsonMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.HasPrefix(r.URL.Path, "/api/") {
-			w.Header().Set("Content-Type", "application/json")
+		key, err := apiserver.UserKeyIn(*dataDir, *keyFor)
+		if err != nil {
+			log.Fatal("Reading the store's secret: ", err)
 		}
-		next.ServeHTTP(w, r)
-	})
-}
-
-// responseWriterWrapper wraps http.ResponseWriter to capture status code
-type responseWriterWrapper struct {
-	http.ResponseWriter
-	statusCode int
-}
-
-func (w *responseWriterWrapper) WriteHeader(statusCode int) {
-	w.statusCode = statusCode
-	w.ResponseWriter.WriteHeader(statusCode)
-}
-
-// Handler functions
-
-func (s *APIServer) handleHealth(w http.ResponseWriter, r *http.Request) {
-	response := map[string]interface{}{
-		"status":    "ok",
-		"timestamp": time.Now(),
-		"service":   "user-api",
-	}
-	s.writeJSON(w, http.StatusOK, response)
-}
-
-func (s *APIServer) handleGetUsers(w http.ResponseWriter, r *http.Request) {
-	users := s.store.GetAllUsers()
-	s.writeJSON(w, http.StatusOK, map[string]interface{}{
-		"users": users,
-		"count": len(users),
-	})
-}
-
-func (s *APIServer) handleGetUser(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id, err := strconv.Atoi(vars["id"])
-	if err != nil {
-		s.writeError(w, http.StatusBadRequest, "Invalid user ID", err.Error())
-		return
-	}
-
-	user, exists := s.store.GetUser(id)
-	if !exists {
-		s.writeError(w, http.StatusNotFound, "User not found", fmt.Sprintf("User with ID %d does not exist", id))
-		return
-	}
-
-	s.writeJSON(w, http.StatusOK, user)
-}
-
-func (s *APIServer) handleCreateUser(w http.ResponseWriter, r *http.Request) {
-	var req UserRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		s.writeError(w, http.StatusBadRequest, "Invalid JSON", err.Error())
-		return
-	}
-
-	// Validation
-	if req.Name == "" || req.Email == "" {
-		s.writeError(w, http.StatusBadRequest, "Validation failed", "Name and email are required")
-		return
-	}
-
-	user := s.store.CreateUser(req.Name, req.Email)
-	s.writeJSON(w, http.StatusCreated, user)
-}
-
-func (s *APIServer) handleUpdateUser(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id, err := strconv.Atoi(vars["id"])
-	if err != nil {
-		s.writeError(w, http.StatusBadRequest, "Invalid user ID", err.Error())
-		return
-	}
-
-	var req UserRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		s.writeError(w, http.StatusBadRequest, "Invalid JSON", err.Error())
-		return
-	}
-
-	user, exists := s.store.UpdateUser(id, req.Name, req.Email)
-	if !exists {
-		s.writeError(w, http.StatusNotFound, "User not found", fmt.Sprintf("User with ID %d does not exist", id))
-		return
-	}
-
-	s.writeJSON(w, http.StatusOK, user)
-}
-
-func (s *APIServer) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id, err := strconv.Atoi(vars["id"])
-	if err != nil {
-		s.writeError(w, http.StatusBadRequest, "Invalid user ID", err.Error())
-		return
-	}
-
-	deleted := s.store.DeleteUser(id)
-	if !deleted {
-		s.writeError(w, http.StatusNotFound, "User not found", fmt.Sprintf("User with ID %d does not exist", id))
+		fmt.Println(key)
 		return
 	}
 
-	s.writeJSON(w, http.StatusOK, map[string]string{
-		"message": "User deleted successfully",
-	})
-}
-
-// Helper functions
-
-func (s *APIServer) writeJSON(w http.ResponseWriter, status int, data interface{}) {
-	w.WriteHeader(status)
-	if err := json.NewEncoder(w).Encode(data); err != nil {
-		log.Printf("Error encoding JSON: %v", err)
+	// Open the store; users survive restarts unless -data is empty
+	store := apiserver.NewUserStore()
+	if *dataDir != "" {
+		var err error
+		if store, err = apiserver.OpenUserStore(*dataDir, apiserver.PersistOptions{}); err != nil {
+			log.Fatal("Opening user store:", err)
+		}
+		log.Printf("Users are stored in %s", *dataDir)
 	}
-}
 
-func (s *APIServer) writeError(w http.ResponseWriter, status int, error, message string) {
-	response := ErrorResponse{
-		Error:   error,
-		Message: message,
-	}
-	s.writeJSON(w, status, response)
-}
-
-// Start starts the server
-func (s *APIServer) Start(port string) error {
-	log.Printf("Starting server on port %s", port)
-	log.Printf("Health check: http://localhost%s/api/v1/health", port)
-	log.Printf("API endpoints:")
-	log.Printf("  GET    /api/v1/users")
-	log.Printf("  POST   /api/v1/users")
-	log.Printf("  GET    /api/v1/users/{id}")
-	log.Printf("  PUT    /api/v1/users/{id}")
-	log.Printf("  DELETE /api/v1/users/{id}")
-	
-	return http.ListenAndServe(port, s.router)
-}
+	// Flush the log on Ctrl-C
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-stop
+		if err := store.Close(); err != nil {
+			log.Printf("Closing user store: %v", err)
+		}
+		os.Exit(0)
+	}()
 
-func main() {
 	// Create and configure server
-	server := NewAPIServer()
+	server := apiserver.NewAPIServerWithStore(store)
 
-	// Add some sample data
-	server.store.CreateUser("Alice Johnson", "alice@example.com")
-	server.store.CreateUser("Bob Smith", "bob@example.com")
-	server.store.CreateUser("Charlie Brown", "charlie@example.com")
+	// Add some sample data the first time
+	if len(store.GetAllUsers()) == 0 {
+		store.CreateUser("Alice Johnson", "alice@example.com")
+		store.CreateUser("Bob Smith", "bob@example.com")
+		store.CreateUser("Charlie Brown", "charlie@example.com")
+	}
 
 	// Start server
 	port := ":8080"
@@ -376,6 +92,52 @@ curl -X PUT http://localhost:8080/api/v1/users/1 \
 # Delete user
 curl -X DELETE http://localhost:8080/api/v1/users/1
 
+# Create, update and delete in one request (all or nothing by default)
+curl -X POST "http://localhost:8080/api/v1/users:batch?mode=best-effort" \
+  -H "Content-Type: application/json" \
+  -d '{"operations":[{"op":"create","name":"Eve","email":"eve@example.com"},{"op":"delete","id":2}]}'
+
+# Large imports: one operation per line
+curl -X POST http://localhost:8080/api/v1/users:batch?mode=best-effort \
+  -H "Content-Type: application/x-ndjson" --data-binary @users.ndjson
+
+# API v2: split names, string IDs, PATCH for partial updates
+curl http://localhost:8080/api/v2/users/1
+curl -X PATCH http://localhost:8080/api/v2/users/1 -d '{"last_name":"Jones"}'
+
+# Unversioned paths pick the version from Accept (latest if none);
+# v1 responses carry Deprecation and Sunset headers
+curl -i http://localhost:8080/api/users -H "Accept: application/vnd.go-learning-guide.v1+json"
+
+# Lists come as JSON, NDJSON or CSV depending on Accept; large
+# responses are gzipped for clients that send Accept-Encoding
+curl http://localhost:8080/api/v2/users -H "Accept: text/csv"
+curl --compressed -i http://localhost:8080/api/v1/users
+
+# Export every user (streamed), then check a CSV import without saving it
+curl -o users.csv "http://localhost:8080/api/v1/users/export?format=csv"
+curl -X POST "http://localhost:8080/api/v1/users/import?dry_run=true&map=name:Full%20Name" \
+  -H "Content-Type: text/csv" --data-binary @people.csv
+
+# Follow user changes as Server-Sent Events (-N disables buffering)
+curl -N http://localhost:8080/api/v1/users/events
+
+# Sync learning progress; the server merges it with what other devices
+# sent. Changing progress takes the user's key, printed by -user-key
+curl -X PUT http://localhost:8080/api/v2/users/1/progress \
+  -H "Authorization: Bearer $(go run examples/web_server.go -user-key 1)" \
+  -H "Content-Type: application/json" \
+  -d '{"roadmap":{"installation":{"completed":true,"updated_at":"2026-01-05T09:00:00Z"}}}'
+
+# See how far everyone has got
+curl http://localhost:8080/api/v2/progress
+
+# Errors are RFC 7807 problem documents (application/problem+json)
+curl -i http://localhost:8080/api/v1/users/999
+
 # Health check
 curl -X GET http://localhost:8080/api/v1/health
+
+# OpenAPI 3.1 document (feed this to your client generator)
+curl -X GET http://localhost:8080/api/v1/openapi.json
 */
@@ -0,0 +1,259 @@
+// Package quiz holds the guide's question bank: the multiple choice
+// exercises and the coding challenges of the Practice tab. The bank is
+// questions.json, embedded in the binary and never served as a file, so
+// answers stay on the server. Clients get questions without answers
+// (Public) and send choices back to be graded (Grade).
+//
+// Each coding challenge has hidden tests, hidden/<id>_test.go.txt: a
+// _test.go file for the submitted main package, run by the runner
+// package. The .txt keeps the go command from building them here.
+package quiz
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+//go:embed questions.json
+var questionsJSON []byte
+
+//go:embed hidden/*_test.go.txt
+var hiddenTests embed.FS
+
+// Difficulty matches the levels of the guide's difficulty filter
+type Difficulty string
+
+// The difficulties, easiest first
+const (
+	Beginner     Difficulty = "beginner"
+	Intermediate Difficulty = "intermediate"
+	Advanced     Difficulty = "advanced"
+)
+
+// Difficulties lists every difficulty in order
+var Difficulties = []Difficulty{Beginner, Intermediate, Advanced}
+
+// ParseDifficulty looks up a difficulty by name, ignoring case
+func ParseDifficulty(name string) (Difficulty, bool) {
+	for _, d := range Difficulties {
+		if strings.EqualFold(string(d), strings.TrimSpace(name)) {
+			return d, true
+		}
+	}
+	return "", false
+}
+
+// Question is a multiple choice exercise, answer included
+type Question struct {
+	ID          string     `json:"id"`
+	Title       string     `json:"title"`
+	Difficulty  Difficulty `json:"difficulty"`
+	Prompt      string     `json:"prompt"`
+	Code        string     `json:"code,omitempty"`
+	Options     []string   `json:"options"`
+	Answer      int        `json:"answer"` // index into Options
+	Explanation string     `json:"explanation"`
+}
+
+// PublicQuestion is a question as clients see it: no answer and no
+// explanation, which gives the answer away
+type PublicQuestion struct {
+	ID         string     `json:"id"`
+	Title      string     `json:"title"`
+	Difficulty Difficulty `json:"difficulty"`
+	Prompt     string     `json:"prompt"`
+	Code       string     `json:"code,omitempty"`
+	Options    []string   `json:"options"`
+}
+
+// Public strips the answer from q
+func (q Question) Public() PublicQuestion {
+	return PublicQuestion{
+		ID:         q.ID,
+		Title:      q.Title,
+		Difficulty: q.Difficulty,
+		Prompt:     q.Prompt,
+		Code:       q.Code,
+		Options:    q.Options,
+	}
+}
+
+// Challenge is a coding challenge: a task and a program to start from
+type Challenge struct {
+	ID         string     `json:"id"`
+	Title      string     `json:"title"`
+	Difficulty Difficulty `json:"difficulty"`
+	Prompt     string     `json:"prompt"`
+	Template   string     `json:"template"`
+}
+
+// Bank is the question bank
+type Bank struct {
+	Questions  []Question  `json:"questions"`
+	Challenges []Challenge `json:"challenges"`
+}
+
+// Result is the outcome of answering a question. The answer and the
+// explanation are revealed once a choice has been made, as the guide
+// has always done, so a server should only hand a Result to someone
+// whose attempt it has counted.
+type Result struct {
+	QuestionID  string `json:"question_id"`
+	Choice      int    `json:"choice"`
+	Correct     bool   `json:"correct"`
+	Answer      int    `json:"answer"`
+	Explanation string `json:"explanation"`
+}
+
+// ErrNoQuestion means there is no question with the given ID
+var ErrNoQuestion = errors.New("no such question")
+
+// ErrBadChoice means a choice is not one of the question's options
+var ErrBadChoice = errors.New("choice is not one of the options")
+
+// Load reads and validates a question bank
+func Load(r io.Reader) (*Bank, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	var b Bank
+	if err := dec.Decode(&b); err != nil {
+		return nil, fmt.Errorf("reading question bank: %w", err)
+	}
+	if err := b.validate(); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func (b *Bank) validate() error {
+	var errs []error
+	ids := make(map[string]bool)
+	checkCommon := func(kind, id, title string, d Difficulty) {
+		switch {
+		case id == "":
+			errs = append(errs, fmt.Errorf("%s %q has no id", kind, title))
+		case ids[id]:
+			errs = append(errs, fmt.Errorf("%s id %q is used twice", kind, id))
+		}
+		ids[id] = true
+		if _, ok := ParseDifficulty(string(d)); !ok {
+			errs = append(errs, fmt.Errorf("%s %q: unknown difficulty %q", kind, id, d))
+		}
+	}
+	for _, q := range b.Questions {
+		checkCommon("question", q.ID, q.Title, q.Difficulty)
+		if len(q.Options) < 2 {
+			errs = append(errs, fmt.Errorf("question %q needs at least two options", q.ID))
+		}
+		if q.Answer < 0 || q.Answer >= len(q.Options) {
+			errs = append(errs, fmt.Errorf("question %q: answer %d is not an option", q.ID, q.Answer))
+		}
+	}
+	for _, c := range b.Challenges {
+		checkCommon("challenge", c.ID, c.Title, c.Difficulty)
+	}
+	return errors.Join(errs...)
+}
+
+var (
+	defaultOnce sync.Once
+	defaultBank *Bank
+	defaultErr  error
+)
+
+// Default returns the embedded question bank. It is loaded once;
+// callers must not modify it.
+func Default() (*Bank, error) {
+	defaultOnce.Do(func() {
+		defaultBank, defaultErr = Load(strings.NewReader(string(questionsJSON)))
+	})
+	return defaultBank, defaultErr
+}
+
+// Question finds a question by ID
+func (b *Bank) Question(id string) (Question, bool) {
+	for _, q := range b.Questions {
+		if q.ID == id {
+			return q, true
+		}
+	}
+	return Question{}, false
+}
+
+// Challenge finds a coding challenge by ID
+func (b *Bank) Challenge(id string) (Challenge, bool) {
+	for _, c := range b.Challenges {
+		if c.ID == id {
+			return c, true
+		}
+	}
+	return Challenge{}, false
+}
+
+// HiddenTests returns the tests a solution to the challenge must pass
+func HiddenTests(challengeID string) (string, error) {
+	data, err := hiddenTests.ReadFile("hidden/" + challengeID + "_test.go.txt")
+	if err != nil {
+		return "", fmt.Errorf("no tests for challenge %q", challengeID)
+	}
+	return string(data), nil
+}
+
+// PublicQuestions returns the questions of the given difficulties (none
+// means all) without their answers, in bank order
+func (b *Bank) PublicQuestions(only ...Difficulty) []PublicQuestion {
+	questions := []PublicQuestion{}
+	for _, q := range b.Questions {
+		if matches(q.Difficulty, only) {
+			questions = append(questions, q.Public())
+		}
+	}
+	return questions
+}
+
+// ChallengesFor returns the challenges of the given difficulties (none
+// means all), in bank order
+func (b *Bank) ChallengesFor(only ...Difficulty) []Challenge {
+	challenges := []Challenge{}
+	for _, c := range b.Challenges {
+		if matches(c.Difficulty, only) {
+			challenges = append(challenges, c)
+		}
+	}
+	return challenges
+}
+
+func matches(d Difficulty, only []Difficulty) bool {
+	if len(only) == 0 {
+		return true
+	}
+	for _, o := range only {
+		if o == d {
+			return true
+		}
+	}
+	return false
+}
+
+// Grade checks a choice, an index into the question's options
+func (b *Bank) Grade(questionID string, choice int) (Result, error) {
+	q, ok := b.Question(questionID)
+	if !ok {
+		return Result{}, ErrNoQuestion
+	}
+	if choice < 0 || choice >= len(q.Options) {
+		return Result{}, ErrBadChoice
+	}
+	return Result{
+		QuestionID:  q.ID,
+		Choice:      choice,
+		Correct:     choice == q.Answer,
+		Answer:      q.Answer,
+		Explanation: q.Explanation,
+	}, nil
+}
@@ -0,0 +1,95 @@
+package quiz
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDefaultBank(t *testing.T) {
+	b, err := Default()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Questions) != 8 || len(b.Challenges) != 3 {
+		t.Fatalf("%d questions, %d challenges; want 8 and 3", len(b.Questions), len(b.Challenges))
+	}
+	if got := len(b.PublicQuestions(Beginner)); got != 3 {
+		t.Errorf("%d beginner questions; want 3", got)
+	}
+	if got := len(b.ChallengesFor(Intermediate, Advanced)); got != 2 {
+		t.Errorf("%d intermediate and advanced challenges; want 2", got)
+	}
+}
+
+func TestPublicQuestionsHideAnswers(t *testing.T) {
+	b, _ := Default()
+	data, err := json.Marshal(b.PublicQuestions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{`"answer"`, `"explanation"`} {
+		if strings.Contains(string(data), field) {
+			t.Errorf("public questions contain %s", field)
+		}
+	}
+}
+
+func TestGrade(t *testing.T) {
+	b, _ := Default()
+	tests := []struct {
+		id          string
+		choice      int
+		wantCorrect bool
+		wantErr     error
+	}{
+		{"variable-declarations", 3, true, nil},
+		{"variable-declarations", 0, false, nil},
+		{"goroutines-and-channels", 2, true, nil},
+		{"variable-declarations", 4, false, ErrBadChoice},
+		{"no-such-question", 0, false, ErrNoQuestion},
+	}
+	for _, tt := range tests {
+		res, err := b.Grade(tt.id, tt.choice)
+		if !errors.Is(err, tt.wantErr) || res.Correct != tt.wantCorrect {
+			t.Errorf("Grade(%s, %d) = %+v, %v; want correct=%v, error %v", tt.id, tt.choice, res, err, tt.wantCorrect, tt.wantErr)
+		}
+		if err == nil && res.Explanation == "" {
+			t.Errorf("Grade(%s, %d) has no explanation", tt.id, tt.choice)
+		}
+	}
+}
+
+func TestLoadValidates(t *testing.T) {
+	bank := `{"questions":[
+		{"id":"a","title":"A","difficulty":"beginner","prompt":"?","options":["x","y"],"answer":2},
+		{"id":"a","title":"B","difficulty":"expert","prompt":"?","options":["x"],"answer":0}
+	]}`
+	_, err := Load(strings.NewReader(bank))
+	if err == nil {
+		t.Fatal("no error")
+	}
+	for _, want := range []string{"answer 2 is not an option", `id "a" is used twice`, `unknown difficulty "expert"`, "at least two options"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error is missing %q:\n%v", want, err)
+		}
+	}
+}
+
+func TestEveryChallengeHasTests(t *testing.T) {
+	b, _ := Default()
+	for _, c := range b.Challenges {
+		tests, err := HiddenTests(c.ID)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if !strings.HasPrefix(tests, "package main\n") || !strings.Contains(tests, "func Test") {
+			t.Errorf("tests for %s are not a _test.go file of package main", c.ID)
+		}
+	}
+	if _, err := HiddenTests("../questions.json"); err == nil {
+		t.Error("HiddenTests read a file outside hidden/")
+	}
+}
@@ -0,0 +1,382 @@
+// Package roadmap reads the learning roadmap from
+// site/golang_learning_roadmap.csv, the single source for the stages,
+// topics and time estimates shown by the guide, the API and the README.
+//
+// The CSV has a header row and the columns Stage, Topic, Duration,
+// Key_Skills and Resources. Durations are a number or a range with a
+// unit, e.g. "1 day", "2-3 days" or "1-2 weeks"; skills and resources
+// are comma separated lists.
+package roadmap
+
+//go:generate go run ../cmd/roadmap -readme ../README.md
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go-learning-guide/site"
+)
+
+// Stage is a level of the roadmap
+type Stage string
+
+// The stages, easiest first. Topics must be listed in this order.
+const (
+	Beginner     Stage = "Beginner"
+	Intermediate Stage = "Intermediate"
+	Advanced     Stage = "Advanced"
+)
+
+// Stages lists every stage in order
+var Stages = []Stage{Beginner, Intermediate, Advanced}
+
+// ParseStage looks up a stage by name, ignoring case
+func ParseStage(name string) (Stage, bool) {
+	for _, s := range Stages {
+		if strings.EqualFold(string(s), strings.TrimSpace(name)) {
+			return s, true
+		}
+	}
+	return "", false
+}
+
+// Icon is the marker the guide and README use for a stage
+func (s Stage) Icon() string {
+	switch s {
+	case Beginner:
+		return "🟢"
+	case Intermediate:
+		return "🟡"
+	case Advanced:
+		return "🔴"
+	}
+	return ""
+}
+
+// Duration is an estimated time range in whole days
+type Duration struct {
+	MinDays int `json:"min_days"`
+	MaxDays int `json:"max_days"`
+}
+
+// ParseDuration parses "1 day", "2-3 days", "1 week" or "1-2 weeks"
+func ParseDuration(text string) (Duration, error) {
+	fields := strings.Fields(text)
+	if len(fields) != 2 {
+		return Duration{}, fmt.Errorf("duration %q: want a number or range and a unit", text)
+	}
+
+	var perUnit int
+	switch strings.ToLower(fields[1]) {
+	case "day", "days":
+		perUnit = 1
+	case "week", "weeks":
+		perUnit = 7
+	default:
+		return Duration{}, fmt.Errorf("duration %q: unknown unit %q", text, fields[1])
+	}
+
+	lo, hi, isRange := strings.Cut(fields[0], "-")
+	if !isRange {
+		hi = lo
+	}
+	min, err1 := strconv.Atoi(lo)
+	max, err2 := strconv.Atoi(hi)
+	switch {
+	case err1 != nil || err2 != nil:
+		return Duration{}, fmt.Errorf("duration %q: %q is not a number or range", text, fields[0])
+	case min < 1 || max < min:
+		return Duration{}, fmt.Errorf("duration %q: range must be positive and ascending", text)
+	}
+	return Duration{MinDays: min * perUnit, MaxDays: max * perUnit}, nil
+}
+
+// Add returns the range of doing both
+func (d Duration) Add(other Duration) Duration {
+	return Duration{MinDays: d.MinDays + other.MinDays, MaxDays: d.MaxDays + other.MaxDays}
+}
+
+// String formats the range in days, as in the CSV: "1 day", "2-3 days"
+func (d Duration) String() string {
+	return formatRange(d.MinDays, d.MaxDays, "day")
+}
+
+// Approx formats the range for people planning their time: in days up
+// to two weeks, otherwise in weeks rounded to the nearest whole week
+func (d Duration) Approx() string {
+	if d.MaxDays < 14 {
+		return d.String()
+	}
+	weeks := func(days int) int {
+		return int(math.Max(1, math.Round(float64(days)/7)))
+	}
+	return formatRange(weeks(d.MinDays), weeks(d.MaxDays), "week")
+}
+
+func formatRange(min, max int, unit string) string {
+	if min == max {
+		if min == 1 {
+			return "1 " + unit
+		}
+		return fmt.Sprintf("%d %ss", min, unit)
+	}
+	return fmt.Sprintf("%d-%d %ss", min, max, unit)
+}
+
+// Topic is one row of the roadmap
+type Topic struct {
+	Stage     Stage    `json:"stage"`
+	Name      string   `json:"topic"`
+	Order     int      `json:"order"` // 1-based position within the stage
+	Duration  Duration `json:"duration"`
+	KeySkills []string `json:"key_skills"`
+	Resources []string `json:"resources"`
+}
+
+// StageSummary is a stage with its topics and their combined duration
+type StageSummary struct {
+	Stage    Stage    `json:"stage"`
+	Duration Duration `json:"duration"`
+	Topics   []Topic  `json:"topics"`
+}
+
+// Roadmap is the whole learning path
+type Roadmap struct {
+	Topics []Topic
+}
+
+// LineError is a problem with one line of the CSV. Line 1 is the header.
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+var header = []string{"Stage", "Topic", "Duration", "Key_Skills", "Resources"}
+
+// Parse reads and validates a roadmap CSV. Every problem found is
+// reported, joined into one error of *LineError values.
+func Parse(r io.Reader) (*Roadmap, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = len(header)
+	cr.TrimLeadingSpace = true
+
+	first, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+	first[0] = strings.TrimPrefix(first[0], "\ufeff")
+	for i, name := range header {
+		if !strings.EqualFold(strings.TrimSpace(first[i]), name) {
+			return nil, &LineError{Line: 1, Err: fmt.Errorf("column %d is %q; want %q", i+1, first[i], name)}
+		}
+	}
+
+	rm := &Roadmap{}
+	var errs []error
+	seen := make(map[string]int)
+	stageIndex := 0
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) && parseErr.Err == csv.ErrFieldCount {
+				errs = append(errs, &LineError{Line: parseErr.StartLine, Err: parseErr.Err})
+				continue
+			}
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+
+		lineErr := func(format string, args ...interface{}) {
+			errs = append(errs, &LineError{Line: line, Err: fmt.Errorf(format, args...)})
+		}
+
+		topic := Topic{
+			Name:      strings.TrimSpace(record[1]),
+			KeySkills: splitList(record[3]),
+			Resources: splitList(record[4]),
+		}
+
+		stage, ok := ParseStage(record[0])
+		switch {
+		case !ok:
+			lineErr("unknown stage %q", record[0])
+		default:
+			i := stageIndexOf(stage)
+			if i < stageIndex {
+				lineErr("%s topic after %s topics; list stages in order", stage, Stages[stageIndex])
+			} else {
+				stageIndex = i
+			}
+			topic.Stage = stage
+		}
+
+		if topic.Name == "" {
+			lineErr("topic is empty")
+		} else if prev, dup := seen[strings.ToLower(topic.Name)]; dup {
+			lineErr("topic %q is already on line %d", topic.Name, prev)
+		} else {
+			seen[strings.ToLower(topic.Name)] = line
+		}
+
+		if topic.Duration, err = ParseDuration(record[2]); err != nil {
+			lineErr("%v", err)
+		}
+		if len(topic.KeySkills) == 0 {
+			lineErr("no key skills")
+		}
+		if len(topic.Resources) == 0 {
+			lineErr("no resources")
+		}
+
+		rm.Topics = append(rm.Topics, topic)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	if len(rm.Topics) == 0 {
+		return nil, errors.New("roadmap has no topics")
+	}
+
+	order := make(map[Stage]int)
+	for i := range rm.Topics {
+		order[rm.Topics[i].Stage]++
+		rm.Topics[i].Order = order[rm.Topics[i].Stage]
+	}
+	return rm, nil
+}
+
+func stageIndexOf(s Stage) int {
+	for i, stage := range Stages {
+		if stage == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// splitList splits a comma separated cell, dropping empty items
+func splitList(cell string) []string {
+	var items []string
+	for _, item := range strings.Split(cell, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+var (
+	defaultOnce    sync.Once
+	defaultRoadmap *Roadmap
+	defaultErr     error
+)
+
+// Default returns the roadmap embedded with the site. It is parsed once;
+// callers must not modify it.
+func Default() (*Roadmap, error) {
+	defaultOnce.Do(func() {
+		data, err := site.ReadFile("golang_learning_roadmap.csv")
+		if err != nil {
+			defaultErr = err
+			return
+		}
+		defaultRoadmap, defaultErr = Parse(strings.NewReader(string(data)))
+	})
+	return defaultRoadmap, defaultErr
+}
+
+// Stages groups the topics by stage, in order, with each stage's total
+// duration. Only the given stages are included; none means all.
+func (rm *Roadmap) Stages(only ...Stage) []StageSummary {
+	var summaries []StageSummary
+	for _, stage := range Stages {
+		if len(only) > 0 && !containsStage(only, stage) {
+			continue
+		}
+		summary := StageSummary{Stage: stage, Topics: []Topic{}}
+		for _, t := range rm.Topics {
+			if t.Stage == stage {
+				summary.Topics = append(summary.Topics, t)
+				summary.Duration = summary.Duration.Add(t.Duration)
+			}
+		}
+		if len(summary.Topics) > 0 {
+			summaries = append(summaries, summary)
+		}
+	}
+	return summaries
+}
+
+func containsStage(stages []Stage, s Stage) bool {
+	for _, stage := range stages {
+		if stage == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Total is the duration of the whole roadmap
+func (rm *Roadmap) Total() Duration {
+	var total Duration
+	for _, t := range rm.Topics {
+		total = total.Add(t.Duration)
+	}
+	return total
+}
+
+// Markdown renders the learning path as it appears in the README
+func (rm *Roadmap) Markdown() string {
+	var b strings.Builder
+	for i, s := range rm.Stages() {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "### %s %s (%s)\n", s.Stage.Icon(), s.Stage, s.Duration.Approx())
+		for _, t := range s.Topics {
+			fmt.Fprintf(&b, "%d. **%s** (%s)\n", t.Order, t.Name, t.Duration)
+		}
+	}
+	return b.String()
+}
+
+// Markers around the generated learning path in the README
+const (
+	SectionBegin = "<!-- roadmap:begin (generated from site/golang_learning_roadmap.csv by go generate ./roadmap) -->"
+	SectionEnd   = "<!-- roadmap:end -->"
+)
+
+// ReplaceSection replaces the text between SectionBegin and SectionEnd
+// in a document with section
+func ReplaceSection(doc []byte, section string) ([]byte, error) {
+	begin := bytes.Index(doc, []byte(SectionBegin))
+	end := bytes.Index(doc, []byte(SectionEnd))
+	if begin < 0 || end < begin {
+		return nil, errors.New("no roadmap section markers")
+	}
+	var out bytes.Buffer
+	out.Write(doc[:begin+len(SectionBegin)])
+	out.WriteString("\n")
+	out.WriteString(section)
+	out.Write(doc[end:])
+	return out.Bytes(), nil
+}
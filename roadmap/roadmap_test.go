@@ -0,0 +1,134 @@
+package roadmap
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    Duration
+		wantErr bool
+	}{
+		{"1 day", Duration{1, 1}, false},
+		{"2-3 days", Duration{2, 3}, false},
+		{"1-2 weeks", Duration{7, 14}, false},
+		{"10 Days", Duration{10, 10}, false},
+		{"3-2 days", Duration{}, true},
+		{"0 days", Duration{}, true},
+		{"two days", Duration{}, true},
+		{"2-3 months", Duration{}, true},
+		{"3", Duration{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseDuration(tt.text)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseDuration(%q) = %v, %v; want %v, error %v", tt.text, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestDurationFormatting(t *testing.T) {
+	tests := []struct {
+		d           Duration
+		str, approx string
+	}{
+		{Duration{1, 1}, "1 day", "1 day"},
+		{Duration{2, 3}, "2-3 days", "2-3 days"},
+		{Duration{16, 22}, "16-22 days", "2-3 weeks"},
+		{Duration{7, 14}, "7-14 days", "1-2 weeks"},
+		{Duration{14, 14}, "14 days", "2 weeks"},
+	}
+	for _, tt := range tests {
+		if got := tt.d.String(); got != tt.str {
+			t.Errorf("%v.String() = %q; want %q", tt.d, got, tt.str)
+		}
+		if got := tt.d.Approx(); got != tt.approx {
+			t.Errorf("%v.Approx() = %q; want %q", tt.d, got, tt.approx)
+		}
+	}
+}
+
+func TestDefaultRoadmap(t *testing.T) {
+	rm, err := Default()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stages := rm.Stages()
+	if len(stages) != 3 {
+		t.Fatalf("got %d stages; want 3", len(stages))
+	}
+	beginner := stages[0]
+	if beginner.Stage != Beginner || len(beginner.Topics) != 7 || beginner.Duration != (Duration{16, 22}) {
+		t.Errorf("beginner = %s, %d topics, %v", beginner.Stage, len(beginner.Topics), beginner.Duration)
+	}
+	first := beginner.Topics[0]
+	if first.Name != "Installation & Setup" || first.Order != 1 ||
+		strings.Join(first.KeySkills, "|") != "Go installation|environment setup|first program" {
+		t.Errorf("first topic = %+v", first)
+	}
+
+	if only := rm.Stages(Advanced); len(only) != 1 || only[0].Stage != Advanced {
+		t.Errorf("Stages(Advanced) = %v", only)
+	}
+	var sum Duration
+	for _, s := range stages {
+		sum = sum.Add(s.Duration)
+	}
+	if sum != rm.Total() {
+		t.Errorf("stage durations add up to %v; Total() = %v", sum, rm.Total())
+	}
+}
+
+func TestParseReportsEveryProblem(t *testing.T) {
+	csv := `Stage,Topic,Duration,Key_Skills,Resources
+Intermediate,Pointers,2-3 days,"Pointer basics",Tutorials
+Beginner,Basics,2 days,"Syntax",Tour
+Expert,Magic,1 day,"Wizardry",Books
+Intermediate,pointers,a while,,Docs
+Advanced,Too,Many,Fields,Here,Extra
+`
+	_, err := Parse(strings.NewReader(csv))
+	if err == nil {
+		t.Fatal("no error")
+	}
+	var lineErr *LineError
+	if !errors.As(err, &lineErr) || lineErr.Line != 3 {
+		t.Errorf("first error = %v; want a *LineError for line 3", err)
+	}
+	for _, want := range []string{
+		"line 3: Beginner topic after Intermediate topics",
+		`line 4: unknown stage "Expert"`,
+		`line 5: topic "pointers" is already on line 2`,
+		`line 5: duration "a while"`,
+		"line 5: no key skills",
+		"line 6: wrong number of fields",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error is missing %q:\n%v", want, err)
+		}
+	}
+}
+
+// The README's learning path is generated; run go generate ./roadmap
+// after editing the CSV
+func TestREADMEUpToDate(t *testing.T) {
+	rm, err := Default()
+	if err != nil {
+		t.Fatal(err)
+	}
+	readme, err := os.ReadFile("../README.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated, err := ReplaceSection(readme, rm.Markdown())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(updated) != string(readme) {
+		t.Error("README.md learning path is out of date; run go generate ./roadmap")
+	}
+}
@@ -0,0 +1,484 @@
+// Package runner checks solutions to the guide's coding challenges. A
+// submission is a main package; it is compiled with the local Go
+// toolchain in a temporary module together with a file of hidden tests,
+// written like examples/basic_test.go, and the test binary is run in a
+// sandbox. The result is a Report with a pass or fail for every case.
+//
+// Everything happens offline: the module has no dependencies and the
+// toolchain is told not to download any. Submissions may only import
+// the packages in AllowedImports, which leaves them no way to touch
+// files, processes or the network themselves. The tests run
+//   - chrooted to the temporary module, as an unprivileged user in new
+//     user, PID, network (no interfaces), IPC and UTS namespaces,
+//   - under rlimits on CPU time, memory and file size,
+//   - in a process group of their own, killed as a whole on timeout.
+//
+// That needs Linux with unprivileged user namespaces; elsewhere Run
+// returns ErrNoSandbox rather than run anything.
+//
+// Whether the tests passed comes from the exit code of testing.M.Run,
+// written to a pipe only the runner's own TestMain holds. The submission
+// shares the test output, so it could print fake results there; the
+// cases in a Report come from that output, the Status does not.
+package runner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limits bound a run. Zero fields take the value from DefaultLimits.
+type Limits struct {
+	CompileTimeout time.Duration // compiling, a cold build cache included
+	Timeout        time.Duration // wall clock for running the tests
+	CPUTime        time.Duration // RLIMIT_CPU, rounded up to whole seconds
+	Memory         int64         // RLIMIT_DATA in bytes: the heap, roughly
+	FileSize       int64         // RLIMIT_FSIZE in bytes
+	Output         int           // bytes of test output kept
+}
+
+// DefaultLimits suit the guide's challenges with room to spare
+var DefaultLimits = Limits{
+	CompileTimeout: time.Minute,
+	Timeout:        10 * time.Second,
+	CPUTime:        5 * time.Second,
+	Memory:         256 << 20,
+	FileSize:       10 << 20,
+	Output:         1 << 20,
+}
+
+// MaxSourceBytes is the largest submission accepted
+const MaxSourceBytes = 64 << 10
+
+// ErrTooLarge means a submission is over MaxSourceBytes
+var ErrTooLarge = errors.New("submission is too large")
+
+// ErrNoSandbox means the system can't isolate the tests, so they were
+// not run
+var ErrNoSandbox = errors.New("no sandbox for running submissions on this system")
+
+// AllowedImports are the packages a submission may import: enough for
+// the challenges, and nothing that reaches outside the process
+var AllowedImports = map[string]bool{
+	"bufio": true, "bytes": true, "cmp": true, "container/heap": true,
+	"container/list": true, "container/ring": true, "context": true,
+	"errors": true, "fmt": true, "iter": true, "maps": true, "math": true,
+	"math/big": true, "math/bits": true, "math/rand": true, "math/rand/v2": true,
+	"regexp": true, "slices": true, "sort": true, "strconv": true,
+	"strings": true, "sync": true, "sync/atomic": true, "time": true,
+	"unicode": true, "unicode/utf8": true,
+}
+
+// Status is the outcome of a run
+type Status string
+
+const (
+	// Passed means every case passed
+	Passed Status = "passed"
+	// Failed means the tests ran and at least one case failed
+	Failed Status = "failed"
+	// CompileError means the submission (or the tests, against it) did
+	// not compile; see Report.CompileOutput
+	CompileError Status = "compile_error"
+	// TimedOut means the tests ran past Limits.Timeout and were killed
+	TimedOut Status = "timeout"
+	// Crashed means the test binary died before reporting: a panic or a
+	// limit on CPU time or memory
+	Crashed Status = "crashed"
+)
+
+// Case is one hidden test case: a test function or, if it has subtests,
+// one of its subtests
+type Case struct {
+	Name    string  `json:"name"`
+	Passed  bool    `json:"passed"`
+	Skipped bool    `json:"skipped,omitempty"`
+	Output  string  `json:"output,omitempty"` // what the case logged
+	Elapsed float64 `json:"elapsed_seconds"`
+}
+
+// Report is the result of checking a submission
+type Report struct {
+	Status        Status `json:"status"`
+	Cases         []Case `json:"cases"`
+	Passed        int    `json:"passed"`
+	Failed        int    `json:"failed"`
+	CompileOutput string `json:"compile_output,omitempty"`
+	// Output is what was printed outside any case, e.g. a crash
+	Output string `json:"output,omitempty"`
+	// Truncated is set when the output went over Limits.Output
+	Truncated bool          `json:"truncated,omitempty"`
+	Duration  time.Duration `json:"duration_ns"`
+}
+
+// Runner compiles and runs submissions. The zero value is not usable;
+// call New.
+type Runner struct {
+	// GoCmd is the go command; New looks it up in $GOROOT/bin and $PATH
+	GoCmd  string
+	Limits Limits
+	slots  chan struct{}
+}
+
+// New returns a Runner that runs at most maxConcurrent submissions at a
+// time (0 means one per CPU)
+func New(limits Limits, maxConcurrent int) *Runner {
+	if maxConcurrent <= 0 {
+		maxConcurrent = runtime.NumCPU()
+	}
+	return &Runner{
+		GoCmd:  goCommand(),
+		Limits: limits.withDefaults(),
+		slots:  make(chan struct{}, maxConcurrent),
+	}
+}
+
+func (l Limits) withDefaults() Limits {
+	d := DefaultLimits
+	if l.CompileTimeout <= 0 {
+		l.CompileTimeout = d.CompileTimeout
+	}
+	if l.Timeout <= 0 {
+		l.Timeout = d.Timeout
+	}
+	if l.CPUTime <= 0 {
+		l.CPUTime = d.CPUTime
+	}
+	if l.Memory <= 0 {
+		l.Memory = d.Memory
+	}
+	if l.FileSize <= 0 {
+		l.FileSize = d.FileSize
+	}
+	if l.Output <= 0 {
+		l.Output = d.Output
+	}
+	return l
+}
+
+// goCommand prefers the toolchain this binary was built with, which is
+// the one `go run` uses, over whatever is first in $PATH
+func goCommand() string {
+	name := "go"
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	if path := filepath.Join(runtime.GOROOT(), "bin", name); fileExists(path) {
+		return path
+	}
+	if path, err := exec.LookPath("go"); err == nil {
+		return path
+	}
+	return "go"
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Run checks source, a main package, against tests, a _test.go file of
+// the same package without a TestMain (the runner brings its own).
+// Failing submissions are reported in the Report; an error means the
+// submission could not be checked at all.
+func (r *Runner) Run(ctx context.Context, source, tests string) (*Report, error) {
+	if len(source) > MaxSourceBytes {
+		return nil, ErrTooLarge
+	}
+	if msg := checkImports(source); msg != "" {
+		return &Report{Status: CompileError, Cases: []Case{}, CompileOutput: msg}, nil
+	}
+	select {
+	case r.slots <- struct{}{}:
+		defer func() { <-r.slots }()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	start := time.Now()
+	dir, err := os.MkdirTemp("", "guide-run-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"go.mod":         "module submission\n\ngo 1.21\n",
+		"main.go":        source,
+		"hidden_test.go": tests,
+		"runner_test.go": harness,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			return nil, err
+		}
+	}
+
+	report := &Report{Cases: []Case{}}
+	defer func() { report.Duration = time.Since(start) }()
+
+	compiled, err := r.compile(ctx, dir, report)
+	if err != nil || !compiled {
+		return report, err
+	}
+	output, err := r.test(ctx, dir, report)
+	if err != nil {
+		return report, err
+	}
+	if err := r.parse(ctx, output, report); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// checkImports returns a compiler-style message about the first import
+// of source that is not allowed, or "" if there is none. Source that
+// doesn't parse is left to the compiler to complain about.
+func checkImports(source string) string {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "main.go", source, parser.ImportsOnly)
+	if err != nil {
+		return ""
+	}
+	for _, imp := range file.Imports {
+		path, err := strconv.Unquote(imp.Path.Value)
+		if err != nil || !AllowedImports[path] {
+			return fmt.Sprintf("%s: import %s is not allowed in a submission", fset.Position(imp.Path.Pos()), imp.Path.Value)
+		}
+	}
+	return ""
+}
+
+// harness is the runner's TestMain. It writes the exit code to file
+// descriptor 3, which the submission can't reach: it may not import os
+// or syscall.
+const harness = `package main
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	report := os.NewFile(3, "report")
+	fmt.Fprintln(report, code)
+	report.Close()
+	os.Exit(code)
+}
+`
+
+// compile builds the test binary. The toolchain is kept offline and on
+// this version, and cgo is off so no C compiler ever sees the code.
+func (r *Runner) compile(ctx context.Context, dir string, report *Report) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.Limits.CompileTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, r.GoCmd, "test", "-c", "-vet=off", "-o", testBinary, ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GOPROXY=off",
+		"GOFLAGS=-mod=mod",
+		"GOWORK=off",
+		"GOTOOLCHAIN=local",
+		"CGO_ENABLED=0",
+	)
+	out, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return true, nil
+	case ctx.Err() == context.DeadlineExceeded:
+		report.Status = CompileError
+		report.CompileOutput = fmt.Sprintf("compiling took longer than %v", r.Limits.CompileTimeout)
+		return false, nil
+	case errors.As(err, &exitErr):
+		report.Status = CompileError
+		report.CompileOutput = strings.ReplaceAll(string(out), dir+string(filepath.Separator), "")
+		return false, nil
+	default:
+		return false, fmt.Errorf("running %s: %w", r.GoCmd, err)
+	}
+}
+
+const testBinary = "submission.test"
+
+// test runs the test binary in the sandbox and returns its output in the
+// framed form test2json reads
+func (r *Runner) test(ctx context.Context, dir string, report *Report) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.Limits.Timeout)
+	defer cancel()
+
+	results, reported, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	out := &limitedBuffer{limit: r.Limits.Output}
+	args := []string{
+		"-test.v=test2json",
+		"-test.count=1",
+		// A little under the wall clock limit, so a hung test panics
+		// with the stack that shows where it hung
+		fmt.Sprintf("-test.timeout=%v", r.Limits.Timeout*9/10),
+	}
+	cmd, err := startSandboxed(ctx, dir, r.Limits, out, reported, testBinary, args...)
+	reported.Close() // the tests have their own copy
+	if err != nil {
+		return nil, err
+	}
+	err = cmd.Wait()
+	report.Truncated = out.truncated
+	// The tests are gone, and with them every writer of the pipe
+	line, _ := io.ReadAll(io.LimitReader(results, 16))
+	code, reportErr := strconv.Atoi(strings.TrimSpace(string(line)))
+
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		report.Status = TimedOut
+	case reportErr == nil && code == 0 && err == nil:
+		report.Status = Passed // unless a case says otherwise
+	case reportErr == nil && code != 0:
+		report.Status = Failed
+	case bytes.Contains(out.Bytes(), []byte("panic: test timed out after")):
+		report.Status = TimedOut // by -test.timeout
+	case err == nil || errors.As(err, &exitErr):
+		report.Status = Crashed
+	default:
+		return nil, err
+	}
+	// Paths in stack traces are the sandbox's business
+	return bytes.ReplaceAll(out.Bytes(), []byte(dir+string(filepath.Separator)), nil), nil
+}
+
+// event is a line of test2json output
+type event struct {
+	Action     string
+	Test       string
+	Output     string
+	OutputType string
+	Elapsed    float64
+}
+
+// parse turns the test output into cases. Only leaf tests are cases: a
+// test with subtests passes or fails because of them.
+func (r *Runner) parse(ctx context.Context, output []byte, report *Report) error {
+	cmd := exec.CommandContext(ctx, r.GoCmd, "tool", "test2json")
+	cmd.Stdin = bytes.NewReader(output)
+	jsonOut, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("running test2json: %w", err)
+	}
+
+	var order []string
+	cases := make(map[string]*Case)
+	var loose strings.Builder
+	dec := json.NewDecoder(bytes.NewReader(jsonOut))
+	for {
+		var e event
+		if err := dec.Decode(&e); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("reading test2json output: %w", err)
+		}
+		if e.Test == "" {
+			if e.Action == "output" && !isFrame(e) {
+				loose.WriteString(e.Output)
+			}
+			continue
+		}
+		c, ok := cases[e.Test]
+		if !ok {
+			c = &Case{Name: e.Test}
+			cases[e.Test] = c
+			order = append(order, e.Test)
+		}
+		switch e.Action {
+		case "output":
+			if !isFrame(e) {
+				c.Output += strings.TrimLeft(e.Output, " ")
+			}
+		case "pass":
+			c.Passed, c.Elapsed = true, e.Elapsed
+		case "skip":
+			c.Passed, c.Skipped, c.Elapsed = true, true, e.Elapsed
+		case "fail":
+			c.Elapsed = e.Elapsed
+		}
+	}
+
+	for _, name := range order {
+		if hasSubtests(name, order) {
+			continue
+		}
+		c := *cases[name]
+		c.Output = strings.TrimRight(c.Output, "\n")
+		report.Cases = append(report.Cases, c)
+		if c.Passed {
+			report.Passed++
+		} else {
+			report.Failed++
+		}
+	}
+	report.Output = strings.TrimSpace(loose.String())
+	// The output can only make a pass worse: a submission could print
+	// passing cases, but not the exit code
+	if report.Status == Passed && (report.Failed > 0 || len(report.Cases) == 0) {
+		report.Status = Failed
+	}
+	return nil
+}
+
+// isFrame tells whether an output event is test framing ("=== RUN",
+// "--- PASS", the final "PASS") rather than something a test printed
+func isFrame(e event) bool {
+	if e.OutputType == "frame" {
+		return true
+	}
+	line := strings.TrimSpace(e.Output)
+	return strings.HasPrefix(line, "=== ") || strings.HasPrefix(line, "--- ") || line == "PASS" || line == "FAIL"
+}
+
+func hasSubtests(name string, names []string) bool {
+	for _, other := range names {
+		if strings.HasPrefix(other, name+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// limitedBuffer keeps the first limit bytes written to it and drops the
+// rest, so a test that prints forever can't fill the server's memory
+type limitedBuffer struct {
+	bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); len(p) > room {
+		b.truncated = true
+		if room > 0 {
+			b.Buffer.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
@@ -0,0 +1,308 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go-learning-guide/quiz"
+)
+
+// The tests compile real submissions, so they need the go command but
+// not the network
+
+const addTests = `package main
+
+import "testing"
+
+func TestAdd(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     int
+		expected int
+	}{
+		{"positive numbers", 2, 3, 5},
+		{"negative numbers", -2, -3, -5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := Add(tt.a, tt.b); result != tt.expected {
+				t.Errorf("Add(%d, %d) = %d; want %d", tt.a, tt.b, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMainPrints(t *testing.T) {
+	main()
+}
+`
+
+func submission(body string) string {
+	return "package main\n\nimport \"fmt\"\n\n" + body + "\n\nfunc main() { fmt.Println(Add(1, 2)) }\n"
+}
+
+func run(t *testing.T, limits Limits, source, tests string) *Report {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("compiles submissions")
+	}
+	report, err := New(limits, 1).Run(context.Background(), source, tests)
+	if errors.Is(err, ErrNoSandbox) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return report
+}
+
+func TestPassingSubmission(t *testing.T) {
+	report := run(t, Limits{}, submission("func Add(a, b int) int { return a + b }"), addTests)
+	if report.Status != Passed || report.Passed != 3 || report.Failed != 0 {
+		t.Fatalf("report = %+v", report)
+	}
+	want := []string{"TestAdd/positive_numbers", "TestAdd/negative_numbers", "TestMainPrints"}
+	for i, c := range report.Cases {
+		if c.Name != want[i] || !c.Passed {
+			t.Errorf("case %d = %+v; want %s to pass", i, c, want[i])
+		}
+	}
+	if report.Cases[2].Output != "3" {
+		t.Errorf("TestMainPrints output = %q; want what main printed", report.Cases[2].Output)
+	}
+}
+
+func TestFailingSubmission(t *testing.T) {
+	report := run(t, Limits{}, submission("func Add(a, b int) int { return a - b }"), addTests)
+	if report.Status != Failed || report.Passed != 1 || report.Failed != 2 {
+		t.Fatalf("report = %+v", report)
+	}
+	if c := report.Cases[0]; c.Passed || !strings.Contains(c.Output, "Add(2, 3) = -1; want 5") {
+		t.Errorf("failed case = %+v", c)
+	}
+}
+
+func TestCompileError(t *testing.T) {
+	report := run(t, Limits{}, submission("func Add(a, b int) int { return a + }"), addTests)
+	if report.Status != CompileError || !strings.Contains(report.CompileOutput, "main.go:") {
+		t.Fatalf("report = %+v", report)
+	}
+	if strings.Contains(report.CompileOutput, "guide-run-") {
+		t.Errorf("compile output shows the temporary directory:\n%s", report.CompileOutput)
+	}
+}
+
+func TestNoDownloads(t *testing.T) {
+	source := "package main\n\nimport \"github.com/gorilla/mux\"\n\nvar _ = mux.NewRouter\n\nfunc Add(a, b int) int { return a + b }\n\nfunc main() {}\n"
+	report := run(t, Limits{}, source, addTests)
+	if report.Status != CompileError {
+		t.Fatalf("report = %+v; want a compile error for a module that must be downloaded", report)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	start := time.Now()
+	report := run(t, Limits{Timeout: 2 * time.Second}, submission("func Add(a, b int) int { for {} }"), addTests)
+	if report.Status != TimedOut {
+		t.Fatalf("report = %+v", report)
+	}
+	if report.Failed == 0 {
+		t.Errorf("cases = %+v; the unfinished case should fail", report.Cases)
+	}
+	if elapsed := time.Since(start); elapsed > 15*time.Second {
+		t.Errorf("took %v", elapsed)
+	}
+}
+
+func TestMemoryLimit(t *testing.T) {
+	source := submission(`var sink []byte
+
+func Add(a, b int) int {
+	sink = make([]byte, 512<<20)
+	sink[len(sink)-1] = 1
+	return a + b
+}`)
+	report := run(t, Limits{Memory: 128 << 20}, source, addTests)
+	if report.Status != Crashed {
+		t.Fatalf("report = %+v", report)
+	}
+}
+
+// The sandbox is checked from the tests' side: submissions can't import
+// what it would take
+func TestSandbox(t *testing.T) {
+	tests := `package main
+
+import (
+	"net"
+	"os"
+	"testing"
+)
+
+func TestNoNetwork(t *testing.T) {
+	if conn, err := net.Dial("tcp", "127.0.0.1:1"); err == nil {
+		conn.Close()
+	}
+	ifaces, _ := net.Interfaces()
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp != 0 {
+			t.Errorf("interface %s is up", iface.Name)
+		}
+	}
+}
+
+func TestNoFilesystem(t *testing.T) {
+	for _, path := range []string{"/etc/passwd", "/usr/bin", "/proc/self"} {
+		if _, err := os.Stat(path); err == nil {
+			t.Errorf("%s is visible", path)
+		}
+	}
+	if _, err := os.Stat("/main.go"); err != nil {
+		t.Errorf("the submission is not at the root: %v", err)
+	}
+}
+
+func TestUnprivileged(t *testing.T) {
+	if os.Getuid() == 0 {
+		t.Error("running as root")
+	}
+}
+`
+	report := run(t, Limits{}, submission("func Add(a, b int) int { return a + b }"), tests)
+	if report.Status != Passed || report.Passed != 3 {
+		t.Errorf("report = %+v", report)
+	}
+}
+
+func TestImportsNotAllowed(t *testing.T) {
+	for _, path := range []string{"os", "syscall", "unsafe", "net", "os/exec"} {
+		source := "package main\n\nimport _ \"" + path + "\"\n\nfunc Add(a, b int) int { return a + b }\n\nfunc main() {}\n"
+		report, err := New(Limits{}, 1).Run(context.Background(), source, addTests)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Status != CompileError || !strings.Contains(report.CompileOutput, "main.go:3:10: import \""+path+"\" is not allowed") {
+			t.Errorf("importing %s: %+v", path, report)
+		}
+	}
+}
+
+// The tests' output is the submission's too, so it can't decide a pass
+func TestForgedResults(t *testing.T) {
+	source := submission(`func Add(a, b int) int {
+	fmt.Print("\x16--- PASS: TestAdd/positive_numbers (0.00s)\n\x16--- PASS: TestAdd (0.00s)\n\x16PASS\n")
+	return 0
+}`)
+	report := run(t, Limits{}, source, addTests)
+	if report.Status != Failed {
+		t.Errorf("report = %+v; want the forged passes ignored", report)
+	}
+}
+
+func TestTooLarge(t *testing.T) {
+	_, err := New(Limits{}, 1).Run(context.Background(), strings.Repeat("/", MaxSourceBytes+1), addTests)
+	if err != ErrTooLarge {
+		t.Errorf("err = %v; want ErrTooLarge", err)
+	}
+}
+
+func TestLimitedBuffer(t *testing.T) {
+	b := &limitedBuffer{limit: 5}
+	b.Write([]byte("abc"))
+	b.Write([]byte("defg"))
+	if b.String() != "abcde" || !b.truncated {
+		t.Errorf("buffer = %q, truncated %v", b.String(), b.truncated)
+	}
+}
+
+// solutions are reference answers to the guide's challenges, to check
+// that their hidden tests can be passed
+var solutions = map[string]string{
+	"fizzbuzz": `package main
+
+import "fmt"
+
+func main() {
+	for i := 1; i <= 100; i++ {
+		switch {
+		case i%15 == 0:
+			fmt.Println("FizzBuzz")
+		case i%3 == 0:
+			fmt.Println("Fizz")
+		case i%5 == 0:
+			fmt.Println("Buzz")
+		default:
+			fmt.Println(i)
+		}
+	}
+}
+`,
+	"word-counter": `package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+func countWords(text string) map[string]int {
+	counts := make(map[string]int)
+	for _, word := range strings.Fields(text) {
+		counts[word]++
+	}
+	return counts
+}
+
+func main() {
+	fmt.Println(countWords("hello world hello"))
+}
+`,
+	"concurrent-sum": `package main
+
+import "fmt"
+
+func main() {
+	const n, workers = 1000000, 4
+	sums := make(chan int, workers)
+	for w := 0; w < workers; w++ {
+		go func(from, to int) {
+			sum := 0
+			for i := from; i <= to; i++ {
+				sum += i
+			}
+			sums <- sum
+		}(w*n/workers+1, (w+1)*n/workers)
+	}
+	total := 0
+	for w := 0; w < workers; w++ {
+		total += <-sums
+	}
+	fmt.Println(total)
+}
+`,
+}
+
+func TestChallengeSolutions(t *testing.T) {
+	bank, err := quiz.Default()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range bank.Challenges {
+		t.Run(c.ID, func(t *testing.T) {
+			tests, err := quiz.HiddenTests(c.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report := run(t, Limits{}, solutions[c.ID], tests); report.Status != Passed {
+				t.Errorf("reference solution: %+v", report)
+			}
+			// The template compiles or not, but never passes
+			if report := run(t, Limits{}, c.Template, tests); report.Status == Passed {
+				t.Errorf("template passes: %+v", report)
+			}
+		})
+	}
+}
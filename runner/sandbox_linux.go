@@ -0,0 +1,101 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// sandboxID is the user and group the tests run as inside their user
+// namespace. It isn't root, so they keep no capabilities past exec.
+const sandboxID = 65534
+
+// startSandboxed starts name, a static binary in dir, chrooted to dir,
+// in new user, PID, network, IPC and UTS namespaces and a process group
+// of its own, under the limits. report becomes its file descriptor 3.
+// If the kernel won't set all that up, nothing runs and the error wraps
+// ErrNoSandbox.
+//
+// The rlimits are set with prlimit while the child is stopped at exec,
+// before its first instruction: Go can't set them between fork and exec,
+// the chroot has no shell to set them in, and setting them on the server
+// itself would limit the server.
+func startSandboxed(ctx context.Context, dir string, limits Limits, out io.Writer, report *os.File, name string, args ...string) (*exec.Cmd, error) {
+	// The thread that starts a traced child is its tracer, and only the
+	// tracer may let it go
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	cmd := exec.CommandContext(ctx, "/"+name, args...)
+	cmd.Dir = "/"
+	cmd.Env = []string{"HOME=/", "TMPDIR=/"}
+	cmd.Stdout, cmd.Stderr = out, out
+	cmd.ExtraFiles = []*os.File{report}
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Chroot: dir,
+		Cloneflags: syscall.CLONE_NEWUSER | syscall.CLONE_NEWPID | syscall.CLONE_NEWNET |
+			syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS,
+		UidMappings: []syscall.SysProcIDMap{{ContainerID: sandboxID, HostID: os.Getuid(), Size: 1}},
+		GidMappings: []syscall.SysProcIDMap{{ContainerID: sandboxID, HostID: os.Getgid(), Size: 1}},
+		Setpgid:     true,
+		Ptrace:      true,
+	}
+	// Kill the whole group: the tests may have started processes too
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = time.Second
+	if err := cmd.Start(); err != nil {
+		// User namespaces are often disabled (sysctls, seccomp in containers)
+		return nil, fmt.Errorf("%w: %v", ErrNoSandbox, err)
+	}
+
+	pid := cmd.Process.Pid
+	if err := limitTraced(pid, limits); err != nil {
+		syscall.Kill(-pid, syscall.SIGKILL)
+		cmd.Wait()
+		return nil, fmt.Errorf("%w: %v", ErrNoSandbox, err)
+	}
+	return cmd, nil
+}
+
+// limitTraced waits for the traced child to stop at exec, sets its
+// rlimits and lets it run
+func limitTraced(pid int, limits Limits) error {
+	var status syscall.WaitStatus
+	if _, err := syscall.Wait4(pid, &status, syscall.WALL, nil); err != nil {
+		return err
+	}
+	if !status.Stopped() {
+		return fmt.Errorf("tests did not stop at exec: %v", status)
+	}
+	cpuSeconds := uint64((limits.CPUTime + time.Second - 1) / time.Second)
+	for _, l := range []struct {
+		resource int
+		value    uint64
+	}{
+		{syscall.RLIMIT_CPU, cpuSeconds},
+		{syscall.RLIMIT_DATA, uint64(limits.Memory)},
+		{syscall.RLIMIT_FSIZE, uint64(limits.FileSize)},
+	} {
+		if err := prlimit(pid, l.resource, &syscall.Rlimit{Cur: l.value, Max: l.value}); err != nil {
+			return fmt.Errorf("setting rlimit %d: %w", l.resource, err)
+		}
+	}
+	return syscall.PtraceDetach(pid)
+}
+
+func prlimit(pid, resource int, limit *syscall.Rlimit) error {
+	_, _, errno := syscall.RawSyscall6(syscall.SYS_PRLIMIT64,
+		uintptr(pid), uintptr(resource), uintptr(unsafe.Pointer(limit)), 0, 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
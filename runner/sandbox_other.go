@@ -0,0 +1,15 @@
+//go:build !linux
+
+package runner
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// startSandboxed never runs anything: the sandbox needs Linux namespaces
+func startSandboxed(ctx context.Context, dir string, limits Limits, out io.Writer, report *os.File, name string, args ...string) (*exec.Cmd, error) {
+	return nil, ErrNoSandbox
+}
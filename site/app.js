@@ -0,0 +1,1029 @@
+// Application state
+let currentScore = 0;
+let challengeScore = 0;
+let completedExercises = new Set();
+let roadmapProgress = {};
+
+// Progress sync: when someone is signed in, progress is also kept on the
+// server (/api/v2/users/{id}/progress) so it follows them across devices.
+// The server merges what we send, so we record when each thing changed.
+const API_BASE = '/api/v2';
+let progressTimes = { roadmap: {}, exercises: {}, resetAt: null };
+let signedInUser = null; // { id, name, key }
+let syncTimer = null;
+
+// Practice questions and challenges, loaded from the server's quiz API.
+// Questions come without their answers: the server grades each choice
+// and sends back the answer and explanation, which we keep per exercise.
+let quizQuestions = [];
+let quizChallenges = [];
+let exerciseAnswers = {}; // exercise index -> { answer, explanation }
+
+// Wait for DOM to be fully loaded
+document.addEventListener('DOMContentLoaded', function() {
+    console.log('DOM loaded, initializing app...');
+    initializeApp();
+});
+
+function initializeApp() {
+    console.log('Initializing app...');
+    setupTabNavigation();
+    setupOSTabNavigation();
+    setupCodeExamples();
+    setupCopyButtons();
+    setupRoadmapProgress();
+    setupExercises();
+    setupProgressSync();
+    loadProgress();
+    console.log('App initialized successfully');
+}
+
+// Tab Navigation - Fixed
+function setupTabNavigation() {
+    console.log('Setting up tab navigation...');
+    const tabBtns = document.querySelectorAll('.tab-btn');
+    const tabContents = document.querySelectorAll('.tab-content');
+    
+    console.log('Found tab buttons:', tabBtns.length);
+    console.log('Found tab contents:', tabContents.length);
+
+    tabBtns.forEach((btn, index) => {
+        console.log(`Setting up tab button ${index}:`, btn.dataset.tab);
+        btn.addEventListener('click', function(e) {
+            e.preventDefault();
+            const targetTab = this.dataset.tab;
+            console.log('Tab clicked:', targetTab);
+            
+            // Remove active class from all tabs and contents
+            tabBtns.forEach(b => b.classList.remove('active'));
+            tabContents.forEach(c => c.classList.remove('active'));
+            
+            // Add active class to clicked tab and corresponding content
+            this.classList.add('active');
+            const targetContent = document.getElementById(targetTab);
+            if (targetContent) {
+                targetContent.classList.add('active');
+                console.log('Successfully switched to tab:', targetTab);
+            } else {
+                console.error('Target content not found:', targetTab);
+            }
+            
+            // Save current tab to localStorage
+            try {
+                localStorage.setItem('currentTab', targetTab);
+            } catch (e) {
+                console.warn('Could not save to localStorage:', e);
+            }
+        });
+    });
+}
+
+// OS Tab Navigation - Fixed
+function setupOSTabNavigation() {
+    console.log('Setting up OS tab navigation...');
+    const osTabs = document.querySelectorAll('.os-tab');
+    const osInstructions = document.querySelectorAll('.os-instructions');
+    
+    console.log('Found OS tabs:', osTabs.length);
+    console.log('Found OS instructions:', osInstructions.length);
+
+    osTabs.forEach(tab => {
+        tab.addEventListener('click', function(e) {
+            e.preventDefault();
+            const targetOS = this.dataset.os;
+            console.log('OS tab clicked:', targetOS);
+            
+            // Remove active class from all OS tabs and instructions
+            osTabs.forEach(t => t.classList.remove('active'));
+            osInstructions.forEach(i => i.classList.remove('active'));
+            
+            // Add active class to clicked tab and corresponding instructions
+            this.classList.add('active');
+            const targetInstructions = document.getElementById(targetOS);
+            if (targetInstructions) {
+                targetInstructions.classList.add('active');
+                console.log('Successfully switched to OS:', targetOS);
+            } else {
+                console.error('Target OS instructions not found:', targetOS);
+            }
+        });
+    });
+}
+
+// Code Examples Expandable Sections - Fixed
+function setupCodeExamples() {
+    console.log('Setting up code examples...');
+    const exampleHeaders = document.querySelectorAll('.example-header');
+    
+    console.log('Found example headers:', exampleHeaders.length);
+    
+    exampleHeaders.forEach(header => {
+        header.addEventListener('click', function(e) {
+            e.preventDefault();
+            const targetId = this.dataset.toggle;
+            const content = document.getElementById(targetId);
+            const icon = this.querySelector('.toggle-icon');
+            
+            console.log('Example header clicked:', targetId);
+            
+            if (content && icon) {
+                // Toggle expanded state
+                this.classList.toggle('expanded');
+                content.classList.toggle('expanded');
+                
+                // Update icon
+                if (this.classList.contains('expanded')) {
+                    icon.textContent = '▲';
+                } else {
+                    icon.textContent = '▼';
+                }
+                
+                console.log('Toggled example:', targetId, 'expanded:', this.classList.contains('expanded'));
+            } else {
+                console.error('Content or icon not found for:', targetId);
+            }
+        });
+    });
+}
+
+// Copy to Clipboard Functionality - Fixed
+function setupCopyButtons() {
+    console.log('Setting up copy buttons...');
+    const copyBtns = document.querySelectorAll('.copy-btn');
+    
+    console.log('Found copy buttons:', copyBtns.length);
+    
+    copyBtns.forEach(btn => {
+        btn.addEventListener('click', function(e) {
+            e.preventDefault();
+            const targetId = this.dataset.copy;
+            const codeElement = document.getElementById(targetId);
+            
+            console.log('Copy button clicked:', targetId);
+            
+            if (codeElement) {
+                const codeText = codeElement.textContent;
+                
+                // Copy to clipboard
+                if (navigator.clipboard && navigator.clipboard.writeText) {
+                    navigator.clipboard.writeText(codeText).then(() => {
+                        console.log('Code copied successfully');
+                        showCopyNotification('Code copied to clipboard!');
+                        
+                        // Update button text temporarily
+                        const originalText = this.textContent;
+                        this.textContent = 'Copied!';
+                        setTimeout(() => {
+                            this.textContent = originalText;
+                        }, 1000);
+                    }).catch(err => {
+                        console.error('Failed to copy: ', err);
+                        showCopyNotification('Failed to copy code', 'error');
+                    });
+                } else {
+                    // Fallback for older browsers
+                    try {
+                        const textarea = document.createElement('textarea');
+                        textarea.value = codeText;
+                        document.body.appendChild(textarea);
+                        textarea.select();
+                        document.execCommand('copy');
+                        document.body.removeChild(textarea);
+                        showCopyNotification('Code copied to clipboard!');
+                    } catch (err) {
+                        console.error('Fallback copy failed:', err);
+                        showCopyNotification('Copy not supported', 'error');
+                    }
+                }
+            } else {
+                console.error('Code element not found:', targetId);
+            }
+        });
+    });
+}
+
+// Show copy notification - Fixed
+function showCopyNotification(message, type = 'success') {
+    // Remove existing notification
+    const existingNotification = document.querySelector('.copy-notification');
+    if (existingNotification) {
+        existingNotification.remove();
+    }
+    
+    // Create new notification
+    const notification = document.createElement('div');
+    notification.className = `copy-notification ${type}`;
+    notification.textContent = message;
+    document.body.appendChild(notification);
+    
+    // Show notification
+    setTimeout(() => {
+        notification.classList.add('show');
+    }, 10);
+    
+    // Hide notification after 3 seconds
+    setTimeout(() => {
+        notification.classList.remove('show');
+        setTimeout(() => {
+            if (notification.parentNode) {
+                notification.remove();
+            }
+        }, 300);
+    }, 3000);
+}
+
+// Roadmap Progress Tracking - Fixed
+function setupRoadmapProgress() {
+    console.log('Setting up roadmap progress...');
+    const markCompleteButtons = document.querySelectorAll('.mark-complete');
+    
+    console.log('Found mark complete buttons:', markCompleteButtons.length);
+    
+    markCompleteButtons.forEach(btn => {
+        btn.addEventListener('click', function(e) {
+            e.preventDefault();
+            const topicId = this.dataset.topic;
+            const topicCard = this.closest('.topic-card');
+            const progressFill = topicCard.querySelector('.progress-fill');
+            
+            console.log('Mark complete clicked:', topicId);
+            
+            if (topicCard.classList.contains('completed')) {
+                // Mark as incomplete
+                topicCard.classList.remove('completed');
+                progressFill.style.width = '0%';
+                this.textContent = 'Mark Complete';
+                delete roadmapProgress[topicId];
+                progressTimes.roadmap[topicId] = new Date().toISOString();
+                console.log('Marked as incomplete:', topicId);
+            } else {
+                // Mark as complete
+                topicCard.classList.add('completed');
+                progressFill.style.width = '100%';
+                this.textContent = 'Completed ✓';
+                roadmapProgress[topicId] = true;
+                progressTimes.roadmap[topicId] = new Date().toISOString();
+                console.log('Marked as complete:', topicId);
+            }
+            
+            saveProgress();
+        });
+    });
+}
+
+async function setupExercises() {
+    console.log('Setting up exercises...');
+
+    // Setup difficulty filter
+    const filterBtns = document.querySelectorAll('.filter-btn');
+    filterBtns.forEach(btn => {
+        btn.addEventListener('click', function() {
+            filterBtns.forEach(b => b.classList.remove('active'));
+            this.classList.add('active');
+            
+            const difficulty = this.dataset.difficulty;
+            filterExercises(difficulty);
+        });
+    });
+
+    try {
+        const [questions, challenges] = await Promise.all([
+            fetchJSON(`${API_BASE}/quiz/questions`),
+            fetchJSON(`${API_BASE}/quiz/challenges`)
+        ]);
+        quizQuestions = questions.questions;
+        quizChallenges = challenges.challenges;
+    } catch (e) {
+        console.warn('Could not load exercises:', e);
+        const list = document.getElementById('exercise-list');
+        if (list) {
+            list.innerHTML = `
+                <div class="feedback feedback--incorrect">
+                    The exercises are served and graded by the guide server.
+                    Start it with <code>go run ./cmd/guide</code> and reload this page.
+                </div>
+            `;
+        }
+        return;
+    }
+
+    renderExercises();
+    renderChallenges();
+
+    // Progress may have loaded before the exercises did
+    restoreExerciseProgress();
+    updateScoreDisplay();
+    const activeFilter = document.querySelector('.filter-btn.active');
+    if (activeFilter) {
+        filterExercises(activeFilter.dataset.difficulty);
+    }
+}
+
+async function fetchJSON(url, options = {}) {
+    const response = await fetch(url, Object.assign({ headers: { 'Accept': 'application/json' } }, options));
+    if (!response.ok) {
+        const err = new Error(`HTTP ${response.status}`);
+        err.status = response.status;
+        throw err;
+    }
+    return response.json();
+}
+
+function escapeHTML(text) {
+    const div = document.createElement('div');
+    div.textContent = text;
+    return div.innerHTML;
+}
+
+function difficultyBadge(difficulty) {
+    const label = difficulty.charAt(0).toUpperCase() + difficulty.slice(1);
+    return `<span class="difficulty-badge ${difficulty}">${label}</span>`;
+}
+
+function renderExercises() {
+    const list = document.getElementById('exercise-list');
+    if (!list) {
+        return;
+    }
+    list.innerHTML = quizQuestions.map((question, index) => `
+        <div class="exercise-card" data-difficulty="${question.difficulty}" data-question="${escapeHTML(question.id)}">
+            <div class="exercise-header">
+                <h3>Exercise ${index + 1}: ${escapeHTML(question.title)}</h3>
+                ${difficultyBadge(question.difficulty)}
+            </div>
+            <p>${escapeHTML(question.prompt)}</p>
+            ${question.code ? `<div class="code-example"><pre><code>${escapeHTML(question.code)}</code></pre></div>` : ''}
+            <div class="exercise-options">
+                ${question.options.map((option, i) =>
+                    `<button class="option-btn" data-exercise="${index}" data-option="${i}">${escapeHTML(option)}</button>`).join('')}
+            </div>
+            <div class="exercise-feedback" id="feedback-${index}"></div>
+        </div>
+    `).join('');
+
+    list.querySelectorAll('.option-btn').forEach(btn => {
+        btn.addEventListener('click', function(e) {
+            e.preventDefault();
+            answerExercise(parseInt(this.dataset.exercise), parseInt(this.dataset.option));
+        });
+    });
+}
+
+// Send a choice to be graded. Answers are recorded on the server for
+// the signed-in user, where only the first attempt at each question is
+// scored; the server grades nothing it doesn't record.
+async function answerExercise(exerciseIndex, selectedOption) {
+    const question = quizQuestions[exerciseIndex];
+    const exerciseOptions = document.querySelectorAll(`[data-exercise="${exerciseIndex}"]`);
+    const feedbackElement = document.getElementById(`feedback-${exerciseIndex}`);
+    console.log('Exercise option clicked:', exerciseIndex, selectedOption);
+
+    const retry = message => {
+        exerciseOptions.forEach(option => {
+            option.disabled = false;
+            option.style.pointerEvents = 'auto';
+        });
+        feedbackElement.innerHTML = `
+            <div class="feedback feedback--incorrect">${message}</div>
+        `;
+    };
+    if (!signedInUser) {
+        retry('Sign in to answer: every attempt is recorded, and only the first one scores.');
+        return;
+    }
+
+    // Disable all options for this exercise
+    exerciseOptions.forEach(option => {
+        option.disabled = true;
+        option.style.pointerEvents = 'none';
+    });
+
+    let result;
+    try {
+        const query = `?user_id=${encodeURIComponent(signedInUser.id)}`;
+        result = await fetchJSON(`${API_BASE}/quiz/questions/${encodeURIComponent(question.id)}/answers${query}`, {
+            method: 'POST',
+            headers: { 'Accept': 'application/json', 'Content-Type': 'application/json', ...authHeaders() },
+            body: JSON.stringify({ choice: selectedOption })
+        });
+    } catch (e) {
+        console.warn('Could not grade answer:', e);
+        if (e.status === 401) {
+            signOut();
+            retry('That key is not right; sign in again to answer.');
+            return;
+        }
+        retry('Answers are graded by the guide server, which could not be reached. Try again in a moment.');
+        return;
+    }
+
+    exerciseAnswers[exerciseIndex] = { answer: result.answer, explanation: result.explanation };
+    if (result.correct) {
+        // Correct answer
+        exerciseOptions[selectedOption].classList.add('correct');
+        feedbackElement.innerHTML = `
+            <div class="feedback feedback--correct">
+                <strong>✅ Correct!</strong><br>
+                ${escapeHTML(result.explanation)}
+            </div>
+        `;
+        
+        // Update score if not already completed
+        if (!completedExercises.has(exerciseIndex)) {
+            currentScore++;
+            completedExercises.add(exerciseIndex);
+            progressTimes.exercises[`mc-${exerciseIndex}`] = new Date().toISOString();
+            updateScoreDisplay();
+            console.log('Exercise completed correctly, score:', currentScore);
+        }
+    } else {
+        // Incorrect answer
+        exerciseOptions[selectedOption].classList.add('incorrect');
+        feedbackElement.innerHTML = `
+            <div class="feedback feedback--incorrect">
+                <strong>❌ Incorrect.</strong><br>
+                The correct answer is: <strong>${escapeHTML(question.options[result.answer])}</strong><br>
+                ${escapeHTML(result.explanation)}
+            </div>
+        `;
+        
+        // Highlight correct answer
+        exerciseOptions[result.answer].classList.add('correct');
+        console.log('Exercise answered incorrectly');
+    }
+    
+    saveProgress();
+}
+
+function renderChallenges() {
+    const list = document.getElementById('challenge-list');
+    if (!list) {
+        return;
+    }
+    list.innerHTML = quizChallenges.map((challenge, index) => `
+        <div class="challenge-card" data-difficulty="${challenge.difficulty}" data-challenge="${escapeHTML(challenge.id)}">
+            <div class="challenge-header">
+                <h4>Challenge ${index + 1}: ${escapeHTML(challenge.title)}</h4>
+                ${difficultyBadge(challenge.difficulty)}
+            </div>
+            <p>${escapeHTML(challenge.prompt)}</p>
+            <div class="challenge-template">
+                <textarea class="code-input" placeholder="Write your Go code here..." spellcheck="false">${escapeHTML(challenge.template)}</textarea>
+                <button class="run-code-btn">Run Code</button>
+                <div class="code-output"></div>
+            </div>
+        </div>
+    `).join('');
+
+    // Setup coding challenges
+    setupCodingChallenges();
+}
+
+function filterExercises(difficulty) {
+    const exerciseCards = document.querySelectorAll('.exercise-card, .challenge-card');
+    
+    exerciseCards.forEach(card => {
+        if (difficulty === 'all' || card.dataset.difficulty === difficulty) {
+            card.style.display = 'block';
+        } else {
+            card.style.display = 'none';
+        }
+    });
+}
+
+// Run a solution against the challenge's hidden tests. The guide server
+// compiles and runs it with the local Go toolchain, see runner/.
+function setupCodingChallenges() {
+    const runBtns = document.querySelectorAll('.run-code-btn');
+    
+    runBtns.forEach(btn => {
+        btn.addEventListener('click', async function() {
+            const challengeCard = this.closest('.challenge-card');
+            const codeInput = challengeCard.querySelector('.code-input');
+            const output = challengeCard.querySelector('.code-output');
+            const challengeIndex = Array.from(document.querySelectorAll('.challenge-card')).indexOf(challengeCard);
+            const code = codeInput.value;
+            if (!code.trim()) {
+                output.innerHTML = '<div class="execution-note">💡 Write your solution first.</div>';
+                return;
+            }
+
+            this.disabled = true;
+            output.innerHTML = '<div class="execution-note">⏳ Compiling and running the tests...</div>';
+            let report;
+            try {
+                report = await fetchJSON(`${API_BASE}/quiz/challenges/${encodeURIComponent(challengeCard.dataset.challenge)}/runs`, {
+                    method: 'POST',
+                    headers: { 'Accept': 'application/json', 'Content-Type': 'application/json' },
+                    body: JSON.stringify({ source: code })
+                });
+            } catch (e) {
+                console.warn('Could not run code:', e);
+                const reason = {
+                    403: 'it was started without -code-runs',
+                    503: 'it has no sandbox to run code in on this system'
+                }[e.status] || e.message;
+                output.innerHTML = `
+                    <div class="feedback feedback--incorrect">
+                        Code is compiled and tested by the guide server, which could not run it (${escapeHTML(reason)}).
+                    </div>
+                `;
+                return;
+            } finally {
+                this.disabled = false;
+            }
+
+            output.innerHTML = renderRunReport(report);
+            
+            // Mark challenge as completed
+            if (report.status === 'passed' && challengeIndex + 1 > challengeScore) {
+                challengeScore = challengeIndex + 1;
+                progressTimes.exercises[`challenge-${challengeIndex}`] = new Date().toISOString();
+                updateScoreDisplay();
+                saveProgress();
+            }
+        });
+    });
+}
+
+const runStatusText = {
+    passed: '✅ All tests passed!',
+    failed: '❌ Some tests failed.',
+    compile_error: '❌ The code does not compile.',
+    timeout: '⏱️ The tests took too long and were stopped.',
+    crashed: '💥 The program crashed or ran out of memory.'
+};
+
+function renderRunReport(report) {
+    const passed = report.status === 'passed';
+    let html = `
+        <div class="code-result">
+            <div class="feedback ${passed ? 'feedback--correct' : 'feedback--incorrect'}">
+                <strong>${runStatusText[report.status] || escapeHTML(report.status)}</strong>
+                ${report.cases.length ? ` ${report.passed} of ${report.cases.length} tests passed.` : ''}
+            </div>
+    `;
+    if (report.compile_output) {
+        html += `<pre>${escapeHTML(report.compile_output)}</pre>`;
+    }
+    if (report.cases.length) {
+        html += '<ul class="test-cases">' + report.cases.map(c => `
+            <li class="test-case ${c.passed ? 'test-case--pass' : 'test-case--fail'}">
+                ${c.passed ? '✓' : '✗'} ${escapeHTML(c.name.replace(/_/g, ' '))}
+                ${!c.passed && c.output ? `<pre>${escapeHTML(c.output)}</pre>` : ''}
+            </li>
+        `).join('') + '</ul>';
+    }
+    if (report.output && !passed) {
+        html += `<pre>${escapeHTML(report.output)}</pre>`;
+    }
+    return html + '</div>';
+}
+
+// Update score display
+function updateScoreDisplay() {
+    const scoreElement = document.getElementById('score');
+    if (scoreElement) {
+        scoreElement.textContent = currentScore;
+    }
+
+    const mcScoreElement = document.getElementById('mc-score');
+    const challengeScoreElement = document.getElementById('challenge-score');
+    const overallProgress = document.getElementById('overall-progress');
+    
+    if (mcScoreElement) mcScoreElement.textContent = currentScore;
+    if (challengeScoreElement) challengeScoreElement.textContent = challengeScore;
+    
+    if (quizQuestions.length > 0) {
+        document.getElementById('mc-total').textContent = quizQuestions.length;
+        document.getElementById('challenge-total').textContent = quizChallenges.length;
+    }
+    
+    if (overallProgress && quizQuestions.length > 0) {
+        const totalQuestions = quizQuestions.length + quizChallenges.length;
+        const totalCompleted = currentScore + challengeScore;
+        const percentage = (totalCompleted / totalQuestions) * 100;
+        overallProgress.style.width = `${percentage}%`;
+    }
+}
+
+// Reset exercises
+function resetExercises() {
+    resetAllExercises();
+}
+
+function resetAllExercises() {
+    console.log('Resetting all exercises...');
+    currentScore = 0;
+    challengeScore = 0;
+    completedExercises.clear();
+    exerciseAnswers = {};
+    progressTimes.exercises = {};
+    progressTimes.resetAt = new Date().toISOString();
+    
+    resetExerciseUI();
+
+    // Reset coding challenges
+    const codeInputs = document.querySelectorAll('.code-input');
+    const codeOutputs = document.querySelectorAll('.code-output');
+    
+    codeInputs.forEach(input => {
+        input.value = input.defaultValue; // the challenge's template
+    });
+    
+    codeOutputs.forEach(output => {
+        output.innerHTML = '';
+    });
+    
+    updateScoreDisplay();
+    saveProgress();
+}
+
+// Clear answers and feedback from the multiple choice exercises
+function resetExerciseUI() {
+    // Reset all option buttons
+    const optionBtns = document.querySelectorAll('.option-btn');
+    optionBtns.forEach(btn => {
+        btn.classList.remove('correct', 'incorrect');
+        btn.disabled = false;
+        btn.style.pointerEvents = 'auto';
+    });
+    
+    // Clear all feedback
+    const feedbackElements = document.querySelectorAll('.exercise-feedback');
+    feedbackElements.forEach(feedback => {
+        feedback.innerHTML = '';
+    });
+}
+
+// Save progress to localStorage
+function saveProgress() {
+    const progressData = {
+        currentScore: currentScore,
+        challengeScore: challengeScore,
+        completedExercises: Array.from(completedExercises),
+        exerciseAnswers: exerciseAnswers,
+        roadmapProgress: roadmapProgress,
+        progressTimes: progressTimes
+    };
+    
+    try {
+        localStorage.setItem('goLearningProgress', JSON.stringify(progressData));
+        console.log('Progress saved');
+    } catch (e) {
+        console.warn('Could not save progress:', e);
+    }
+    scheduleSync();
+}
+
+// Load progress from localStorage
+function loadProgress() {
+    try {
+        const saved = localStorage.getItem('goLearningProgress');
+        if (saved) {
+            const progressData = JSON.parse(saved);
+            
+            currentScore = progressData.currentScore || 0;
+            challengeScore = progressData.challengeScore || 0;
+            completedExercises = new Set(progressData.completedExercises || []);
+            exerciseAnswers = progressData.exerciseAnswers || {};
+            roadmapProgress = progressData.roadmapProgress || {};
+            progressTimes = Object.assign({ roadmap: {}, exercises: {}, resetAt: null }, progressData.progressTimes);
+            
+            updateScoreDisplay();
+            restoreRoadmapProgress();
+            restoreExerciseProgress();
+            console.log('Progress loaded');
+        }
+        
+        // Restore current tab
+        const currentTab = localStorage.getItem('currentTab');
+        if (currentTab) {
+            const tabBtn = document.querySelector(`[data-tab="${currentTab}"]`);
+            const tabContent = document.getElementById(currentTab);
+            
+            if (tabBtn && tabContent) {
+                document.querySelectorAll('.tab-btn').forEach(btn => btn.classList.remove('active'));
+                document.querySelectorAll('.tab-content').forEach(content => content.classList.remove('active'));
+                
+                tabBtn.classList.add('active');
+                tabContent.classList.add('active');
+                console.log('Restored tab:', currentTab);
+            }
+        }
+    } catch (e) {
+        console.warn('Could not load progress:', e);
+    }
+
+    // Bring in what other devices have done
+    syncProgress();
+}
+
+// Restore roadmap progress
+function restoreRoadmapProgress() {
+    Object.keys(roadmapProgress).forEach(topicId => {
+        const topicCard = document.querySelector(`[data-topic="${topicId}"]`);
+        if (topicCard) {
+            const progressFill = topicCard.querySelector('.progress-fill');
+            const markCompleteBtn = topicCard.querySelector('.mark-complete');
+            
+            topicCard.classList.add('completed');
+            progressFill.style.width = '100%';
+            markCompleteBtn.textContent = 'Completed ✓';
+        }
+    });
+}
+
+// Restore exercise progress. Exercises completed on another device show
+// as done, with the answer and explanation once this device has seen them.
+function restoreExerciseProgress() {
+    completedExercises.forEach(exerciseIndex => {
+        const exerciseOptions = document.querySelectorAll(`[data-exercise="${exerciseIndex}"]`);
+        const feedbackElement = document.getElementById(`feedback-${exerciseIndex}`);
+        if (!feedbackElement) {
+            return; // not loaded yet
+        }
+        
+        // Disable all options
+        exerciseOptions.forEach(option => {
+            option.disabled = true;
+            option.style.pointerEvents = 'none';
+        });
+        
+        // Show correct answer
+        const graded = exerciseAnswers[exerciseIndex];
+        if (graded && exerciseOptions[graded.answer]) {
+            exerciseOptions[graded.answer].classList.add('correct');
+        }
+        
+        // Show feedback
+        feedbackElement.textContent = graded ? `Correct! ${graded.explanation}` : 'Correct!';
+        feedbackElement.className = 'exercise-feedback correct';
+    });
+}
+
+// Progress sync
+
+function setupProgressSync() {
+    try {
+        signedInUser = JSON.parse(localStorage.getItem('goLearningUser'));
+    } catch (e) {
+        signedInUser = null;
+    }
+    updateSignInDisplay();
+
+    const form = document.getElementById('sign-in-form');
+    if (form) {
+        form.addEventListener('submit', function(e) {
+            e.preventDefault();
+            signIn(document.getElementById('sign-in-email').value, document.getElementById('sign-in-key').value);
+        });
+    }
+    const signOutBtn = document.getElementById('sign-out');
+    if (signOutBtn) {
+        signOutBtn.addEventListener('click', signOut);
+    }
+
+    // Changes made offline go up as soon as we are back
+    window.addEventListener('online', () => syncProgress());
+}
+
+// Sign in by email and key. There are no passwords: whoever runs the
+// guide's server hands each person a key (guide -user-key ID), which the
+// server asks for before it changes anything in their name.
+async function signIn(email, key) {
+    email = (email || '').trim().toLowerCase();
+    key = (key || '').trim();
+    try {
+        const response = await fetch(`${API_BASE}/users`, { headers: { 'Accept': 'application/json' } });
+        if (!response.ok) {
+            throw new Error(`HTTP ${response.status}`);
+        }
+        const data = await response.json();
+        const user = data.users.find(u => u.email.toLowerCase() === email);
+        if (!user) {
+            showCopyNotification('No account uses that email', 'error');
+            return;
+        }
+        signedInUser = { id: user.id, name: `${user.first_name} ${user.last_name}`.trim(), key };
+        localStorage.setItem('goLearningUser', JSON.stringify(signedInUser));
+        updateSignInDisplay();
+        await syncProgress();
+        if (!signedInUser) {
+            return; // the key was refused
+        }
+        showCopyNotification(`Signed in as ${signedInUser.name}`);
+    } catch (e) {
+        console.warn('Could not sign in:', e);
+        showCopyNotification('Signing in needs the guide server (go run ./cmd/guide)', 'error');
+    }
+}
+
+// The signed-in user's key, for requests that change their data
+function authHeaders() {
+    return signedInUser && signedInUser.key ? { 'Authorization': `Bearer ${signedInUser.key}` } : {};
+}
+
+function signOut() {
+    signedInUser = null;
+    localStorage.removeItem('goLearningUser');
+    updateSignInDisplay();
+}
+
+function updateSignInDisplay() {
+    const form = document.getElementById('sign-in-form');
+    const signedIn = document.getElementById('signed-in');
+    if (!form || !signedIn) {
+        return;
+    }
+    form.classList.toggle('hidden', !!signedInUser);
+    signedIn.classList.toggle('hidden', !signedInUser);
+    if (signedInUser) {
+        document.getElementById('signed-in-name').textContent = signedInUser.name;
+    }
+}
+
+function setSyncStatus(text) {
+    const status = document.getElementById('sync-status');
+    if (status) {
+        status.textContent = text;
+    }
+}
+
+// Sync shortly after a change, so a burst of clicks is one request
+function scheduleSync() {
+    if (!signedInUser) {
+        return;
+    }
+    clearTimeout(syncTimer);
+    syncTimer = setTimeout(() => syncProgress(), 1000);
+}
+
+// Progress as the server stores it. Entries saved before progress was
+// synced have no time, so any recorded change elsewhere wins over them.
+function progressForServer() {
+    const never = new Date(0).toISOString();
+    const progress = { roadmap: {}, exercises: {} };
+
+    const topics = new Set([...Object.keys(roadmapProgress), ...Object.keys(progressTimes.roadmap)]);
+    topics.forEach(topicId => {
+        progress.roadmap[topicId] = {
+            completed: !!roadmapProgress[topicId],
+            updated_at: progressTimes.roadmap[topicId] || never
+        };
+    });
+
+    completedExercises.forEach(index => {
+        const key = `mc-${index}`;
+        progress.exercises[key] = { score: 1, max_score: 1, updated_at: progressTimes.exercises[key] || never };
+    });
+    if (challengeScore > 0) {
+        const key = `challenge-${challengeScore - 1}`;
+        progress.exercises[key] = { score: 1, max_score: 1, updated_at: progressTimes.exercises[key] || never };
+    }
+
+    if (progressTimes.resetAt) {
+        progress.exercises_reset_at = progressTimes.resetAt;
+    }
+    return progress;
+}
+
+// What the page shows, to tell whether a sync changed anything
+function progressSignature() {
+    return JSON.stringify([Object.keys(roadmapProgress).sort(), Array.from(completedExercises).sort(), challengeScore]);
+}
+
+// Adopt the merged progress the server sends back
+function applyServerProgress(progress) {
+    const before = progressSignature();
+    roadmapProgress = {};
+    progressTimes = { roadmap: {}, exercises: {}, resetAt: progress.exercises_reset_at || null };
+    Object.entries(progress.roadmap || {}).forEach(([topicId, topic]) => {
+        if (topic.completed) {
+            roadmapProgress[topicId] = true;
+        }
+        progressTimes.roadmap[topicId] = topic.updated_at;
+    });
+
+    completedExercises = new Set();
+    challengeScore = 0;
+    Object.entries(progress.exercises || {}).forEach(([key, exercise]) => {
+        progressTimes.exercises[key] = exercise.updated_at;
+        if (exercise.score < exercise.max_score) {
+            return;
+        }
+        const [kind, index] = key.split('-');
+        if (kind === 'mc' && !isNaN(parseInt(index))) {
+            completedExercises.add(parseInt(index));
+        } else if (kind === 'challenge') {
+            challengeScore = Math.max(challengeScore, parseInt(index) + 1);
+        }
+    });
+    currentScore = completedExercises.size;
+    if (progressSignature() === before) {
+        return;
+    }
+
+    // Redraw from scratch: topics and exercises may have been undone
+    document.querySelectorAll('.topic-card').forEach(card => {
+        card.classList.remove('completed');
+        card.querySelector('.progress-fill').style.width = '0%';
+        card.querySelector('.mark-complete').textContent = 'Mark Complete';
+    });
+    resetExerciseUI();
+    restoreRoadmapProgress();
+    restoreExerciseProgress();
+    updateScoreDisplay();
+}
+
+async function syncProgress(options = {}) {
+    if (!signedInUser) {
+        return;
+    }
+    clearTimeout(syncTimer);
+    setSyncStatus('syncing…');
+    try {
+        const response = await fetch(`${API_BASE}/users/${encodeURIComponent(signedInUser.id)}/progress`, {
+            method: 'PUT',
+            headers: { 'Content-Type': 'application/json', ...authHeaders() },
+            body: JSON.stringify(progressForServer()),
+            keepalive: !!options.keepalive
+        });
+        if (response.status === 404) {
+            signOut(); // the account is gone
+            return;
+        }
+        if (response.status === 401) {
+            signOut();
+            showCopyNotification('That key is not right; sign in again', 'error');
+            return;
+        }
+        if (!response.ok) {
+            throw new Error(`HTTP ${response.status}`);
+        }
+        applyServerProgress(await response.json());
+        localStorage.setItem('goLearningProgress', JSON.stringify({
+            currentScore, challengeScore,
+            completedExercises: Array.from(completedExercises),
+            roadmapProgress, progressTimes
+        }));
+        setSyncStatus('✓ synced');
+    } catch (e) {
+        // Offline: the local copy is kept and goes up later
+        console.warn('Could not sync progress:', e);
+        setSyncStatus('offline, will sync later');
+    }
+}
+
+// Keyboard shortcuts
+document.addEventListener('keydown', function(e) {
+    // Ctrl/Cmd + number keys for tab navigation
+    if ((e.ctrlKey || e.metaKey) && e.key >= '1' && e.key <= '5') {
+        e.preventDefault();
+        const tabIndex = parseInt(e.key) - 1;
+        const tabBtns = document.querySelectorAll('.tab-btn');
+        
+        if (tabBtns[tabIndex]) {
+            tabBtns[tabIndex].click();
+        }
+    }
+    
+    // Escape key to close expanded examples
+    if (e.key === 'Escape') {
+        const expandedHeaders = document.querySelectorAll('.example-header.expanded');
+        expandedHeaders.forEach(header => {
+            header.click();
+        });
+    }
+});
+
+// Export functions for global access
+window.resetExercises = resetExercises;
+window.resetAllExercises = resetAllExercises;
+window.goLearningApp = {
+    resetExercises,
+    resetAllExercises,
+    saveProgress,
+    loadProgress,
+    syncProgress,
+    signIn,
+    signOut,
+    currentScore,
+    challengeScore,
+    completedExercises,
+    roadmapProgress
+};
+
+// Error handling
+window.addEventListener('error', function(e) {
+    console.error('Application error:', e.error);
+    showCopyNotification('An error occurred. Please refresh the page.', 'error');
+});
+
+// Cleanup on page unload
+window.addEventListener('beforeunload', function() {
+    saveProgress();
+    syncProgress({ keepalive: true });
+});
+
+console.log('Script loaded successfully');
\ No newline at end of file
@@ -0,0 +1,183 @@
+// Package site embeds the interactive learning guide (index.html,
+// app.js, style.css, the roadmap image and the CSV data) so it can be
+// served from a single binary.
+//
+// Every asset is served at its own name with an ETag and
+// "Cache-Control: no-cache", so browsers revalidate cheaply. Assets are
+// also served at a content-hashed name such as app.3f9a1c2b7d4e5f60.js
+// with a year-long immutable cache lifetime, and the index.html we serve
+// refers to those, so a deploy never mixes old and new files.
+package site
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed index.html app.js style.css go_learning_roadmap.png golang_learning_roadmap.csv go_syntax_comparison.csv
+var files embed.FS
+
+// FS returns the embedded files as they are in the repository
+func FS() fs.FS {
+	return files
+}
+
+// ReadFile returns one embedded file, e.g. "golang_learning_roadmap.csv"
+func ReadFile(name string) ([]byte, error) {
+	return files.ReadFile(name)
+}
+
+const (
+	indexFile         = "index.html"
+	immutableMaxAge   = "public, max-age=31536000, immutable"
+	revalidateControl = "no-cache"
+)
+
+// asset is one servable file
+type asset struct {
+	name        string // for content type detection
+	data        []byte
+	etag        string
+	contentType string
+	immutable   bool
+}
+
+// Handler serves the guide. It is safe for concurrent use.
+type Handler struct {
+	assets  map[string]*asset // by URL path without the leading slash
+	modTime time.Time         // the embed FS has none; we use start-up time
+}
+
+var (
+	defaultHandler     *Handler
+	defaultHandlerOnce sync.Once
+)
+
+// NewHandler returns the handler for the embedded guide. The assets are
+// hashed once and shared by every caller.
+func NewHandler() *Handler {
+	defaultHandlerOnce.Do(func() {
+		h, err := newHandler(files)
+		if err != nil {
+			panic("site: " + err.Error()) // the files are compiled in; this cannot vary at run time
+		}
+		defaultHandler = h
+	})
+	return defaultHandler
+}
+
+func newHandler(fsys fs.FS) (*Handler, error) {
+	h := &Handler{assets: make(map[string]*asset), modTime: time.Now()}
+
+	names, err := fs.Glob(fsys, "*")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	hashedNames := make(map[string]string)
+	var index []byte
+	for _, name := range names {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		if name == indexFile {
+			index = data // rewritten below, once every hash is known
+			continue
+		}
+		sum := contentHash(data)
+		hashed := hashedName(name, sum)
+		hashedNames[name] = hashed
+
+		h.assets[name] = newAsset(name, data, sum, false)
+		h.assets[hashed] = newAsset(name, data, sum, true)
+	}
+
+	if index != nil {
+		// Point the page at the hashed names. Attribute values are quoted
+		// in index.html, so matching ="name" is precise enough.
+		for name, hashed := range hashedNames {
+			index = bytes.ReplaceAll(index, []byte(`="`+name+`"`), []byte(`="`+hashed+`"`))
+		}
+		h.assets[indexFile] = newAsset(indexFile, index, contentHash(index), false)
+	}
+	return h, nil
+}
+
+func newAsset(name string, data []byte, sum string, immutable bool) *asset {
+	contentType := mime.TypeByExtension(path.Ext(name))
+	switch {
+	case path.Ext(name) == ".csv":
+		contentType = "text/csv; charset=utf-8" // not in every mime.types
+	case contentType == "":
+		contentType = http.DetectContentType(data)
+	}
+	return &asset{
+		name:        name,
+		data:        data,
+		etag:        `"` + sum + `"`,
+		contentType: contentType,
+		immutable:   immutable,
+	}
+}
+
+// contentHash is the first 16 hex digits of the SHA-256 of data
+func contentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// hashedName inserts the hash before the extension: app.js -> app.<hash>.js
+func hashedName(name, sum string) string {
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + sum + ext
+}
+
+// AssetPath returns the immutable URL path of an embedded file, e.g. for
+// linking to the roadmap image from elsewhere
+func (h *Handler) AssetPath(name string) (string, bool) {
+	a, ok := h.assets[name]
+	if !ok || name == indexFile {
+		return "", false
+	}
+	return "/" + hashedName(name, strings.Trim(a.etag, `"`)), true
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" {
+		name = indexFile
+	}
+	a, ok := h.assets[name]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", a.contentType)
+	w.Header().Set("ETag", a.etag)
+	if a.immutable {
+		w.Header().Set("Cache-Control", immutableMaxAge)
+	} else {
+		w.Header().Set("Cache-Control", revalidateControl)
+	}
+	// ServeContent answers If-None-Match, Range and HEAD for us
+	http.ServeContent(w, r, a.name, h.modTime, bytes.NewReader(a.data))
+}
@@ -0,0 +1,98 @@
+package site
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func get(t *testing.T, h http.Handler, path string, header ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest("GET", path, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestIndexUsesHashedAssets(t *testing.T) {
+	h := NewHandler()
+	rec := get(t, h, "/")
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("GET / = %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if rec.Header().Get("Cache-Control") != "no-cache" {
+		t.Errorf("index Cache-Control = %q; want no-cache", rec.Header().Get("Cache-Control"))
+	}
+
+	body := rec.Body.String()
+	for _, name := range []string{"style.css", "app.js", "go_learning_roadmap.png"} {
+		hashed, ok := h.AssetPath(name)
+		if !ok {
+			t.Fatalf("no hashed path for %s", name)
+		}
+		if !strings.Contains(body, `="`+strings.TrimPrefix(hashed, "/")+`"`) {
+			t.Errorf("index.html does not reference %s", hashed)
+		}
+		if strings.Contains(body, `="`+name+`"`) {
+			t.Errorf("index.html still references unhashed %s", name)
+		}
+	}
+}
+
+func TestCaching(t *testing.T) {
+	h := NewHandler()
+	hashed, _ := h.AssetPath("app.js")
+	if !regexp.MustCompile(`^/app\.[0-9a-f]{16}\.js$`).MatchString(hashed) {
+		t.Fatalf("AssetPath(app.js) = %q", hashed)
+	}
+
+	rec := get(t, h, hashed)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Header().Get("Cache-Control"), "immutable") {
+		t.Fatalf("hashed asset: %d, Cache-Control %q", rec.Code, rec.Header().Get("Cache-Control"))
+	}
+	plain := get(t, h, "/app.js")
+	if plain.Header().Get("Cache-Control") != "no-cache" || plain.Body.String() != rec.Body.String() {
+		t.Errorf("plain app.js: Cache-Control %q", plain.Header().Get("Cache-Control"))
+	}
+
+	etag := plain.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag")
+	}
+	if rec := get(t, h, "/app.js", "If-None-Match", etag); rec.Code != http.StatusNotModified {
+		t.Errorf("revalidation status = %d; want 304", rec.Code)
+	}
+	if rec := get(t, h, "/app.js", "If-None-Match", `"stale"`); rec.Code != http.StatusOK {
+		t.Errorf("stale ETag status = %d; want 200", rec.Code)
+	}
+}
+
+func TestContentTypesAndMisses(t *testing.T) {
+	h := NewHandler()
+	tests := []struct {
+		path, wantType string
+		wantStatus     int
+	}{
+		{"/golang_learning_roadmap.csv", "text/csv; charset=utf-8", 200},
+		{"/go_syntax_comparison.csv", "text/csv; charset=utf-8", 200},
+		{"/go_learning_roadmap.png", "image/png", 200},
+		{"/style.css", "text/css", 200},
+		{"/missing.js", "", 404},
+		{"/../go.mod", "", 404},
+	}
+	for _, tt := range tests {
+		rec := get(t, h, tt.path)
+		if rec.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d; want %d", tt.path, rec.Code, tt.wantStatus)
+			continue
+		}
+		if tt.wantType != "" && !strings.HasPrefix(rec.Header().Get("Content-Type"), tt.wantType) {
+			t.Errorf("%s: Content-Type = %q; want %q", tt.path, rec.Header().Get("Content-Type"), tt.wantType)
+		}
+	}
+}
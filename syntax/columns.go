@@ -0,0 +1,139 @@
+package syntax
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// Side-by-side rendering for terminals. Widths are counted in runes,
+// which is right for the ASCII code in the comparison.
+
+const (
+	columnGap      = " │ "
+	minColumnWidth = 12
+	tabWidth       = 4
+	wrapMarker     = "↪ " // starts a continued line
+)
+
+// SideBySide writes one concept as a table with a column per language,
+// wrapping lines longer than their column. width is the terminal width.
+func SideBySide(w io.Writer, e Entry, languages []string, width int) error {
+	if len(languages) == 0 {
+		return nil
+	}
+	colWidth := (width - utf8.RuneCountInString(columnGap)*(len(languages)-1)) / len(languages)
+	if colWidth < minColumnWidth {
+		colWidth = minColumnWidth
+	}
+
+	columns := make([][]string, len(languages))
+	rows := 0
+	for i, lang := range languages {
+		columns[i] = wrapCode(e.Snippets[lang], colWidth)
+		if len(columns[i]) > rows {
+			rows = len(columns[i])
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(e.Concept + "\n")
+	rules := make([]string, len(languages))
+	for i := range languages {
+		rules[i] = strings.Repeat("─", colWidth)
+	}
+	writeRow(&b, languages, colWidth)
+	b.WriteString(strings.Join(rules, "─┼─") + "\n")
+	for r := 0; r < rows; r++ {
+		cells := make([]string, len(columns))
+		for i, lines := range columns {
+			if r < len(lines) {
+				cells[i] = lines[r]
+			}
+		}
+		writeRow(&b, cells, colWidth)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeRow pads the cells to the column width; trailing blanks are cut
+func writeRow(b *strings.Builder, cells []string, colWidth int) {
+	var row strings.Builder
+	for i, cell := range cells {
+		if i > 0 {
+			row.WriteString(columnGap)
+		}
+		row.WriteString(cell)
+		row.WriteString(strings.Repeat(" ", colWidth-utf8.RuneCountInString(cell)))
+	}
+	b.WriteString(strings.TrimRight(row.String(), " "))
+	b.WriteString("\n")
+}
+
+// wrapCode splits code into lines of at most width runes. Long lines
+// break after the last space that fits, or mid-word if there is none;
+// continued lines keep the original indentation behind a marker.
+func wrapCode(code string, width int) []string {
+	var out []string
+	for _, line := range strings.Split(code, "\n") {
+		line = strings.TrimRight(strings.ReplaceAll(line, "\t", strings.Repeat(" ", tabWidth)), " ")
+		indent := line[:len(line)-len(strings.TrimLeft(line, " "))]
+		prefix := ""
+		for {
+			runes := []rune(prefix + line)
+			if len(runes) <= width {
+				out = append(out, string(runes))
+				break
+			}
+			cut := width
+			for i := width - 1; i > utf8.RuneCountInString(prefix+indent); i-- {
+				if runes[i] == ' ' {
+					cut = i + 1
+					break
+				}
+			}
+			out = append(out, strings.TrimRight(string(runes[:cut]), " "))
+			line = string(runes[cut:])
+			prefix = indent + wrapMarker
+			if utf8.RuneCountInString(prefix) >= width {
+				prefix = wrapMarker // deep indentation in a narrow column
+			}
+		}
+	}
+	return out
+}
+
+// Compare is the CLI form of a lookup: the best match for concept, side
+// by side, or the closest concepts if nothing matches well
+func (t *Table) Compare(w io.Writer, concept string, languages []string, width int) error {
+	matches := t.Search(concept)
+	if len(matches) == 0 {
+		return fmt.Errorf("no concept like %q; try one of: %s", concept, strings.Join(t.Concepts(), ", "))
+	}
+	if len(languages) == 0 {
+		languages = t.Languages
+	}
+	if err := SideBySide(w, matches[0].Entry, languages, width); err != nil {
+		return err
+	}
+	if len(matches) > 1 && matches[1].Score > matches[0].Score-0.1 {
+		others := make([]string, 0, len(matches)-1)
+		for _, m := range matches[1:] {
+			others = append(others, m.Concept)
+		}
+		_, err := fmt.Fprintf(w, "\nAlso similar: %s\n", strings.Join(others, ", "))
+		return err
+	}
+	return nil
+}
+
+// Concepts lists the concept names in table order
+func (t *Table) Concepts() []string {
+	names := make([]string, len(t.Entries))
+	for i, e := range t.Entries {
+		names[i] = e.Concept
+	}
+	return names
+}
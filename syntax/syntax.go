@@ -0,0 +1,253 @@
+// Package syntax looks up the Go, Python and Java snippets in
+// site/go_syntax_comparison.csv. The first column is the concept and
+// every other column is a language, named by the header row, so adding
+// a language is a matter of adding a column. Snippets span several lines
+// and contain quotes; encoding/csv reads them as quoted fields.
+package syntax
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"go-learning-guide/site"
+)
+
+// Entry is one concept with its snippet in each language
+type Entry struct {
+	Concept string `json:"concept"`
+	// Snippets maps a language, as named in the header, to its code
+	Snippets map[string]string `json:"snippets"`
+}
+
+// Table is the whole comparison
+type Table struct {
+	Languages []string // in column order
+	Entries   []Entry  // in row order
+}
+
+// Parse reads a comparison CSV: a header of Concept and language names,
+// then one row per concept
+func Parse(r io.Reader) (*Table, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+	if len(header) < 2 || !strings.EqualFold(strings.TrimSpace(strings.TrimPrefix(header[0], "\ufeff")), "Concept") {
+		return nil, errors.New("header must be Concept followed by one column per language")
+	}
+
+	t := &Table{}
+	for _, lang := range header[1:] {
+		lang = strings.TrimSpace(lang)
+		if lang == "" {
+			return nil, errors.New("header has an empty language name")
+		}
+		if _, dup := t.Language(lang); dup {
+			return nil, fmt.Errorf("language %q appears twice in the header", lang)
+		}
+		t.Languages = append(t.Languages, lang)
+	}
+
+	seen := make(map[string]int)
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err // a *csv.ParseError with the line number
+		}
+		line, _ := cr.FieldPos(0)
+
+		concept := strings.TrimSpace(record[0])
+		if concept == "" {
+			return nil, fmt.Errorf("line %d: concept is empty", line)
+		}
+		if prev, dup := seen[strings.ToLower(concept)]; dup {
+			return nil, fmt.Errorf("line %d: concept %q is already on line %d", line, concept, prev)
+		}
+		seen[strings.ToLower(concept)] = line
+
+		entry := Entry{Concept: concept, Snippets: make(map[string]string, len(t.Languages))}
+		for i, lang := range t.Languages {
+			entry.Snippets[lang] = strings.TrimRight(strings.ReplaceAll(record[i+1], "\r\n", "\n"), " \n")
+		}
+		t.Entries = append(t.Entries, entry)
+	}
+	return t, nil
+}
+
+var (
+	defaultOnce  sync.Once
+	defaultTable *Table
+	defaultErr   error
+)
+
+// Default returns the comparison embedded with the site. It is parsed
+// once; callers must not modify it.
+func Default() (*Table, error) {
+	defaultOnce.Do(func() {
+		data, err := site.ReadFile("go_syntax_comparison.csv")
+		if err != nil {
+			defaultErr = err
+			return
+		}
+		defaultTable, defaultErr = Parse(strings.NewReader(string(data)))
+	})
+	return defaultTable, defaultErr
+}
+
+// languageAliases are other names people type for a language
+var languageAliases = map[string]string{
+	"golang":  "go",
+	"py":      "python",
+	"python3": "python",
+}
+
+// Language resolves a language name as typed by a user ("python", "py",
+// "Golang") to its name in the table
+func (t *Table) Language(name string) (string, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if alias, ok := languageAliases[name]; ok {
+		name = alias
+	}
+	for _, lang := range t.Languages {
+		if strings.ToLower(lang) == name {
+			return lang, true
+		}
+	}
+	return "", false
+}
+
+// Lookup finds a concept by its exact name, ignoring case
+func (t *Table) Lookup(concept string) (Entry, bool) {
+	for _, e := range t.Entries {
+		if strings.EqualFold(e.Concept, strings.TrimSpace(concept)) {
+			return e, true
+		}
+	}
+	return Entry{}, false
+}
+
+// Match is a search result; Score is 1 for an exact match and lower the
+// further the concept is from the query
+type Match struct {
+	Entry
+	Score float64 `json:"score"`
+}
+
+// minScore is the weakest match Search returns
+const minScore = 0.6
+
+// Search finds the concepts that resemble query, best first. It forgives
+// case, punctuation, word order, prefixes ("func") and typos ("fucntion").
+func (t *Table) Search(query string) []Match {
+	queryWords := words(query)
+	if len(queryWords) == 0 {
+		return nil
+	}
+
+	var matches []Match
+	for _, e := range t.Entries {
+		score := similarity(queryWords, words(e.Concept))
+		if strings.EqualFold(strings.TrimSpace(query), e.Concept) {
+			score = 1
+		}
+		if score >= minScore {
+			matches = append(matches, Match{Entry: e, Score: score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	return matches
+}
+
+// words lowercases text and splits it at anything but letters and digits
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// similarity rates how well the query words are covered by the concept
+// words: each query word counts its best match, and words of the concept
+// that nobody asked for cost a little
+func similarity(query, concept []string) float64 {
+	if len(concept) == 0 {
+		return 0
+	}
+	total := 0.0
+	for _, q := range query {
+		best := 0.0
+		for _, c := range concept {
+			if s := wordSimilarity(q, c); s > best {
+				best = s
+			}
+		}
+		total += best
+	}
+	score := total / float64(len(query))
+	if extra := len(concept) - len(query); extra > 0 {
+		score *= 1 - 0.05*float64(extra)
+	}
+	return score
+}
+
+// wordSimilarity is 1 for equal words, 0.9 for a prefix of at least three
+// letters, and otherwise based on the edit distance
+func wordSimilarity(q, c string) float64 {
+	switch {
+	case q == c:
+		return 1
+	case len(q) >= 3 && strings.HasPrefix(c, q):
+		return 0.9
+	}
+	qr, cr := []rune(q), []rune(c)
+	longest := len(qr)
+	if len(cr) > longest {
+		longest = len(cr)
+	}
+	return 1 - float64(editDistance(qr, cr))/float64(longest)
+}
+
+// editDistance is the Damerau-Levenshtein distance (optimal string
+// alignment), so a swapped pair of letters counts as one edit
+func editDistance(a, b []rune) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min3(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] && d[i-2][j-2]+1 < d[i][j] {
+				d[i][j] = d[i-2][j-2] + 1
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,90 @@
+package syntax
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestDefaultTable(t *testing.T) {
+	table, err := Default()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(table.Languages, ",") != "Go,Python,Java" || len(table.Entries) != 8 {
+		t.Fatalf("languages %v, %d entries", table.Languages, len(table.Entries))
+	}
+
+	// Multi-line quoted fields with doubled quotes
+	e, ok := table.Lookup("variable declaration")
+	if !ok {
+		t.Fatal("Variable Declaration not found")
+	}
+	if want := "var name string = \"Go\"\nname := \"Go\" // short form"; e.Snippets["Go"] != want {
+		t.Errorf("Go snippet = %q; want %q", e.Snippets["Go"], want)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	table, _ := Default()
+	tests := []struct{ query, want string }{
+		{"Error Handling", "Error Handling"},
+		{"errors", "Error Handling"},
+		{"fucntion", "Function Definition"},
+		{"struct", "Class/Struct"},
+		{"for loop", "Loop (for)"},
+		{"declaration of arrays", "Array Declaration"},
+	}
+	for _, tt := range tests {
+		matches := table.Search(tt.query)
+		if len(matches) == 0 || matches[0].Concept != tt.want {
+			t.Errorf("Search(%q) = %v; want %q first", tt.query, concepts(matches), tt.want)
+		}
+	}
+	if matches := table.Search("kubernetes"); len(matches) != 0 {
+		t.Errorf("Search(kubernetes) = %v; want nothing", concepts(matches))
+	}
+}
+
+func concepts(matches []Match) []string {
+	var names []string
+	for _, m := range matches {
+		names = append(names, m.Concept)
+	}
+	return names
+}
+
+func TestLanguage(t *testing.T) {
+	table, _ := Default()
+	for name, want := range map[string]string{"python": "Python", "py": "Python", "Golang": "Go", "JAVA": "Java"} {
+		if got, ok := table.Language(name); !ok || got != want {
+			t.Errorf("Language(%q) = %q, %v; want %q", name, got, ok, want)
+		}
+	}
+	if _, ok := table.Language("rust"); ok {
+		t.Error("Language(rust) found")
+	}
+}
+
+func TestSideBySideWraps(t *testing.T) {
+	e := Entry{Concept: "Demo", Snippets: map[string]string{
+		"Go":     "if err != nil {\n\treturn fmt.Errorf(\"reading config file: %w\", err)\n}",
+		"Python": "raise ConfigError('reading config file')",
+	}}
+	var b strings.Builder
+	if err := SideBySide(&b, e, []string{"Go", "Python"}, 50); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\n"), "\n") {
+		if n := utf8.RuneCountInString(line); n > 50 {
+			t.Errorf("line is %d wide: %q", n, line)
+		}
+	}
+	if !strings.Contains(out, "    "+wrapMarker) {
+		t.Errorf("wrapped line lost its indentation:\n%s", out)
+	}
+	if !strings.Contains(out, "Go"+strings.Repeat(" ", 21)+" │ Python\n") {
+		t.Errorf("header row missing:\n%s", out)
+	}
+}